@@ -28,10 +28,11 @@ type GetProductsInput struct {
 	StartDate    time.Time `json:"start_date"`
 	EndDate      time.Time `json:"end_date"`
 	MinBudget    float64   `json:"min_budget,omitempty"`
-	BudgetType   string    `json:"budget_type,omitempty"`   // CPM, CPC, Flat
+	BudgetType   string    `json:"budget_type,omitempty"`   // CPM, CPC, Flat, vCPM, CPA
 	Priority     int       `json:"priority,omitempty"`      // 1-10 priority level
 	CPM          float64   `json:"cpm,omitempty"`           // Cost per mille
 	CPC          float64   `json:"cpc,omitempty"`           // Cost per click
+	CPA          float64   `json:"cpa,omitempty"`           // Cost per acquisition
 	PlacementIDs []string  `json:"placement_ids,omitempty"` // Specific placements to forecast
 }
 
@@ -58,8 +59,9 @@ type CreateMediaBuyInput struct {
 	Budget      float64 `json:"budget"`
 	BudgetType  string  `json:"budget_type"`
 	PlacementID string  `json:"placement_id"`
-	CPM         float64 `json:"cpm,omitempty"` // Cost per mille for CPM campaigns
+	CPM         float64 `json:"cpm,omitempty"` // Cost per mille for CPM and vCPM campaigns
 	CPC         float64 `json:"cpc,omitempty"` // Cost per click for CPC campaigns
+	CPA         float64 `json:"cpa,omitempty"` // Cost per acquisition for CPA campaigns
 }
 
 type CreateMediaBuyOutput struct {
@@ -81,14 +83,14 @@ func validateBudgetType(budgetType string) error {
 	if budgetType == "" {
 		return nil // Budget type is optional
 	}
-	validTypes := []string{"cpm", "cpc", "flat"}
+	validTypes := []string{"cpm", "cpc", "flat", "vcpm", "cpa"}
 	budgetTypeLower := strings.ToLower(budgetType)
 	for _, validType := range validTypes {
 		if budgetTypeLower == validType {
 			return nil
 		}
 	}
-	return fmt.Errorf("invalid budget_type: must be one of 'cpm', 'cpc', or 'flat'")
+	return fmt.Errorf("invalid budget_type: must be one of 'cpm', 'cpc', 'flat', 'vcpm', or 'cpa'")
 }
 
 // GetProducts implements the AdCP get_products task
@@ -182,6 +184,10 @@ func (s *AdCPServer) GetProducts(ctx context.Context, req *mcp.CallToolRequest,
 			if cpc == 0 {
 				cpc = 1.0 // Default $1 CPC
 			}
+			cpa := input.CPA
+			if cpa == 0 {
+				cpa = 20.0 // Default $20 CPA
+			}
 
 			// Always forecast for this specific placement only
 			placementIDs := []string{placement.ID}
@@ -196,6 +202,7 @@ func (s *AdCPServer) GetProducts(ctx context.Context, req *mcp.CallToolRequest,
 				Priority:     priority,
 				CPM:          cpm,
 				CPC:          cpc,
+				CPA:          cpa,
 			}
 
 			s.logger.Info("Requesting forecast",
@@ -306,11 +313,11 @@ func (s *AdCPServer) CreateMediaBuy(ctx context.Context, req *mcp.CallToolReques
 	budgetType := strings.ToLower(input.BudgetType)
 
 	// Validate that CPM/CPC is provided based on budget type
-	if budgetType == "cpm" && input.CPM <= 0 {
+	if (budgetType == "cpm" || budgetType == "vcpm") && input.CPM <= 0 {
 		return &mcp.CallToolResult{
 			IsError: true,
 			Content: []mcp.Content{&mcp.TextContent{
-				Text: "Invalid cpm: CPM rate must be provided and greater than 0 for CPM campaigns",
+				Text: "Invalid cpm: CPM rate must be provided and greater than 0 for CPM and vCPM campaigns",
 			}},
 		}, CreateMediaBuyOutput{}, nil
 	}
@@ -322,6 +329,14 @@ func (s *AdCPServer) CreateMediaBuy(ctx context.Context, req *mcp.CallToolReques
 			}},
 		}, CreateMediaBuyOutput{}, nil
 	}
+	if budgetType == "cpa" && input.CPA <= 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{
+				Text: "Invalid cpa: CPA rate must be provided and greater than 0 for CPA campaigns",
+			}},
+		}, CreateMediaBuyOutput{}, nil
+	}
 	// Validate placement exists for this publisher
 	allPlacements := s.adDataStore.GetAllPlacements()
 	var placement *models.Placement
@@ -382,6 +397,11 @@ func (s *AdCPServer) CreateMediaBuy(ctx context.Context, req *mcp.CallToolReques
 	case "cpc":
 		lineItem.CPC = input.CPC
 		lineItem.ECPM = 0 // For CPC campaigns, ECPM will be calculated by UpdateCTR() based on actual performance
+	case "vcpm":
+		lineItem.CPM = input.CPM // vCPM campaigns are ranked by CPM times the placement viewability rate
+	case "cpa":
+		lineItem.CPA = input.CPA
+		lineItem.ECPM = 0 // For CPA campaigns, ECPM will be calculated by UpdateCTR() from the conversion rate
 	}
 
 	if err := s.pg.InsertLineItem(lineItem); err != nil {
@@ -560,7 +580,7 @@ func main() {
 				},
 				"budget_type": map[string]interface{}{
 					"type":        "string",
-					"enum":        []string{"cpm", "cpc", "flat"},
+					"enum":        []string{"cpm", "cpc", "flat", "vcpm", "cpa"},
 					"description": "Budget type (optional, defaults to cpm)",
 				},
 				"min_budget": map[string]interface{}{
@@ -581,6 +601,10 @@ func main() {
 					"type":        "number",
 					"description": "Cost per click for CPC campaigns (optional, defaults to $1.00)",
 				},
+				"cpa": map[string]interface{}{
+					"type":        "number",
+					"description": "Cost per acquisition for CPA campaigns (optional, defaults to $20.00)",
+				},
 				"placement_ids": map[string]interface{}{
 					"type":        "array",
 					"items":       map[string]interface{}{"type": "string"},
@@ -611,7 +635,7 @@ func main() {
 				},
 				"budget_type": map[string]interface{}{
 					"type":        "string",
-					"enum":        []string{"cpm", "cpc", "flat"},
+					"enum":        []string{"cpm", "cpc", "flat", "vcpm", "cpa"},
 					"description": "Budget type",
 				},
 				"placement_id": map[string]interface{}{
@@ -620,12 +644,16 @@ func main() {
 				},
 				"cpm": map[string]interface{}{
 					"type":        "number",
-					"description": "Cost per mille (CPM) rate - required for CPM campaigns",
+					"description": "Cost per mille (CPM) rate - required for CPM and vCPM campaigns",
 				},
 				"cpc": map[string]interface{}{
 					"type":        "number",
 					"description": "Cost per click (CPC) rate - required for CPC campaigns",
 				},
+				"cpa": map[string]interface{}{
+					"type":        "number",
+					"description": "Cost per acquisition (CPA) rate - required for CPA campaigns",
+				},
 			},
 			"required": []string{"name", "publisher_id", "budget", "budget_type", "placement_id"},
 		},
@@ -117,6 +117,10 @@ func run(logger *zap.Logger, cfg config.Config) error {
 	}
 	defer analyticsSvc.Close()
 
+	if err := analyticsSvc.ApplyRetention(cfg.RetentionEventsDays); err != nil {
+		return fmt.Errorf("failed to apply events retention: %w", err)
+	}
+
 	// Connect analytics to the data store for spend updates
 	analyticsSvc.SetAdDataStore(adDataStore)
 
@@ -169,6 +173,9 @@ func run(logger *zap.Logger, cfg config.Config) error {
 	r.HandleFunc("/impression", srvDeps.ImpressionHandler).Methods("GET")
 	r.HandleFunc("/click", srvDeps.ClickHandler).Methods("GET")
 	r.HandleFunc("/event", srvDeps.EventHandler).Methods("GET")
+	r.HandleFunc("/viewable", srvDeps.ViewableHandler).Methods("GET")
+	r.HandleFunc("/conversion", srvDeps.ConversionHandler).Methods("GET")
+	r.HandleFunc("/postback", srvDeps.PostbackHandler).Methods("GET", "POST")
 	r.HandleFunc("/report", srvDeps.ReportHandler).Methods("POST")
 	r.HandleFunc("/health", srvDeps.HealthHandler).Methods("GET")
 	r.HandleFunc("/reload", srvDeps.ReloadHandler).Methods("POST")
@@ -202,6 +209,23 @@ func run(logger *zap.Logger, cfg config.Config) error {
 	crud.HandleFunc("/creatives", srvDeps.CreateCreative).Methods("POST")
 	crud.HandleFunc("/creatives/{id}", srvDeps.UpdateCreative).Methods("PUT")
 	crud.HandleFunc("/creatives/{id}", srvDeps.DeleteCreative).Methods("DELETE")
+	crud.HandleFunc("/creatives/{id}/preview", srvDeps.PreviewCreative).Methods("GET")
+	crud.HandleFunc("/creatives/{id}/preview/click", srvDeps.PreviewClick).Methods("GET")
+	crud.HandleFunc("/preview/pixel", srvDeps.PreviewPixel).Methods("GET")
+
+	crud.HandleFunc("/assets", srvDeps.UploadAsset).Methods("POST")
+
+	crud.HandleFunc("/templates", srvDeps.ListTemplates).Methods("GET")
+	crud.HandleFunc("/templates", srvDeps.CreateTemplate).Methods("POST")
+	crud.HandleFunc("/templates/{id}", srvDeps.UpdateTemplate).Methods("PUT")
+	crud.HandleFunc("/templates/{id}", srvDeps.DeleteTemplate).Methods("DELETE")
+
+	crud.HandleFunc("/privacy/users/{id}", srvDeps.ExportUserData).Methods("GET")
+	crud.HandleFunc("/privacy/users/{id}", srvDeps.DeleteUserData).Methods("DELETE")
+	crud.HandleFunc("/privacy/jobs/{id}", srvDeps.GetPrivacyJob).Methods("GET")
+
+	// Uploaded creative assets
+	r.HandleFunc("/assets/{key}", srvDeps.ServeAsset).Methods("GET", "HEAD")
 
 	// Static file server for serving static assets like HTML, CSS, JS
 	// Serve minified SDK in production, original in development
@@ -272,6 +296,44 @@ func run(logger *zap.Logger, cfg config.Config) error {
 		}()
 	}
 
+	retention := db.RetentionPolicy{
+		AdReports:   time.Duration(cfg.RetentionAdReportsDays) * 24 * time.Hour,
+		PrivacyJobs: time.Duration(cfg.RetentionPrivacyJobsDays) * 24 * time.Hour,
+		// Exports hold a full copy of a user's data, so they expire first
+		PrivacyExports: cfg.PrivacyExportTTL,
+	}
+	if (retention.AdReports > 0 || retention.PrivacyJobs > 0 || retention.PrivacyExports > 0) && cfg.RetentionPurgeInterval > 0 {
+		logger.Info("retention purge enabled",
+			zap.Duration("interval", cfg.RetentionPurgeInterval),
+			zap.Int("ad_reports_days", cfg.RetentionAdReportsDays),
+			zap.Int("privacy_jobs_days", cfg.RetentionPrivacyJobsDays),
+			zap.Duration("privacy_export_ttl", cfg.PrivacyExportTTL))
+		purge := func() {
+			purged, err := pg.PurgeExpired(retention, time.Now())
+			if err != nil {
+				logger.Error("retention purge", zap.Error(err))
+			}
+			for table, n := range purged {
+				if n > 0 {
+					logger.Info("retention purge", zap.String("table", table), zap.Int64("rows", n))
+				}
+			}
+		}
+		purgeTicker := time.NewTicker(cfg.RetentionPurgeInterval)
+		go func() {
+			purge()
+			for {
+				select {
+				case <-purgeTicker.C:
+					purge()
+				case <-ctx.Done():
+					purgeTicker.Stop()
+					return
+				}
+			}
+		}()
+	}
+
 	// Log sampling statistics every 5 minutes
 	samplingTicker := time.NewTicker(5 * time.Minute)
 	go func() {
@@ -300,6 +362,8 @@ func run(logger *zap.Logger, cfg config.Config) error {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		return fmt.Errorf("server shutdown failed: %w", err)
 	}
+	// Fire the third-party trackers still queued
+	srvDeps.Trackers.Close()
 
 	return nil
 }
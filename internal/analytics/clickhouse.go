@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -24,9 +25,23 @@ type AnalyticsService interface {
 	// RecordEvent records a custom analytics event with targeting context.
 	RecordEvent(ctx context.Context, store models.AdDataStore, eventType, requestID, impID, creativeID string, lineItemID int, cost float64, targetingCtx models.TargetingContext, publisherID int, placementID string) error
 	// RecordImpression is a convenience wrapper for impression events.
-	RecordImpression(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, deviceType, country string, publisherID int, placementID string) error
+	RecordImpression(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error
+	// RecordViewableImpression is a convenience wrapper for viewable
+	// impression events and vCPM spend.
+	RecordViewableImpression(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error
 	// RecordClick is a convenience wrapper for click events and CPC spend.
-	RecordClick(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, deviceType, country string, publisherID int, placementID string) error
+	RecordClick(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error
+	// RecordConversion records an attributed conversion with its value and
+	// charges CPA line items.
+	RecordConversion(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, value float64, attribution string, targetingCtx models.TargetingContext, publisherID int, placementID string) error
+	// RecordBillableEvent records a billable custom event and charges its
+	// cost to the line item.
+	RecordBillableEvent(ctx context.Context, store models.AdDataStore, eventType, requestID, impID, creativeID string, lineItemID int, cost float64, targetingCtx models.TargetingContext, publisherID int, placementID string) error
+	// GetEventsByUserID returns every event recorded with the given user ID.
+	GetEventsByUserID(ctx context.Context, userID string) ([]EventRecord, error)
+	// DeleteEventsByUserID removes every event recorded with the given user ID
+	// and returns how many events matched.
+	DeleteEventsByUserID(ctx context.Context, userID string) (int64, error)
 }
 
 // Analytics wraps a ClickHouse DB connection.
@@ -52,6 +67,31 @@ type EventRecord struct {
 	PublisherID *int32            `json:"publisher_id"`
 	PlacementID *string           `json:"placement_id"`
 	KeyValues   map[string]string `json:"key_values,omitempty"`
+	UserID      *string           `json:"user_id"`
+	Consent     string            `json:"consent_status"`
+	Domain      string            `json:"domain"`
+	AppBundle   string            `json:"app_bundle"`
+	PagePath    string            `json:"page_path"`
+	Categories  []string          `json:"categories"`
+	Invalid     bool              `json:"invalid"`
+	IVTReason   string            `json:"ivt_reason"`
+	Value       float64           `json:"value"`
+	Attribution string            `json:"attribution"`
+}
+
+// eventMigrations adds columns introduced after the original events schema so
+// existing deployments pick them up on startup.
+var eventMigrations = []string{
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS user_id Nullable(String)`,
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS consent_status String DEFAULT ''`,
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS domain String DEFAULT ''`,
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS app_bundle String DEFAULT ''`,
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS invalid UInt8 DEFAULT 0`,
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS ivt_reason String DEFAULT ''`,
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS value Float64 DEFAULT 0`,
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS attribution String DEFAULT ''`,
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS page_path String DEFAULT ''`,
+	`ALTER TABLE events ADD COLUMN IF NOT EXISTS categories Array(String)`,
 }
 
 // InitClickHouse connects to ClickHouse and ensures the events table exists.
@@ -78,11 +118,26 @@ func InitClickHouse(dsn string, pg *db.Postgres, metrics observability.MetricsRe
        country      Nullable(String),
        publisher_id Nullable(Int32),
        placement_id Nullable(String),
-       key_values   Map(String, String)
+       key_values   Map(String, String),
+       user_id      Nullable(String),
+       consent_status String DEFAULT '',
+       domain       String DEFAULT '',
+       app_bundle   String DEFAULT '',
+       invalid      UInt8 DEFAULT 0,
+       ivt_reason   String DEFAULT '',
+       value        Float64 DEFAULT 0,
+       attribution  String DEFAULT '',
+       page_path    String DEFAULT '',
+       categories   Array(String)
    ) ENGINE=MergeTree() ORDER BY (event_type, timestamp)`
 	if _, err := db.ExecContext(context.Background(), create); err != nil {
 		return nil, fmt.Errorf("clickhouse create table: %w", err)
 	}
+	for _, stmt := range eventMigrations {
+		if _, err := db.ExecContext(context.Background(), stmt); err != nil {
+			return nil, fmt.Errorf("clickhouse migrate events: %w", err)
+		}
+	}
 
 	zap.L().Info("Connected to ClickHouse")
 	return &Analytics{DB: db, PG: pg, Metrics: metrics}, nil
@@ -100,6 +155,12 @@ func (a *Analytics) SetAdDataStore(store models.AdDataStore) {
 var ErrUnavailable = fmt.Errorf("analytics unavailable")
 
 func (a *Analytics) RecordEvent(ctx context.Context, store models.AdDataStore, eventType, requestID, impID, creativeID string, lineItemID int, cost float64, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	return a.insertEvent(ctx, store, eventType, requestID, impID, creativeID, lineItemID, cost, 0, "", targetingCtx, publisherID, placementID)
+}
+
+// insertEvent writes an event row, including the conversion value and
+// attribution type that only conversion events carry.
+func (a *Analytics) insertEvent(ctx context.Context, store models.AdDataStore, eventType, requestID, impID, creativeID string, lineItemID int, cost, value float64, attribution string, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
 	if a == nil || a.DB == nil {
 		return ErrUnavailable
 	}
@@ -145,6 +206,20 @@ func (a *Analytics) RecordEvent(ctx context.Context, store models.AdDataStore, e
 	}
 
 	keyValues := targetingCtx.KeyValues
+	if keyValues == nil {
+		keyValues = make(map[string]string)
+	}
+	categories := targetingCtx.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+
+	// The user ID is only present when the consent decision allowed it.
+	var uid sql.NullString
+	if targetingCtx.UserID != "" {
+		uid.String = targetingCtx.UserID
+		uid.Valid = true
+	}
 
 	// Handle placement_id
 	var pid sql.NullString
@@ -153,8 +228,13 @@ func (a *Analytics) RecordEvent(ctx context.Context, store models.AdDataStore, e
 		pid.Valid = true
 	}
 
-	stmt := `INSERT INTO events (timestamp, event_type, request_id, imp_id, creative_id, campaign_id, line_item_id, cost, device_type, country, publisher_id, placement_id, key_values) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	if _, err := a.DB.ExecContext(ctx, stmt, time.Now(), eventType, requestID, impID, cr, cmp, li, cost, dt, co, pub, pid, keyValues); err != nil {
+	var invalid uint8
+	if targetingCtx.IVTReason != "" {
+		invalid = 1
+	}
+
+	stmt := `INSERT INTO events (timestamp, event_type, request_id, imp_id, creative_id, campaign_id, line_item_id, cost, device_type, country, publisher_id, placement_id, key_values, user_id, consent_status, domain, app_bundle, page_path, categories, invalid, ivt_reason, value, attribution) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := a.DB.ExecContext(ctx, stmt, time.Now(), eventType, requestID, impID, cr, cmp, li, cost, dt, co, pub, pid, keyValues, uid, targetingCtx.Privacy.Status, targetingCtx.Domain, targetingCtx.AppBundle, targetingCtx.PagePath, categories, invalid, targetingCtx.IVTReason, value, attribution); err != nil {
 		zap.L().Error("clickhouse insert failed", zap.Error(err), zap.String("event_type", eventType))
 		return fmt.Errorf("insert %s event: %w", eventType, err)
 	}
@@ -162,12 +242,17 @@ func (a *Analytics) RecordEvent(ctx context.Context, store models.AdDataStore, e
 }
 
 // RecordImpression is a convenience wrapper for RecordEvent.
-func (a *Analytics) RecordImpression(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, deviceType, country string, publisherID int, placementID string) error {
+func (a *Analytics) RecordImpression(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
 	// Look up the line item once so we can calculate cost and update spend.
 	var li *models.LineItem
 	if lineItemID > 0 {
 		li = models.GetLineItemByID(store, lineItemID)
 	}
+	// Invalid traffic is recorded without cost and does not spend budget.
+	// vCPM line items are charged by RecordViewableImpression instead.
+	if targetingCtx.IVTReason != "" || (li != nil && li.BudgetType == models.BudgetTypeVCPM) {
+		li = nil
+	}
 
 	// Calculate how much this impression costs based on budget type.
 	var cost float64
@@ -184,13 +269,6 @@ func (a *Analytics) RecordImpression(ctx context.Context, store models.AdDataSto
 		}
 	}
 
-	// Create targeting context for impression
-	targetingCtx := models.TargetingContext{
-		DeviceType: deviceType,
-		Country:    country,
-		KeyValues:  make(map[string]string), // Impressions don't have key-values by default
-	}
-
 	// Persist the impression event along with its cost.
 	if err := a.RecordEvent(ctx, store, "impression", requestID, impID, creativeID, lineItemID, cost, targetingCtx, publisherID, placementID); err != nil {
 		// still update spend tracking but surface the error
@@ -229,24 +307,21 @@ func (a *Analytics) RecordImpression(ctx context.Context, store models.AdDataSto
 }
 
 // RecordClick is a convenience wrapper for click events and CPC spend.
-func (a *Analytics) RecordClick(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, deviceType, country string, publisherID int, placementID string) error {
+func (a *Analytics) RecordClick(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
 	var li *models.LineItem
 	if lineItemID > 0 {
 		li = models.GetLineItemByID(store, lineItemID)
 	}
+	// Invalid traffic is recorded without cost and does not spend budget.
+	if targetingCtx.IVTReason != "" {
+		li = nil
+	}
 
 	var cost float64
 	if li != nil && li.BudgetType == models.BudgetTypeCPC {
 		cost = li.CPC
 	}
 
-	// Create targeting context for click
-	targetingCtx := models.TargetingContext{
-		DeviceType: deviceType,
-		Country:    country,
-		KeyValues:  make(map[string]string), // Clicks don't have key-values by default
-	}
-
 	if err := a.RecordEvent(ctx, store, "click", requestID, impID, creativeID, lineItemID, cost, targetingCtx, publisherID, placementID); err != nil {
 		if li != nil && li.BudgetType == models.BudgetTypeCPC {
 			li.Spend += li.CPC
@@ -267,6 +342,114 @@ func (a *Analytics) RecordClick(ctx context.Context, store models.AdDataStore, r
 	return nil
 }
 
+// RecordViewableImpression is a convenience wrapper for viewable_impression
+// events and vCPM spend.
+func (a *Analytics) RecordViewableImpression(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	var li *models.LineItem
+	if lineItemID > 0 {
+		li = models.GetLineItemByID(store, lineItemID)
+	}
+	// Invalid traffic is recorded without cost and does not spend budget.
+	if targetingCtx.IVTReason != "" {
+		li = nil
+	}
+
+	var cost float64
+	if li != nil && li.BudgetType == models.BudgetTypeVCPM {
+		cost = li.CPM / 1000
+	}
+
+	if err := a.RecordEvent(ctx, store, "viewable_impression", requestID, impID, creativeID, lineItemID, cost, targetingCtx, publisherID, placementID); err != nil {
+		if li != nil && li.BudgetType == models.BudgetTypeVCPM {
+			li.Spend += li.CPM / 1000
+			a.Metrics.SetSpendTotal(strconv.Itoa(li.CampaignID), li.Spend)
+			a.saveSpend(li)
+		}
+		if errors.Is(err, ErrUnavailable) {
+			return ErrUnavailable
+		}
+		return fmt.Errorf("record viewable impression: %w", err)
+	}
+
+	if li != nil && li.BudgetType == models.BudgetTypeVCPM {
+		li.Spend += li.CPM / 1000
+		a.Metrics.SetSpendTotal(strconv.Itoa(li.CampaignID), li.Spend)
+		a.saveSpend(li)
+	}
+	return nil
+}
+
+// RecordConversion records a conversion event with its value and attribution
+// type, and charges CPA line items their CPA bid.
+func (a *Analytics) RecordConversion(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, value float64, attribution string, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	var li *models.LineItem
+	if lineItemID > 0 {
+		li = models.GetLineItemByID(store, lineItemID)
+	}
+	// Invalid traffic is recorded without cost and does not spend budget.
+	if targetingCtx.IVTReason != "" {
+		li = nil
+	}
+
+	var cost float64
+	if li != nil && li.BudgetType == models.BudgetTypeCPA {
+		cost = li.CPA
+	}
+
+	if err := a.insertEvent(ctx, store, "conversion", requestID, impID, creativeID, lineItemID, cost, value, attribution, targetingCtx, publisherID, placementID); err != nil {
+		if li != nil && li.BudgetType == models.BudgetTypeCPA {
+			li.Spend += li.CPA
+			a.Metrics.SetSpendTotal(strconv.Itoa(li.CampaignID), li.Spend)
+			a.saveSpend(li)
+		}
+		if errors.Is(err, ErrUnavailable) {
+			return ErrUnavailable
+		}
+		return fmt.Errorf("record conversion: %w", err)
+	}
+
+	if li != nil && li.BudgetType == models.BudgetTypeCPA {
+		li.Spend += li.CPA
+		a.Metrics.SetSpendTotal(strconv.Itoa(li.CampaignID), li.Spend)
+		a.saveSpend(li)
+	}
+	return nil
+}
+
+// RecordBillableEvent records a custom event priced by the publisher's event
+// type definition and charges the cost to the line item regardless of its
+// budget type.
+func (a *Analytics) RecordBillableEvent(ctx context.Context, store models.AdDataStore, eventType, requestID, impID, creativeID string, lineItemID int, cost float64, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	var li *models.LineItem
+	if lineItemID > 0 {
+		li = models.GetLineItemByID(store, lineItemID)
+	}
+	// Invalid traffic is recorded without cost and does not spend budget.
+	if targetingCtx.IVTReason != "" {
+		li = nil
+		cost = 0
+	}
+
+	if err := a.RecordEvent(ctx, store, eventType, requestID, impID, creativeID, lineItemID, cost, targetingCtx, publisherID, placementID); err != nil {
+		if li != nil && cost > 0 {
+			li.Spend += cost
+			a.Metrics.SetSpendTotal(strconv.Itoa(li.CampaignID), li.Spend)
+			a.saveSpend(li)
+		}
+		if errors.Is(err, ErrUnavailable) {
+			return ErrUnavailable
+		}
+		return fmt.Errorf("record billable event: %w", err)
+	}
+
+	if li != nil && cost > 0 {
+		li.Spend += cost
+		a.Metrics.SetSpendTotal(strconv.Itoa(li.CampaignID), li.Spend)
+		a.saveSpend(li)
+	}
+	return nil
+}
+
 // saveSpend persists line item spend to the data store if configured.
 func (a *Analytics) saveSpend(li *models.LineItem) {
 	if a == nil || li == nil {
@@ -300,8 +483,70 @@ func (a *Analytics) GetEventsByRequestID(id string) ([]EventRecord, error) {
 	if a == nil || a.DB == nil {
 		return nil, ErrUnavailable
 	}
-	query := `SELECT timestamp, event_type, request_id, imp_id, creative_id, campaign_id, line_item_id, cost, device_type, country, publisher_id, placement_id FROM events WHERE request_id=? ORDER BY timestamp`
-	rows, err := a.DB.QueryContext(context.Background(), query, id)
+	return a.queryEvents(context.Background(), `request_id=?`, id)
+}
+
+// ApplyRetention sets the TTL on the events table so ClickHouse drops events
+// older than the given number of days during merges. A value of zero removes
+// any TTL set by an earlier configuration.
+func (a *Analytics) ApplyRetention(days int) error {
+	if a == nil || a.DB == nil {
+		return ErrUnavailable
+	}
+	ctx := context.Background()
+	if days > 0 {
+		stmt := fmt.Sprintf(`ALTER TABLE events MODIFY TTL timestamp + INTERVAL %d DAY`, days)
+		if _, err := a.DB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("set events ttl: %w", err)
+		}
+		return nil
+	}
+
+	var engine string
+	if err := a.DB.QueryRowContext(ctx, `SELECT engine_full FROM system.tables WHERE database = currentDatabase() AND name = 'events'`).Scan(&engine); err != nil {
+		return fmt.Errorf("read events ttl: %w", err)
+	}
+	if !strings.Contains(engine, " TTL ") {
+		return nil
+	}
+	if _, err := a.DB.ExecContext(ctx, `ALTER TABLE events REMOVE TTL`); err != nil {
+		return fmt.Errorf("remove events ttl: %w", err)
+	}
+	return nil
+}
+
+// GetEventsByUserID returns all events recorded with the given user ID.
+func (a *Analytics) GetEventsByUserID(ctx context.Context, userID string) ([]EventRecord, error) {
+	if a == nil || a.DB == nil {
+		return nil, ErrUnavailable
+	}
+	return a.queryEvents(ctx, `user_id=?`, userID)
+}
+
+// DeleteEventsByUserID removes all events recorded with the given user ID.
+// ClickHouse applies the delete as an asynchronous mutation, so the events may
+// remain visible for a short time after this returns.
+func (a *Analytics) DeleteEventsByUserID(ctx context.Context, userID string) (int64, error) {
+	if a == nil || a.DB == nil {
+		return 0, ErrUnavailable
+	}
+	var n uint64
+	if err := a.DB.QueryRowContext(ctx, `SELECT count() FROM events WHERE user_id=?`, userID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count user events: %w", err)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if _, err := a.DB.ExecContext(ctx, `ALTER TABLE events DELETE WHERE user_id=?`, userID); err != nil {
+		return 0, fmt.Errorf("delete user events: %w", err)
+	}
+	return int64(n), nil
+}
+
+// queryEvents selects events matching the given condition in timestamp order.
+func (a *Analytics) queryEvents(ctx context.Context, where string, arg interface{}) ([]EventRecord, error) {
+	query := `SELECT timestamp, event_type, request_id, imp_id, creative_id, campaign_id, line_item_id, cost, device_type, country, publisher_id, placement_id, user_id, consent_status, domain, app_bundle, page_path, categories, invalid, ivt_reason, value, attribution FROM events WHERE ` + where + ` ORDER BY timestamp`
+	rows, err := a.DB.QueryContext(ctx, query, arg)
 	if err != nil {
 		return nil, fmt.Errorf("query events: %w", err)
 	}
@@ -314,9 +559,11 @@ func (a *Analytics) GetEventsByRequestID(id string) ([]EventRecord, error) {
 	var events []EventRecord
 	for rows.Next() {
 		var ev EventRecord
-		if err := rows.Scan(&ev.Timestamp, &ev.EventType, &ev.RequestID, &ev.ImpID, &ev.CreativeID, &ev.CampaignID, &ev.LineItemID, &ev.Cost, &ev.DeviceType, &ev.Country, &ev.PublisherID, &ev.PlacementID); err != nil {
+		var invalid uint8
+		if err := rows.Scan(&ev.Timestamp, &ev.EventType, &ev.RequestID, &ev.ImpID, &ev.CreativeID, &ev.CampaignID, &ev.LineItemID, &ev.Cost, &ev.DeviceType, &ev.Country, &ev.PublisherID, &ev.PlacementID, &ev.UserID, &ev.Consent, &ev.Domain, &ev.AppBundle, &ev.PagePath, &ev.Categories, &invalid, &ev.IVTReason, &ev.Value, &ev.Attribution); err != nil {
 			return nil, fmt.Errorf("scan event: %w", err)
 		}
+		ev.Invalid = invalid == 1
 		events = append(events, ev)
 	}
 	if err := rows.Err(); err != nil {
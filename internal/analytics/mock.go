@@ -29,15 +29,40 @@ func (m *MockAnalytics) RecordEvent(ctx context.Context, dataStore models.AdData
 }
 
 // RecordImpression records an impression event (mock implementation)
-func (m *MockAnalytics) RecordImpression(ctx context.Context, dataStore models.AdDataStore, requestID, impID, creativeID string, lineItemID int, deviceType, country string, publisherID int, placementID string) error {
+func (m *MockAnalytics) RecordImpression(ctx context.Context, dataStore models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	return nil
+}
+
+// RecordViewableImpression records a viewable impression event (mock implementation)
+func (m *MockAnalytics) RecordViewableImpression(ctx context.Context, dataStore models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
 	return nil
 }
 
 // RecordClick records a click event (mock implementation)
-func (m *MockAnalytics) RecordClick(ctx context.Context, dataStore models.AdDataStore, requestID, impID, creativeID string, lineItemID int, deviceType, country string, publisherID int, placementID string) error {
+func (m *MockAnalytics) RecordClick(ctx context.Context, dataStore models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
 	return nil
 }
 
+// RecordConversion records a conversion event (mock implementation)
+func (m *MockAnalytics) RecordConversion(ctx context.Context, dataStore models.AdDataStore, requestID, impID, creativeID string, lineItemID int, value float64, attribution string, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	return nil
+}
+
+// RecordBillableEvent records a billable custom event (mock implementation)
+func (m *MockAnalytics) RecordBillableEvent(ctx context.Context, dataStore models.AdDataStore, eventType, requestID, impID, creativeID string, lineItemID int, cost float64, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	return nil
+}
+
+// GetEventsByUserID returns no events (mock implementation)
+func (m *MockAnalytics) GetEventsByUserID(ctx context.Context, userID string) ([]EventRecord, error) {
+	return nil, nil
+}
+
+// DeleteEventsByUserID deletes nothing (mock implementation)
+func (m *MockAnalytics) DeleteEventsByUserID(ctx context.Context, userID string) (int64, error) {
+	return 0, nil
+}
+
 // MockClickHouseDB is a mock implementation of ClickHouse database for testing
 type MockClickHouseDB struct{}
 
@@ -17,7 +17,7 @@ func TestRecordImpression_CPMSpend(t *testing.T) {
 
 	a := &Analytics{Metrics: observability.NewNoOpRegistry()}
 	// Add context.Background() to calls
-	if err := a.RecordImpression(context.Background(), testStore, "req1", "1", "1", 1, "mobile", "US", 1, "test-placement"); err != nil && err != ErrUnavailable {
+	if err := a.RecordImpression(context.Background(), testStore, "req1", "1", "1", 1, models.TargetingContext{DeviceType: "mobile", Country: "US"}, 1, "test-placement"); err != nil && err != ErrUnavailable {
 		t.Fatalf("record impression: %v", err)
 	}
 	li := models.GetLineItemByID(testStore, 1)
@@ -27,7 +27,7 @@ func TestRecordImpression_CPMSpend(t *testing.T) {
 	}
 	// Metrics are now handled by NoOpRegistry - no assertions needed
 
-	if err := a.RecordImpression(context.Background(), testStore, "req2", "1", "1", 1, "mobile", "US", 1, "test-placement"); err != nil && err != ErrUnavailable {
+	if err := a.RecordImpression(context.Background(), testStore, "req2", "1", "1", 1, models.TargetingContext{DeviceType: "mobile", Country: "US"}, 1, "test-placement"); err != nil && err != ErrUnavailable {
 		t.Fatalf("record impression: %v", err)
 	}
 	want = 2 * (2.0 / 1000)
@@ -45,7 +45,7 @@ func TestRecordImpression_FlatSpend(t *testing.T) {
 	})
 
 	a := &Analytics{Metrics: observability.NewNoOpRegistry()}
-	if err := a.RecordImpression(context.Background(), testStore, "req1", "1", "1", 2, "mobile", "US", 1, "test-placement"); err != nil && err != ErrUnavailable {
+	if err := a.RecordImpression(context.Background(), testStore, "req1", "1", "1", 2, models.TargetingContext{DeviceType: "mobile", Country: "US"}, 1, "test-placement"); err != nil && err != ErrUnavailable {
 		t.Fatalf("record impression: %v", err)
 	}
 	li := models.GetLineItemByID(testStore, 2)
@@ -55,7 +55,7 @@ func TestRecordImpression_FlatSpend(t *testing.T) {
 	}
 	// Metrics are now handled by NoOpRegistry - no assertions needed
 
-	if err := a.RecordImpression(context.Background(), testStore, "req2", "1", "1", 2, "mobile", "US", 1, "test-placement"); err != nil && err != ErrUnavailable {
+	if err := a.RecordImpression(context.Background(), testStore, "req2", "1", "1", 2, models.TargetingContext{DeviceType: "mobile", Country: "US"}, 1, "test-placement"); err != nil && err != ErrUnavailable {
 		t.Fatalf("record impression: %v", err)
 	}
 	if li.Spend != want {
@@ -63,3 +63,133 @@ func TestRecordImpression_FlatSpend(t *testing.T) {
 	}
 	// Metrics are now handled by NoOpRegistry - no assertions needed
 }
+
+func TestRecordInvalidTraffic_NoSpend(t *testing.T) {
+	testStore := models.NewInMemoryAdDataStore()
+	_ = testStore.SetLineItems([]models.LineItem{
+		{ID: 3, CampaignID: 3, CPM: 2.0, BudgetType: models.BudgetTypeCPM, BudgetAmount: 10, Active: true},
+		{ID: 4, CampaignID: 4, CPC: 0.5, BudgetType: models.BudgetTypeCPC, BudgetAmount: 10, Active: true},
+	})
+
+	a := &Analytics{Metrics: observability.NewNoOpRegistry()}
+	ctx := models.TargetingContext{DeviceType: "desktop", IVTReason: "datacenter"}
+	if err := a.RecordImpression(context.Background(), testStore, "req1", "1", "1", 3, ctx, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record impression: %v", err)
+	}
+	if err := a.RecordClick(context.Background(), testStore, "req1", "1", "1", 4, ctx, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record click: %v", err)
+	}
+	if s := models.GetLineItemByID(testStore, 3).Spend; s != 0 {
+		t.Errorf("invalid impression spent %f", s)
+	}
+	if s := models.GetLineItemByID(testStore, 4).Spend; s != 0 {
+		t.Errorf("invalid click spent %f", s)
+	}
+}
+
+func TestRecordViewableImpression_VCPMSpend(t *testing.T) {
+	testStore := models.NewInMemoryAdDataStore()
+	_ = testStore.SetLineItems([]models.LineItem{
+		{ID: 5, CampaignID: 5, CPM: 4.0, BudgetType: models.BudgetTypeVCPM, BudgetAmount: 10, Active: true},
+		{ID: 6, CampaignID: 6, CPM: 2.0, BudgetType: models.BudgetTypeCPM, BudgetAmount: 10, Active: true},
+	})
+
+	a := &Analytics{Metrics: observability.NewNoOpRegistry()}
+	ctx := models.TargetingContext{DeviceType: "desktop"}
+	if err := a.RecordImpression(context.Background(), testStore, "req1", "1", "1", 5, ctx, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record impression: %v", err)
+	}
+	vcpm := models.GetLineItemByID(testStore, 5)
+	if vcpm.Spend != 0 {
+		t.Fatalf("vCPM impression should not spend, got %f", vcpm.Spend)
+	}
+
+	if err := a.RecordViewableImpression(context.Background(), testStore, "req1", "1", "1", 5, ctx, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record viewable impression: %v", err)
+	}
+	if want := 4.0 / 1000; vcpm.Spend != want {
+		t.Fatalf("want spend %f got %f", want, vcpm.Spend)
+	}
+
+	// CPM line items already paid for the rendered impression.
+	if err := a.RecordViewableImpression(context.Background(), testStore, "req2", "1", "2", 6, ctx, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record viewable impression: %v", err)
+	}
+	if cpm := models.GetLineItemByID(testStore, 6); cpm.Spend != 0 {
+		t.Fatalf("CPM viewable impression should not spend, got %f", cpm.Spend)
+	}
+
+	ivt := models.TargetingContext{DeviceType: "desktop", IVTReason: "bot"}
+	if err := a.RecordViewableImpression(context.Background(), testStore, "req3", "1", "1", 5, ivt, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record viewable impression: %v", err)
+	}
+	if want := 4.0 / 1000; vcpm.Spend != want {
+		t.Fatalf("invalid viewable impression should not spend, got %f", vcpm.Spend)
+	}
+}
+
+func TestRecordConversion_CPASpend(t *testing.T) {
+	testStore := models.NewInMemoryAdDataStore()
+	_ = testStore.SetLineItems([]models.LineItem{
+		{ID: 7, CampaignID: 7, CPA: 25.0, BudgetType: models.BudgetTypeCPA, BudgetAmount: 100, Active: true},
+		{ID: 8, CampaignID: 8, CPC: 1.0, BudgetType: models.BudgetTypeCPC, BudgetAmount: 100, Active: true},
+	})
+
+	a := &Analytics{Metrics: observability.NewNoOpRegistry()}
+	ctx := models.TargetingContext{DeviceType: "desktop"}
+	if err := a.RecordClick(context.Background(), testStore, "req1", "1", "1", 7, ctx, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record click: %v", err)
+	}
+	cpa := models.GetLineItemByID(testStore, 7)
+	if cpa.Spend != 0 {
+		t.Fatalf("CPA click should not spend, got %f", cpa.Spend)
+	}
+
+	if err := a.RecordConversion(context.Background(), testStore, "req1", "1", "1", 7, 80, "post_click", ctx, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record conversion: %v", err)
+	}
+	if cpa.Spend != 25.0 {
+		t.Fatalf("want spend 25 got %f", cpa.Spend)
+	}
+
+	// Other budget types already paid for the impression or click.
+	if err := a.RecordConversion(context.Background(), testStore, "req2", "1", "2", 8, 80, "post_click", ctx, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record conversion: %v", err)
+	}
+	if cpc := models.GetLineItemByID(testStore, 8); cpc.Spend != 0 {
+		t.Fatalf("CPC conversion should not spend, got %f", cpc.Spend)
+	}
+
+	ivt := models.TargetingContext{DeviceType: "desktop", IVTReason: "bot"}
+	if err := a.RecordConversion(context.Background(), testStore, "req3", "1", "1", 7, 80, "post_view", ivt, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record conversion: %v", err)
+	}
+	if cpa.Spend != 25.0 {
+		t.Fatalf("invalid conversion should not spend, got %f", cpa.Spend)
+	}
+}
+
+func TestRecordBillableEvent_Spend(t *testing.T) {
+	testStore := models.NewInMemoryAdDataStore()
+	_ = testStore.SetLineItems([]models.LineItem{
+		{ID: 9, CampaignID: 9, CPM: 2.0, BudgetType: models.BudgetTypeCPM, BudgetAmount: 100, Active: true},
+	})
+
+	a := &Analytics{Metrics: observability.NewNoOpRegistry()}
+	ctx := models.TargetingContext{DeviceType: "desktop"}
+	if err := a.RecordBillableEvent(context.Background(), testStore, "add_to_cart", "req1", "1", "1", 9, 0.25, ctx, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record billable event: %v", err)
+	}
+	li := models.GetLineItemByID(testStore, 9)
+	if li.Spend != 0.25 {
+		t.Fatalf("want spend 0.25 got %f", li.Spend)
+	}
+
+	ivt := models.TargetingContext{DeviceType: "desktop", IVTReason: "bot"}
+	if err := a.RecordBillableEvent(context.Background(), testStore, "add_to_cart", "req2", "1", "1", 9, 0.25, ivt, 1, "test-placement"); err != nil && err != ErrUnavailable {
+		t.Fatalf("record billable event: %v", err)
+	}
+	if li.Spend != 0.25 {
+		t.Fatalf("invalid billable event should not spend, got %f", li.Spend)
+	}
+}
@@ -2,19 +2,21 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/patrickwarner/openadserve/internal/config"
 	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/ivt"
 	"github.com/patrickwarner/openadserve/internal/logic"
 	"github.com/patrickwarner/openadserve/internal/middleware"
 	"github.com/patrickwarner/openadserve/internal/models"
 	"github.com/patrickwarner/openadserve/internal/observability"
+	"github.com/patrickwarner/openadserve/internal/privacy"
 	"github.com/patrickwarner/openadserve/internal/token"
 
 	"go.opentelemetry.io/otel"
@@ -25,6 +27,14 @@ import (
 
 var tracer = otel.Tracer("openadserve")
 
+// errInvalidTraffic takes the no-bid path for requests flagged as invalid
+// traffic when IVT_NO_BID is enabled.
+var errInvalidTraffic = errors.New("invalid traffic")
+
+// errNoAcceptedSize takes the no-bid path when none of the sizes in
+// imp.banner.format is accepted by the placement.
+var errNoAcceptedSize = errors.New("no requested size accepted by the placement")
+
 // decodeOpenRTBRequest reads and unmarshals an OpenRTB request body.
 func decodeOpenRTBRequest(r *http.Request) (*models.OpenRTBRequest, error) {
 	body, err := io.ReadAll(r.Body)
@@ -118,19 +128,74 @@ func (s *Server) GetAdHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	placementID := req.Imp[0].TagID
+
+	// Decide what the user's consent allows before the user ID is used for
+	// frequency capping, stored in tokens or recorded with events.
+	privacyCtx := privacy.Evaluate(req.Regs, req.User)
+	pl := s.AdDataStore.GetPlacement(placementID)
+	if pub.ChildDirected || (pl != nil && pl.ChildDirected) {
+		privacy.ApplyCOPPA(&privacyCtx)
+	}
 	userID := req.User.ID
+	if privacyCtx.RestrictUserData {
+		userID = ""
+	}
 	width := req.Imp[0].W
 	height := req.Imp[0].H
 	deviceUA := req.Device.UA
-	ipStr := r.Header.Get("X-Forwarded-For")
-	if ipStr == "" {
-		ipStr, _, _ = net.SplitHostPort(r.RemoteAddr)
-	}
+	ipStr := s.ClientIP.ForAdRequest(r, req.Device.IP)
 
-	targetingCtx := logic.ResolveTargeting(s.GeoIP, deviceUA, ipStr)
-	if len(req.Ext.KV) > 0 {
+	// device.sua from server-side callers wins over hints sent on this request
+	hints := logic.ClientHintsFromSUA(req.Device.SUA).Merge(logic.ClientHintsFromHeaders(r.Header))
+	targetingCtx := logic.ResolveTargetingWithHints(s.GeoIP, deviceUA, ipStr, hints)
+	// Key-values carry audience data such as segments, which needs the same
+	// permission as the user ID
+	if len(req.Ext.KV) > 0 && !privacyCtx.RestrictUserData {
 		targetingCtx.KeyValues = req.Ext.KV
 	}
+	logic.ApplySiteContext(&targetingCtx, req.Site, req.App)
+	// Precise device location is personal data, so it needs the same
+	// permission as the user ID; otherwise the IP-derived location is used.
+	if !privacyCtx.RestrictUserData {
+		logic.ApplyDeviceGeo(&targetingCtx, req.Device.Geo)
+	}
+	targetingCtx.UserID = userID
+	targetingCtx.Privacy = privacyCtx
+	// Sizes in imp.banner take precedence over imp.w and imp.h; the first
+	// one is the preferred size
+	noAcceptedSize := false
+	if requested := req.Imp[0].Banner.Sizes(); len(requested) > 0 {
+		sizes := requested
+		if pl != nil {
+			sizes = pl.RequestSizes(requested)
+		}
+		if len(sizes) == 0 {
+			noAcceptedSize = true
+		} else {
+			targetingCtx.Sizes = sizes
+			width, height = sizes[0].W, sizes[0].H
+		}
+	}
+	// An ad pod is filled one ad at a time; each ad gets the pod time left
+	var pod *models.VideoPlacement
+	if pl != nil {
+		targetingCtx.Native = pl.Native
+		targetingCtx.Video = pl.Video.Narrow(req.Imp[0].Video)
+		if targetingCtx.Video.IsPod() {
+			pod = targetingCtx.Video
+			if slot := pod.Slot(0); slot != nil {
+				targetingCtx.Video = slot
+			}
+		}
+	}
+	// Invalid traffic is still recorded for reporting but never counts
+	// towards spend or pacing.
+	targetingCtx.IVTReason = s.IVT.CheckRequest(ctx, ipStr, userID, targetingCtx.IsBot, privacyCtx.COPPA)
+
+	ipAttr := s.storedIP(ipStr)
+	if privacyCtx.COPPA {
+		ipAttr = ""
+	}
 
 	// Add request attributes to span
 	span.SetAttributes(
@@ -139,7 +204,11 @@ func (s *Server) GetAdHandler(w http.ResponseWriter, r *http.Request) {
 		attribute.Int("publisher_id", req.Ext.PublisherID),
 		attribute.Int("width", width),
 		attribute.Int("height", height),
-		attribute.String("ip_address", ipStr),
+		attribute.String("ip_address", ipAttr),
+		attribute.String("consent_status", privacyCtx.Status),
+		attribute.String("domain", targetingCtx.Domain),
+		attribute.String("app_bundle", targetingCtx.AppBundle),
+		attribute.String("ivt_reason", targetingCtx.IVTReason),
 	)
 
 	if err := s.Analytics.RecordEvent(ctx, s.AdDataStore, "ad_request", req.ID, req.Imp[0].ID, "", 0, 0, targetingCtx, req.Ext.PublisherID, placementID); err != nil {
@@ -163,7 +232,14 @@ func (s *Server) GetAdHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var ad *models.AdResponse
-	if debugEnabled {
+	nbr := 1
+	if targetingCtx.IVTReason != "" && s.Config.IVTNoBid {
+		err = errInvalidTraffic
+		nbr = ivt.NoBidReason(targetingCtx.IVTReason)
+	} else if noAcceptedSize {
+		err = errNoAcceptedSize
+		nbr = 2
+	} else if debugEnabled {
 		if ts, ok := selector.(interface {
 			SelectAdWithTrace(*db.RedisStore, *db.DB, models.AdDataStore, string, string, int, int, models.TargetingContext, *logic.SelectionTrace, config.Config) (*models.AdResponse, error)
 		}); ok {
@@ -195,7 +271,7 @@ func (s *Server) GetAdHandler(w http.ResponseWriter, r *http.Request) {
 		resp := models.OpenRTBResponse{
 			ID:      req.ID,
 			SeatBid: []models.SeatBid{},
-			Nbr:     1,
+			Nbr:     nbr,
 		}
 		if err := writeOpenRTBResponse(w, resp, trace, debugEnabled); err != nil {
 			http.Error(w, "failed to encode response", http.StatusInternalServerError)
@@ -203,19 +279,33 @@ func (s *Server) GetAdHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ads := []*models.AdResponse{ad}
+	if pod != nil && ad.Video != nil {
+		ads = s.fillPod(selector, pod, ad, placementID, userID, width, height, targetingCtx)
+	}
+	price := 0.0
+	for _, a := range ads {
+		price += a.Price
+	}
+
 	// successful bid - add span attributes
 	span.SetAttributes(
 		attribute.String("ad.result", "bid"),
 		attribute.Int("ad.line_item_id", ad.LineItemID),
 		attribute.Int("ad.campaign_id", ad.CampaignID),
 		attribute.Int("ad.creative_id", ad.CreativeID),
-		attribute.Float64("ad.price", ad.Price),
+		attribute.Float64("ad.price", price),
+		attribute.Int("ad.count", len(ads)),
 	)
 
 	// increment serve counter immediately for pacing
-	if err := logic.IncrementLineItemServes(s.Store, ad.LineItemID); err != nil {
-		logger.Error("failed to increment serve counter", zap.Error(err), zap.Int("line_item_id", ad.LineItemID))
-		// Continue serving the ad even if serve counter fails
+	if targetingCtx.IVTReason == "" {
+		for _, a := range ads {
+			if err := logic.IncrementLineItemServes(s.Store, a.LineItemID); err != nil {
+				logger.Error("failed to increment serve counter", zap.Error(err), zap.Int("line_item_id", a.LineItemID))
+				// Continue serving the ad even if serve counter fails
+			}
+		}
 	}
 
 	adm := ad.HTML
@@ -224,18 +314,68 @@ func (s *Server) GetAdHandler(w http.ResponseWriter, r *http.Request) {
 	} else if len(ad.Banner) > 0 {
 		adm = string(ad.Banner)
 	}
-	tok, err := token.GenerateWithAuctionData(req.ID, req.Imp[0].ID, fmt.Sprintf("%d", ad.CreativeID), fmt.Sprintf("%d", ad.CampaignID), fmt.Sprintf("%d", ad.LineItemID), userID, fmt.Sprintf("%d", req.Ext.PublisherID), placementID, ad.Price, "USD", req.Ext.CustomParams, s.TokenSecret)
-	if err != nil {
-		logger.Error("failed to generate token", zap.Error(err), zap.String("request_id", req.ID))
-		s.Metrics.IncrementRequests(endpoint, method, "500")
-		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
-		http.Error(w, "internal server error (token generation)", http.StatusInternalServerError)
-		return
+	tokCtx := token.RequestContext{
+		ConsentStatus: privacyCtx.Status,
+		COPPA:         privacyCtx.COPPA,
+		Domain:        targetingCtx.Domain,
+		AppBundle:     targetingCtx.AppBundle,
+		PagePath:      targetingCtx.PagePath,
+		Categories:    targetingCtx.Categories,
+		IVTReason:     targetingCtx.IVTReason,
+	}
+	// Each ad of a pod is tracked with its own token
+	toks := make([]string, len(ads))
+	for i, a := range ads {
+		toks[i], err = token.GenerateWithContext(req.ID, req.Imp[0].ID, fmt.Sprintf("%d", a.CreativeID), fmt.Sprintf("%d", a.CampaignID), fmt.Sprintf("%d", a.LineItemID), userID, fmt.Sprintf("%d", req.Ext.PublisherID), placementID, a.Price, "USD", req.Ext.CustomParams, tokCtx, s.TokenSecret)
+		if err != nil {
+			logger.Error("failed to generate token", zap.Error(err), zap.String("request_id", req.ID))
+			s.Metrics.IncrementRequests(endpoint, method, "500")
+			s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+			http.Error(w, "internal server error (token generation)", http.StatusInternalServerError)
+			return
+		}
+	}
+	tok := toks[0]
+	// Third-party trackers that fit in the markup are added to it; the rest
+	// are fired when the impression and click are recorded
+	impTrackers, clickTrackers := s.markupTrackers(ad, pl)
+	// Video ads are returned as VAST and native ads of placements with a
+	// native request as a native response; both carry their own tracking URLs
+	if ad.NativeAd != nil {
+		adm, err = s.nativeAdMarkup(ad.NativeAd, s.signedTrackingURLs(r, tok), targetingCtx.Native, impTrackers, clickTrackers)
+		if err != nil {
+			logger.Error("failed to build native response", zap.Error(err), zap.String("request_id", req.ID))
+			s.Metrics.IncrementRequests(endpoint, method, "500")
+			s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+			http.Error(w, "internal server error (native)", http.StatusInternalServerError)
+			return
+		}
+	} else if ad.Video != nil {
+		adm, err = s.videoAdMarkup(r, ads, toks, req.ID+"-"+req.Imp[0].ID, targetingCtx.Video)
+		if err != nil {
+			logger.Error("failed to build vast", zap.Error(err), zap.String("request_id", req.ID))
+			s.Metrics.IncrementRequests(endpoint, method, "500")
+			s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+			http.Error(w, "internal server error (vast)", http.StatusInternalServerError)
+			return
+		}
+	} else if len(ad.Native) == 0 {
+		adm += trackerPixels(impTrackers)
+	}
+	if expanded, err := s.expandAdMarkup(adm, ad, req, placementID); err != nil {
+		// Serve the markup as is rather than lose the impression
+		logger.Warn("failed to expand macros in ad markup", zap.Error(err), zap.Int("creative_id", ad.CreativeID))
+	} else {
+		adm = expanded
 	}
 	impURL := "/impression?t=" + url.QueryEscape(tok)
 	clkURL := "/click?t=" + url.QueryEscape(tok)
 	evtURL := "/event?t=" + url.QueryEscape(tok)
 	repURL := "/report?t=" + url.QueryEscape(tok)
+	var viewURL string
+	if s.Config.ViewabilityMode != ViewabilityOff {
+		viewURL = "/viewable?t=" + url.QueryEscape(tok)
+	}
 	resp := models.OpenRTBResponse{
 		ID: req.ID,
 		SeatBid: []models.SeatBid{{
@@ -245,20 +385,29 @@ func (s *Server) GetAdHandler(w http.ResponseWriter, r *http.Request) {
 				CrID:      fmt.Sprintf("%d", ad.CreativeID),
 				CID:       fmt.Sprintf("%d", ad.CampaignID),
 				Adm:       adm,
-				Price:     ad.Price,
+				Price:     price,
 				ImpURL:    impURL,
 				ClickURL:  clkURL,
 				EventURL:  evtURL,
 				ReportURL: repURL,
+				ViewURL:   viewURL,
+				W:         ad.Width,
+				H:         ad.Height,
 			}},
 		}},
 	}
-	if err := s.Analytics.RecordEvent(ctx, s.AdDataStore, "ad_served", req.ID, req.Imp[0].ID, fmt.Sprintf("%d", ad.CreativeID), ad.LineItemID, 0, targetingCtx, req.Ext.PublisherID, placementID); err != nil {
-		logger.Error("analytics record", zap.Error(err))
-		s.Metrics.IncrementRequests(endpoint, method, "500")
-		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
-		http.Error(w, "analytics error", http.StatusInternalServerError)
-		return
+	if ad.ADomain != "" {
+		resp.SeatBid[0].Bid[0].ADomain = []string{ad.ADomain}
+	}
+	for _, a := range ads {
+		if err := s.Analytics.RecordEvent(ctx, s.AdDataStore, "ad_served", req.ID, req.Imp[0].ID, fmt.Sprintf("%d", a.CreativeID), a.LineItemID, 0, targetingCtx, req.Ext.PublisherID, placementID); err != nil {
+			logger.Error("analytics record", zap.Error(err))
+			s.Metrics.IncrementRequests(endpoint, method, "500")
+			s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+			http.Error(w, "analytics error", http.StatusInternalServerError)
+			return
+		}
+		s.Metrics.IncrementEvent("ad_served")
 	}
 	if observability.ShouldSample(observability.GetSamplingRate()) {
 		logger.Info("ad served",
@@ -266,7 +415,6 @@ func (s *Server) GetAdHandler(w http.ResponseWriter, r *http.Request) {
 			zap.String("user_id", userID),
 			zap.String("event_type", "ad_served"))
 	}
-	s.Metrics.IncrementEvent("ad_served")
 
 	s.Metrics.IncrementRequests(endpoint, method, "200")
 	s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/config"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/logic/selectors"
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/observability"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// contextSelector records the targeting context it was called with.
+type contextSelector struct {
+	ctx *models.TargetingContext
+}
+
+func (c contextSelector) SelectAd(_ *db.RedisStore, _ *db.DB, _ models.AdDataStore, _, _ string, _, _ int, ctx models.TargetingContext, _ config.Config) (*models.AdResponse, error) {
+	*c.ctx = ctx
+	return &models.AdResponse{CreativeID: 1, CampaignID: 100, LineItemID: 10, HTML: "a"}, nil
+}
+
+func TestGetAdHandler_KeyValuesNeedConsent(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	var got models.TargetingContext
+	srv := &Server{
+		Logger:      zap.NewNop(),
+		Analytics:   analytics.NewMockAnalytics(),
+		SelectorMap: map[int]selectors.Selector{0: contextSelector{ctx: &got}},
+		TokenSecret: []byte("secret"),
+		TokenTTL:    time.Minute,
+		Metrics:     observability.NewNoOpRegistry(),
+		Store:       &db.RedisStore{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), Ctx: context.Background()},
+	}
+	testStore := models.NewInMemoryAdDataStore()
+	srv.AdDataStore = testStore
+	models.SetPublishers(testStore, []models.Publisher{{ID: 1, Name: "p1", APIKey: "key1"}})
+	models.SetLineItems(testStore, []models.LineItem{{ID: 10, CampaignID: 100, PublisherID: 1, Active: true}})
+	models.SetCampaigns(testStore, []models.Campaign{{ID: 100, PublisherID: 1}})
+	placement := models.Placement{ID: "slot", Width: 1, Height: 1, Formats: []string{"html"}}
+	srv.DB = &db.DB{Placements: map[string]models.Placement{"slot": placement}}
+
+	gdpr := 1
+	tests := []struct {
+		name   string
+		regs   models.Regs
+		wantKV bool
+	}{
+		{"no regulation", models.Regs{}, true},
+		{"gdpr without consent", models.Regs{GDPR: &gdpr}, false},
+		{"us privacy opt-out", models.Regs{USPrivacy: "1YYN"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = models.TargetingContext{}
+			body, _ := json.Marshal(models.OpenRTBRequest{
+				ID:   "1",
+				Imp:  []models.Impression{{ID: "1", TagID: "slot"}},
+				User: models.User{ID: "u"},
+				Regs: tt.regs,
+				Ext:  models.RequestExt{PublisherID: 1, KV: map[string]string{"segment": "premium"}},
+			})
+			req := httptest.NewRequest(http.MethodPost, "/ad", bytes.NewReader(body))
+			req.RemoteAddr = "127.0.0.1:1234"
+			req.Header.Set("X-API-Key", "key1")
+			rec := httptest.NewRecorder()
+			srv.GetAdHandler(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", rec.Code)
+			}
+			if hasKV := got.KeyValues["segment"] == "premium"; hasKV != tt.wantKV {
+				t.Errorf("key-values passed to the selector = %v, want %v", got.KeyValues, tt.wantKV)
+			}
+		})
+	}
+}
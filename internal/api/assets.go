@@ -0,0 +1,198 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/patrickwarner/openadserve/internal/assets"
+	"github.com/patrickwarner/openadserve/internal/logic/render"
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// assetCacheControl lets browsers and CDNs cache assets for a year; keys are
+// derived from the content so a stored asset never changes.
+const assetCacheControl = "public, max-age=31536000, immutable"
+
+// StoredAsset describes an uploaded asset or one of its variants.
+type StoredAsset struct {
+	Key         string `json:"key"`
+	URL         string `json:"url"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+// AssetUpload is the response of UploadAsset. Banner can be used as is as
+// a creative's banner.
+type AssetUpload struct {
+	Banner render.BannerData `json:"banner"`
+	Assets []StoredAsset     `json:"assets"`
+}
+
+// UploadAsset stores an image uploaded as the "file" field of a multipart
+// form. When the form names a placement_id, or a slot width and height, the
+// image must fill one of the slot's sizes at 1x to 4x pixel density and the
+// lower densities are generated for the banner's srcset.
+func (s *Server) UploadAsset(w http.ResponseWriter, r *http.Request) {
+	if s.Assets == nil {
+		http.Error(w, "asset storage unavailable", http.StatusInternalServerError)
+		return
+	}
+	maxBytes := int64(s.Config.AssetMaxBytes)
+	if maxBytes <= 0 {
+		maxBytes = 2 << 20
+	}
+	// leave room for the multipart framing and the other fields
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+	if err := r.ParseMultipartForm(maxBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("file larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer func() { _ = file.Close() }()
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		http.Error(w, "read failed", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		http.Error(w, fmt.Sprintf("file larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	img, err := assets.Inspect(data, s.Config.AssetMaxWidth, s.Config.AssetMaxHeight)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sizes, err := s.uploadSlotSizes(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	images := []*assets.Image{img}
+	if len(sizes) > 0 {
+		slot, density, err := assets.MatchSlot(img, sizes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		variants, err := assets.Variants(img, slot, density)
+		if err != nil {
+			s.Logger.Error("asset variants", zap.Error(err))
+			http.Error(w, "processing failed", http.StatusInternalServerError)
+			return
+		}
+		images = append(variants, img)
+	}
+
+	sum := sha256.Sum256(data)
+	prefix := hex.EncodeToString(sum[:16])
+	base := s.publicBaseURL(r)
+	out := AssetUpload{Banner: render.BannerData{Alt: r.FormValue("alt")}}
+	for _, v := range images {
+		key := fmt.Sprintf("%s_%dx%d%s", prefix, v.Width, v.Height, v.Ext())
+		if err := s.Assets.Put(r.Context(), key, v.Data, v.ContentType); err != nil {
+			s.Logger.Error("store asset", zap.String("key", key), zap.Error(err))
+			http.Error(w, "store failed", http.StatusInternalServerError)
+			return
+		}
+		u := base + "/assets/" + key
+		out.Assets = append(out.Assets, StoredAsset{Key: key, URL: u, Width: v.Width, Height: v.Height, ContentType: v.ContentType, Size: len(v.Data)})
+		out.Banner.Images = append(out.Banner.Images, render.BannerSize{URL: u, Width: v.Width, Height: v.Height})
+	}
+	out.Banner.Image = out.Banner.Images[0].URL
+
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, out)
+}
+
+// uploadSlotSizes returns the slot sizes an upload must fit: those of the
+// form's placement_id, or its width and height. None means any size.
+func (s *Server) uploadSlotSizes(r *http.Request) ([]models.Format, error) {
+	if id := r.FormValue("placement_id"); id != "" {
+		var pl *models.Placement
+		if s.AdDataStore != nil {
+			pl = s.AdDataStore.GetPlacement(id)
+		}
+		if pl == nil {
+			return nil, errors.New("placement not found")
+		}
+		return pl.AcceptedSizes(), nil
+	}
+	if r.FormValue("width") == "" && r.FormValue("height") == "" {
+		return nil, nil
+	}
+	width, err := strconv.Atoi(r.FormValue("width"))
+	if err != nil || width <= 0 {
+		return nil, errors.New("invalid width")
+	}
+	height, err := strconv.Atoi(r.FormValue("height"))
+	if err != nil || height <= 0 {
+		return nil, errors.New("invalid height")
+	}
+	return []models.Format{{W: width, H: height}}, nil
+}
+
+// ServeAsset serves a stored asset with long-lived cache headers.
+func (s *Server) ServeAsset(w http.ResponseWriter, r *http.Request) {
+	if s.Assets == nil {
+		http.NotFound(w, r)
+		return
+	}
+	key := mux.Vars(r)["key"]
+	etag := `"` + key + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Set("Cache-Control", assetCacheControl)
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, obj, err := s.Assets.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		s.Logger.Error("load asset", zap.String("key", key), zap.Error(err))
+		http.Error(w, "load failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = body.Close() }()
+
+	if obj.ContentType != "" {
+		w.Header().Set("Content-Type", obj.ContentType)
+	}
+	if obj.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	w.Header().Set("Cache-Control", assetCacheControl)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		s.Logger.Debug("serve asset", zap.String("key", key), zap.Error(err))
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/storage"
+)
+
+func uploadRequest(t *testing.T, file []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	fw, _ := mw.CreateFormFile("file", "banner.png")
+	_, _ = fw.Write(file)
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/assets", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploadAndServeAsset(t *testing.T) {
+	local, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPlacements([]models.Placement{{ID: "mpu", PublisherID: 1, Width: 300, Height: 250}})
+	srv := newTestServer()
+	srv.Assets = local
+	srv.AdDataStore = store
+	srv.Config.PublicBaseURL = "https://ads.example"
+
+	var pngData bytes.Buffer
+	_ = png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 600, 500)))
+
+	w := httptest.NewRecorder()
+	srv.UploadAsset(w, uploadRequest(t, pngData.Bytes(), map[string]string{"placement_id": "mpu", "alt": "Sale"}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	var out AssetUpload
+	if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out.Banner.Images) != 2 || out.Banner.Images[0].Width != 300 || out.Banner.Images[1].Width != 600 {
+		t.Fatalf("expected 1x and 2x images, got %+v", out.Banner.Images)
+	}
+	if out.Banner.Image != out.Banner.Images[0].URL || out.Banner.Alt != "Sale" ||
+		!strings.HasPrefix(out.Banner.Image, "https://ads.example/assets/") {
+		t.Errorf("unexpected banner %+v", out.Banner)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/assets/{key}", srv.ServeAsset).Methods("GET", "HEAD")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/assets/"+out.Assets[0].Key, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" ||
+		w.Header().Get("Cache-Control") != assetCacheControl || w.Body.Len() != out.Assets[0].Size {
+		t.Fatalf("unexpected asset response %d %v", w.Code, w.Header())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/assets/"+out.Assets[0].Key, nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/assets/missing.png", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing asset, got %d", w.Code)
+	}
+}
+
+func TestUploadAsset_Rejects(t *testing.T) {
+	local, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("storage: %v", err)
+	}
+	srv := newTestServer()
+	srv.Assets = local
+	srv.Config.AssetMaxBytes = 1 << 20
+
+	var pngData bytes.Buffer
+	_ = png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 320, 50)))
+
+	cases := []struct {
+		name   string
+		file   []byte
+		fields map[string]string
+		code   int
+	}{
+		{"not an image", []byte("<svg onload=alert(1)></svg>"), nil, http.StatusBadRequest},
+		{"wrong size", pngData.Bytes(), map[string]string{"width": "300", "height": "250"}, http.StatusBadRequest},
+		{"too large", bytes.Repeat([]byte{0}, 2<<20), nil, http.StatusRequestEntityTooLarge},
+		{"any size", pngData.Bytes(), nil, http.StatusCreated},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		srv.UploadAsset(w, uploadRequest(t, tc.file, tc.fields))
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d %s", tc.name, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/patrickwarner/openadserve/internal/conversion"
 	"github.com/patrickwarner/openadserve/internal/logic"
 	"github.com/patrickwarner/openadserve/internal/macros"
 	"github.com/patrickwarner/openadserve/internal/middleware"
@@ -78,6 +79,14 @@ func (s *Server) ClickHandler(w http.ResponseWriter, r *http.Request) {
 		attribute.String("line_item_id", payload.LIID),
 	)
 
+	// Drop the user ID if the user's data was deleted after the token was issued
+	userID := s.trackedUserID(ctx, payload.UserID, payload.IssuedAt)
+
+	// Flagged clicks still redirect but are recorded as invalid_click, without
+	// CPC spend, daily click caps or CTR model input.
+	ivtReason := s.trackingIVTReason(r, "click", tok, userID, payload.RequestID, payload.ImpID, payload.CrID, payload.Context.IVTReason, payload.Context.COPPA)
+	span.SetAttributes(attribute.String("ivt_reason", ivtReason))
+
 	var pubID int
 	var lineItemID int
 	var creative *models.Creative
@@ -99,8 +108,10 @@ func (s *Server) ClickHandler(w http.ResponseWriter, r *http.Request) {
 			creative = cr
 			pubID = cr.PublisherID
 			lineItemID = cr.LineItemID
-			_ = s.Store.IncrementClick(cr.LineItemID)
-			_ = s.Store.IncrementCTRClick(cr.LineItemID)
+			if ivtReason == "" {
+				_ = s.Store.IncrementClick(cr.LineItemID)
+				_ = s.Store.IncrementCTRClick(cr.LineItemID)
+			}
 		}
 	}
 
@@ -129,10 +140,28 @@ func (s *Server) ClickHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Resolve device type and country from request headers/IP
-	deviceType, country := logic.ResolveTargetingFromRequest(r, s.GeoIP)
+	deviceType, country := logic.ResolveTargetingFromRequest(r, s.ClientIP.FromRequest(r), s.GeoIP)
+	targetingCtx := models.TargetingContext{
+		DeviceType: deviceType,
+		Country:    country,
+		UserID:     userID,
+		Privacy:    models.PrivacyContext{Status: payload.Context.ConsentStatus},
+		Domain:     payload.Context.Domain,
+		AppBundle:  payload.Context.AppBundle,
+		PagePath:   payload.Context.PagePath,
+		Categories: payload.Context.Categories,
+		IVTReason:  ivtReason,
+	}
 
 	// Record click analytics
-	if err := s.Analytics.RecordClick(ctx, s.AdDataStore, payload.RequestID, payload.ImpID, payload.CrID, lineItemID, deviceType, country, publisherID, payload.PlacementID); err != nil {
+	eventType := "click"
+	if ivtReason != "" {
+		eventType = "invalid_click"
+		err = s.Analytics.RecordEvent(ctx, s.AdDataStore, eventType, payload.RequestID, payload.ImpID, payload.CrID, lineItemID, 0, targetingCtx, publisherID, payload.PlacementID)
+	} else {
+		err = s.Analytics.RecordClick(ctx, s.AdDataStore, payload.RequestID, payload.ImpID, payload.CrID, lineItemID, targetingCtx, publisherID, payload.PlacementID)
+	}
+	if err != nil {
 		logger.Error("analytics record", zap.Error(err))
 		s.Metrics.IncrementRequests(endpoint, method, "500")
 		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
@@ -141,27 +170,61 @@ func (s *Server) ClickHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if observability.ShouldSample(observability.GetSamplingRate()) {
-		logger.Info("click", zap.String("request_id", payload.RequestID), zap.String("user_id", ""), zap.String("event_type", "click"))
+		logger.Info("click", zap.String("request_id", payload.RequestID), zap.String("user_id", ""), zap.String("event_type", eventType), zap.String("ivt_reason", ivtReason))
 	}
-	s.Metrics.IncrementEvent("click")
+	s.Metrics.IncrementEvent(eventType)
 
-	// Determine destination URL and handle redirect or pixel response
-	destinationURL := ""
-	if creative != nil && s.MacroService != nil {
-		// Use custom parameters from token (passed in ad request ext field)
-		customParams := payload.CustomParams
-		if customParams == nil {
-			customParams = make(map[string]string)
+	// Remember valid clicks for conversion attribution. The click ID is passed
+	// to the landing page via the {CLICK_ID} macro.
+	clickID := ""
+	if ivtReason == "" && s.Conversions != nil {
+		clickID, err = s.Conversions.RecordClick(ctx, conversion.Touch{
+			RequestID:   payload.RequestID,
+			ImpID:       payload.ImpID,
+			CreativeID:  creative.ID,
+			LineItemID:  lineItemID,
+			CampaignID:  creative.CampaignID,
+			PublisherID: publisherID,
+			PlacementID: payload.PlacementID,
+			UserID:      userID,
+			DeviceType:  deviceType,
+			Country:     country,
+			Consent:     payload.Context.ConsentStatus,
+			Domain:      payload.Context.Domain,
+			AppBundle:   payload.Context.AppBundle,
+			PagePath:    payload.Context.PagePath,
+			Categories:  payload.Context.Categories,
+			Time:        time.Now(),
+		})
+		if err != nil {
+			logger.Error("record click for conversions", zap.Error(err))
 		}
+	}
+
+	// Use custom parameters from token (passed in ad request ext field)
+	customParams := payload.CustomParams
+	if customParams == nil {
+		customParams = make(map[string]string)
+	}
+
+	// Create click context for macro expansion
+	clickCtx := macros.NewClickContextFromRequest(
+		payload.RequestID,
+		payload.ImpID,
+		creative,
+		customParams,
+	)
+	clickCtx.ClickID = clickID
+	clickCtx.Price = payload.BidPrice
 
-		// Create click context for macro expansion
-		clickCtx := macros.NewClickContextFromRequest(
-			payload.RequestID,
-			payload.ImpID,
-			creative,
-			customParams,
-		)
+	// Fire the third-party click trackers not returned in the markup
+	if ivtReason == "" {
+		s.fireThirdPartyTrackers(r, creative, payload.PlacementID, true, clickCtx)
+	}
 
+	// Determine destination URL and handle redirect or pixel response
+	destinationURL := ""
+	if s.MacroService != nil {
 		// Get expanded destination URL
 		if expandedURL, err := s.MacroService.GetDestinationURL(ctx, creative, clickCtx); err != nil {
 			logger.Error("Failed to expand destination URL",
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/patrickwarner/openadserve/internal/conversion"
+	"github.com/patrickwarner/openadserve/internal/middleware"
+	"github.com/patrickwarner/openadserve/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// Conversion outcomes returned by the postback endpoint.
+const (
+	conversionRecorded      = "recorded"
+	conversionDuplicate     = "duplicate"
+	conversionNotAttributed = "not_attributed"
+	conversionLimitReached  = "limit_reached"
+)
+
+// ConversionHandler handles GET /conversion pixel requests fired from the
+// advertiser's confirmation page. It always answers with a pixel once the
+// parameters are valid so a missing attribution never breaks the page.
+func (s *Server) ConversionHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const endpoint = "/conversion"
+	const method = "GET"
+
+	status, code := s.recordConversion(w, r, true)
+	s.Metrics.IncrementRequests(endpoint, method, strconv.Itoa(code))
+	s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+	if status == "" {
+		return
+	}
+	s.sendPixelResponse(w)
+}
+
+// PostbackHandler handles GET and POST /postback server-to-server conversion
+// notifications and reports the outcome as JSON. Postbacks must carry the
+// campaign_id and the campaign's postback key.
+func (s *Server) PostbackHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	const endpoint = "/postback"
+	method := r.Method
+
+	status, code := s.recordConversion(w, r, false)
+	s.Metrics.IncrementRequests(endpoint, method, strconv.Itoa(code))
+	s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+	if status == "" {
+		return
+	}
+	writeJSON(w, map[string]string{"status": status})
+}
+
+// recordConversion attributes and records the conversion described by the
+// request parameters: click_id, or user_id with campaign_id, plus optional
+// value and order_id. It returns the outcome and HTTP status; an empty
+// outcome means an error response has already been written. Pixel requests
+// come from the user's browser and are checked for invalid traffic; postbacks
+// come from advertiser servers and are authenticated with the campaign's
+// postback key instead. Pixels attributed by user_id need the key as well.
+func (s *Server) recordConversion(w http.ResponseWriter, r *http.Request, pixel bool) (string, int) {
+	ctx := r.Context()
+	logger := middleware.LoggerFromRequest(r, s.Logger)
+
+	if s.Analytics == nil || s.Conversions == nil {
+		logger.Error("conversion tracking unavailable")
+		http.Error(w, "conversion tracking unavailable", http.StatusServiceUnavailable)
+		return "", http.StatusServiceUnavailable
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid parameters", http.StatusBadRequest)
+		return "", http.StatusBadRequest
+	}
+	clickID := r.Form.Get("click_id")
+	userID := r.Form.Get("user_id")
+	campaignID, _ := strconv.Atoi(r.Form.Get("campaign_id"))
+	orderID := r.Form.Get("order_id")
+	if clickID == "" && (userID == "" || campaignID <= 0) {
+		s.Metrics.IncrementEvent("bad_conversion")
+		http.Error(w, "click_id or user_id and campaign_id required", http.StatusBadRequest)
+		return "", http.StatusBadRequest
+	}
+	var value float64
+	if v := r.Form.Get("value"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < 0 || math.IsNaN(parsed) || math.IsInf(parsed, 0) ||
+			(s.Config.ConversionMaxValue > 0 && parsed > s.Config.ConversionMaxValue) {
+			s.Metrics.IncrementEvent("bad_conversion")
+			http.Error(w, "invalid value", http.StatusBadRequest)
+			return "", http.StatusBadRequest
+		}
+		value = parsed
+	}
+	if !pixel && s.Config.PostbackSecret == "" {
+		logger.Warn("postback received but POSTBACK_SECRET is not set")
+		http.Error(w, "postbacks not configured", http.StatusServiceUnavailable)
+		return "", http.StatusServiceUnavailable
+	}
+	keyed := campaignID > 0 && conversion.VerifyPostbackKey([]byte(s.Config.PostbackSecret), campaignID, r.Form.Get("key"))
+	if !keyed {
+		// User IDs are easy to guess, so without the campaign's key a pixel
+		// is only attributed by the click ID issued to the clicking browser
+		if !pixel || clickID == "" {
+			s.Metrics.IncrementEvent("bad_conversion")
+			http.Error(w, "invalid postback key", http.StatusForbidden)
+			return "", http.StatusForbidden
+		}
+		userID = ""
+	}
+
+	touch, attribution, err := s.Conversions.Attribute(ctx, clickID, userID, campaignID)
+	if err == nil && keyed && touch.CampaignID != campaignID {
+		// A campaign's key only reports conversions of its own touches
+		err = conversion.ErrNotAttributed
+	}
+	if errors.Is(err, conversion.ErrNotAttributed) {
+		s.Metrics.IncrementEvent("conversion_unattributed")
+		return conversionNotAttributed, http.StatusOK
+	}
+	if err != nil {
+		logger.Error("attribute conversion", zap.Error(err))
+		http.Error(w, "attribution error", http.StatusInternalServerError)
+		return "", http.StatusInternalServerError
+	}
+
+	ivtReason := ""
+	if pixel {
+		ivtReason = s.trackingIVTReason(r, "conversion", "", touch.UserID, touch.RequestID, touch.ImpID, strconv.Itoa(touch.CreativeID), "", touch.Consent == models.ConsentCOPPA)
+	}
+
+	// Only valid conversions are deduplicated so invalid traffic can't use up
+	// a touch before the real conversion arrives.
+	if ivtReason == "" {
+		first, err := s.Conversions.MarkConverted(ctx, touch, orderID)
+		if errors.Is(err, conversion.ErrOrderLimit) {
+			s.Metrics.IncrementEvent("conversion_limit")
+			return conversionLimitReached, http.StatusOK
+		}
+		if err != nil {
+			logger.Error("mark conversion", zap.Error(err))
+			http.Error(w, "attribution error", http.StatusInternalServerError)
+			return "", http.StatusInternalServerError
+		}
+		if !first {
+			s.Metrics.IncrementEvent("conversion_duplicate")
+			return conversionDuplicate, http.StatusOK
+		}
+	}
+
+	targetingCtx := models.TargetingContext{
+		DeviceType: touch.DeviceType,
+		Country:    touch.Country,
+		UserID:     s.trackedUserID(ctx, touch.UserID, touch.Time),
+		Privacy:    models.PrivacyContext{Status: touch.Consent},
+		Domain:     touch.Domain,
+		AppBundle:  touch.AppBundle,
+		PagePath:   touch.PagePath,
+		Categories: touch.Categories,
+		IVTReason:  ivtReason,
+	}
+	if err := s.Analytics.RecordConversion(ctx, s.AdDataStore, touch.RequestID, touch.ImpID, strconv.Itoa(touch.CreativeID), touch.LineItemID, value, attribution, targetingCtx, touch.PublisherID, touch.PlacementID); err != nil {
+		logger.Error("analytics record", zap.Error(err))
+		http.Error(w, "analytics error", http.StatusInternalServerError)
+		return "", http.StatusInternalServerError
+	}
+	if ivtReason == "" && touch.LineItemID > 0 && s.Store != nil {
+		_ = s.Store.IncrementCVRConversion(touch.LineItemID)
+	}
+
+	logger.Info("conversion",
+		zap.String("request_id", touch.RequestID),
+		zap.String("attribution", attribution),
+		zap.Float64("value", value),
+		zap.String("ivt_reason", ivtReason))
+	s.Metrics.IncrementEvent("conversion")
+	return conversionRecorded, http.StatusOK
+}
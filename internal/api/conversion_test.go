@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/conversion"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/models"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap/zaptest"
+)
+
+func (a *recordingAnalytics) RecordConversion(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, value float64, attribution string, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	a.events = append(a.events, "conversion:"+attribution)
+	return nil
+}
+
+func newConversionTestServer(t *testing.T) (*Server, *recordingAnalytics) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	rec := &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = rec
+	srv.AdDataStore = models.NewInMemoryAdDataStore()
+	srv.Store = &db.RedisStore{Client: rdb, Ctx: context.Background()}
+	srv.Conversions = conversion.NewTracker(rdb, conversion.Config{PostClickWindow: time.Hour, PostViewWindow: time.Hour, MaxOrdersPerTouch: 2}, nil)
+	srv.Config.PostbackSecret = "postback-secret"
+	srv.Config.ConversionMaxValue = 1000
+	return srv, rec
+}
+
+// postbackQuery adds campaign 1's postback key to a postback query.
+func postbackQuery(srv *Server, query string) string {
+	return query + "&campaign_id=1&key=" + conversion.PostbackKey([]byte(srv.Config.PostbackSecret), 1)
+}
+
+func postbackStatus(t *testing.T, srv *Server, query string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.PostbackHandler(w, httptest.NewRequest(http.MethodGet, "/postback?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("postback %q: expected 200, got %d", query, w.Code)
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp["status"]
+}
+
+func TestPostbackHandler(t *testing.T) {
+	srv, rec := newConversionTestServer(t)
+	ctx := context.Background()
+
+	clickID, err := srv.Conversions.RecordClick(ctx, conversion.Touch{RequestID: "req-1", ImpID: "1", CreativeID: 1, LineItemID: 1, CampaignID: 1, PublisherID: 1})
+	if err != nil {
+		t.Fatalf("RecordClick: %v", err)
+	}
+
+	if got := postbackStatus(t, srv, postbackQuery(srv, "click_id="+clickID+"&value=12.5")); got != conversionRecorded {
+		t.Fatalf("expected recorded, got %q", got)
+	}
+	if got := postbackStatus(t, srv, postbackQuery(srv, "click_id="+clickID)); got != conversionDuplicate {
+		t.Fatalf("expected duplicate, got %q", got)
+	}
+	if got := postbackStatus(t, srv, postbackQuery(srv, "click_id=unknown")); got != conversionNotAttributed {
+		t.Fatalf("expected not_attributed, got %q", got)
+	}
+	if len(rec.events) != 1 || rec.events[0] != "conversion:"+conversion.AttributionPostClick {
+		t.Fatalf("expected one post-click conversion, got %v", rec.events)
+	}
+	if _, convs := srv.Store.GetCVRCounts(1); convs != 1 {
+		t.Fatalf("expected 1 counted conversion, got %d", convs)
+	}
+
+	for _, query := range []string{"", "click_id=" + clickID + "&value=abc", "user_id=u1",
+		postbackQuery(srv, "click_id="+clickID+"&value=5000"), postbackQuery(srv, "click_id="+clickID+"&value=NaN")} {
+		w := httptest.NewRecorder()
+		srv.PostbackHandler(w, httptest.NewRequest(http.MethodGet, "/postback?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("postback %q: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestPostbackHandler_Authentication(t *testing.T) {
+	srv, rec := newConversionTestServer(t)
+	clickID, err := srv.Conversions.RecordClick(context.Background(), conversion.Touch{RequestID: "req-1", ImpID: "1", LineItemID: 1, CampaignID: 1, PublisherID: 1, UserID: "u1"})
+	if err != nil {
+		t.Fatalf("RecordClick: %v", err)
+	}
+
+	otherKey := conversion.PostbackKey([]byte(srv.Config.PostbackSecret), 2)
+	for _, query := range []string{
+		"click_id=" + clickID,
+		"click_id=" + clickID + "&campaign_id=1&key=guess",
+		"user_id=u1&campaign_id=1&key=" + otherKey,
+	} {
+		w := httptest.NewRecorder()
+		srv.PostbackHandler(w, httptest.NewRequest(http.MethodGet, "/postback?"+query, nil))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("postback %q: expected 403, got %d", query, w.Code)
+		}
+	}
+	// Campaign 2's key doesn't report conversions of campaign 1's clicks
+	if got := postbackStatus(t, srv, "click_id="+clickID+"&campaign_id=2&key="+otherKey); got != conversionNotAttributed {
+		t.Fatalf("expected not_attributed for another campaign's key, got %q", got)
+	}
+	if len(rec.events) != 0 {
+		t.Fatalf("expected no conversions, got %v", rec.events)
+	}
+
+	srv.Config.PostbackSecret = ""
+	w := httptest.NewRecorder()
+	srv.PostbackHandler(w, httptest.NewRequest(http.MethodGet, "/postback?click_id="+clickID, nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a postback secret, got %d", w.Code)
+	}
+}
+
+func TestPostbackHandler_OrderLimit(t *testing.T) {
+	srv, rec := newConversionTestServer(t)
+	clickID, err := srv.Conversions.RecordClick(context.Background(), conversion.Touch{RequestID: "req-1", ImpID: "1", LineItemID: 1, CampaignID: 1, PublisherID: 1})
+	if err != nil {
+		t.Fatalf("RecordClick: %v", err)
+	}
+	for i, want := range []string{conversionRecorded, conversionRecorded, conversionLimitReached} {
+		query := postbackQuery(srv, "click_id="+clickID+"&order_id=o"+strconv.Itoa(i))
+		if got := postbackStatus(t, srv, query); got != want {
+			t.Fatalf("order %d: expected %q, got %q", i, want, got)
+		}
+	}
+	if len(rec.events) != 2 {
+		t.Fatalf("expected two conversions, got %v", rec.events)
+	}
+}
+
+func TestConversionHandler_PostView(t *testing.T) {
+	srv, rec := newConversionTestServer(t)
+
+	if err := srv.Conversions.RecordView(context.Background(), conversion.Touch{RequestID: "req-1", ImpID: "1", CreativeID: 1, LineItemID: 1, CampaignID: 3, PublisherID: 1, UserID: "u1"}); err != nil {
+		t.Fatalf("RecordView: %v", err)
+	}
+
+	key := conversion.PostbackKey([]byte(srv.Config.PostbackSecret), 3)
+	w := httptest.NewRecorder()
+	srv.ConversionHandler(w, httptest.NewRequest(http.MethodGet, "/conversion?user_id=u1&campaign_id=3&key="+key, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/gif" {
+		t.Fatalf("expected pixel, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if len(rec.events) != 1 || rec.events[0] != "conversion:"+conversion.AttributionPostView {
+		t.Fatalf("expected one post-view conversion, got %v", rec.events)
+	}
+
+	srv.Conversions = nil
+	w = httptest.NewRecorder()
+	srv.ConversionHandler(w, httptest.NewRequest(http.MethodGet, "/conversion?user_id=u1&campaign_id=3&key="+key, nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a tracker, got %d", w.Code)
+	}
+}
+
+func TestConversionHandler_ForgedUserID(t *testing.T) {
+	srv, rec := newConversionTestServer(t)
+	ctx := context.Background()
+	touch := conversion.Touch{RequestID: "req-1", ImpID: "1", CreativeID: 1, LineItemID: 1, CampaignID: 1, PublisherID: 1, UserID: "u1"}
+	clickID, err := srv.Conversions.RecordClick(ctx, touch)
+	if err != nil {
+		t.Fatalf("RecordClick: %v", err)
+	}
+	if err := srv.Conversions.RecordView(ctx, touch); err != nil {
+		t.Fatalf("RecordView: %v", err)
+	}
+
+	for _, query := range []string{"user_id=u1&campaign_id=1", "user_id=u1&campaign_id=1&key=guess"} {
+		w := httptest.NewRecorder()
+		srv.ConversionHandler(w, httptest.NewRequest(http.MethodGet, "/conversion?"+query, nil))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("pixel %q: expected 403, got %d", query, w.Code)
+		}
+	}
+	// An unknown click ID doesn't fall back to the unauthenticated user ID
+	w := httptest.NewRecorder()
+	srv.ConversionHandler(w, httptest.NewRequest(http.MethodGet, "/conversion?click_id=unknown&user_id=u1&campaign_id=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected pixel for unknown click ID, got %d", w.Code)
+	}
+	if len(rec.events) != 0 {
+		t.Fatalf("expected no conversions from forged pixels, got %v", rec.events)
+	}
+	if _, convs := srv.Store.GetCVRCounts(1); convs != 0 {
+		t.Fatalf("expected no counted conversions, got %d", convs)
+	}
+
+	// The touch is still unconverted, so the real click ID is recorded
+	w = httptest.NewRecorder()
+	srv.ConversionHandler(w, httptest.NewRequest(http.MethodGet, "/conversion?click_id="+clickID, nil))
+	if w.Code != http.StatusOK || len(rec.events) != 1 {
+		t.Fatalf("expected the click ID conversion to be recorded, got %d %v", w.Code, rec.events)
+	}
+}
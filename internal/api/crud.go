@@ -2,13 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 
+	"github.com/patrickwarner/openadserve/internal/logic"
 	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/trackers"
 )
 
 // helper function to write JSON response
@@ -38,6 +42,10 @@ func (s *Server) CreatePublisher(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	if err := pub.ValidateEventTypes(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// First persist to PostgreSQL to get the ID
 	if s.PG != nil {
@@ -76,6 +84,10 @@ func (s *Server) UpdatePublisher(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	if err := pub.ValidateEventTypes(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	pub.ID = id
 
 	// Update in data store
@@ -274,6 +286,10 @@ func (s *Server) CreatePlacement(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	if err := validatePlacement(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Insert into data store
 	if err := s.AdDataStore.InsertPlacement(p); err != nil {
@@ -294,6 +310,16 @@ func (s *Server) CreatePlacement(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, p)
 }
 
+// validatePlacement checks the placement's further sizes and native request.
+func validatePlacement(p models.Placement) error {
+	for _, f := range p.Sizes {
+		if f.W <= 0 || f.H <= 0 {
+			return fmt.Errorf("placement size %dx%d must be positive", f.W, f.H)
+		}
+	}
+	return p.Native.Validate()
+}
+
 func (s *Server) UpdatePlacement(w http.ResponseWriter, r *http.Request) {
 	if s.AdDataStore == nil {
 		http.Error(w, "data store unavailable", http.StatusInternalServerError)
@@ -305,6 +331,10 @@ func (s *Server) UpdatePlacement(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	if err := validatePlacement(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	p.ID = id
 
 	// Update in data store
@@ -379,6 +409,10 @@ func (s *Server) CreateLineItem(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	if err := validateTrackers(li.ImpressionTrackers, li.ClickTrackers); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// First persist to PostgreSQL to get the ID
 	if s.PG != nil {
@@ -417,6 +451,10 @@ func (s *Server) UpdateLineItem(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	if err := validateTrackers(li.ImpressionTrackers, li.ClickTrackers); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	li.ID = id
 
 	// Update in data store
@@ -437,6 +475,7 @@ func (s *Server) UpdateLineItem(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	logic.ForgetGeofenceIndex(id)
 	s.notifyUpdate("line_item", "update", id)
 	writeJSON(w, li)
 }
@@ -471,6 +510,7 @@ func (s *Server) DeleteLineItem(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	logic.ForgetGeofenceIndex(id)
 	s.notifyUpdate("line_item", "delete", id)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -502,6 +542,19 @@ func (s *Server) CreateCreative(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := s.validateVideo(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.validateNative(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateDelivery(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Auto-populate campaign and publisher from line item
 	if c.LineItemID != 0 && s.AdDataStore != nil {
 		lineItem := s.AdDataStore.GetLineItemByID(c.LineItemID)
@@ -512,16 +565,27 @@ func (s *Server) CreateCreative(w http.ResponseWriter, r *http.Request) {
 		c.CampaignID = lineItem.CampaignID
 		c.PublisherID = lineItem.PublisherID
 	}
+	if code, err := s.validateCreativeTemplate(&c); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
 
-	// Auto-populate width and height from placement
+	// Auto-populate width and height from placement unless the creative
+	// is one of the other sizes the placement accepts
 	if c.PlacementID != "" && s.AdDataStore != nil {
 		placement := s.AdDataStore.GetPlacement(c.PlacementID)
 		if placement == nil {
 			http.Error(w, "placement not found", http.StatusBadRequest)
 			return
 		}
-		c.Width = placement.Width
-		c.Height = placement.Height
+		if c.Width == 0 && c.Height == 0 {
+			c.Width = placement.Width
+			c.Height = placement.Height
+		}
+		if err := validateSize(c, placement); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	// Note: Creatives are currently only stored in PostgreSQL
@@ -536,6 +600,87 @@ func (s *Server) CreateCreative(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, c)
 }
 
+// validateVideo checks the media of video creatives. Creatives of
+// programmatic line items may leave it out since their bids return VAST.
+func (s *Server) validateVideo(c models.Creative) error {
+	if c.Format != models.FormatVideo {
+		return nil
+	}
+	if c.Video == nil && s.AdDataStore != nil {
+		if li := s.AdDataStore.GetLineItemByID(c.LineItemID); li != nil && li.Type == models.LineItemTypeProgrammatic {
+			return nil
+		}
+	}
+	return c.Video.Validate()
+}
+
+// validateDelivery checks the creative's flight dates, rotation weight,
+// frequency cap and third-party trackers.
+func validateDelivery(c models.Creative) error {
+	if !c.StartDate.IsZero() && !c.EndDate.IsZero() && c.EndDate.Before(c.StartDate) {
+		return errors.New("end_date must not be before start_date")
+	}
+	if c.Weight < 0 {
+		return errors.New("weight must not be negative")
+	}
+	if c.FrequencyCap < 0 || c.FrequencyWindow < 0 {
+		return errors.New("frequency_cap and frequency_window must not be negative")
+	}
+	return validateTrackers(c.ImpressionTrackers, c.ClickTrackers)
+}
+
+// validateTrackers checks that third-party trackers are absolute http or
+// https URLs that don't point at loopback, private or link-local addresses.
+// Macros are allowed anywhere in them.
+func validateTrackers(lists ...[]string) error {
+	for _, urls := range lists {
+		for _, raw := range urls {
+			if err := trackers.CheckURL(raw, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateSize checks that the placement accepts the creative's size. Video
+// creatives fit the player rather than the slot size.
+func validateSize(c models.Creative, pl *models.Placement) error {
+	if c.Format == models.FormatVideo || pl.AcceptsSize(c.Width, c.Height) {
+		return nil
+	}
+	return fmt.Errorf("placement %s does not accept %dx%d creatives", pl.ID, c.Width, c.Height)
+}
+
+// validateNative checks native creatives against the native request of
+// their placement: the assets must fill every required asset and clicks
+// must lead somewhere. Creatives of programmatic line items may leave the
+// assets out since their bids return a native response.
+func (s *Server) validateNative(c models.Creative) error {
+	if c.Format != models.FormatNative || s.AdDataStore == nil {
+		return nil
+	}
+	pl := s.AdDataStore.GetPlacement(c.PlacementID)
+	if pl == nil || pl.Native == nil {
+		return nil
+	}
+	li := s.AdDataStore.GetLineItemByID(c.LineItemID)
+	if len(c.Native) == 0 && li != nil && li.Type == models.LineItemTypeProgrammatic {
+		return nil
+	}
+	nc, err := models.ParseNativeCreative(c.Native)
+	if err != nil {
+		return err
+	}
+	if _, err := pl.Native.Response(nc); err != nil {
+		return err
+	}
+	if c.ClickURL == "" && (li == nil || li.ClickURL == "") {
+		return errors.New("native creative requires a click url")
+	}
+	return nil
+}
+
 func (s *Server) UpdateCreative(w http.ResponseWriter, r *http.Request) {
 	if s.PG == nil {
 		http.Error(w, "postgres unavailable", http.StatusInternalServerError)
@@ -553,6 +698,30 @@ func (s *Server) UpdateCreative(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	c.ID = id
+	if err := s.validateVideo(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.validateNative(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateDelivery(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if code, err := s.validateCreativeTemplate(&c); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if (c.Width != 0 || c.Height != 0) && s.AdDataStore != nil {
+		if pl := s.AdDataStore.GetPlacement(c.PlacementID); pl != nil {
+			if err := validateSize(c, pl); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
 	if err := s.PG.UpdateCreative(c); err != nil {
 		s.Logger.Error("update creative", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
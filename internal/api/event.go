@@ -16,16 +16,9 @@ import (
 // CustomEvent kept for backwards compatibility of tests.
 type CustomEvent struct{}
 
-// AllowedEventTypes lists the custom event names accepted by the server.
-// Publishers should document the behaviour of each event so its
-// meaning is clear when referenced in pacing or reporting logic.
-var AllowedEventTypes = map[string]struct{}{
-	"like":    {}, // user expressed a like/heart reaction
-	"share":   {}, // user shared the content
-	"comment": {}, // user commented on the content
-}
-
-// EventHandler handles GET /event pixel requests.
+// EventHandler handles GET /event pixel requests. The event type must be one
+// of the publisher's EventTypes, which decide whether it is deduplicated and
+// billed.
 func (s *Server) EventHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	const endpoint = "event"
@@ -64,21 +57,12 @@ func (s *Server) EventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, ok := AllowedEventTypes[evType]; !ok {
-		s.Logger.Error("unknown event type", zap.String("type", evType))
-		s.Metrics.IncrementEvent("bad_event")
-		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
-		http.Error(w, "unknown event type", http.StatusBadRequest)
-		return
-	}
-
 	var pubID int
 	var lineItemID int
 	if id, err := strconv.Atoi(payload.CrID); err == nil {
 		if cr := s.DB.FindCreativeByID(id); cr != nil {
 			pubID = cr.PublisherID
 			lineItemID = cr.LineItemID
-			_ = s.Store.IncrementCustomEvent(cr.LineItemID, evType)
 		}
 	}
 
@@ -89,7 +73,8 @@ func (s *Server) EventHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if pubID == 0 || models.GetPublisherByID(s.AdDataStore, pubID) == nil {
+	pub := models.GetPublisherByID(s.AdDataStore, pubID)
+	if pubID == 0 || pub == nil {
 		s.Logger.Error("unknown publisher", zap.Int("publisher_id", pubID))
 		s.Metrics.IncrementEvent("bad_event")
 		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
@@ -97,6 +82,37 @@ func (s *Server) EventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	eventType := pub.EventType(evType)
+	if eventType == nil {
+		s.Logger.Error("unknown event type", zap.String("type", evType), zap.Int("publisher_id", pubID))
+		s.Metrics.IncrementEvent("bad_event")
+		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+		http.Error(w, "unknown event type", http.StatusBadRequest)
+		return
+	}
+
+	// Invalid events are recorded but excluded from spend and daily event caps
+	ivtReason := s.trackingIVTReason(r, evType, tok, payload.UserID, payload.RequestID, payload.ImpID, payload.CrID, payload.Context.IVTReason, payload.Context.COPPA)
+
+	// Deduplicated events count once per impression. Only valid events are
+	// deduplicated so invalid traffic can't use up the impression's event.
+	if ivtReason == "" && eventType.Deduplicated() && s.Store != nil && s.Store.Client != nil {
+		key := "event:dedupe:" + evType + ":" + payload.RequestID + ":" + payload.ImpID + ":" + payload.CrID
+		first, err := s.Store.Client.SetNX(r.Context(), key, 1, s.TokenTTL).Result()
+		if err != nil {
+			s.Logger.Warn("event dedupe", zap.Error(err))
+		} else if !first {
+			s.Metrics.IncrementEvent("duplicate_event")
+			s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+			s.sendPixelResponse(w)
+			return
+		}
+	}
+
+	if ivtReason == "" && lineItemID > 0 && s.Store != nil {
+		_ = s.Store.IncrementCustomEvent(lineItemID, evType)
+	}
+
 	// Get publisher ID from token or fallback to creative lookup
 	publisherID := pubID
 	if payload.PubID != "" {
@@ -106,16 +122,28 @@ func (s *Server) EventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Resolve device type and country from request headers/IP
-	deviceType, country := logic.ResolveTargetingFromRequest(r, s.GeoIP)
+	deviceType, country := logic.ResolveTargetingFromRequest(r, s.ClientIP.FromRequest(r), s.GeoIP)
 
 	// Create targeting context for event
 	targetingCtx := models.TargetingContext{
 		DeviceType: deviceType,
 		Country:    country,
 		KeyValues:  make(map[string]string), // Events don't have key-values
+		UserID:     s.trackedUserID(r.Context(), payload.UserID, payload.IssuedAt),
+		Privacy:    models.PrivacyContext{Status: payload.Context.ConsentStatus},
+		Domain:     payload.Context.Domain,
+		AppBundle:  payload.Context.AppBundle,
+		PagePath:   payload.Context.PagePath,
+		Categories: payload.Context.Categories,
+		IVTReason:  ivtReason,
 	}
 
-	if err := s.Analytics.RecordEvent(r.Context(), s.AdDataStore, evType, payload.RequestID, payload.ImpID, payload.CrID, lineItemID, 0, targetingCtx, publisherID, payload.PlacementID); err != nil {
+	if eventType.Billable {
+		err = s.Analytics.RecordBillableEvent(r.Context(), s.AdDataStore, evType, payload.RequestID, payload.ImpID, payload.CrID, lineItemID, eventType.Cost, targetingCtx, publisherID, payload.PlacementID)
+	} else {
+		err = s.Analytics.RecordEvent(r.Context(), s.AdDataStore, evType, payload.RequestID, payload.ImpID, payload.CrID, lineItemID, 0, targetingCtx, publisherID, payload.PlacementID)
+	}
+	if err != nil {
 		s.Logger.Error("analytics record", zap.Error(err))
 		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
 		http.Error(w, "analytics error", http.StatusInternalServerError)
@@ -124,7 +152,5 @@ func (s *Server) EventHandler(w http.ResponseWriter, r *http.Request) {
 	s.Logger.Info("custom event", zap.String("request_id", payload.RequestID), zap.String("event_type", evType))
 	s.Metrics.IncrementEvent(evType)
 	s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
-	w.Header().Set("Content-Type", "image/gif")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(pixelGIF)
+	s.sendPixelResponse(w)
 }
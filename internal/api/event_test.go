@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/ivt"
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/token"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap/zaptest"
+)
+
+func (a *recordingAnalytics) RecordBillableEvent(ctx context.Context, store models.AdDataStore, eventType, requestID, impID, creativeID string, lineItemID int, cost float64, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	a.events = append(a.events, "billable:"+eventType)
+	return nil
+}
+
+func TestEventHandler_PublisherEventTypes(t *testing.T) {
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "Test", APIKey: "k", EventTypes: []models.EventType{
+		{Name: "video_complete", Dedupe: true},
+		{Name: "add_to_cart", Billable: true, Cost: 0.25},
+	}}})
+	testDB := &db.DB{Creatives: []models.Creative{{ID: 1, LineItemID: 1, CampaignID: 1, PublisherID: 1}}}
+	testDB.BuildIndexes()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	rec := &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = rec
+	srv.DB = testDB
+	srv.AdDataStore = store
+	srv.Store = &db.RedisStore{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), Ctx: context.Background()}
+	srv.TokenTTL = time.Hour
+
+	tok, err := token.Generate("req-1", "imp-1", "1", "1", "1", "", "1", srv.TokenSecret)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	send := func(evType string) int {
+		w := httptest.NewRecorder()
+		srv.EventHandler(w, httptest.NewRequest(http.MethodGet, "/event?t="+url.QueryEscape(tok)+"&type="+evType, nil))
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := send("video_complete"); code != http.StatusOK {
+			t.Fatalf("video_complete %d: expected 200, got %d", i, code)
+		}
+		if code := send("add_to_cart"); code != http.StatusOK {
+			t.Fatalf("add_to_cart %d: expected 200, got %d", i, code)
+		}
+	}
+	// Billable events are deduplicated even without dedupe.
+	want := []string{"video_complete", "billable:add_to_cart"}
+	if len(rec.events) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, rec.events)
+	}
+	for i := range want {
+		if rec.events[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, rec.events)
+		}
+	}
+
+	today := time.Now().Format("2006-01-02")
+	if n, _ := mr.Get("event:video_complete:lineitem:1:" + today); n != "1" {
+		t.Fatalf("expected deduplicated count 1, got %q", n)
+	}
+
+	// Default event types don't apply once the publisher defines its own.
+	if code := send("like"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for undefined event type, got %d", code)
+	}
+}
+
+func TestEventHandler_InvalidEventsDontUseDedupe(t *testing.T) {
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "Test", APIKey: "k"}})
+	testDB := &db.DB{Creatives: []models.Creative{{ID: 1, LineItemID: 1, CampaignID: 1, PublisherID: 1}}}
+	testDB.BuildIndexes()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	rec := &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv := newTestServer()
+	srv.Analytics = rec
+	srv.DB = testDB
+	srv.AdDataStore = store
+	srv.Store = &db.RedisStore{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), Ctx: context.Background()}
+	srv.IVT = ivt.NewDetector(nil, nil, ivt.Config{}, nil)
+	srv.TokenTTL = time.Hour
+
+	tok, err := token.Generate("req-1", "imp-1", "1", "1", "1", "", "1", srv.TokenSecret)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	send := func(ua string) {
+		req := httptest.NewRequest(http.MethodGet, "/event?t="+url.QueryEscape(tok)+"&type=video_start", nil)
+		req.Header.Set("User-Agent", ua)
+		srv.EventHandler(httptest.NewRecorder(), req)
+	}
+	send("Googlebot/2.1 (+http://www.google.com/bot.html)")
+	send("Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+	send("Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+	if len(rec.events) != 2 {
+		t.Fatalf("expected the bot event and one valid event, got %v", rec.events)
+	}
+}
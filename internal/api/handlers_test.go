@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/ivt"
 	"github.com/patrickwarner/openadserve/internal/logic/selectors"
 	"github.com/patrickwarner/openadserve/internal/observability"
 	"github.com/patrickwarner/openadserve/internal/token"
@@ -50,3 +51,50 @@ func TestImpressionHandler_ExpiredToken(t *testing.T) {
 		t.Fatalf("expected 401, got %d", rec.Code)
 	}
 }
+
+func TestPrivacyHandlers_NoPostgres(t *testing.T) {
+	srv := newTestServer()
+
+	rec := httptest.NewRecorder()
+	srv.DeleteUserData(rec, httptest.NewRequest(http.MethodDelete, "/api/privacy/users/u1", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.GetPrivacyJob(rec, httptest.NewRequest(http.MethodGet, "/api/privacy/jobs/1", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+}
+
+func TestStoredIP(t *testing.T) {
+	srv := newTestServer()
+	if got := srv.storedIP("203.0.113.57"); got != "203.0.113.57" {
+		t.Fatalf("expected full IP without anonymization, got %q", got)
+	}
+	srv.Config.IPAnonymization = true
+	if got := srv.storedIP("203.0.113.57"); got != "203.0.113.0" {
+		t.Fatalf("expected truncated client IP, got %q", got)
+	}
+}
+
+func TestTrackingIVTReason(t *testing.T) {
+	srv := newTestServer()
+	srv.IVT = ivt.NewDetector(nil, nil, ivt.Config{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/impression", nil)
+	req.Header.Set("User-Agent", "Googlebot/2.1 (+http://www.google.com/bot.html)")
+	if got := srv.trackingIVTReason(req, "impression", "tok", "u1", "r", "1", "7", "", false); got != ivt.ReasonBot {
+		t.Fatalf("expected bot reason, got %q", got)
+	}
+
+	// A reason from the ad request carries over to its tracking events.
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+	if got := srv.trackingIVTReason(req, "click", "tok", "u1", "r", "1", "7", ivt.ReasonIPVelocity, false); got != ivt.ReasonIPVelocity {
+		t.Fatalf("expected token reason, got %q", got)
+	}
+	if got := srv.trackingIVTReason(req, "click", "tok", "u1", "r", "1", "7", "", false); got != "" {
+		t.Fatalf("expected valid traffic, got %q", got)
+	}
+}
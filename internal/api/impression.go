@@ -6,7 +6,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/patrickwarner/openadserve/internal/conversion"
 	"github.com/patrickwarner/openadserve/internal/logic"
+	"github.com/patrickwarner/openadserve/internal/macros"
 	"github.com/patrickwarner/openadserve/internal/middleware"
 	"github.com/patrickwarner/openadserve/internal/models"
 	"github.com/patrickwarner/openadserve/internal/observability"
@@ -79,13 +81,21 @@ func (s *Server) ImpressionHandler(w http.ResponseWriter, r *http.Request) {
 		logger.Info("impression", zap.String("request_id", payload.RequestID), zap.String("user_id", ""), zap.String("event_type", "impression"))
 	}
 
+	// Invalid impressions are recorded but excluded from spend, pacing and CTR
+	ivtReason := s.trackingIVTReason(r, "impression", tok, payload.UserID, payload.RequestID, payload.ImpID, payload.CrID, payload.Context.IVTReason, payload.Context.COPPA)
+	span.SetAttributes(attribute.String("ivt_reason", ivtReason))
+
 	var pubID int
 	var lineItemID int
+	var creative *models.Creative
 	if id, err := strconv.Atoi(payload.CrID); err == nil {
 		if cr := s.DB.FindCreativeByID(id); cr != nil {
+			creative = cr
 			pubID = cr.PublisherID
 			lineItemID = cr.LineItemID
-			_ = s.Store.IncrementCTRImpression(cr.LineItemID)
+			if ivtReason == "" {
+				_ = s.Store.IncrementCTRImpression(cr.LineItemID)
+			}
 		}
 	}
 
@@ -104,20 +114,34 @@ func (s *Server) ImpressionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Increment impression counter for billing
-	if lineItemID > 0 {
+	// Increment impression counter for billing; vCPM line items count viewable
+	// impressions in ViewableHandler instead
+	if lineItemID > 0 && ivtReason == "" && !s.isVCPM(lineItemID) {
 		if err := logic.IncrementLineItemImpressions(s.Store, lineItemID); err != nil {
 			logger.Error("failed to increment impression counter", zap.Error(err), zap.Int("line_item_id", lineItemID))
 			// Don't fail the request - impression has already been recorded
 		}
 	}
 
+	// Count measurable impressions towards the placement's viewability rate
+	if payload.PlacementID != "" && ivtReason == "" && s.Config.ViewabilityMode != ViewabilityOff {
+		if err := s.Store.IncrementViewabilityImpression(payload.PlacementID, s.Config.ViewabilityRateDays); err != nil {
+			logger.Error("failed to increment viewability counter", zap.Error(err), zap.String("placement_id", payload.PlacementID))
+		}
+	}
+
+	// Drop the user ID if the user's data was deleted after the token was issued
+	userID := s.trackedUserID(ctx, payload.UserID, payload.IssuedAt)
+
 	// Increment frequency cap counter for impression
-	if lineItemID > 0 && payload.UserID != "" {
-		if err := logic.IncrementFrequencyCap(s.Store, payload.UserID, pubID, lineItemID, s.AdDataStore); err != nil {
+	if lineItemID > 0 && userID != "" {
+		if err := logic.IncrementFrequencyCap(s.Store, userID, pubID, lineItemID, s.AdDataStore); err != nil {
 			logger.Error("failed to increment frequency cap counter", zap.Error(err), zap.Int("line_item_id", lineItemID))
 			// Don't fail the request - impression has already been recorded
 		}
+		if err := logic.IncrementCreativeFrequencyCap(s.Store, userID, creative); err != nil {
+			logger.Error("failed to increment creative frequency cap counter", zap.Error(err), zap.Int("creative_id", creative.ID))
+		}
 	}
 
 	// Get publisher ID from token or fallback to creative lookup
@@ -129,10 +153,21 @@ func (s *Server) ImpressionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Resolve device type and country from request headers/IP
-	deviceType, country := logic.ResolveTargetingFromRequest(r, s.GeoIP)
+	deviceType, country := logic.ResolveTargetingFromRequest(r, s.ClientIP.FromRequest(r), s.GeoIP)
+	targetingCtx := models.TargetingContext{
+		DeviceType: deviceType,
+		Country:    country,
+		UserID:     userID,
+		Privacy:    models.PrivacyContext{Status: payload.Context.ConsentStatus},
+		Domain:     payload.Context.Domain,
+		AppBundle:  payload.Context.AppBundle,
+		PagePath:   payload.Context.PagePath,
+		Categories: payload.Context.Categories,
+		IVTReason:  ivtReason,
+	}
 
 	// Record the impression in ClickHouse for analytics.
-	if err := s.Analytics.RecordImpression(ctx, s.AdDataStore, payload.RequestID, payload.ImpID, payload.CrID, lineItemID, deviceType, country, publisherID, payload.PlacementID); err != nil {
+	if err := s.Analytics.RecordImpression(ctx, s.AdDataStore, payload.RequestID, payload.ImpID, payload.CrID, lineItemID, targetingCtx, publisherID, payload.PlacementID); err != nil {
 		logger.Error("analytics record", zap.Error(err))
 		s.Metrics.IncrementImpressions("500")
 		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
@@ -141,6 +176,40 @@ func (s *Server) ImpressionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	s.Metrics.IncrementEvent("impression")
 
+	// Fire the third-party impression trackers not returned in the markup
+	if ivtReason == "" {
+		mctx := macros.NewClickContextFromRequest(payload.RequestID, payload.ImpID, creative, payload.CustomParams)
+		mctx.PublisherID = int32(publisherID)
+		mctx.PlacementID = payload.PlacementID
+		mctx.Price = payload.BidPrice
+		s.fireThirdPartyTrackers(r, creative, payload.PlacementID, false, mctx)
+	}
+
+	// Remember the impression for post-view conversion attribution
+	if ivtReason == "" && s.Conversions != nil {
+		err := s.Conversions.RecordView(ctx, conversion.Touch{
+			RequestID:   payload.RequestID,
+			ImpID:       payload.ImpID,
+			CreativeID:  creative.ID,
+			LineItemID:  lineItemID,
+			CampaignID:  creative.CampaignID,
+			PublisherID: publisherID,
+			PlacementID: payload.PlacementID,
+			UserID:      userID,
+			DeviceType:  deviceType,
+			Country:     country,
+			Consent:     payload.Context.ConsentStatus,
+			Domain:      payload.Context.Domain,
+			AppBundle:   payload.Context.AppBundle,
+			PagePath:    payload.Context.PagePath,
+			Categories:  payload.Context.Categories,
+			Time:        time.Now(),
+		})
+		if err != nil {
+			logger.Error("record view for conversions", zap.Error(err))
+		}
+	}
+
 	s.Metrics.IncrementImpressions("200")
 	s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
 	w.Header().Set("Content-Type", "image/gif")
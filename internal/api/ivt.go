@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/patrickwarner/openadserve/internal/logic"
+)
+
+// trackingIVTReason classifies an impression, click or custom event request
+// as invalid traffic. The detector always runs so impression times and token
+// use are recorded, but a reason carried in the token from the ad request
+// takes precedence. The IPs of child-directed requests aren't stored.
+func (s *Server) trackingIVTReason(r *http.Request, eventType, tok, userID, requestID, impID, creativeID, tokenReason string, childDirected bool) string {
+	ip := s.ClientIP.FromRequest(r)
+	isBot := logic.ResolveTargetingFromUA(r.Header.Get("User-Agent")).IsBot
+
+	var reason string
+	switch eventType {
+	case "impression":
+		reason = s.IVT.CheckImpression(r.Context(), tok, ip, requestID, impID, creativeID, isBot, childDirected)
+	case "click":
+		reason = s.IVT.CheckClick(r.Context(), tok, ip, userID, requestID, impID, creativeID, isBot, childDirected)
+	default:
+		reason = s.IVT.CheckEvent(r.Context(), tok, ip, isBot, childDirected)
+	}
+	if tokenReason != "" {
+		return tokenReason
+	}
+	return reason
+}
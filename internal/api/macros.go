@@ -0,0 +1,34 @@
+package api
+
+import (
+	"time"
+
+	"github.com/patrickwarner/openadserve/internal/macros"
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// expandAdMarkup expands macros in the markup of an ad at serve time, with
+// the same macros as click URLs. HTML markup, which includes composed
+// banners, is expanded with HTML encoding and native assets and responses as
+// JSON. VAST documents are left alone.
+func (s *Server) expandAdMarkup(adm string, ad *models.AdResponse, req *models.OpenRTBRequest, placementID string) (string, error) {
+	if s.MacroService == nil || ad.Video != nil || adm == "" {
+		return adm, nil
+	}
+	mctx := &macros.ClickContext{
+		RequestID:    req.ID,
+		ImpressionID: req.Imp[0].ID,
+		Timestamp:    time.Now(),
+		CreativeID:   int32(ad.CreativeID),
+		LineItemID:   int32(ad.LineItemID),
+		CampaignID:   int32(ad.CampaignID),
+		PublisherID:  int32(req.Ext.PublisherID),
+		PlacementID:  placementID,
+		Price:        ad.Price,
+		CustomParams: req.Ext.CustomParams,
+	}
+	if ad.NativeAd != nil || len(ad.Native) > 0 || len(ad.Banner) > 0 {
+		return s.MacroService.ExpandJSON(adm, mctx)
+	}
+	return s.MacroService.ExpandHTML(adm, mctx)
+}
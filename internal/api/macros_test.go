@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/macros"
+	"github.com/patrickwarner/openadserve/internal/models"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestGetAdHandler_MarkupMacros(t *testing.T) {
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "p1", APIKey: "key1"}})
+	_ = store.SetPlacements([]models.Placement{{ID: "header", PublisherID: 1, Width: 320, Height: 50, Formats: []string{"html", "native"}}})
+
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv.AdDataStore = store
+	srv.DB = &db.DB{}
+	srv.MacroService = macros.NewServiceForTesting(srv.Logger)
+
+	serve := func(ad *models.AdResponse) string {
+		t.Helper()
+		var gotCtx models.TargetingContext
+		srv.SelectorMap[0] = ctxSelector{ctx: &gotCtx, response: ad}
+		body, _ := json.Marshal(models.OpenRTBRequest{
+			ID:   "req-1",
+			Imp:  []models.Impression{{ID: "1", TagID: "header"}},
+			User: models.User{ID: "u1"},
+			Ext:  models.RequestExt{PublisherID: 1, CustomParams: map[string]string{"section": "news & sport"}},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/ad", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", "key1")
+		w := httptest.NewRecorder()
+		srv.GetAdHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		var resp models.OpenRTBResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.SeatBid[0].Bid[0].Adm
+	}
+
+	adm := serve(&models.AdResponse{CreativeID: 7, CampaignID: 2, LineItemID: 3, Price: 1.5,
+		HTML: `<p>{CUSTOM.section}</p><img src="https://t.example/px?cr={CREATIVE_ID}&s={CUSTOM.section}&p=${AUCTION_PRICE}">`})
+	if want := `<p>news &amp; sport</p><img src="https://t.example/px?cr=7&s=news+%26+sport&p=1.5">`; adm != want {
+		t.Errorf("unexpected html markup\ngot  %s\nwant %s", adm, want)
+	}
+
+	adm = serve(&models.AdResponse{CreativeID: 8, CampaignID: 2, LineItemID: 3,
+		Native: json.RawMessage(`{"title":"Today in {CUSTOM.section}","pixel":"https://t.example/px?r={AUCTION_ID}"}`)})
+	if want := `{"pixel":"https://t.example/px?r=req-1","title":"Today in news & sport"}`; adm != want {
+		t.Errorf("unexpected native markup\ngot  %s\nwant %s", adm, want)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// adTrackingURLs are the absolute URLs our impressions, clicks and viewable
+// impressions are recorded at.
+type adTrackingURLs struct {
+	Impression string
+	Click      string
+	Viewable   string
+}
+
+// signedTrackingURLs returns the tracking URLs of our endpoints for a token.
+func (s *Server) signedTrackingURLs(r *http.Request, tok string) adTrackingURLs {
+	base := s.publicBaseURL(r)
+	q := url.QueryEscape(tok)
+	return adTrackingURLs{
+		Impression: base + "/impression?t=" + q,
+		Click:      base + "/click?t=" + q,
+		Viewable:   base + "/viewable?t=" + q,
+	}
+}
+
+// nativeAdMarkup renders a native ad as an OpenRTB Native 1.2 response whose
+// link and trackers point at the tracking URLs. The impression URL is an
+// event tracker when the native request accepts image trackers for
+// impressions and an imptracker otherwise, so it is fired only once; the
+// viewable URL needs an image tracker for viewability. Responses from
+// programmatic bids keep their own link and trackers, so our click URL is
+// added as a click tracker. Third-party impression and click trackers follow
+// ours.
+func (s *Server) nativeAdMarkup(ad *models.NativeResponse, urls adTrackingURLs, req *models.NativeRequest, impTrackers, clickTrackers []string) (string, error) {
+	impURL := urls.Impression
+	click := urls.Click
+
+	out := *ad
+	out.Ver = models.NativeVersion
+	var events []models.NativeEventTracker
+	if req.Tracks(models.NativeEventImpression) {
+		for _, u := range append([]string{impURL}, impTrackers...) {
+			events = append(events, models.NativeEventTracker{Event: models.NativeEventImpression, Method: models.NativeMethodImage, URL: u})
+		}
+	} else {
+		out.ImpTrackers = append(append([]string{impURL}, impTrackers...), ad.ImpTrackers...)
+	}
+	if s.Config.ViewabilityMode != ViewabilityOff && req.Tracks(models.NativeEventViewableMRC50) {
+		events = append(events, models.NativeEventTracker{Event: models.NativeEventViewableMRC50, Method: models.NativeMethodImage, URL: urls.Viewable})
+	}
+	out.EventTrackers = append(events, ad.EventTrackers...)
+	if ad.Link.URL == "" {
+		// The click endpoint redirects to the landing page
+		out.Link = models.NativeLink{URL: click, ClickTrackers: clickTrackers}
+	} else {
+		out.Link.ClickTrackers = append(append([]string{click}, clickTrackers...), ad.Link.ClickTrackers...)
+	}
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
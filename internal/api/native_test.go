@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/models"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func testNativeRequest() *models.NativeRequest {
+	return &models.NativeRequest{
+		Assets: []models.NativeAssetRequest{
+			{ID: 1, Required: 1, Title: &models.NativeTitleRequest{Len: 25}},
+			{ID: 2, Required: 1, Img: &models.NativeImageRequest{Type: 3, WMin: 600, HMin: 300}},
+			{ID: 3, Data: &models.NativeDataRequest{Type: 12, Len: 15}},
+		},
+		EventTrackers: []models.NativeEventTrackerRequest{
+			{Event: models.NativeEventImpression, Methods: []int{models.NativeMethodImage}},
+			{Event: models.NativeEventViewableMRC50, Methods: []int{2}},
+		},
+	}
+}
+
+func TestGetAdHandler_NativeResponse(t *testing.T) {
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "p1", APIKey: "key1"}})
+	_ = store.SetPlacements([]models.Placement{{ID: "feed", PublisherID: 1, Formats: []string{"native"}, Native: testNativeRequest()}})
+
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv.AdDataStore = store
+	srv.DB = &db.DB{}
+
+	serve := func(ad *models.NativeResponse) models.NativeResponse {
+		t.Helper()
+		var gotCtx models.TargetingContext
+		srv.SelectorMap[0] = ctxSelector{ctx: &gotCtx, response: &models.AdResponse{CreativeID: 7, CampaignID: 2, LineItemID: 3, NativeAd: ad, Price: 4}}
+		body, _ := json.Marshal(models.OpenRTBRequest{
+			ID:   "req-1",
+			Imp:  []models.Impression{{ID: "1", TagID: "feed"}},
+			User: models.User{ID: "u1"},
+			Ext:  models.RequestExt{PublisherID: 1},
+		})
+		req := httptest.NewRequest(http.MethodPost, "http://ads.example.com/ad", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", "key1")
+		w := httptest.NewRecorder()
+		srv.GetAdHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		if gotCtx.Native == nil || len(gotCtx.Native.Assets) != 3 {
+			t.Fatalf("expected the placement's native request in the targeting context, got %+v", gotCtx.Native)
+		}
+		var resp models.OpenRTBResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var native models.NativeResponse
+		if err := json.Unmarshal([]byte(resp.SeatBid[0].Bid[0].Adm), &native); err != nil {
+			t.Fatalf("adm is not a native response: %v", err)
+		}
+		return native
+	}
+
+	// Direct creatives link to our click redirect
+	native := serve(&models.NativeResponse{Assets: []models.NativeAsset{{ID: 1, Title: &models.NativeTitle{Text: "Hello"}}}})
+	if native.Ver != "1.2" || len(native.Assets) != 1 || native.Assets[0].Title.Text != "Hello" {
+		t.Fatalf("unexpected assets %+v", native)
+	}
+	if !strings.HasPrefix(native.Link.URL, "http://ads.example.com/click?t=") || len(native.Link.ClickTrackers) != 0 {
+		t.Errorf("unexpected link %+v", native.Link)
+	}
+	// The impression is tracked once, as an event tracker; viewability only
+	// accepts JS trackers in this request
+	if len(native.ImpTrackers) != 0 || len(native.EventTrackers) != 1 || native.EventTrackers[0].Event != models.NativeEventImpression ||
+		native.EventTrackers[0].Method != models.NativeMethodImage || !strings.HasPrefix(native.EventTrackers[0].URL, "http://ads.example.com/impression?t=") {
+		t.Errorf("unexpected trackers %v %+v", native.ImpTrackers, native.EventTrackers)
+	}
+
+	// Programmatic responses keep their link and trackers
+	native = serve(&models.NativeResponse{
+		Link:        models.NativeLink{URL: "https://brand.example", ClickTrackers: []string{"https://dsp.example/click"}},
+		ImpTrackers: []string{"https://dsp.example/imp"},
+	})
+	if native.Link.URL != "https://brand.example" || len(native.Link.ClickTrackers) != 2 ||
+		!strings.HasPrefix(native.Link.ClickTrackers[0], "http://ads.example.com/click?t=") {
+		t.Errorf("unexpected link %+v", native.Link)
+	}
+	if len(native.ImpTrackers) != 1 || native.ImpTrackers[0] != "https://dsp.example/imp" || len(native.EventTrackers) != 1 {
+		t.Errorf("unexpected trackers %v %+v", native.ImpTrackers, native.EventTrackers)
+	}
+
+	// Without image event trackers the impression URL is an imptracker
+	_ = store.UpdatePlacement(models.Placement{ID: "feed", PublisherID: 1, Formats: []string{"native"},
+		Native: &models.NativeRequest{Assets: testNativeRequest().Assets}})
+	native = serve(&models.NativeResponse{})
+	if len(native.ImpTrackers) != 1 || !strings.HasPrefix(native.ImpTrackers[0], "http://ads.example.com/impression?t=") || len(native.EventTrackers) != 0 {
+		t.Errorf("unexpected trackers %v %+v", native.ImpTrackers, native.EventTrackers)
+	}
+}
+
+func TestValidateNative(t *testing.T) {
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPlacements([]models.Placement{{ID: "feed", PublisherID: 1, Formats: []string{"native"}, Native: testNativeRequest()}})
+	_ = store.SetLineItems([]models.LineItem{
+		{ID: 1, PublisherID: 1, Type: models.LineItemTypeDirect},
+		{ID: 2, PublisherID: 1, Type: models.LineItemTypeProgrammatic, Endpoint: "https://dsp.example/bid"},
+	})
+	srv := newTestServer()
+	srv.AdDataStore = store
+
+	assets := json.RawMessage(`{"title":"Hello","images":[{"type":3,"url":"https://cdn.example/a.jpg","w":1200,"h":627}]}`)
+	valid := models.Creative{PlacementID: "feed", LineItemID: 1, Format: "native", Native: assets, ClickURL: "https://brand.example"}
+	if err := srv.validateNative(valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := srv.validateNative(models.Creative{PlacementID: "feed", LineItemID: 2, Format: "native"}); err != nil {
+		t.Errorf("programmatic creatives may leave out assets: %v", err)
+	}
+
+	small := valid
+	small.Native = json.RawMessage(`{"title":"Hello","images":[{"type":3,"url":"https://cdn.example/a.jpg","w":300,"h":250}]}`)
+	noClick := valid
+	noClick.ClickURL = ""
+	for name, c := range map[string]models.Creative{"image too small": small, "no click url": noClick} {
+		if err := srv.validateNative(c); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
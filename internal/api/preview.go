@@ -0,0 +1,328 @@
+package api
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/patrickwarner/openadserve/internal/logic/selectors"
+	"github.com/patrickwarner/openadserve/internal/macros"
+	"github.com/patrickwarner/openadserve/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// previewRequestID is the sample auction ID macros are expanded with in
+// previews.
+const previewRequestID = "preview"
+
+// CreativePreview is the JSON form of a preview: the markup the creative
+// would be served with and the no-op click URL it reports clicks to.
+type CreativePreview struct {
+	CreativeID  int    `json:"creative_id"`
+	PlacementID string `json:"placement_id,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Adm         string `json:"adm"`
+	ClickURL    string `json:"click_url"`
+}
+
+// PreviewCreative renders a creative as it would be served in a placement,
+// given by the placement query parameter or the creative's own, so that it
+// can be checked before trafficking. Macros are expanded with sample values,
+// extended by custom.<key> query parameters, and our tracking URLs point at
+// preview endpoints that record nothing. Third-party trackers are left out.
+// The response is an HTML page with native ads drawn with the SDK's default
+// native template, or the CreativePreview JSON with format=json.
+func (s *Server) PreviewCreative(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var creative *models.Creative
+	if s.DB != nil {
+		creative = s.DB.FindCreativeByID(id)
+	}
+	if creative == nil {
+		http.Error(w, "creative not found", http.StatusNotFound)
+		return
+	}
+	c := *creative
+	if li := models.GetLineItemByID(s.AdDataStore, c.LineItemID); li != nil {
+		c.LineItem = li
+	}
+	if c.LineItem != nil && c.LineItem.Type == models.LineItemTypeProgrammatic {
+		http.Error(w, "programmatic creatives are rendered from bids and can't be previewed", http.StatusBadRequest)
+		return
+	}
+	if c.Video != nil && c.Video.VASTTagURL != "" {
+		http.Error(w, "creatives served from a VAST tag can't be previewed", http.StatusBadRequest)
+		return
+	}
+
+	placementID := r.URL.Query().Get("placement")
+	if placementID == "" {
+		placementID = c.PlacementID
+	}
+	var pl *models.Placement
+	if placementID != "" && s.AdDataStore != nil {
+		pl = s.AdDataStore.GetPlacement(placementID)
+	}
+	if pl == nil && r.URL.Query().Get("placement") != "" {
+		http.Error(w, "placement not found", http.StatusNotFound)
+		return
+	}
+	var targetingCtx models.TargetingContext
+	if pl != nil {
+		targetingCtx.Native = pl.Native
+		targetingCtx.Video = pl.Video
+	}
+	ad, err := selectors.BuildPreviewResponse(c, targetingCtx)
+	if err != nil {
+		http.Error(w, "creative template failed to render: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if c.Format == models.FormatNative && targetingCtx.Native != nil && ad.NativeAd == nil {
+		http.Error(w, "creative doesn't fill the placement's native request", http.StatusBadRequest)
+		return
+	}
+	if ad.Width == 0 && pl != nil {
+		ad.Width, ad.Height = pl.Width, pl.Height
+	}
+
+	// The preview click endpoint expands the landing page's macros with the
+	// same placement and custom parameters
+	clickQuery := url.Values{}
+	if placementID != "" {
+		clickQuery.Set("placement", placementID)
+	}
+	for k, v := range previewCustomParams(r) {
+		clickQuery.Set("custom."+k, v)
+	}
+	base := s.publicBaseURL(r)
+	pixel := base + "/api/preview/pixel"
+	urls := adTrackingURLs{
+		Impression: pixel,
+		Click:      base + "/api/creatives/" + strconv.Itoa(c.ID) + "/preview/click",
+		Viewable:   pixel,
+	}
+	if len(clickQuery) > 0 {
+		urls.Click += "?" + clickQuery.Encode()
+	}
+
+	adm := ad.HTML
+	if len(ad.Native) > 0 {
+		adm = string(ad.Native)
+	}
+	if ad.NativeAd != nil {
+		adm, err = s.nativeAdMarkup(ad.NativeAd, urls, targetingCtx.Native, nil, nil)
+		if err != nil {
+			s.Logger.Error("failed to build native preview", zap.Error(err), zap.Int("creative_id", c.ID))
+			http.Error(w, "internal server error (native)", http.StatusInternalServerError)
+			return
+		}
+	}
+	req := &models.OpenRTBRequest{
+		ID:  previewRequestID,
+		Imp: []models.Impression{{ID: "1", TagID: placementID}},
+		Ext: models.RequestExt{PublisherID: c.PublisherID, CustomParams: previewCustomParams(r)},
+	}
+	if expanded, err := s.expandAdMarkup(adm, ad, req, placementID); err != nil {
+		s.Logger.Warn("failed to expand macros in preview", zap.Error(err), zap.Int("creative_id", c.ID))
+	} else {
+		adm = expanded
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "json" {
+		writeJSON(w, CreativePreview{CreativeID: c.ID, PlacementID: placementID, Format: c.Format,
+			Width: ad.Width, Height: ad.Height, Adm: adm, ClickURL: urls.Click})
+		return
+	}
+
+	page := previewPage{CreativeID: c.ID, PlacementID: placementID, Width: ad.Width, Height: ad.Height, ClickURL: urls.Click}
+	switch {
+	case ad.NativeAd != nil:
+		page.Native = nativePreviewFromResponse(adm)
+	case c.Format == models.FormatNative && c.Template != nil:
+		// The SDK shows the rendered template instead of its default layout
+		page.Markup = nativePreviewFromAssets(adm, urls.Click).HTML
+	case c.Format == models.FormatNative:
+		page.Native = nativePreviewFromAssets(adm, urls.Click)
+	case ad.Video != nil:
+		page.Video = ad.Video.MediaFiles
+	default:
+		page.Markup = adm
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := previewTemplate.Execute(w, page); err != nil {
+		s.Logger.Error("render preview", zap.Error(err))
+	}
+}
+
+// PreviewClick stands in for the click endpoint in previews: it redirects
+// to the creative's landing page without recording a click.
+func (s *Server) PreviewClick(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var creative *models.Creative
+	if s.DB != nil {
+		creative = s.DB.FindCreativeByID(id)
+	}
+	if creative == nil {
+		http.Error(w, "creative not found", http.StatusNotFound)
+		return
+	}
+	c := *creative
+	if li := models.GetLineItemByID(s.AdDataStore, c.LineItemID); li != nil {
+		c.LineItem = li
+	}
+	destination := ""
+	if s.MacroService != nil {
+		placementID := r.URL.Query().Get("placement")
+		if placementID == "" {
+			placementID = c.PlacementID
+		}
+		clickCtx := macros.NewClickContextFromRequest(previewRequestID, "1", &c, previewCustomParams(r))
+		clickCtx.PlacementID = placementID
+		clickCtx.ClickID = previewRequestID
+		destination, _ = s.MacroService.GetDestinationURL(r.Context(), &c, clickCtx)
+	}
+	if u, err := url.Parse(destination); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		http.Redirect(w, r, destination, http.StatusFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.sendPixelResponse(w)
+}
+
+// PreviewPixel stands in for the impression and viewability endpoints in
+// previews.
+func (s *Server) PreviewPixel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	s.sendPixelResponse(w)
+}
+
+// previewCustomParams returns the custom.<key> query parameters as the
+// custom parameters of the sample ad request.
+func previewCustomParams(r *http.Request) map[string]string {
+	params := map[string]string{}
+	for k, v := range r.URL.Query() {
+		if key, ok := strings.CutPrefix(k, "custom."); ok && key != "" && len(v) > 0 {
+			params[key] = v[0]
+		}
+	}
+	return params
+}
+
+// previewPage is the data of previewTemplate. Exactly one of Markup,
+// Native and Video is set.
+type previewPage struct {
+	CreativeID  int
+	PlacementID string
+	Width       int
+	Height      int
+	ClickURL    string
+	Markup      string
+	Native      *nativePreview
+	Video       []models.MediaFile
+}
+
+// nativePreview holds the assets the SDK's default native template shows.
+type nativePreview struct {
+	Title       string
+	Description string
+	Image       *nativePreviewImage
+	ClickURL    string
+	// HTML is the markup rendered from the creative's template, if any.
+	HTML string
+}
+
+type nativePreviewImage struct {
+	URL string `json:"url"`
+	W   int    `json:"w"`
+	H   int    `json:"h"`
+	Alt string `json:"alt"`
+}
+
+// nativePreviewFromAssets reads the raw native assets served to placements
+// without a native request. The SDK adds the click URL.
+func nativePreviewFromAssets(adm, clickURL string) *nativePreview {
+	var assets struct {
+		Title       string              `json:"title"`
+		Description string              `json:"description"`
+		Image       *nativePreviewImage `json:"image"`
+		HTML        string              `json:"html"`
+	}
+	_ = json.Unmarshal([]byte(adm), &assets)
+	return &nativePreview{Title: assets.Title, Description: assets.Description, Image: assets.Image, ClickURL: clickURL, HTML: assets.HTML}
+}
+
+// nativePreviewFromResponse reads the title, main image, description and
+// link of a native response.
+func nativePreviewFromResponse(adm string) *nativePreview {
+	resp, err := models.ParseNativeResponse(adm)
+	if err != nil {
+		return &nativePreview{}
+	}
+	out := &nativePreview{ClickURL: resp.Link.URL}
+	for _, a := range resp.Assets {
+		switch {
+		case a.Title != nil:
+			out.Title = a.Title.Text
+		case a.Img != nil && (out.Image == nil || a.Img.Type == 3):
+			out.Image = &nativePreviewImage{URL: a.Img.URL, W: a.Img.W, H: a.Img.H}
+		case a.Data != nil && a.Data.Type == 2:
+			out.Description = a.Data.Value
+		}
+	}
+	return out
+}
+
+// previewTemplate lays out a preview. Markup runs in a sandboxed frame
+// without access to our origin; native ads follow the SDK's default
+// template.
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Creative {{.CreativeID}} preview</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 24px; color: #333; }
+.preview-info { font-size: 0.875rem; color: #666; margin-bottom: 16px; }
+.preview-ad { display: inline-block; border: 1px dashed #ccc; }
+iframe { border: 0; display: block; }
+</style>
+</head>
+<body>
+<div class="preview-info">Creative {{.CreativeID}}{{if .PlacementID}} in placement {{.PlacementID}}{{end}}{{if .Width}} · {{.Width}}×{{.Height}}{{end}} · preview, impressions and clicks are not recorded</div>
+<div class="preview-ad">
+{{- if .Native}}{{with .Native}}
+<div class="native-ad">
+  <h2>{{if .Title}}{{.Title}}{{else}}Native Ad{{end}}</h2>
+  {{with .Image}}<img src="{{.URL}}" alt="{{if .Alt}}{{.Alt}}{{else}}{{$.Native.Title}}{{end}}"{{if .W}} width="{{.W}}"{{end}}{{if .H}} height="{{.H}}"{{end}}>{{end}}
+  <p>{{.Description}}</p>
+  {{if .ClickURL}}<a href="{{.ClickURL}}" target="_blank" rel="noopener">Learn More</a>{{end}}
+</div>
+{{- end}}{{else if .Video}}
+<video controls{{if .Width}} width="{{.Width}}" height="{{.Height}}"{{end}}>
+  {{range .Video}}<source src="{{.URL}}" type="{{.MIME}}">{{end}}
+</video>
+{{- else}}
+<iframe sandbox="allow-scripts allow-popups allow-popups-to-escape-sandbox" srcdoc="{{.Markup}}" width="{{if .Width}}{{.Width}}{{else}}300{{end}}" height="{{if .Height}}{{.Height}}{{else}}250{{end}}"></iframe>
+{{- end}}
+</div>
+{{if and .ClickURL (not .Native)}}<p><a href="{{.ClickURL}}" target="_blank" rel="noopener">Open landing page</a></p>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/macros"
+	"github.com/patrickwarner/openadserve/internal/models"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func newPreviewServer(t *testing.T, creatives ...models.Creative) (*Server, *mux.Router) {
+	t.Helper()
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "p1"}})
+	_ = store.SetPlacements([]models.Placement{
+		{ID: "mpu", PublisherID: 1, Width: 300, Height: 250, Formats: []string{"html", "banner"}},
+		{ID: "feed", PublisherID: 1, Formats: []string{"native"}, Native: testNativeRequest()},
+		{ID: "stream", PublisherID: 1, Formats: []string{"native"}},
+	})
+	_ = store.SetLineItems([]models.LineItem{{ID: 3, CampaignID: 2, PublisherID: 1, Active: true, CPM: 2.5, ECPM: 2.5,
+		ClickURL: "https://brand.example/landing?src={PLACEMENT_ID}&u={CUSTOM.utm}", ImpressionTrackers: []string{"https://li.example/i"}}})
+	testDB := &db.DB{Creatives: creatives}
+	testDB.BuildIndexes()
+
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.AdDataStore = store
+	srv.DB = testDB
+	srv.MacroService = macros.NewServiceForTesting(srv.Logger)
+	srv.Config.PublicBaseURL = "https://ads.example"
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/creatives/{id}/preview", srv.PreviewCreative).Methods("GET")
+	r.HandleFunc("/api/creatives/{id}/preview/click", srv.PreviewClick).Methods("GET")
+	return srv, r
+}
+
+func TestPreviewCreative_Banner(t *testing.T) {
+	_, r := newPreviewServer(t, models.Creative{ID: 7, LineItemID: 3, CampaignID: 2, PublisherID: 1, PlacementID: "mpu",
+		Format: "banner", Width: 300, Height: 250,
+		Banner: json.RawMessage(`{"image":"https://cdn.example/a.png?c={CREATIVE_ID}","images":[{"url":"https://cdn.example/a@2x.png","width":600,"height":500}]}`)})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/creatives/7/preview?format=json&custom.utm=mail", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	var preview CreativePreview
+	if err := json.NewDecoder(w.Body).Decode(&preview); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasPrefix(preview.Adm, `<img src="https://cdn.example/a.png?c=7"`) || !strings.Contains(preview.Adm, `srcset="https://cdn.example/a@2x.png 600w"`) {
+		t.Errorf("expected the composed banner with macros expanded, got %s", preview.Adm)
+	}
+	if strings.Contains(preview.Adm, "li.example") {
+		t.Errorf("third-party trackers must not be in previews, got %s", preview.Adm)
+	}
+	if preview.ClickURL != "https://ads.example/api/creatives/7/preview/click?custom.utm=mail&placement=mpu" || preview.Width != 300 {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/creatives/7/preview", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") || !strings.Contains(w.Body.String(), `<iframe sandbox="allow-scripts`) ||
+		!strings.Contains(w.Body.String(), "srcdoc=\"&lt;img src=&#34;https://cdn.example/a.png?c=7") {
+		t.Errorf("expected the markup in a sandboxed frame, got %s %s", ct, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(preview.ClickURL, "https://ads.example"), nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://brand.example/landing?src=mpu&u=mail" {
+		t.Errorf("expected a redirect to the landing page, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/creatives/7/preview?placement=missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown placement, got %d", w.Code)
+	}
+}
+
+func TestPreviewCreative_Native(t *testing.T) {
+	_, r := newPreviewServer(t, models.Creative{ID: 8, LineItemID: 3, CampaignID: 2, PublisherID: 1, Format: "native",
+		Native: json.RawMessage(`{"title":"Fresh <b>coffee</b>","images":[{"type":3,"url":"https://cdn.example/main.jpg","w":1200,"h":627}],"data":[{"type":12,"value":"Order now"}]}`)})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/creatives/8/preview?placement=feed&format=json", nil))
+	var preview CreativePreview
+	if err := json.NewDecoder(w.Body).Decode(&preview); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	native, err := models.ParseNativeResponse(preview.Adm)
+	if err != nil {
+		t.Fatalf("adm is not a native response: %v", err)
+	}
+	if native.Link.URL != preview.ClickURL || len(native.EventTrackers) != 1 || native.EventTrackers[0].URL != "https://ads.example/api/preview/pixel" {
+		t.Errorf("expected preview tracking URLs, got %+v", native)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/creatives/8/preview?placement=feed", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "<h2>Fresh &lt;b&gt;coffee&lt;/b&gt;</h2>") || !strings.Contains(body, `<img src="https://cdn.example/main.jpg"`) ||
+		!strings.Contains(body, ">Learn More</a>") {
+		t.Errorf("expected the native template, got %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/creatives/9/preview", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown creative, got %d", w.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/privacy"
+)
+
+// ===== Privacy =====
+
+// DeleteUserData starts a job removing every record tied to a user ID.
+func (s *Server) DeleteUserData(w http.ResponseWriter, r *http.Request) {
+	s.submitPrivacyJob(w, r, models.PrivacyJobDelete)
+}
+
+// ExportUserData starts a job collecting every record tied to a user ID. The
+// export is returned with the job once it completes.
+func (s *Server) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	s.submitPrivacyJob(w, r, models.PrivacyJobExport)
+}
+
+func (s *Server) submitPrivacyJob(w http.ResponseWriter, r *http.Request, jobType string) {
+	if s.PrivacyJobs == nil {
+		http.Error(w, "postgres unavailable", http.StatusInternalServerError)
+		return
+	}
+	userID := mux.Vars(r)["id"]
+	if userID == "" {
+		http.Error(w, "user id required", http.StatusBadRequest)
+		return
+	}
+	job, err := s.PrivacyJobs.Submit(jobType, userID)
+	if err != nil {
+		s.Logger.Error("submit privacy job", zap.String("type", jobType), zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/privacy/jobs/%d", job.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, job)
+}
+
+// GetPrivacyJob returns the status, audit trail and result of a privacy job.
+func (s *Server) GetPrivacyJob(w http.ResponseWriter, r *http.Request) {
+	if s.PrivacyJobs == nil {
+		http.Error(w, "postgres unavailable", http.StatusInternalServerError)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	job, err := s.PrivacyJobs.Get(id)
+	if err != nil {
+		s.Logger.Error("get privacy job", zap.Int("id", id), zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, job)
+}
+
+// storedIP returns the client IP in the form it may be stored or traced. When
+// IP anonymization is enabled the address is truncated; the full address is
+// only used for the geo lookup.
+func (s *Server) storedIP(ip string) string {
+	if !s.Config.IPAnonymization {
+		return ip
+	}
+	return privacy.AnonymizeIP(ip)
+}
+
+// trackedUserID returns the user ID carried by a tracking token, or "" when
+// the user's data was deleted after the token was issued.
+func (s *Server) trackedUserID(ctx context.Context, userID string, issuedAt time.Time) string {
+	if userID == "" || s.Store == nil {
+		return userID
+	}
+	if privacy.ErasedAfter(ctx, s.Store.Client, userID, issuedAt) {
+		return ""
+	}
+	return userID
+}
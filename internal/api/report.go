@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"strconv"
 	"time"
@@ -67,10 +66,15 @@ func (s *Server) ReportHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract IP address without port number
-	ipAddr := r.RemoteAddr
-	if host, _, err := net.SplitHostPort(ipAddr); err == nil {
-		ipAddr = host
+	ipAddr := s.ClientIP.FromRequest(r)
+
+	// Drop the user ID if the user's data was deleted after the token was issued
+	userID := s.trackedUserID(r.Context(), pl.UserID, pl.IssuedAt)
+	storedIP := s.storedIP(ipAddr)
+	if pl.Context.COPPA {
+		// Child-directed requests never store identifiers
+		userID = ""
+		storedIP = ""
 	}
 
 	// Get placement ID from the creative
@@ -85,10 +89,10 @@ func (s *Server) ReportHandler(w http.ResponseWriter, r *http.Request) {
 		LineItemID:   atoi(pl.LIID),
 		CampaignID:   atoi(pl.CID),
 		PublisherID:  publisherFromCreative(s.DB, pl.CrID),
-		UserID:       pl.UserID,
+		UserID:       userID,
 		PlacementID:  placementID,
 		ReportReason: req.Reason,
-		IPAddress:    ipAddr,
+		IPAddress:    storedIP,
 		UserAgent:    r.UserAgent(),
 		Status:       "pending",
 	}
@@ -109,13 +113,20 @@ func (s *Server) ReportHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Resolve device type and country from request headers/IP
-		deviceType, country := logic.ResolveTargetingFromRequest(r, s.GeoIP)
+		deviceType, country := logic.ResolveTargetingFromRequest(r, s.ClientIP.FromRequest(r), s.GeoIP)
 
 		// Create targeting context for report
 		targetingCtx := models.TargetingContext{
 			DeviceType: deviceType,
 			Country:    country,
 			KeyValues:  make(map[string]string), // Reports don't have key-values
+			UserID:     userID,
+			Privacy:    models.PrivacyContext{Status: pl.Context.ConsentStatus},
+			Domain:     pl.Context.Domain,
+			AppBundle:  pl.Context.AppBundle,
+			PagePath:   pl.Context.PagePath,
+			Categories: pl.Context.Categories,
+			IVTReason:  pl.Context.IVTReason,
 		}
 
 		_ = s.Analytics.RecordEvent(r.Context(), s.AdDataStore, "ad_report", pl.RequestID, pl.ImpID, pl.CrID, atoi(pl.LIID), 0, targetingCtx, publisherID, pl.PlacementID)
@@ -12,26 +12,38 @@ import (
 	"database/sql"
 
 	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/clientip"
 	"github.com/patrickwarner/openadserve/internal/config"
+	"github.com/patrickwarner/openadserve/internal/conversion"
 	"github.com/patrickwarner/openadserve/internal/db"
 	"github.com/patrickwarner/openadserve/internal/forecasting"
 	"github.com/patrickwarner/openadserve/internal/geoip"
+	"github.com/patrickwarner/openadserve/internal/ivt"
+	"github.com/patrickwarner/openadserve/internal/logic"
 	"github.com/patrickwarner/openadserve/internal/logic/selectors"
 	"github.com/patrickwarner/openadserve/internal/macros"
 	"github.com/patrickwarner/openadserve/internal/models"
 	"github.com/patrickwarner/openadserve/internal/observability"
+	"github.com/patrickwarner/openadserve/internal/privacy"
+	"github.com/patrickwarner/openadserve/internal/storage"
+	"github.com/patrickwarner/openadserve/internal/trackers"
 
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
 const (
 	defaultCTRDefault = 0.5
 	ctrWeightDefault  = 2.0
+	defaultCVRDefault = 0.01
+	cvrWeightDefault  = 100.0
 )
 
 var (
 	defaultCTR = defaultCTRDefault
 	ctrWeight  = ctrWeightDefault
+	defaultCVR = defaultCVRDefault
+	cvrWeight  = cvrWeightDefault
 )
 
 func init() {
@@ -45,6 +57,16 @@ func init() {
 			ctrWeight = f
 		}
 	}
+	if v := os.Getenv("DEFAULT_CVR"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			defaultCVR = f
+		}
+	}
+	if v := os.Getenv("CVR_WEIGHT"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cvrWeight = f
+		}
+	}
 }
 
 // Server groups dependencies for HTTP handlers.
@@ -66,6 +88,21 @@ type Server struct {
 	Config         config.Config
 	MacroService   *macros.Service
 	ForecastEngine *forecasting.Engine
+	PrivacyJobs    *privacy.JobRunner
+	// ClientIP resolves the end-user address behind proxies. A nil resolver
+	// uses the connection address only.
+	ClientIP *clientip.Resolver
+	// IVT flags invalid traffic. A nil detector treats all traffic as valid.
+	IVT *ivt.Detector
+	// Conversions attributes conversions to clicks and impressions. A nil
+	// tracker disables conversion tracking.
+	Conversions *conversion.Tracker
+	// Trackers fires third-party impression and click trackers from the
+	// server. A nil firer drops them.
+	Trackers *trackers.Firer
+	// Assets stores uploaded creative assets. A nil storage disables
+	// uploads.
+	Assets storage.Storage
 }
 
 // NewServer constructs a Server.
@@ -76,6 +113,93 @@ func NewServer(logger *zap.Logger, store *db.RedisStore, database *db.DB, pg *db
 		selector = rs
 	}
 
+	var privacyJobs *privacy.JobRunner
+	if pg != nil {
+		var rdb *redis.Client
+		if store != nil {
+			rdb = store.Client
+		}
+		// Remembered clicks and impressions carry the user ID for the
+		// attribution windows, which usually outlast the tokens
+		eraseTTL := max(ttl, cfg.ConversionPostClickWindow, cfg.ConversionPostViewWindow)
+		privacyJobs = privacy.NewJobRunner(rdb, pg, analytics, eraseTTL, cfg.PrivacyExportTTL, logger)
+	}
+
+	clientIP, err := clientip.New(cfg.TrustedProxies, clientip.Header(cfg.ClientIPHeader), clientip.DeviceIPPolicy(cfg.DeviceIPPolicy))
+	if err != nil && logger != nil {
+		logger.Warn("client ip configuration", zap.Error(err))
+	}
+
+	var detector *ivt.Detector
+	if cfg.IVTEnabled {
+		var rdb *redis.Client
+		if store != nil {
+			rdb = store.Client
+		}
+		var datacenters *ivt.IPList
+		if cfg.IVTDatacenterList != "" {
+			datacenters, err = ivt.LoadIPList(cfg.IVTDatacenterList)
+			if err != nil && logger != nil {
+				logger.Warn("ivt datacenter list", zap.Error(err))
+			}
+		}
+		detector = ivt.NewDetector(rdb, datacenters, ivt.Config{
+			IPRequestLimit:   cfg.IVTIPRequestLimit,
+			UserRequestLimit: cfg.IVTUserRequestLimit,
+			VelocityWindow:   cfg.IVTVelocityWindow,
+			MinClickDelay:    cfg.IVTMinClickDelay,
+			ClickIPLimit:     cfg.IVTClickIPLimit,
+			ClickUserLimit:   cfg.IVTClickUserLimit,
+			ClickWindow:      cfg.IVTClickWindow,
+			MaxTokenIPs:      cfg.IVTMaxTokenIPs,
+			TokenTTL:         ttl,
+			IPKey:            secret,
+			AnonymizeIPs:     cfg.IPAnonymization,
+		}, logger)
+	}
+
+	var conversions *conversion.Tracker
+	if store != nil && store.Client != nil {
+		conversions = conversion.NewTracker(store.Client, conversion.Config{
+			PostClickWindow:   cfg.ConversionPostClickWindow,
+			PostViewWindow:    cfg.ConversionPostViewWindow,
+			MaxOrdersPerTouch: cfg.ConversionMaxOrders,
+		}, logger)
+	}
+
+	macroService := macros.NewService(logger)
+	if err := macroService.ConfigurePriceEncryption(cfg.PriceEncryptionKey, cfg.PriceIntegrityKey); err != nil {
+		logger.Error("invalid price encryption keys, AUCTION_PRICE will not be expanded", zap.Error(err))
+	}
+
+	domainTimeouts, err := trackers.ParseDomainTimeouts(cfg.TrackerDomainTimeouts)
+	if err != nil && logger != nil {
+		logger.Warn("tracker domain timeouts", zap.Error(err))
+	}
+	firer := trackers.New(trackers.Config{
+		Workers:        cfg.TrackerWorkers,
+		QueueSize:      cfg.TrackerQueueSize,
+		Retries:        cfg.TrackerRetries,
+		RetryBackoff:   cfg.TrackerRetryBackoff,
+		Timeout:        cfg.TrackerTimeout,
+		DomainTimeouts: domainTimeouts,
+	}, logger)
+
+	assetStorage, err := storage.New(storage.Config{
+		Backend: cfg.AssetStorage,
+		Dir:     cfg.AssetDir,
+		S3: storage.S3Config{
+			Endpoint:  cfg.AssetS3Endpoint,
+			Bucket:    cfg.AssetS3Bucket,
+			Region:    cfg.AssetS3Region,
+			AccessKey: cfg.AssetS3AccessKey,
+			SecretKey: cfg.AssetS3SecretKey,
+		},
+	})
+	if err != nil && logger != nil {
+		logger.Warn("asset storage unavailable, uploads disabled", zap.Error(err))
+	}
+
 	return &Server{
 		Logger:       logger,
 		Store:        store,
@@ -91,7 +215,13 @@ func NewServer(logger *zap.Logger, store *db.RedisStore, database *db.DB, pg *db
 		AdDataStore:  adDataStore,
 		Metrics:      metrics,
 		Config:       cfg,
-		MacroService: macros.NewService(logger),
+		MacroService: macroService,
+		PrivacyJobs:  privacyJobs,
+		ClientIP:     clientIP,
+		IVT:          detector,
+		Conversions:  conversions,
+		Trackers:     firer,
+		Assets:       assetStorage,
 	}
 }
 
@@ -167,6 +297,7 @@ func (s *Server) Reload() error {
 	if err := s.AdDataStore.ReloadAll(items, campaigns, publishers, placements); err != nil {
 		return fmt.Errorf("reload ad data: %w", err)
 	}
+	logic.ResetGeofenceIndexes()
 
 	database, err := db.Init(s.PG, s.AdDataStore)
 	if err != nil {
@@ -179,7 +310,8 @@ func (s *Server) Reload() error {
 	return nil
 }
 
-// UpdateCTR recalculates CTR and eCPM for CPC line items.
+// UpdateCTR recalculates CTR and eCPM for CPC line items, and conversion rate
+// and eCPM for CPA line items.
 func (s *Server) UpdateCTR() {
 	if s.Store == nil || s.Store.Client == nil {
 		return
@@ -197,10 +329,15 @@ func (s *Server) UpdateCTR() {
 		}
 
 		for _, li := range lineItems {
-			imps, clicks := s.Store.GetCTRCounts(li.ID)
-			ctr := (float64(clicks) + defaultCTR*ctrWeight) / (float64(imps) + ctrWeight)
-			if li.BudgetType == models.BudgetTypeCPC {
+			switch li.BudgetType {
+			case models.BudgetTypeCPC:
+				imps, clicks := s.Store.GetCTRCounts(li.ID)
+				ctr := (float64(clicks) + defaultCTR*ctrWeight) / (float64(imps) + ctrWeight)
 				updates[li.ID] = li.CPC * ctr * 1000
+			case models.BudgetTypeCPA:
+				imps, convs := s.Store.GetCVRCounts(li.ID)
+				cvr := (float64(convs) + defaultCVR*cvrWeight) / (float64(imps) + cvrWeight)
+				updates[li.ID] = li.CPA * cvr * 1000
 			}
 		}
 	}
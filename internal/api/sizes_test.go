@@ -0,0 +1,64 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/models"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestGetAdHandler_BannerFormats(t *testing.T) {
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "p1", APIKey: "key1"}})
+	_ = store.SetPlacements([]models.Placement{{ID: "mpu", PublisherID: 1, Width: 300, Height: 250,
+		Sizes: []models.Format{{W: 336, H: 280}}, Formats: []string{"html"}}})
+
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv.AdDataStore = store
+	srv.DB = &db.DB{}
+	var gotCtx models.TargetingContext
+	srv.SelectorMap[0] = ctxSelector{ctx: &gotCtx, response: &models.AdResponse{CreativeID: 7, CampaignID: 2, LineItemID: 3, HTML: "<div>ad</div>", Width: 336, Height: 280, Price: 4}}
+
+	serve := func(formats ...models.Format) models.OpenRTBResponse {
+		t.Helper()
+		body, _ := json.Marshal(models.OpenRTBRequest{
+			ID:   "req-1",
+			Imp:  []models.Impression{{ID: "1", TagID: "mpu", Banner: &models.ImpBanner{Format: formats}}},
+			User: models.User{ID: "u1"},
+			Ext:  models.RequestExt{PublisherID: 1},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/ad", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", "key1")
+		w := httptest.NewRecorder()
+		srv.GetAdHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		var resp models.OpenRTBResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	resp := serve(models.Format{W: 728, H: 90}, models.Format{W: 336, H: 280})
+	if len(gotCtx.Sizes) != 1 || gotCtx.Sizes[0] != (models.Format{W: 336, H: 280}) {
+		t.Fatalf("expected only the accepted size to be requested, got %v", gotCtx.Sizes)
+	}
+	if bid := resp.SeatBid[0].Bid[0]; bid.W != 336 || bid.H != 280 {
+		t.Errorf("expected the winning size in the bid, got %dx%d", bid.W, bid.H)
+	}
+
+	if resp := serve(models.Format{W: 728, H: 90}); len(resp.SeatBid) != 0 || resp.Nbr != 2 {
+		t.Errorf("expected no bid for sizes the placement doesn't accept, got %+v", resp)
+	}
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"github.com/patrickwarner/openadserve/internal/logic/render"
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// ===== Creative Templates =====
+
+// ListTemplates returns the creative templates, optionally only those of
+// ?publisher_id.
+func (s *Server) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	if s.PG == nil {
+		http.Error(w, "postgres unavailable", http.StatusInternalServerError)
+		return
+	}
+	ts, err := s.PG.LoadTemplates()
+	if err != nil {
+		s.Logger.Error("load creative templates", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if raw := r.URL.Query().Get("publisher_id"); raw != "" {
+		pubID, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "invalid publisher_id", http.StatusBadRequest)
+			return
+		}
+		var out []models.CreativeTemplate
+		for _, t := range ts {
+			if t.PublisherID == pubID {
+				out = append(out, t)
+			}
+		}
+		ts = out
+	}
+	if ts == nil {
+		ts = []models.CreativeTemplate{}
+	}
+	writeJSON(w, ts)
+}
+
+func (s *Server) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	if s.PG == nil {
+		http.Error(w, "postgres unavailable", http.StatusInternalServerError)
+		return
+	}
+	var t models.CreativeTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if err := s.validateTemplate(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.PG.InsertTemplate(&t); err != nil {
+		s.Logger.Error("insert creative template", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	s.notifyUpdate("template", "create", t.ID)
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, t)
+}
+
+// UpdateTemplate replaces a template. Changes that would leave a creative
+// using the template invalid, such as removing a variable it sets or
+// changing the format, are refused with 409.
+func (s *Server) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	if s.PG == nil {
+		http.Error(w, "postgres unavailable", http.StatusInternalServerError)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var t models.CreativeTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	t.ID = id
+	if err := s.validateTemplate(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cs, err := s.PG.LoadCreatives()
+	if err != nil {
+		s.Logger.Error("load creatives", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	for _, c := range cs {
+		if c.TemplateID != id {
+			continue
+		}
+		if err := checkTemplateCreative(c, &t); err != nil {
+			http.Error(w, fmt.Sprintf("creative %d: %v", c.ID, err), http.StatusConflict)
+			return
+		}
+	}
+	if err := s.PG.UpdateTemplate(t); err != nil {
+		s.Logger.Error("update creative template", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	s.notifyUpdate("template", "update", id)
+	writeJSON(w, t)
+}
+
+// DeleteTemplate removes a template no creative uses.
+func (s *Server) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if s.PG == nil {
+		http.Error(w, "postgres unavailable", http.StatusInternalServerError)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	n, err := s.PG.CountTemplateCreatives(id)
+	if err != nil {
+		s.Logger.Error("count template creatives", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if n > 0 {
+		http.Error(w, fmt.Sprintf("template is used by %d creatives", n), http.StatusConflict)
+		return
+	}
+	if err := s.PG.DeleteTemplate(id); err != nil {
+		s.Logger.Error("delete creative template", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	render.ForgetTemplate(id)
+	s.notifyUpdate("template", "delete", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateTemplate checks a template's declarations, that its publisher
+// exists and that its body renders.
+func (s *Server) validateTemplate(t models.CreativeTemplate) error {
+	if t.Name == "" {
+		return errors.New("template name is required")
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if s.AdDataStore != nil && s.AdDataStore.GetPublisher(t.PublisherID) == nil {
+		return errors.New("publisher not found")
+	}
+	if err := render.CheckTemplate(&t); err != nil {
+		return fmt.Errorf("template body: %w", err)
+	}
+	return nil
+}
+
+// validateCreativeTemplate checks the template a creative references and
+// the values it supplies. Creatives take their format from the template.
+func (s *Server) validateCreativeTemplate(c *models.Creative) (int, error) {
+	if c.TemplateID == 0 {
+		if len(c.TemplateValues) > 0 {
+			return http.StatusBadRequest, errors.New("template_values require a template_id")
+		}
+		return 0, nil
+	}
+	t, err := s.PG.LoadTemplate(c.TemplateID)
+	if err != nil {
+		s.Logger.Error("load creative template", zap.Error(err))
+		return http.StatusInternalServerError, errors.New("internal error")
+	}
+	if t == nil {
+		return http.StatusBadRequest, errors.New("template not found")
+	}
+	if c.Format == "" {
+		c.Format = t.Format
+	}
+	if err := checkTemplateCreative(*c, t); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
+
+// checkTemplateCreative checks that a creative can be rendered from a
+// template: they belong to the same publisher and format, and the
+// creative's values are valid for the template's variables.
+func checkTemplateCreative(c models.Creative, t *models.CreativeTemplate) error {
+	if t.PublisherID != c.PublisherID {
+		return fmt.Errorf("template %d belongs to another publisher", t.ID)
+	}
+	if c.Format != t.Format {
+		return fmt.Errorf("template %d builds %s creatives, not %s", t.ID, t.Format, c.Format)
+	}
+	if err := t.CheckValues(c.TemplateValues); err != nil {
+		return err
+	}
+	_, err := render.ComposeTemplateHTML(t, c.TemplateValues)
+	return err
+}
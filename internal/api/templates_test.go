@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func promoTemplate() models.CreativeTemplate {
+	return models.CreativeTemplate{ID: 4, PublisherID: 1, Name: "Promo", Format: "banner",
+		Body: `<a href="{{.link}}" style="background: {{.color}}"><img src="{{.image}}" alt="{{.headline}}"><b>{{.headline}}</b></a>`,
+		Variables: []models.TemplateVariable{
+			{Name: "headline", Type: models.TemplateVarText, Required: true, MaxLength: 40},
+			{Name: "link", Type: models.TemplateVarURL, Required: true},
+			{Name: "image", Type: models.TemplateVarImage, Required: true},
+			{Name: "color", Type: models.TemplateVarColor, Default: "#ffcc00"},
+		}}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	srv := newTestServer()
+	tmpl := promoTemplate()
+	if err := srv.validateTemplate(tmpl); err != nil {
+		t.Fatalf("expected a valid template, got %v", err)
+	}
+
+	tmpl.Body = `<b>{{.headline}}</b>{{.subtitle}}`
+	if err := srv.validateTemplate(tmpl); err == nil || !strings.Contains(err.Error(), "subtitle") {
+		t.Errorf("expected undeclared variables to be rejected, got %v", err)
+	}
+	tmpl.Body = `<b>{{.headline</b>`
+	if err := srv.validateTemplate(tmpl); err == nil {
+		t.Error("expected a body that doesn't parse to be rejected")
+	}
+}
+
+func TestCheckTemplateCreative(t *testing.T) {
+	tmpl := promoTemplate()
+	c := models.Creative{PublisherID: 1, Format: "banner", TemplateID: 4, TemplateValues: map[string]string{
+		"headline": "Summer sale", "link": "https://brand.example/sale", "image": "https://cdn.example/sale.png"}}
+	if err := checkTemplateCreative(c, &tmpl); err != nil {
+		t.Fatalf("expected a valid creative, got %v", err)
+	}
+
+	other := c
+	other.PublisherID = 2
+	if err := checkTemplateCreative(other, &tmpl); err == nil {
+		t.Error("expected templates of another publisher to be rejected")
+	}
+	other = c
+	other.Format = "html"
+	if err := checkTemplateCreative(other, &tmpl); err == nil {
+		t.Error("expected a format other than the template's to be rejected")
+	}
+	other = c
+	other.TemplateValues = map[string]string{"headline": "Summer sale", "link": "https://brand.example/sale"}
+	if err := checkTemplateCreative(other, &tmpl); err == nil || !strings.Contains(err.Error(), "image") {
+		t.Errorf("expected the missing image to be reported, got %v", err)
+	}
+}
+
+func TestPreviewCreative_Template(t *testing.T) {
+	tmpl := promoTemplate()
+	srv, r := newPreviewServer(t, models.Creative{ID: 9, LineItemID: 3, CampaignID: 2, PublisherID: 1, PlacementID: "mpu",
+		Format: "banner", Width: 300, Height: 250, TemplateID: 4, TemplateValues: map[string]string{
+			"headline": `Fish & "chips"`, "link": "https://brand.example/?c={CREATIVE_ID}", "image": "https://cdn.example/fish.png"}})
+	srv.DB.Templates = map[int]models.CreativeTemplate{4: tmpl}
+	srv.DB.BuildIndexes()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/creatives/9/preview?format=json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	var preview CreativePreview
+	if err := json.NewDecoder(w.Body).Decode(&preview); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := `<a href="https://brand.example/?c=9" style="background: #ffcc00"><img src="https://cdn.example/fish.png" alt="Fish &amp; &#34;chips&#34;"><b>Fish &amp; &#34;chips&#34;</b></a>`
+	if preview.Adm != want {
+		t.Errorf("expected the rendered template\n got %s\nwant %s", preview.Adm, want)
+	}
+}
+
+func TestPreviewCreative_NativeTemplate(t *testing.T) {
+	tmpl := models.CreativeTemplate{ID: 5, PublisherID: 1, Name: "Feed card", Format: models.FormatNative,
+		Body:      `<div class="card"><h3>{{.title}}</h3></div>`,
+		Variables: []models.TemplateVariable{{Name: "title", Type: models.TemplateVarText, Required: true}}}
+	srv, r := newPreviewServer(t, models.Creative{ID: 10, LineItemID: 3, CampaignID: 2, PublisherID: 1, PlacementID: "stream",
+		Format: models.FormatNative, Native: json.RawMessage(`{"title":"Fresh coffee"}`), TemplateID: 5,
+		TemplateValues: map[string]string{"title": "Fresh <coffee>"}})
+	srv.DB.Templates = map[int]models.CreativeTemplate{5: tmpl}
+	srv.DB.BuildIndexes()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/creatives/10/preview?format=json", nil))
+	var preview CreativePreview
+	if err := json.NewDecoder(w.Body).Decode(&preview); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var assets map[string]string
+	if err := json.Unmarshal([]byte(preview.Adm), &assets); err != nil {
+		t.Fatalf("adm is not native assets: %v %s", err, preview.Adm)
+	}
+	if assets["title"] != "Fresh coffee" || assets["html"] != `<div class="card"><h3>Fresh &lt;coffee&gt;</h3></div>` {
+		t.Errorf("expected the rendered template as the html asset, got %v", assets)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/creatives/10/preview", nil))
+	if body := w.Body.String(); !strings.Contains(body, `srcdoc="&lt;div class=&#34;card&#34;&gt;`) {
+		t.Errorf("expected the rendered template in the preview frame, got %s", body)
+	}
+}
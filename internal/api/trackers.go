@@ -0,0 +1,112 @@
+package api
+
+import (
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/patrickwarner/openadserve/internal/macros"
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/trackers"
+
+	"go.uber.org/zap"
+)
+
+// thirdPartyTrackers returns a creative's line item and the third-party
+// impression and click trackers of both, the line item's first.
+func (s *Server) thirdPartyTrackers(c *models.Creative) (li *models.LineItem, imp, click []string) {
+	li = models.GetLineItemByID(s.AdDataStore, c.LineItemID)
+	if li == nil {
+		li = c.LineItem
+	}
+	if li != nil {
+		imp = append(imp, li.ImpressionTrackers...)
+		click = append(click, li.ClickTrackers...)
+	}
+	imp = append(imp, c.ImpressionTrackers...)
+	click = append(click, c.ClickTrackers...)
+	return li, imp, click
+}
+
+// trackersInMarkup reports whether a creative's third-party impression and
+// click trackers are returned in its ad markup. Native responses carry both
+// and HTML markup carries impression pixels; clicks on HTML ads always reach
+// our click endpoint. Trackers not returned, including all of those of line
+// items with ServerSideTrackers, are fired when we record the impression or
+// click.
+func trackersInMarkup(li *models.LineItem, c *models.Creative, pl *models.Placement) (imp, click bool) {
+	switch {
+	case li != nil && li.ServerSideTrackers:
+		return false, false
+	case pl != nil && pl.Native != nil:
+		return true, true
+	case c.Video != nil || c.Format == models.FormatVideo || c.Format == models.FormatNative || (pl != nil && pl.Video != nil):
+		// VAST from bidders and raw native assets have no place for them
+		return false, false
+	}
+	return true, false
+}
+
+// markupTrackers returns the third-party trackers of the ad to add to its
+// markup.
+func (s *Server) markupTrackers(ad *models.AdResponse, pl *models.Placement) (imp, click []string) {
+	if s.DB == nil {
+		return nil, nil
+	}
+	c := s.DB.FindCreativeByID(ad.CreativeID)
+	if c == nil {
+		return nil, nil
+	}
+	li, imp, click := s.thirdPartyTrackers(c)
+	inImp, inClick := trackersInMarkup(li, c, pl)
+	if !inImp {
+		imp = nil
+	}
+	if !inClick {
+		click = nil
+	}
+	return imp, click
+}
+
+// trackerPixels renders impression trackers as hidden image pixels to append
+// to HTML markup. Their macros are expanded with the rest of the markup.
+func trackerPixels(urls []string) string {
+	var b strings.Builder
+	for _, u := range urls {
+		b.WriteString(`<img src="`)
+		b.WriteString(html.EscapeString(u))
+		b.WriteString(`" width="1" height="1" style="display:none" alt="">`)
+	}
+	return b.String()
+}
+
+// fireThirdPartyTrackers fires the impression or click trackers of a
+// creative that weren't returned in its markup, on behalf of the viewer
+// whose request is r.
+func (s *Server) fireThirdPartyTrackers(r *http.Request, c *models.Creative, placementID string, click bool, mctx *macros.ClickContext) {
+	if s.Trackers == nil {
+		return
+	}
+	li, imp, clicks := s.thirdPartyTrackers(c)
+	inImp, inClick := trackersInMarkup(li, c, s.AdDataStore.GetPlacement(placementID))
+	urls, inMarkup := imp, inImp
+	if click {
+		urls, inMarkup = clicks, inClick
+	}
+	if inMarkup || len(urls) == 0 {
+		return
+	}
+	reqs := make([]trackers.Request, 0, len(urls))
+	for _, u := range urls {
+		if s.MacroService != nil {
+			expanded, err := s.MacroService.ExpandClickURL(u, mctx)
+			if err != nil {
+				s.Logger.Warn("failed to expand third-party tracker", zap.String("url", u), zap.Error(err))
+			} else {
+				u = expanded
+			}
+		}
+		reqs = append(reqs, trackers.Request{URL: u, UserAgent: r.UserAgent()})
+	}
+	s.Trackers.Fire(reqs...)
+}
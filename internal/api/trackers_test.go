@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/macros"
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/token"
+	"github.com/patrickwarner/openadserve/internal/trackers"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestGetAdHandler_ThirdPartyTrackers(t *testing.T) {
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "p1", APIKey: "key1"}})
+	_ = store.SetPlacements([]models.Placement{{ID: "mpu", PublisherID: 1, Width: 300, Height: 250, Formats: []string{"html"}}})
+	lineItem := models.LineItem{ID: 3, CampaignID: 2, PublisherID: 1, Active: true,
+		ImpressionTrackers: []string{"https://li.example/i"}, ClickTrackers: []string{"https://li.example/c"}}
+	_ = store.SetLineItems([]models.LineItem{lineItem})
+	testDB := &db.DB{Creatives: []models.Creative{{ID: 7, LineItemID: 3, CampaignID: 2, PublisherID: 1, Format: "html",
+		ImpressionTrackers: []string{"https://cr.example/imp?r={AUCTION_ID}&c={CREATIVE_ID}"}}}}
+	testDB.BuildIndexes()
+
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv.AdDataStore = store
+	srv.DB = testDB
+	srv.MacroService = macros.NewServiceForTesting(srv.Logger)
+	srv.SelectorMap[0] = ctxSelector{ctx: &models.TargetingContext{}, response: &models.AdResponse{CreativeID: 7, CampaignID: 2, LineItemID: 3, HTML: "<div>ad</div>", Price: 4}}
+
+	serve := func() string {
+		t.Helper()
+		body, _ := json.Marshal(models.OpenRTBRequest{
+			ID:   "req-1",
+			Imp:  []models.Impression{{ID: "1", TagID: "mpu"}},
+			User: models.User{ID: "u1"},
+			Ext:  models.RequestExt{PublisherID: 1},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/ad", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", "key1")
+		w := httptest.NewRecorder()
+		srv.GetAdHandler(w, req)
+		var resp models.OpenRTBResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || len(resp.SeatBid) == 0 {
+			t.Fatalf("expected a bid, got %d %v", w.Code, err)
+		}
+		return resp.SeatBid[0].Bid[0].Adm
+	}
+
+	adm := serve()
+	want := `<div>ad</div><img src="https://li.example/i" width="1" height="1" style="display:none" alt="">` +
+		`<img src="https://cr.example/imp?r=req-1&amp;c=7" width="1" height="1" style="display:none" alt="">`
+	if adm != want {
+		t.Errorf("expected impression pixels with macros expanded, got %s", adm)
+	}
+	if strings.Contains(adm, "li.example/c") {
+		t.Errorf("click trackers of HTML ads are fired on click, got %s", adm)
+	}
+
+	lineItem.ServerSideTrackers = true
+	_ = store.SetLineItems([]models.LineItem{lineItem})
+	if adm := serve(); adm != "<div>ad</div>" {
+		t.Errorf("expected no pixels for server-side trackers, got %s", adm)
+	}
+}
+
+func TestTrackers_FiredServerSide(t *testing.T) {
+	var mu sync.Mutex
+	var fired []string
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fired = append(fired, r.URL.RequestURI())
+		mu.Unlock()
+	}))
+	defer tracker.Close()
+
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "p1", APIKey: "key1"}})
+	_ = store.SetLineItems([]models.LineItem{{ID: 1, CampaignID: 1, PublisherID: 1, Active: true, ServerSideTrackers: true,
+		ImpressionTrackers: []string{tracker.URL + "/imp?c={CREATIVE_ID}"}}})
+	testDB := &db.DB{Creatives: []models.Creative{{ID: 1, LineItemID: 1, CampaignID: 1, PublisherID: 1, Format: "html",
+		ClickTrackers: []string{tracker.URL + "/clk?r={AUCTION_ID}"}}}}
+	testDB.BuildIndexes()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv.DB = testDB
+	srv.AdDataStore = store
+	srv.Store = &db.RedisStore{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), Ctx: context.Background()}
+	srv.TokenTTL = time.Hour
+	srv.MacroService = macros.NewServiceForTesting(srv.Logger)
+	srv.Trackers = trackers.New(trackers.Config{Workers: 1, QueueSize: 10, AllowPrivate: true}, srv.Logger)
+
+	tok, err := token.Generate("req-1", "imp-1", "1", "1", "1", "", "1", srv.TokenSecret)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	w := httptest.NewRecorder()
+	srv.ImpressionHandler(w, httptest.NewRequest(http.MethodGet, "/impression?t="+url.QueryEscape(tok), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("impression: expected 200, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	srv.ClickHandler(w, httptest.NewRequest(http.MethodGet, "/click?t="+url.QueryEscape(tok), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("click: expected 200, got %d", w.Code)
+	}
+	srv.Trackers.Close()
+
+	if len(fired) != 2 || fired[0] != "/imp?c=1" || fired[1] != "/clk?r=req-1" {
+		t.Errorf("expected the impression and click trackers to be fired, got %v", fired)
+	}
+}
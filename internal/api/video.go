@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/patrickwarner/openadserve/internal/logic/selectors"
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/vast"
+)
+
+// publicBaseURL returns the scheme and host used for absolute tracking URLs:
+// PUBLIC_BASE_URL when set, otherwise the host the request was sent to.
+func (s *Server) publicBaseURL(r *http.Request) string {
+	if s.Config.PublicBaseURL != "" {
+		return s.Config.PublicBaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// videoAdMarkup renders video ads as one VAST document whose impression,
+// viewability, click and playback tracking point at our signed endpoints.
+// Several ads form an ad pod, each tracked with its own token. Playback
+// events are recorded on /event as the video_* event types.
+func (s *Server) videoAdMarkup(r *http.Request, ads []*models.AdResponse, toks []string, adServingID string, player *models.VideoPlacement) (string, error) {
+	base := s.publicBaseURL(r)
+	out := make([]vast.Ad, len(ads))
+	for i, ad := range ads {
+		id := adServingID
+		if len(ads) > 1 {
+			id += "-" + strconv.Itoa(i+1)
+		}
+		out[i] = s.videoAd(base, ad, toks[i], id, player)
+	}
+	doc, err := vast.Build(out...)
+	if err != nil {
+		return "", err
+	}
+	return string(doc), nil
+}
+
+// videoAd describes one video ad and its tracking URLs. Third-party VAST
+// from programmatic bids and VAST tags keep their own landing page, so our
+// click URL only tracks.
+func (s *Server) videoAd(base string, ad *models.AdResponse, tok, adServingID string, player *models.VideoPlacement) vast.Ad {
+	q := url.QueryEscape(tok)
+	v := vast.Ad{
+		ID:          strconv.Itoa(ad.CreativeID),
+		AdServingID: adServingID,
+		Title:       "Ad " + strconv.Itoa(ad.CreativeID),
+		Video:       *ad.Video,
+		SkipAfter:   -1,
+		Impression:  base + "/impression?t=" + q,
+		Tracking:    make(map[string]string, len(vast.Events)+1),
+	}
+	if player != nil && player.Skippable {
+		v.SkipAfter = player.SkipAfter
+	}
+	if s.Config.ViewabilityMode != ViewabilityOff {
+		v.Viewable = base + "/viewable?t=" + q
+	}
+	click := base + "/click?t=" + q
+	switch {
+	case ad.VAST != "":
+		v.Document = []byte(ad.VAST)
+		v.ClickTracking = click
+	case ad.Video.VASTTagURL != "":
+		v.TagURI = ad.Video.VASTTagURL
+		v.ClickTracking = click
+	case s.hasLandingPage(ad):
+		// The click endpoint redirects to the landing page
+		v.ClickThrough = click
+	default:
+		v.ClickTracking = click
+	}
+	for _, ev := range vast.Events {
+		v.Tracking[ev.VAST] = base + "/event?t=" + q + "&type=" + ev.EventType
+	}
+	v.Tracking[vast.SkipEvent.VAST] = base + "/event?t=" + q + "&type=" + vast.SkipEvent.EventType
+	return v
+}
+
+// fillPod adds ads to a video ad pod after its first ad until the pod is
+// full or nothing else fits. Each ad is limited to the pod time left and
+// kept apart from the line items and advertisers already in the pod.
+func (s *Server) fillPod(selector selectors.Selector, pod *models.VideoPlacement, first *models.AdResponse,
+	placementID, userID string, width, height int, tctx models.TargetingContext) []*models.AdResponse {
+	ads := []*models.AdResponse{first}
+	sep := &models.PodSeparation{}
+	sep.Add(first.LineItemID, first.ADomain)
+	used := first.Video.Duration
+	for len(ads) < pod.PodSize {
+		slot := pod.Slot(used)
+		if slot == nil {
+			break
+		}
+		tctx.Video = slot
+		tctx.Pod = sep
+		ad, err := selector.SelectAd(s.Store, s.DB, s.AdDataStore, placementID, userID, width, height, tctx, s.Config)
+		if err != nil || ad.Video == nil {
+			break
+		}
+		ads = append(ads, ad)
+		sep.Add(ad.LineItemID, ad.ADomain)
+		used += ad.Video.Duration
+	}
+	return ads
+}
+
+// hasLandingPage reports whether clicks on the ad redirect somewhere, using
+// the same precedence as the click handler.
+func (s *Server) hasLandingPage(ad *models.AdResponse) bool {
+	if s.DB != nil {
+		if cr := s.DB.FindCreativeByID(ad.CreativeID); cr != nil && cr.ClickURL != "" {
+			return true
+		}
+	}
+	if s.AdDataStore != nil {
+		if li := s.AdDataStore.GetLineItemByID(ad.LineItemID); li != nil && li.ClickURL != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/config"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/models"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestGetAdHandler_VideoVAST(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	video := &models.VideoCreative{Duration: 15, MediaFiles: []models.MediaFile{
+		{URL: "https://cdn.example.com/ad.mp4", MIME: "video/mp4", Bitrate: 1500, Width: 1280, Height: 720},
+	}}
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "p1", APIKey: "key1"}})
+	_ = store.SetPlacements([]models.Placement{{ID: "preroll", PublisherID: 1, Formats: []string{"video"},
+		Video: &models.VideoPlacement{MaxDuration: 30, Skippable: true, SkipAfter: 5}}})
+	testDB := &db.DB{Creatives: []models.Creative{{ID: 7, PlacementID: "preroll", LineItemID: 3, CampaignID: 2, PublisherID: 1, Format: "video", Video: video, ClickURL: "https://advertiser.example.com"}}}
+	testDB.BuildIndexes()
+
+	rec := &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = rec
+	srv.AdDataStore = store
+	srv.DB = testDB
+	srv.Store = &db.RedisStore{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), Ctx: context.Background()}
+	srv.TokenTTL = time.Hour
+	var gotCtx models.TargetingContext
+	srv.SelectorMap[0] = ctxSelector{ctx: &gotCtx, response: &models.AdResponse{CreativeID: 7, CampaignID: 2, LineItemID: 3, Video: video, Price: 10}}
+
+	skip := 0
+	body, _ := json.Marshal(models.OpenRTBRequest{
+		ID:   "req-1",
+		Imp:  []models.Impression{{ID: "1", TagID: "preroll", Video: &models.ImpVideo{MaxDuration: 20, Skip: &skip}}},
+		User: models.User{ID: "u1"},
+		Ext:  models.RequestExt{PublisherID: 1},
+	})
+	req := httptest.NewRequest(http.MethodPost, "http://ads.example.com/ad", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "key1")
+	w := httptest.NewRecorder()
+	srv.GetAdHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if gotCtx.Video == nil || gotCtx.Video.MaxDuration != 20 || gotCtx.Video.Skippable {
+		t.Fatalf("expected imp.video to narrow the placement, got %+v", gotCtx.Video)
+	}
+
+	var resp models.OpenRTBResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	adm := resp.SeatBid[0].Bid[0].Adm
+	var doc struct {
+		Version    string `xml:"version,attr"`
+		Impression string `xml:"Ad>InLine>Impression"`
+		Linear     struct {
+			SkipOffset string `xml:"skipoffset,attr"`
+			Duration   string `xml:"Duration"`
+			Tracking   []struct {
+				Event string `xml:"event,attr"`
+				URL   string `xml:",chardata"`
+			} `xml:"TrackingEvents>Tracking"`
+			ClickThrough string `xml:"VideoClicks>ClickThrough"`
+			MediaFile    string `xml:"MediaFiles>MediaFile"`
+		} `xml:"Ad>InLine>Creatives>Creative>Linear"`
+	}
+	if err := xml.Unmarshal([]byte(adm), &doc); err != nil {
+		t.Fatalf("adm is not VAST: %v\n%s", err, adm)
+	}
+	if doc.Version != "4.1" || doc.Linear.Duration != "00:00:15" || doc.Linear.SkipOffset != "" {
+		t.Fatalf("unexpected VAST header %+v", doc)
+	}
+	if !strings.HasPrefix(doc.Impression, "http://ads.example.com/impression?t=") ||
+		!strings.HasPrefix(doc.Linear.ClickThrough, "http://ads.example.com/click?t=") ||
+		doc.Linear.MediaFile != "https://cdn.example.com/ad.mp4" {
+		t.Fatalf("unexpected VAST urls %+v", doc)
+	}
+
+	var quartile string
+	for _, tr := range doc.Linear.Tracking {
+		if tr.Event == "firstQuartile" {
+			quartile = tr.URL
+		}
+	}
+	if quartile == "" {
+		t.Fatalf("missing firstQuartile tracking in %v", doc.Linear.Tracking)
+	}
+
+	// Playback events go through the custom event pipeline
+	rec.events = nil
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		srv.EventHandler(w, httptest.NewRequest(http.MethodGet, quartile, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("quartile event: expected 200, got %d", w.Code)
+		}
+	}
+	if len(rec.events) != 1 || rec.events[0] != "video_first_quartile" {
+		t.Fatalf("expected one video_first_quartile event, got %v", rec.events)
+	}
+}
+
+func TestGetAdHandler_VideoPod(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	video := func(d int) *models.VideoCreative {
+		return &models.VideoCreative{Duration: d, MediaFiles: []models.MediaFile{{URL: "https://cdn.example.com/ad.mp4", MIME: "video/mp4"}}}
+	}
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "p1", APIKey: "key1"}})
+	_ = store.SetPlacements([]models.Placement{{ID: "midroll", PublisherID: 1, Formats: []string{"video"},
+		Video: &models.VideoPlacement{MaxDuration: 30, PodSize: 4, PodDuration: 40}}})
+	testDB := &db.DB{}
+	for id := 1; id <= 4; id++ {
+		testDB.Creatives = append(testDB.Creatives, models.Creative{ID: id, PlacementID: "midroll", LineItemID: id, PublisherID: 1, Format: "video"})
+	}
+	testDB.BuildIndexes()
+
+	rec := &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = rec
+	srv.AdDataStore = store
+	srv.DB = testDB
+	srv.Store = &db.RedisStore{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), Ctx: context.Background()}
+	srv.TokenTTL = time.Hour
+	srv.SelectorMap[0] = &podSelector{ads: []*models.AdResponse{
+		{CreativeID: 1, LineItemID: 1, ADomain: "a.example", Video: video(20), Price: 10},
+		{CreativeID: 2, LineItemID: 2, ADomain: "a.example", Video: video(10), Price: 9}, // same advertiser
+		{CreativeID: 3, LineItemID: 3, ADomain: "c.example", Video: video(15), Price: 8},
+		{CreativeID: 4, LineItemID: 4, Video: video(10), Price: 7}, // longer than the 5s left
+	}}
+
+	body, _ := json.Marshal(models.OpenRTBRequest{
+		ID:   "req-1",
+		Imp:  []models.Impression{{ID: "1", TagID: "midroll", Video: &models.ImpVideo{MaxSeq: 3}}},
+		User: models.User{ID: "u1"},
+		Ext:  models.RequestExt{PublisherID: 1},
+	})
+	req := httptest.NewRequest(http.MethodPost, "http://ads.example.com/ad", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "key1")
+	w := httptest.NewRecorder()
+	srv.GetAdHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp models.OpenRTBResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	bid := resp.SeatBid[0].Bid[0]
+	if bid.Price != 18 || bid.CrID != "1" {
+		t.Fatalf("expected the pod total on the first ad's bid, got %+v", bid)
+	}
+	var doc struct {
+		Ads []struct {
+			ID         string `xml:"id,attr"`
+			Sequence   int    `xml:"sequence,attr"`
+			AdServing  string `xml:"InLine>AdServingId"`
+			Impression string `xml:"InLine>Impression"`
+			Tracking   []struct {
+				Event string `xml:"event,attr"`
+				URL   string `xml:",chardata"`
+			} `xml:"InLine>Creatives>Creative>Linear>TrackingEvents>Tracking"`
+		} `xml:"Ad"`
+	}
+	if err := xml.Unmarshal([]byte(bid.Adm), &doc); err != nil {
+		t.Fatalf("adm is not VAST: %v\n%s", err, bid.Adm)
+	}
+	if len(doc.Ads) != 2 || doc.Ads[0].ID != "1" || doc.Ads[1].ID != "3" || doc.Ads[1].Sequence != 2 || doc.Ads[1].AdServing != "req-1-1-2" {
+		t.Fatalf("expected creatives 1 and 3 in the pod, got %+v", doc.Ads)
+	}
+	if doc.Ads[0].Impression == doc.Ads[1].Impression {
+		t.Fatal("expected each ad of the pod to have its own token")
+	}
+
+	// Playback events of different ads in the pod are not deduplicated
+	// against each other
+	rec.events = nil
+	for _, ad := range doc.Ads {
+		for _, tr := range ad.Tracking {
+			if tr.Event == "start" {
+				srv.EventHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tr.URL, nil))
+			}
+		}
+	}
+	if len(rec.events) != 2 {
+		t.Fatalf("expected a video_start per ad, got %v", rec.events)
+	}
+}
+
+// podSelector returns the first of its ads that fits the player constraints
+// and pod separation of the targeting context.
+type podSelector struct {
+	ads []*models.AdResponse
+}
+
+func (p *podSelector) SelectAd(_ *db.RedisStore, _ *db.DB, _ models.AdDataStore, _, _ string, _, _ int, ctx models.TargetingContext, _ config.Config) (*models.AdResponse, error) {
+	for _, ad := range p.ads {
+		if ctx.Video.Accepts(ad.Video) && ctx.Pod.Allows(ad.LineItemID, ad.ADomain) {
+			return ad, nil
+		}
+	}
+	return nil, errors.New("no ad")
+}
+
+// ctxSelector returns a fixed ad and captures the targeting context it was given.
+type ctxSelector struct {
+	ctx      *models.TargetingContext
+	response *models.AdResponse
+}
+
+func (c ctxSelector) SelectAd(_ *db.RedisStore, _ *db.DB, _ models.AdDataStore, _, _ string, _, _ int, ctx models.TargetingContext, _ config.Config) (*models.AdResponse, error) {
+	*c.ctx = ctx
+	return c.response, nil
+}
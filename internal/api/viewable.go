@@ -0,0 +1,178 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/patrickwarner/openadserve/internal/logic"
+	"github.com/patrickwarner/openadserve/internal/middleware"
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/token"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Viewability modes selected by VIEWABILITY_MODE.
+const (
+	// ViewabilityMeasure records viewable impressions. vCPM line items spend
+	// and pace on them; all other budget types follow rendered impressions.
+	ViewabilityMeasure = "measure"
+	// ViewabilityOff omits viewable URLs from ad responses and ignores signals.
+	ViewabilityOff = "off"
+)
+
+// ViewableHandler handles GET /viewable pixel requests sent by the SDK once an
+// ad meets the viewability standard. Each impression is recorded as a
+// viewable_impression event at most once, which is also when vCPM line items
+// are charged.
+func (s *Server) ViewableHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "ViewableHandler",
+		trace.WithAttributes(
+			attribute.String("http.method", "GET"),
+			attribute.String("http.route", "/viewable"),
+		))
+	defer span.End()
+
+	logger := middleware.LoggerFromRequest(r, s.Logger)
+
+	start := time.Now()
+	const endpoint = "viewable"
+	const method = "GET"
+
+	if s.Config.ViewabilityMode == ViewabilityOff {
+		s.Metrics.IncrementRequests(endpoint, method, "200")
+		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+		s.sendPixelResponse(w)
+		return
+	}
+
+	if s.Analytics == nil {
+		span.RecordError(fmt.Errorf("analytics unavailable"))
+		span.SetStatus(codes.Error, "analytics unavailable")
+		logger.Error("analytics unavailable")
+		s.Metrics.IncrementRequests(endpoint, method, "500")
+		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+		http.Error(w, "analytics unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	tok := r.URL.Query().Get("t")
+	if tok == "" {
+		logger.Warn("missing token")
+		s.Metrics.IncrementRequests(endpoint, method, "401")
+		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+		http.Error(w, "token required", http.StatusUnauthorized)
+		return
+	}
+	payload, err := token.Verify(tok, s.TokenSecret, s.TokenTTL)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid token")
+		logger.Warn("token verify", zap.Error(err))
+		s.Metrics.IncrementRequests(endpoint, method, "401")
+		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("request_id", payload.RequestID),
+		attribute.String("impression_id", payload.ImpID),
+		attribute.String("creative_id", payload.CrID),
+		attribute.String("line_item_id", payload.LIID),
+	)
+
+	// The SDK sends the signal once, but a replayed URL must not inflate the
+	// viewable count.
+	if s.Store != nil && s.Store.Client != nil {
+		key := "viewable:" + payload.RequestID + ":" + payload.ImpID + ":" + payload.CrID
+		first, err := s.Store.Client.SetNX(ctx, key, 1, s.TokenTTL).Result()
+		if err != nil {
+			logger.Warn("viewable dedupe", zap.Error(err))
+		} else if !first {
+			s.Metrics.IncrementEvent("duplicate_viewable")
+			s.Metrics.IncrementRequests(endpoint, method, "200")
+			s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+			s.sendPixelResponse(w)
+			return
+		}
+	}
+
+	var pubID int
+	var lineItemID int
+	if id, err := strconv.Atoi(payload.CrID); err == nil {
+		if cr := s.DB.FindCreativeByID(id); cr != nil {
+			pubID = cr.PublisherID
+			lineItemID = cr.LineItemID
+		}
+	}
+	if payload.LIID != "" {
+		if id, err := strconv.Atoi(payload.LIID); err == nil {
+			lineItemID = id
+		}
+	}
+	if payload.PubID != "" {
+		if id, err := strconv.Atoi(payload.PubID); err == nil {
+			pubID = id
+		}
+	}
+	if pubID == 0 || models.GetPublisherByID(s.AdDataStore, pubID) == nil {
+		logger.Error("unknown publisher", zap.Int("publisher_id", pubID))
+		s.Metrics.IncrementRequests(endpoint, method, "400")
+		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+		http.Error(w, "unknown publisher", http.StatusBadRequest)
+		return
+	}
+
+	userID := s.trackedUserID(ctx, payload.UserID, payload.IssuedAt)
+	deviceType, country := logic.ResolveTargetingFromRequest(r, s.ClientIP.FromRequest(r), s.GeoIP)
+	targetingCtx := models.TargetingContext{
+		DeviceType: deviceType,
+		Country:    country,
+		UserID:     userID,
+		Privacy:    models.PrivacyContext{Status: payload.Context.ConsentStatus},
+		Domain:     payload.Context.Domain,
+		AppBundle:  payload.Context.AppBundle,
+		PagePath:   payload.Context.PagePath,
+		Categories: payload.Context.Categories,
+		IVTReason:  s.trackingIVTReason(r, "viewable_impression", tok, userID, payload.RequestID, payload.ImpID, payload.CrID, payload.Context.IVTReason, payload.Context.COPPA),
+	}
+
+	if err := s.Analytics.RecordViewableImpression(ctx, s.AdDataStore, payload.RequestID, payload.ImpID, payload.CrID, lineItemID, targetingCtx, pubID, payload.PlacementID); err != nil {
+		logger.Error("analytics record", zap.Error(err))
+		s.Metrics.IncrementRequests(endpoint, method, "500")
+		s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+		http.Error(w, "analytics error", http.StatusInternalServerError)
+		return
+	}
+	s.Metrics.IncrementEvent("viewable_impression")
+
+	if targetingCtx.IVTReason == "" {
+		if payload.PlacementID != "" {
+			if err := s.Store.IncrementViewabilityViewable(payload.PlacementID, s.Config.ViewabilityRateDays); err != nil {
+				logger.Error("failed to increment viewability counter", zap.Error(err), zap.String("placement_id", payload.PlacementID))
+			}
+		}
+		// vCPM line items bill and pace on viewable impressions
+		if lineItemID > 0 && s.isVCPM(lineItemID) {
+			if err := logic.IncrementLineItemImpressions(s.Store, lineItemID); err != nil {
+				logger.Error("failed to increment impression counter", zap.Error(err), zap.Int("line_item_id", lineItemID))
+			}
+		}
+	}
+
+	s.Metrics.IncrementRequests(endpoint, method, "200")
+	s.Metrics.RecordRequestLatency(endpoint, method, time.Since(start))
+	s.sendPixelResponse(w)
+}
+
+// isVCPM reports whether the line item is billed on viewable impressions.
+func (s *Server) isVCPM(lineItemID int) bool {
+	li := models.GetLineItemByID(s.AdDataStore, lineItemID)
+	return li != nil && li.BudgetType == models.BudgetTypeVCPM
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/models"
+	"github.com/patrickwarner/openadserve/internal/token"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap/zaptest"
+)
+
+// recordingAnalytics captures the event types it is asked to record.
+type recordingAnalytics struct {
+	*analytics.MockAnalytics
+	events []string
+}
+
+func (a *recordingAnalytics) RecordEvent(ctx context.Context, store models.AdDataStore, eventType, requestID, impID, creativeID string, lineItemID int, cost float64, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	a.events = append(a.events, eventType)
+	return nil
+}
+
+func (a *recordingAnalytics) RecordViewableImpression(ctx context.Context, store models.AdDataStore, requestID, impID, creativeID string, lineItemID int, targetingCtx models.TargetingContext, publisherID int, placementID string) error {
+	a.events = append(a.events, "viewable_impression")
+	return nil
+}
+
+func TestViewableHandler(t *testing.T) {
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "Test", APIKey: "k"}})
+	testDB := &db.DB{Creatives: []models.Creative{{ID: 1, LineItemID: 1, CampaignID: 1, PublisherID: 1}}}
+	testDB.BuildIndexes()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	rec := &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = rec
+	srv.DB = testDB
+	srv.AdDataStore = store
+	srv.Store = &db.RedisStore{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), Ctx: context.Background()}
+	srv.TokenTTL = time.Hour
+	srv.Config.ViewabilityMode = ViewabilityMeasure
+
+	tok, err := token.Generate("req-1", "imp-1", "1", "1", "1", "", "1", srv.TokenSecret)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		srv.ViewableHandler(w, httptest.NewRequest(http.MethodGet, "/viewable?t="+url.QueryEscape(tok), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	if len(rec.events) != 1 || rec.events[0] != "viewable_impression" {
+		t.Fatalf("expected one viewable_impression event, got %v", rec.events)
+	}
+
+	w := httptest.NewRecorder()
+	srv.ViewableHandler(w, httptest.NewRequest(http.MethodGet, "/viewable?t=bogus", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for invalid token, got %d", w.Code)
+	}
+
+	srv.Config.ViewabilityMode = ViewabilityOff
+	tok2, _ := token.Generate("req-2", "imp-1", "1", "1", "1", "", "1", srv.TokenSecret)
+	w = httptest.NewRecorder()
+	srv.ViewableHandler(w, httptest.NewRequest(http.MethodGet, "/viewable?t="+url.QueryEscape(tok2), nil))
+	if w.Code != http.StatusOK || len(rec.events) != 1 {
+		t.Fatalf("expected signal to be ignored when off, got %d %v", w.Code, rec.events)
+	}
+}
+
+func TestViewableHandler_VCPMPacing(t *testing.T) {
+	store := models.NewInMemoryAdDataStore()
+	_ = store.SetPublishers([]models.Publisher{{ID: 1, Name: "Test", APIKey: "k"}})
+	_ = store.SetLineItems([]models.LineItem{{ID: 1, CampaignID: 1, PublisherID: 1, CPM: 4, BudgetType: models.BudgetTypeVCPM, Active: true}})
+	testDB := &db.DB{Creatives: []models.Creative{{ID: 1, LineItemID: 1, CampaignID: 1, PublisherID: 1}}}
+	testDB.BuildIndexes()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	srv := newTestServer()
+	srv.Logger = zaptest.NewLogger(t)
+	srv.Analytics = &recordingAnalytics{MockAnalytics: analytics.NewMockAnalytics()}
+	srv.DB = testDB
+	srv.AdDataStore = store
+	srv.Store = &db.RedisStore{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), Ctx: context.Background()}
+	srv.TokenTTL = time.Hour
+	srv.Config.ViewabilityMode = ViewabilityMeasure
+
+	tok, err := token.GenerateWithAuctionData("req-1", "imp-1", "1", "1", "1", "", "1", "header", 0, "", nil, srv.TokenSecret)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	pacingKey := "pacing:impressions:1:" + time.Now().Format("2006-01-02")
+
+	w := httptest.NewRecorder()
+	srv.ImpressionHandler(w, httptest.NewRequest(http.MethodGet, "/impression?t="+url.QueryEscape(tok), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("impression: expected 200, got %d", w.Code)
+	}
+	if mr.Exists(pacingKey) {
+		t.Fatal("vCPM impression should not count towards pacing")
+	}
+
+	w = httptest.NewRecorder()
+	srv.ViewableHandler(w, httptest.NewRequest(http.MethodGet, "/viewable?t="+url.QueryEscape(tok), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("viewable: expected 200, got %d", w.Code)
+	}
+	if v, _ := mr.Get(pacingKey); v != "1" {
+		t.Fatalf("expected viewable impression to count towards pacing, got %q", v)
+	}
+	if imps, views := srv.Store.GetViewabilityCounts("header", srv.Config.ViewabilityRateDays); imps != 1 || views != 1 {
+		t.Fatalf("expected placement counts 1/1, got %d/%d", imps, views)
+	}
+}
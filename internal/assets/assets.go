@@ -0,0 +1,159 @@
+// Package assets validates uploaded creative images and derives the
+// pixel-density variants that banner creatives list in their srcset.
+package assets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// MaxDensity is the highest pixel density an upload may have relative to
+// the slot it is made for.
+const MaxDensity = 4
+
+// ErrUnsupportedType is returned for files that aren't PNG, JPEG or GIF images.
+var ErrUnsupportedType = errors.New("unsupported image type, expected png, jpeg or gif")
+
+// extensions maps the accepted content types to file extensions.
+var extensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+// Image is an encoded image and its dimensions.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Ext returns the file extension of the image's type.
+func (img *Image) Ext() string {
+	return extensions[img.ContentType]
+}
+
+// Inspect checks that data is a PNG, JPEG or GIF image no larger than
+// maxWidth x maxHeight pixels. The type is sniffed from the content rather
+// than trusted from the upload.
+func Inspect(data []byte, maxWidth, maxHeight int) (*Image, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := extensions[contentType]; !ok {
+		return nil, ErrUnsupportedType
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, errors.New("image has no pixels")
+	}
+	if (maxWidth > 0 && cfg.Width > maxWidth) || (maxHeight > 0 && cfg.Height > maxHeight) {
+		return nil, fmt.Errorf("image is %dx%d, larger than the %dx%d limit", cfg.Width, cfg.Height, maxWidth, maxHeight)
+	}
+	return &Image{Data: data, ContentType: contentType, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// MatchSlot returns the slot size among sizes that img fills at an integer
+// pixel density of 1 to MaxDensity, and that density. Lower densities are
+// preferred when several sizes match.
+func MatchSlot(img *Image, sizes []models.Format) (models.Format, int, error) {
+	for density := 1; density <= MaxDensity; density++ {
+		for _, size := range sizes {
+			if size.W > 0 && size.H > 0 && img.Width == size.W*density && img.Height == size.H*density {
+				return size, density, nil
+			}
+		}
+	}
+	return models.Format{}, 0, fmt.Errorf("image is %dx%d, expected one of %s at 1x to %dx", img.Width, img.Height, formatSizes(sizes), MaxDensity)
+}
+
+func formatSizes(sizes []models.Format) string {
+	var b bytes.Buffer
+	for i, size := range sizes {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%dx%d", size.W, size.H)
+	}
+	return b.String()
+}
+
+// Variants returns img scaled down to the slot size at each pixel density
+// below density, lowest first. The caller keeps img itself as the highest
+// density. GIFs, which may be animated, get no variants.
+func Variants(img *Image, slot models.Format, density int) ([]*Image, error) {
+	if density <= 1 || img.ContentType == "image/gif" {
+		return nil, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Width, img.Height))
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	variants := make([]*Image, 0, density-1)
+	for d := 1; d < density; d++ {
+		scaled := downscale(rgba, slot.W*d, slot.H*d)
+		var buf bytes.Buffer
+		switch img.ContentType {
+		case "image/jpeg":
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 90})
+		default:
+			err = png.Encode(&buf, scaled)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("encode variant: %w", err)
+		}
+		variants = append(variants, &Image{Data: buf.Bytes(), ContentType: img.ContentType, Width: slot.W * d, Height: slot.H * d})
+	}
+	return variants, nil
+}
+
+// downscale resizes src to w x h by averaging the source pixels each
+// destination pixel covers.
+func downscale(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
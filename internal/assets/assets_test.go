@@ -0,0 +1,77 @@
+package assets
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	img, err := Inspect(testPNG(t, 30, 25), 100, 100)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if img.ContentType != "image/png" || img.Width != 30 || img.Height != 25 || img.Ext() != ".png" {
+		t.Errorf("unexpected image %s %dx%d", img.ContentType, img.Width, img.Height)
+	}
+	if _, err := Inspect(testPNG(t, 30, 25), 20, 100); err == nil {
+		t.Error("expected images over the limit to be rejected")
+	}
+	if _, err := Inspect([]byte("<html><script>alert(1)</script></html>"), 0, 0); err != ErrUnsupportedType {
+		t.Errorf("expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestMatchSlotAndVariants(t *testing.T) {
+	img, err := Inspect(testPNG(t, 90, 75), 0, 0)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	slot, density, err := MatchSlot(img, []models.Format{{W: 40, H: 40}, {W: 30, H: 25}})
+	if err != nil || slot != (models.Format{W: 30, H: 25}) || density != 3 {
+		t.Fatalf("expected 30x25 at 3x, got %v %d %v", slot, density, err)
+	}
+	if _, _, err := MatchSlot(img, []models.Format{{W: 40, H: 40}}); err == nil {
+		t.Error("expected a size mismatch")
+	}
+
+	variants, err := Variants(img, slot, density)
+	if err != nil {
+		t.Fatalf("Variants: %v", err)
+	}
+	if len(variants) != 2 {
+		t.Fatalf("expected 1x and 2x variants, got %d", len(variants))
+	}
+	for i, v := range variants {
+		decoded, err := png.Decode(bytes.NewReader(v.Data))
+		if err != nil {
+			t.Fatalf("decode variant: %v", err)
+		}
+		b := decoded.Bounds()
+		if b.Dx() != 30*(i+1) || b.Dy() != 25*(i+1) || v.Width != b.Dx() || v.Height != b.Dy() {
+			t.Errorf("variant %d is %dx%d", i, b.Dx(), b.Dy())
+		}
+		if r, _, _, a := decoded.At(5, 5).RGBA(); r>>8 != 200 || a>>8 != 255 {
+			t.Errorf("variant %d lost its colour", i)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package clientip determines the address of the end user behind an HTTP
+// request. Forwarding headers are only honoured when they were added by a
+// trusted proxy, and the OpenRTB device.ip field is governed by a policy so
+// that browsers cannot spoof their location.
+package clientip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DeviceIPPolicy controls when device.ip from an ad request is used instead of
+// the address the request came from.
+type DeviceIPPolicy string
+
+const (
+	// DeviceIPNever ignores device.ip.
+	DeviceIPNever DeviceIPPolicy = "never"
+	// DeviceIPTrusted uses device.ip only when the caller itself is inside a
+	// trusted network, e.g. a server-to-server integration in the same VPC.
+	DeviceIPTrusted DeviceIPPolicy = "trusted"
+	// DeviceIPAlways uses device.ip whenever it is a valid address.
+	DeviceIPAlways DeviceIPPolicy = "always"
+)
+
+// Header names the forwarding header set by the trusted proxies. Only that
+// header is read: proxies usually pass the others through untouched, so a
+// client could fill them in.
+type Header string
+
+const (
+	// HeaderXForwardedFor reads the X-Forwarded-For chain, as appended by
+	// nginx, HAProxy and most load balancers.
+	HeaderXForwardedFor Header = "x-forwarded-for"
+	// HeaderForwarded reads the for= parameters of RFC 7239 Forwarded headers.
+	HeaderForwarded Header = "forwarded"
+	// HeaderXRealIP reads the single address in X-Real-IP, which the proxy
+	// must overwrite rather than append to.
+	HeaderXRealIP Header = "x-real-ip"
+)
+
+// DefaultTrustedProxies are the networks trusted when none are configured:
+// loopback and private ranges, where reverse proxies usually live.
+var DefaultTrustedProxies = []string{
+	"127.0.0.0/8", "::1/128",
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
+}
+
+// Resolver extracts client IPs from requests. A nil Resolver trusts no
+// proxies and ignores device.ip, so only the connection address is used.
+type Resolver struct {
+	trusted  []*net.IPNet
+	header   Header
+	deviceIP DeviceIPPolicy
+}
+
+// New creates a Resolver trusting the given CIDRs or single addresses and
+// reading the given forwarding header from them. Invalid entries are skipped
+// and reported in the returned error alongside a usable Resolver. An unknown
+// header falls back to HeaderXForwardedFor and an unknown policy to
+// DeviceIPNever.
+func New(trustedProxies []string, header Header, policy DeviceIPPolicy) (*Resolver, error) {
+	r := &Resolver{header: HeaderXForwardedFor, deviceIP: DeviceIPNever}
+	var errs []error
+	switch h := Header(strings.ToLower(string(header))); h {
+	case HeaderXForwardedFor, HeaderForwarded, HeaderXRealIP:
+		r.header = h
+	case "":
+	default:
+		errs = append(errs, fmt.Errorf("unknown client ip header %q", header))
+	}
+	switch policy {
+	case DeviceIPNever, DeviceIPTrusted, DeviceIPAlways:
+		r.deviceIP = policy
+	case "":
+	default:
+		errs = append(errs, fmt.Errorf("unknown device ip policy %q", policy))
+	}
+	for _, entry := range trustedProxies {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := Parse(entry)
+			if ip == nil {
+				errs = append(errs, fmt.Errorf("invalid trusted proxy %q", entry))
+				continue
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			r.trusted = append(r.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid trusted proxy %q", entry))
+			continue
+		}
+		r.trusted = append(r.trusted, n)
+	}
+	return r, errors.Join(errs...)
+}
+
+// FromRequest returns the client IP of req as a canonical string, or "" when
+// no valid address is available.
+func (r *Resolver) FromRequest(req *http.Request) string {
+	if ip := r.resolve(req); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// ForAdRequest returns the client IP for an OpenRTB ad request, applying the
+// device IP policy to deviceIP before falling back to FromRequest.
+func (r *Resolver) ForAdRequest(req *http.Request, deviceIP string) string {
+	client := r.resolve(req)
+	if r != nil && deviceIP != "" {
+		if dev := Parse(deviceIP); dev != nil {
+			switch r.deviceIP {
+			case DeviceIPAlways:
+				return dev.String()
+			case DeviceIPTrusted:
+				if client != nil && r.isTrusted(client) {
+					return dev.String()
+				}
+			}
+		}
+	}
+	if client != nil {
+		return client.String()
+	}
+	return ""
+}
+
+// resolve walks the forwarding chain of the configured header from the
+// connection address back towards the client, stopping at the first hop that
+// is not a trusted proxy.
+func (r *Resolver) resolve(req *http.Request) net.IP {
+	peer := Parse(req.RemoteAddr)
+	if peer == nil || r == nil || !r.isTrusted(peer) {
+		return peer
+	}
+
+	var chain []net.IP
+	switch r.header {
+	case HeaderForwarded:
+		chain = forwardedFor(req.Header.Values("Forwarded"))
+	case HeaderXRealIP:
+		if ip := Parse(req.Header.Get("X-Real-IP")); ip != nil {
+			return ip
+		}
+	default:
+		chain = xForwardedFor(req.Header.Values("X-Forwarded-For"))
+	}
+	if len(chain) == 0 {
+		return peer
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := chain[i]
+		if ip == nil {
+			// Obfuscated or malformed hop: nothing further left can be trusted.
+			return peer
+		}
+		if !r.isTrusted(ip) || i == 0 {
+			return ip
+		}
+		peer = ip
+	}
+	return peer
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, n := range r.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses an address that may carry a port, brackets or an IPv6 zone,
+// and returns IPv4-mapped IPv6 addresses in their 4-byte form. It returns nil
+// for anything that is not an IP address.
+func Parse(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if i := strings.IndexByte(s, '%'); i != -1 {
+		s = s[:i]
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// xForwardedFor flattens X-Forwarded-For headers into a list of hops, oldest
+// first. Entries that are not addresses are kept as nil.
+func xForwardedFor(values []string) []net.IP {
+	var chain []net.IP
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				chain = append(chain, Parse(part))
+			}
+		}
+	}
+	return chain
+}
+
+// forwardedFor extracts the for= parameters of RFC 7239 Forwarded headers,
+// oldest first. Obfuscated identifiers and "unknown" are kept as nil.
+func forwardedFor(values []string) []net.IP {
+	var chain []net.IP
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				chain = append(chain, Parse(strings.Trim(val, `"`)))
+			}
+		}
+	}
+	return chain
+}
@@ -0,0 +1,102 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "2001:db8:ffff::1"}
+	resolvers := make(map[Header]*Resolver)
+	for _, h := range []Header{HeaderXForwardedFor, HeaderForwarded, HeaderXRealIP} {
+		r, err := New(trusted, h, DeviceIPNever)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		resolvers[h] = r
+	}
+
+	tests := []struct {
+		name    string
+		header  Header
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct client", HeaderXForwardedFor, "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"spoofed header from untrusted peer", HeaderXForwardedFor, "203.0.113.7:5000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"single proxy", HeaderXForwardedFor, "10.0.0.2:80", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoof prepended by client", HeaderXForwardedFor, "10.0.0.2:80", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"all hops trusted", HeaderXForwardedFor, "10.0.0.2:80", map[string]string{"X-Forwarded-For": "10.1.1.1, 10.0.0.3"}, "10.1.1.1"},
+		{"spoofed forwarded with xff proxy", HeaderXForwardedFor, "10.0.0.2:80", map[string]string{"Forwarded": "for=1.2.3.4", "X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed x-real-ip with xff proxy", HeaderXForwardedFor, "10.0.0.2:80", map[string]string{"X-Real-IP": "1.2.3.4"}, "10.0.0.2"},
+		{"forwarded header", HeaderForwarded, "10.0.0.2:80", map[string]string{"Forwarded": `for="[2001:db8::17]:4711";proto=https, for=10.0.0.3`}, "2001:db8::17"},
+		{"spoofed xff with forwarded proxy", HeaderForwarded, "10.0.0.2:80", map[string]string{"Forwarded": "for=198.51.100.9", "X-Forwarded-For": "1.2.3.4"}, "198.51.100.9"},
+		{"obfuscated hop stops walk", HeaderForwarded, "10.0.0.2:80", map[string]string{"Forwarded": "for=198.51.100.9, for=_hidden"}, "10.0.0.2"},
+		{"x-real-ip", HeaderXRealIP, "10.0.0.2:80", map[string]string{"X-Real-IP": "198.51.100.4"}, "198.51.100.4"},
+		{"spoofed xff with x-real-ip proxy", HeaderXRealIP, "10.0.0.2:80", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "10.0.0.2"},
+		{"ipv4-mapped ipv6 peer", HeaderXForwardedFor, "[::ffff:203.0.113.8]:443", nil, "203.0.113.8"},
+		{"trusted ipv6 proxy", HeaderXForwardedFor, "[2001:db8:ffff::1]:443", map[string]string{"X-Forwarded-For": "2001:db8::abcd"}, "2001:db8::abcd"},
+		{"ipv6 zone", HeaderXForwardedFor, "[fe80::1%eth0]:443", nil, "fe80::1"},
+		{"garbage remote addr", HeaderXForwardedFor, "not-an-ip", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := resolvers[tt.header].FromRequest(req); got != tt.want {
+				t.Errorf("FromRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForAdRequest(t *testing.T) {
+	trusted, _ := New([]string{"10.0.0.0/8"}, "", DeviceIPTrusted)
+	always, _ := New(nil, "", DeviceIPAlways)
+	never, _ := New([]string{"10.0.0.0/8"}, "", DeviceIPNever)
+
+	s2s := httptest.NewRequest("POST", "/ad", nil)
+	s2s.RemoteAddr = "10.0.0.5:1234"
+	browser := httptest.NewRequest("POST", "/ad", nil)
+	browser.RemoteAddr = "203.0.113.7:1234"
+
+	tests := []struct {
+		name string
+		r    *Resolver
+		req  string
+		dev  string
+		want string
+	}{
+		{"trusted caller", trusted, "s2s", "198.51.100.1", "198.51.100.1"},
+		{"untrusted caller", trusted, "browser", "198.51.100.1", "203.0.113.7"},
+		{"always", always, "browser", "198.51.100.1", "198.51.100.1"},
+		{"never", never, "s2s", "198.51.100.1", "10.0.0.5"},
+		{"invalid device ip", always, "browser", "bogus", "203.0.113.7"},
+		{"nil resolver", nil, "browser", "198.51.100.1", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := browser
+			if tt.req == "s2s" {
+				req = s2s
+			}
+			if got := tt.r.ForAdRequest(req, tt.dev); got != tt.want {
+				t.Errorf("ForAdRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReportsInvalidEntries(t *testing.T) {
+	r, err := New([]string{"10.0.0.0/8", "bogus", "300.1.1.1"}, "true-client-ip", "sometimes")
+	if err == nil {
+		t.Fatal("expected error for invalid entries")
+	}
+	if len(r.trusted) != 1 || r.header != HeaderXForwardedFor || r.deviceIP != DeviceIPNever {
+		t.Errorf("unexpected resolver %+v", r)
+	}
+}
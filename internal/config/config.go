@@ -3,7 +3,10 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/patrickwarner/openadserve/internal/clientip"
 )
 
 // Config holds application configuration derived from environment variables.
@@ -40,6 +43,97 @@ type Config struct {
 	TracingEnabled    bool
 	TempoEndpoint     string
 	TracingSampleRate float64
+	// Data retention configuration; a zero retention keeps data indefinitely
+	RetentionEventsDays      int
+	RetentionAdReportsDays   int
+	RetentionPrivacyJobsDays int
+	RetentionPurgeInterval   time.Duration
+	// PrivacyExportTTL is how long the result of a user data export can be
+	// downloaded before it is removed from its job
+	PrivacyExportTTL time.Duration
+	// IPAnonymization truncates client IPs before they are stored or traced
+	IPAnonymization bool
+	// Client IP resolution: proxies whose forwarding header is honoured, the
+	// header they set and when device.ip from ad requests is used
+	TrustedProxies []string
+	ClientIPHeader string
+	DeviceIPPolicy string
+	// Invalid traffic detection; zero limits disable the velocity checks
+	IVTEnabled          bool
+	IVTDatacenterList   string
+	IVTIPRequestLimit   int
+	IVTUserRequestLimit int
+	IVTVelocityWindow   time.Duration
+	IVTMinClickDelay    time.Duration
+	IVTClickIPLimit     int
+	IVTClickUserLimit   int
+	IVTClickWindow      time.Duration
+	IVTMaxTokenIPs      int
+	IVTNoBid            bool
+	// ViewabilityMode is "measure" to record viewable impressions, or "off"
+	// to disable viewability tracking. vCPM line items only spend when
+	// viewable impressions are measured.
+	ViewabilityMode string
+	// DefaultViewabilityRate and ViewabilityRateWeight smooth the per-placement
+	// viewability rate used to rank vCPM line items. The default acts as the
+	// rate of ViewabilityRateWeight prior impressions.
+	DefaultViewabilityRate float64
+	ViewabilityRateWeight  float64
+	// ViewabilityRateDays is the number of days of measurements the rate
+	// covers, so it follows changes to the placement.
+	ViewabilityRateDays int
+	// ConversionPostClickWindow and ConversionPostViewWindow bound how long
+	// after a click or impression a conversion is attributed to it. Zero
+	// disables that kind of attribution.
+	ConversionPostClickWindow time.Duration
+	ConversionPostViewWindow  time.Duration
+	// PostbackSecret derives the per-campaign keys server-to-server
+	// postbacks must carry; postbacks are refused while it is empty.
+	PostbackSecret string
+	// ConversionMaxValue bounds the value of a conversion and
+	// ConversionMaxOrders the number of orders one click or impression
+	// converts into; zero means no limit.
+	ConversionMaxValue  float64
+	ConversionMaxOrders int
+	// PublicBaseURL is the externally reachable scheme and host of the server,
+	// e.g. "https://ads.example.com". VAST documents need absolute tracking
+	// URLs; when empty they are derived from the ad request's host.
+	PublicBaseURL string
+	// VASTMaxWrapperDepth is the most VAST wrappers a programmatic video bid
+	// may pass through before reaching its inline ad.
+	VASTMaxWrapperDepth int
+	// PriceEncryptionKey and PriceIntegrityKey are base64 keys for encrypting
+	// the ${AUCTION_PRICE} macro in ad markup and click URLs. When unset the
+	// price is substituted in cleartext.
+	PriceEncryptionKey string
+	PriceIntegrityKey  string
+	// TrackerWorkers is the number of workers firing third-party trackers
+	// from the server; zero disables server-side firing. At most
+	// TrackerQueueSize URLs wait for a worker, and failed requests are
+	// retried TrackerRetries times starting TrackerRetryBackoff apart.
+	TrackerWorkers      int
+	TrackerQueueSize    int
+	TrackerRetries      int
+	TrackerRetryBackoff time.Duration
+	// TrackerTimeout bounds each tracker request. TrackerDomainTimeouts
+	// overrides it per domain as "domain=duration" pairs separated by commas.
+	TrackerTimeout        time.Duration
+	TrackerDomainTimeouts string
+	// AssetStorage selects where uploaded creative assets are stored:
+	// "local" keeps them in AssetDir, "s3" in an S3-compatible bucket.
+	AssetStorage string
+	AssetDir     string
+	// AssetMaxBytes, AssetMaxWidth and AssetMaxHeight bound uploads.
+	AssetMaxBytes  int
+	AssetMaxWidth  int
+	AssetMaxHeight int
+	// AssetS3* configure the "s3" asset storage. An empty endpoint uses the
+	// AWS endpoint of the region.
+	AssetS3Endpoint  string
+	AssetS3Bucket    string
+	AssetS3Region    string
+	AssetS3AccessKey string
+	AssetS3SecretKey string
 }
 
 // Load parses environment variables and returns a Config populated with
@@ -84,6 +178,66 @@ func Load() Config {
 	cfg.TempoEndpoint = getenv("TEMPO_ENDPOINT", "tempo:4317")
 	cfg.TracingSampleRate = envFloat("TRACING_SAMPLE_RATE", 1.0) // Default to 100% sampling for dev
 
+	// Data retention and IP handling
+	cfg.RetentionEventsDays = envInt("RETENTION_EVENTS_DAYS", 0)
+	cfg.RetentionAdReportsDays = envInt("RETENTION_AD_REPORTS_DAYS", 0)
+	cfg.RetentionPrivacyJobsDays = envInt("RETENTION_PRIVACY_JOBS_DAYS", 0)
+	cfg.RetentionPurgeInterval = envDuration("RETENTION_PURGE_INTERVAL", time.Hour)
+	cfg.PrivacyExportTTL = envDuration("PRIVACY_EXPORT_TTL", 24*time.Hour)
+	cfg.IPAnonymization = envBool("IP_ANONYMIZATION", false)
+
+	// Client IP resolution
+	cfg.TrustedProxies = envList("TRUSTED_PROXIES", clientip.DefaultTrustedProxies)
+	cfg.ClientIPHeader = getenv("CLIENT_IP_HEADER", string(clientip.HeaderXForwardedFor))
+	cfg.DeviceIPPolicy = getenv("DEVICE_IP_POLICY", string(clientip.DeviceIPTrusted))
+
+	// Invalid traffic detection
+	cfg.IVTEnabled = envBool("IVT_ENABLED", true)
+	cfg.IVTDatacenterList = getenv("IVT_DATACENTER_LIST", "")
+	cfg.IVTIPRequestLimit = envInt("IVT_IP_REQUEST_LIMIT", 0)
+	cfg.IVTUserRequestLimit = envInt("IVT_USER_REQUEST_LIMIT", 0)
+	cfg.IVTVelocityWindow = envDuration("IVT_VELOCITY_WINDOW", time.Minute)
+	cfg.IVTMinClickDelay = envDuration("IVT_MIN_CLICK_DELAY", time.Second)
+	cfg.IVTClickIPLimit = envInt("IVT_CLICK_IP_LIMIT", 20)
+	cfg.IVTClickUserLimit = envInt("IVT_CLICK_USER_LIMIT", 5)
+	cfg.IVTClickWindow = envDuration("IVT_CLICK_WINDOW", time.Minute)
+	cfg.IVTMaxTokenIPs = envInt("IVT_MAX_TOKEN_IPS", 3)
+	cfg.IVTNoBid = envBool("IVT_NO_BID", false)
+
+	cfg.ViewabilityMode = getenv("VIEWABILITY_MODE", "measure")
+	cfg.DefaultViewabilityRate = envFloat("DEFAULT_VIEWABILITY_RATE", 0.5)
+	cfg.ViewabilityRateWeight = envFloat("VIEWABILITY_RATE_WEIGHT", 100)
+	cfg.ViewabilityRateDays = envInt("VIEWABILITY_RATE_DAYS", 7)
+
+	cfg.ConversionPostClickWindow = envDuration("CONVERSION_POST_CLICK_WINDOW", 30*24*time.Hour)
+	cfg.ConversionPostViewWindow = envDuration("CONVERSION_POST_VIEW_WINDOW", 24*time.Hour)
+	cfg.PostbackSecret = getenv("POSTBACK_SECRET", "")
+	cfg.ConversionMaxValue = envFloat("CONVERSION_MAX_VALUE", 100000)
+	cfg.ConversionMaxOrders = envInt("CONVERSION_MAX_ORDERS", 10)
+
+	cfg.PublicBaseURL = strings.TrimSuffix(getenv("PUBLIC_BASE_URL", ""), "/")
+	cfg.VASTMaxWrapperDepth = envInt("VAST_MAX_WRAPPER_DEPTH", 5)
+	cfg.PriceEncryptionKey = getenv("PRICE_ENCRYPTION_KEY", "")
+	cfg.PriceIntegrityKey = getenv("PRICE_INTEGRITY_KEY", "")
+
+	cfg.TrackerWorkers = envInt("TRACKER_WORKERS", 8)
+	cfg.TrackerQueueSize = envInt("TRACKER_QUEUE_SIZE", 1000)
+	cfg.TrackerRetries = envInt("TRACKER_RETRIES", 2)
+	cfg.TrackerRetryBackoff = envDuration("TRACKER_RETRY_BACKOFF", 200*time.Millisecond)
+	cfg.TrackerTimeout = envDuration("TRACKER_TIMEOUT", 2*time.Second)
+	cfg.TrackerDomainTimeouts = getenv("TRACKER_DOMAIN_TIMEOUTS", "")
+
+	cfg.AssetStorage = getenv("ASSET_STORAGE", "local")
+	cfg.AssetDir = getenv("ASSET_DIR", "./data/assets")
+	cfg.AssetMaxBytes = envInt("ASSET_MAX_BYTES", 2<<20)
+	cfg.AssetMaxWidth = envInt("ASSET_MAX_WIDTH", 4096)
+	cfg.AssetMaxHeight = envInt("ASSET_MAX_HEIGHT", 4096)
+	cfg.AssetS3Endpoint = getenv("ASSET_S3_ENDPOINT", "")
+	cfg.AssetS3Bucket = getenv("ASSET_S3_BUCKET", "")
+	cfg.AssetS3Region = getenv("ASSET_S3_REGION", "us-east-1")
+	cfg.AssetS3AccessKey = getenv("ASSET_S3_ACCESS_KEY", "")
+	cfg.AssetS3SecretKey = getenv("ASSET_S3_SECRET_KEY", "")
+
 	return cfg
 }
 
@@ -125,6 +279,22 @@ func envBool(key string, def bool) bool {
 	return def
 }
 
+// envList parses a comma-separated environment variable, dropping empty
+// entries. When unset, def is returned.
+func envList(key string, def []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
 // envInt parses an integer environment variable. When unset or invalid, def is returned.
 func envInt(key string, def int) int {
 	v := os.Getenv(key)
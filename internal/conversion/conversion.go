@@ -0,0 +1,246 @@
+// Package conversion attributes advertiser conversions to the clicks and
+// impressions that led to them. Each valid click gets a click ID that the
+// advertiser passes back with the conversion; impressions and clicks are also
+// remembered per user and campaign so conversions reported with a user ID can
+// be attributed without one. Touches are kept in Redis for the post-click and
+// post-view attribution windows.
+package conversion
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Attribution types recorded in the attribution column of conversion events.
+const (
+	AttributionPostClick = "post_click" // Conversion followed a click within the post-click window.
+	AttributionPostView  = "post_view"  // Conversion followed an impression within the post-view window.
+)
+
+// ErrNotAttributed is returned when no click or impression within the
+// attribution windows matches a conversion.
+var ErrNotAttributed = errors.New("conversion not attributed")
+
+// ErrOrderLimit is returned when a touch already led to the most orders it
+// may convert into.
+var ErrOrderLimit = errors.New("conversion order limit reached")
+
+// Touch is an ad interaction a conversion can be attributed to.
+type Touch struct {
+	RequestID   string    `json:"r"`
+	ImpID       string    `json:"i"`
+	CreativeID  int       `json:"c"`
+	LineItemID  int       `json:"l"`
+	CampaignID  int       `json:"cid"`
+	PublisherID int       `json:"p"`
+	PlacementID string    `json:"pl,omitempty"`
+	UserID      string    `json:"u,omitempty"`
+	DeviceType  string    `json:"dt,omitempty"`
+	Country     string    `json:"co,omitempty"`
+	Consent     string    `json:"cs,omitempty"`
+	Domain      string    `json:"d,omitempty"`
+	AppBundle   string    `json:"ab,omitempty"`
+	PagePath    string    `json:"pp,omitempty"`
+	Categories  []string  `json:"ca,omitempty"`
+	Time        time.Time `json:"t"`
+}
+
+// Config holds the attribution windows. A zero window disables that kind of
+// attribution. MaxOrdersPerTouch bounds how many distinct orders one touch
+// converts into; zero means no limit.
+type Config struct {
+	PostClickWindow   time.Duration
+	PostViewWindow    time.Duration
+	MaxOrdersPerTouch int
+}
+
+// Tracker stores touches and attributes conversions to them. A nil Tracker
+// records nothing and attributes nothing.
+type Tracker struct {
+	Redis  *redis.Client
+	Config Config
+	Logger *zap.Logger
+}
+
+// NewTracker creates a Tracker. The logger may be nil.
+func NewTracker(rdb *redis.Client, cfg Config, logger *zap.Logger) *Tracker {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Tracker{Redis: rdb, Config: cfg, Logger: logger}
+}
+
+// RecordClick stores a click and returns the click ID identifying it. The ID
+// is empty when post-click attribution is disabled.
+func (t *Tracker) RecordClick(ctx context.Context, touch Touch) (string, error) {
+	if t == nil || t.Redis == nil || t.Config.PostClickWindow <= 0 {
+		return "", nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate click id: %w", err)
+	}
+	clickID := hex.EncodeToString(buf)
+	data, err := json.Marshal(touch)
+	if err != nil {
+		return "", fmt.Errorf("encode click: %w", err)
+	}
+
+	window := t.Config.PostClickWindow
+	pipe := t.Redis.TxPipeline()
+	pipe.Set(ctx, clickKey(clickID), data, window)
+	if touch.UserID != "" && touch.CampaignID > 0 {
+		pipe.Set(ctx, userClickKey(touch.UserID, touch.CampaignID), clickID, window)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("store click: %w", err)
+	}
+	return clickID, nil
+}
+
+// RecordView stores an impression as the user's latest view of its campaign.
+// Impressions without a user ID can't be attributed and are skipped.
+func (t *Tracker) RecordView(ctx context.Context, touch Touch) error {
+	if t == nil || t.Redis == nil || t.Config.PostViewWindow <= 0 || touch.UserID == "" || touch.CampaignID <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(touch)
+	if err != nil {
+		return fmt.Errorf("encode view: %w", err)
+	}
+	if err := t.Redis.Set(ctx, viewKey(touch.UserID, touch.CampaignID), data, t.Config.PostViewWindow).Err(); err != nil {
+		return fmt.Errorf("store view: %w", err)
+	}
+	return nil
+}
+
+// Attribute finds the touch a conversion belongs to. A click ID takes
+// precedence; otherwise the user's latest click on the campaign is used, and
+// then their latest impression of it. Clicks always win over impressions.
+func (t *Tracker) Attribute(ctx context.Context, clickID, userID string, campaignID int) (*Touch, string, error) {
+	if t == nil || t.Redis == nil {
+		return nil, "", ErrNotAttributed
+	}
+	if clickID != "" {
+		touch, err := t.load(ctx, clickKey(clickID))
+		if err != nil || touch != nil {
+			return touch, AttributionPostClick, err
+		}
+	}
+	if userID == "" || campaignID <= 0 {
+		return nil, "", ErrNotAttributed
+	}
+
+	lastClick, err := t.Redis.Get(ctx, userClickKey(userID, campaignID)).Result()
+	if err != nil && err != redis.Nil {
+		return nil, "", fmt.Errorf("load user click: %w", err)
+	}
+	if lastClick != "" {
+		touch, err := t.load(ctx, clickKey(lastClick))
+		if err != nil || touch != nil {
+			return touch, AttributionPostClick, err
+		}
+	}
+
+	touch, err := t.load(ctx, viewKey(userID, campaignID))
+	if err != nil || touch != nil {
+		return touch, AttributionPostView, err
+	}
+	return nil, "", ErrNotAttributed
+}
+
+// MarkConverted records that a touch converted and reports whether this is
+// its first conversion. When orderID is set, conversions are deduplicated per
+// order instead, so one click may lead to several orders, up to
+// MaxOrdersPerTouch; further orders return ErrOrderLimit.
+func (t *Tracker) MarkConverted(ctx context.Context, touch *Touch, orderID string) (bool, error) {
+	if t == nil || t.Redis == nil || touch == nil {
+		return true, nil
+	}
+	touchKey := "conv:done:" + touch.RequestID + ":" + touch.ImpID
+	key := touchKey
+	if orderID != "" {
+		key = fmt.Sprintf("conv:order:%d:%s", touch.CampaignID, orderID)
+	}
+	ttl := t.Config.PostClickWindow
+	if t.Config.PostViewWindow > ttl {
+		ttl = t.Config.PostViewWindow
+	}
+	first, err := t.Redis.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("mark conversion: %w", err)
+	}
+	if !first || orderID == "" || t.Config.MaxOrdersPerTouch <= 0 {
+		return first, nil
+	}
+
+	// Count the orders of the touch so replaying its click ID with new
+	// order IDs can't record unlimited conversions
+	countKey := "conv:orders:" + touch.RequestID + ":" + touch.ImpID
+	pipe := t.Redis.TxPipeline()
+	n := pipe.Incr(ctx, countKey)
+	pipe.Expire(ctx, countKey, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("count conversion orders: %w", err)
+	}
+	if n.Val() > int64(t.Config.MaxOrdersPerTouch) {
+		return false, ErrOrderLimit
+	}
+	return true, nil
+}
+
+// PostbackKey returns the key a campaign's advertiser passes with postbacks.
+// Keys are derived from the server's postback secret, so each campaign has
+// its own and a leaked key can't report conversions for other campaigns.
+func PostbackKey(secret []byte, campaignID int) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("postback:" + strconv.Itoa(campaignID)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyPostbackKey reports whether key is the postback key of the campaign.
+// An empty secret verifies nothing.
+func VerifyPostbackKey(secret []byte, campaignID int, key string) bool {
+	if len(secret) == 0 || key == "" {
+		return false
+	}
+	return hmac.Equal([]byte(key), []byte(PostbackKey(secret, campaignID)))
+}
+
+func (t *Tracker) load(ctx context.Context, key string) (*Touch, error) {
+	data, err := t.Redis.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load touch: %w", err)
+	}
+	var touch Touch
+	if err := json.Unmarshal(data, &touch); err != nil {
+		return nil, fmt.Errorf("decode touch: %w", err)
+	}
+	return &touch, nil
+}
+
+func clickKey(clickID string) string {
+	return "conv:click:" + clickID
+}
+
+func userClickKey(userID string, campaignID int) string {
+	return fmt.Sprintf("conv:uclick:%s:%d", userID, campaignID)
+}
+
+func viewKey(userID string, campaignID int) string {
+	return fmt.Sprintf("conv:view:%s:%d", userID, campaignID)
+}
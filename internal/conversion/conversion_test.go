@@ -0,0 +1,145 @@
+package conversion
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestTracker(t *testing.T, cfg Config) (*Tracker, *miniredis.Miniredis) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return NewTracker(rdb, cfg, nil), mr
+}
+
+func TestAttributeClickID(t *testing.T) {
+	tr, mr := newTestTracker(t, Config{PostClickWindow: time.Hour, PostViewWindow: time.Hour})
+	ctx := context.Background()
+
+	clickID, err := tr.RecordClick(ctx, Touch{RequestID: "req1", ImpID: "1", LineItemID: 7, CampaignID: 3})
+	if err != nil || clickID == "" {
+		t.Fatalf("RecordClick: %q %v", clickID, err)
+	}
+	touch, attribution, err := tr.Attribute(ctx, clickID, "", 0)
+	if err != nil {
+		t.Fatalf("Attribute: %v", err)
+	}
+	if attribution != AttributionPostClick || touch.LineItemID != 7 || touch.RequestID != "req1" {
+		t.Fatalf("unexpected attribution %q %+v", attribution, touch)
+	}
+
+	if _, _, err := tr.Attribute(ctx, "unknown", "", 0); !errors.Is(err, ErrNotAttributed) {
+		t.Fatalf("expected ErrNotAttributed for unknown click ID, got %v", err)
+	}
+
+	// The click expires with the post-click window.
+	mr.FastForward(2 * time.Hour)
+	if _, _, err := tr.Attribute(ctx, clickID, "", 0); !errors.Is(err, ErrNotAttributed) {
+		t.Fatalf("expected ErrNotAttributed after the window, got %v", err)
+	}
+}
+
+func TestAttributeUser(t *testing.T) {
+	tr, _ := newTestTracker(t, Config{PostClickWindow: time.Hour, PostViewWindow: time.Hour})
+	ctx := context.Background()
+
+	if err := tr.RecordView(ctx, Touch{RequestID: "req1", ImpID: "1", CampaignID: 3, UserID: "u1"}); err != nil {
+		t.Fatalf("RecordView: %v", err)
+	}
+	touch, attribution, err := tr.Attribute(ctx, "", "u1", 3)
+	if err != nil || attribution != AttributionPostView || touch.RequestID != "req1" {
+		t.Fatalf("expected post-view attribution, got %q %+v %v", attribution, touch, err)
+	}
+	if _, _, err := tr.Attribute(ctx, "", "u1", 4); !errors.Is(err, ErrNotAttributed) {
+		t.Fatalf("expected other campaigns to be unattributed, got %v", err)
+	}
+
+	// A later click takes precedence over the impression.
+	if _, err := tr.RecordClick(ctx, Touch{RequestID: "req2", ImpID: "1", CampaignID: 3, UserID: "u1"}); err != nil {
+		t.Fatalf("RecordClick: %v", err)
+	}
+	touch, attribution, err = tr.Attribute(ctx, "", "u1", 3)
+	if err != nil || attribution != AttributionPostClick || touch.RequestID != "req2" {
+		t.Fatalf("expected post-click attribution, got %q %+v %v", attribution, touch, err)
+	}
+}
+
+func TestWindowsDisabled(t *testing.T) {
+	tr, _ := newTestTracker(t, Config{})
+	ctx := context.Background()
+
+	clickID, err := tr.RecordClick(ctx, Touch{RequestID: "req1", CampaignID: 3, UserID: "u1"})
+	if err != nil || clickID != "" {
+		t.Fatalf("expected no click ID with post-click disabled, got %q %v", clickID, err)
+	}
+	if err := tr.RecordView(ctx, Touch{RequestID: "req1", CampaignID: 3, UserID: "u1"}); err != nil {
+		t.Fatalf("RecordView: %v", err)
+	}
+	if _, _, err := tr.Attribute(ctx, "", "u1", 3); !errors.Is(err, ErrNotAttributed) {
+		t.Fatalf("expected ErrNotAttributed, got %v", err)
+	}
+}
+
+func TestMarkConverted(t *testing.T) {
+	tr, _ := newTestTracker(t, Config{PostClickWindow: time.Hour})
+	ctx := context.Background()
+	touch := &Touch{RequestID: "req1", ImpID: "1", CampaignID: 3}
+
+	if first, err := tr.MarkConverted(ctx, touch, ""); err != nil || !first {
+		t.Fatalf("expected first conversion, got %v %v", first, err)
+	}
+	if first, _ := tr.MarkConverted(ctx, touch, ""); first {
+		t.Fatal("expected repeated conversion to be a duplicate")
+	}
+
+	// Distinct orders from the same touch each count once.
+	if first, _ := tr.MarkConverted(ctx, touch, "order-1"); !first {
+		t.Fatal("expected first order to count")
+	}
+	if first, _ := tr.MarkConverted(ctx, touch, "order-2"); !first {
+		t.Fatal("expected second order to count")
+	}
+	if first, _ := tr.MarkConverted(ctx, touch, "order-1"); first {
+		t.Fatal("expected repeated order to be a duplicate")
+	}
+}
+
+func TestMarkConvertedOrderLimit(t *testing.T) {
+	tr, _ := newTestTracker(t, Config{PostClickWindow: time.Hour, MaxOrdersPerTouch: 2})
+	ctx := context.Background()
+	touch := &Touch{RequestID: "req1", ImpID: "1", CampaignID: 3}
+
+	for _, order := range []string{"order-1", "order-2"} {
+		if first, err := tr.MarkConverted(ctx, touch, order); err != nil || !first {
+			t.Fatalf("%s: expected the order to count, got %v %v", order, first, err)
+		}
+	}
+	if _, err := tr.MarkConverted(ctx, touch, "order-3"); !errors.Is(err, ErrOrderLimit) {
+		t.Fatalf("expected ErrOrderLimit past the limit, got %v", err)
+	}
+	// Other touches have their own limit
+	if first, err := tr.MarkConverted(ctx, &Touch{RequestID: "req2", ImpID: "1", CampaignID: 3}, "order-4"); err != nil || !first {
+		t.Fatalf("expected another touch to convert, got %v %v", first, err)
+	}
+}
+
+func TestPostbackKey(t *testing.T) {
+	secret := []byte("s3cret")
+	key := PostbackKey(secret, 3)
+	if !VerifyPostbackKey(secret, 3, key) {
+		t.Fatal("expected the campaign's key to verify")
+	}
+	if VerifyPostbackKey(secret, 4, key) || VerifyPostbackKey([]byte("other"), 3, key) || VerifyPostbackKey(nil, 3, PostbackKey(nil, 3)) {
+		t.Fatal("expected keys of other campaigns and secrets, and an empty secret, not to verify")
+	}
+}
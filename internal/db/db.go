@@ -11,6 +11,7 @@ type DB struct {
 	Creatives  []models.Creative
 	Placements map[string]models.Placement
 	Publishers map[int]models.Publisher
+	Templates  map[int]models.CreativeTemplate
 
 	creativeIndexByPlacement map[string][]models.Creative
 	creativeIndexByID        map[int]*models.Creative
@@ -37,6 +38,15 @@ func Init(pg *Postgres, dataStore models.AdDataStore) (*DB, error) {
 		publishers[p.ID] = p
 	}
 
+	tmpls, err := pg.LoadTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("load creative templates: %w", err)
+	}
+	templates := make(map[int]models.CreativeTemplate, len(tmpls))
+	for _, t := range tmpls {
+		templates[t.ID] = t
+	}
+
 	creatives, err := pg.LoadCreatives()
 	if err != nil {
 		return nil, fmt.Errorf("load creatives: %w", err)
@@ -65,12 +75,19 @@ func Init(pg *Postgres, dataStore models.AdDataStore) (*DB, error) {
 		if _, ok := placements[cr.PlacementID]; !ok {
 			return nil, fmt.Errorf("creative %d references undefined placement %s", cr.ID, cr.PlacementID)
 		}
+		if cr.TemplateID != 0 {
+			t, ok := templates[cr.TemplateID]
+			if !ok {
+				return nil, fmt.Errorf("creative %d references undefined template %d", cr.ID, cr.TemplateID)
+			}
+			cr.Template = &t
+		}
 
 		indexByPlacement[cr.PlacementID] = append(indexByPlacement[cr.PlacementID], *cr)
 		indexByID[cr.ID] = cr
 	}
 
-	return &DB{Creatives: creatives, Placements: placements, Publishers: publishers, creativeIndexByPlacement: indexByPlacement, creativeIndexByID: indexByID}, nil
+	return &DB{Creatives: creatives, Placements: placements, Publishers: publishers, Templates: templates, creativeIndexByPlacement: indexByPlacement, creativeIndexByID: indexByID}, nil
 }
 
 // FindCreativesForPlacement returns all creatives that match a placement ID.
@@ -111,6 +128,12 @@ func (d *DB) GetPublisher(id int) (models.Publisher, bool) {
 	return p, ok
 }
 
+// GetTemplate returns the creative template for the given ID.
+func (d *DB) GetTemplate(id int) (models.CreativeTemplate, bool) {
+	t, ok := d.Templates[id]
+	return t, ok
+}
+
 // BuildIndexes builds the internal indexes for the DB. Used primarily for testing.
 func (d *DB) BuildIndexes() {
 	indexByPlacement := make(map[string][]models.Creative)
@@ -119,6 +142,9 @@ func (d *DB) BuildIndexes() {
 	for i := range d.Creatives {
 		cr := &d.Creatives[i]
 		// LineItem should already be populated during Init()
+		if t, ok := d.Templates[cr.TemplateID]; ok && cr.TemplateID != 0 {
+			cr.Template = &t
+		}
 		indexByPlacement[cr.PlacementID] = append(indexByPlacement[cr.PlacementID], *cr)
 		indexByID[cr.ID] = cr
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -110,6 +111,71 @@ CREATE TABLE IF NOT EXISTS ad_reports (
     status VARCHAR(20) DEFAULT 'pending'
 );
 
+CREATE TABLE IF NOT EXISTS privacy_jobs (
+    id SERIAL PRIMARY KEY,
+    job_type VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    subject_hash CHAR(64) NOT NULL,
+    error TEXT,
+    result JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS privacy_audit_log (
+    id SERIAL PRIMARY KEY,
+    job_id INTEGER REFERENCES privacy_jobs(id),
+    store VARCHAR(50) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    records BIGINT NOT NULL DEFAULT 0,
+    detail TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS creative_templates (
+    id SERIAL PRIMARY KEY,
+    publisher_id INT REFERENCES publishers(id),
+    name TEXT NOT NULL,
+    format TEXT NOT NULL DEFAULT 'html',
+    body TEXT NOT NULL,
+    variables JSONB
+);
+
+-- Columns added after the initial schema; keeps existing databases in step.
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS vendor_id INT;
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS coppa_safe BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS domains TEXT[];
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS page_paths TEXT[];
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS app_bundles TEXT[];
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS categories TEXT[];
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS cities TEXT[];
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS metros TEXT[];
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS postal_codes TEXT[];
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS geofences JSONB;
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS cpa DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS daily_event_caps JSONB;
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS adomain TEXT;
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS impression_trackers TEXT[];
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS click_trackers TEXT[];
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS server_side_trackers BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE line_items ADD COLUMN IF NOT EXISTS referrers TEXT[];
+ALTER TABLE publishers ADD COLUMN IF NOT EXISTS child_directed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE publishers ADD COLUMN IF NOT EXISTS event_types JSONB;
+ALTER TABLE placements ADD COLUMN IF NOT EXISTS child_directed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE placements ADD COLUMN IF NOT EXISTS video JSONB;
+ALTER TABLE placements ADD COLUMN IF NOT EXISTS native JSONB;
+ALTER TABLE placements ADD COLUMN IF NOT EXISTS sizes JSONB;
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS video JSONB;
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS start_date TIMESTAMP;
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS end_date TIMESTAMP;
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS weight INT NOT NULL DEFAULT 0;
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS frequency_cap INT NOT NULL DEFAULT 0;
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS frequency_window INT NOT NULL DEFAULT 0;
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS impression_trackers TEXT[];
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS click_trackers TEXT[];
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS template_id INT NOT NULL DEFAULT 0;
+ALTER TABLE creatives ADD COLUMN IF NOT EXISTS template_values JSONB;
+
 -- Performance indexes for ad serving
 CREATE INDEX IF NOT EXISTS idx_line_items_active_dates ON line_items (active, start_date, end_date) WHERE active = true;
 CREATE INDEX IF NOT EXISTS idx_creatives_placement_id ON creatives (placement_id);
@@ -119,6 +185,9 @@ CREATE INDEX IF NOT EXISTS idx_line_items_publisher_id ON line_items (publisher_
 CREATE INDEX IF NOT EXISTS idx_publishers_api_key ON publishers (api_key);
 CREATE INDEX IF NOT EXISTS idx_campaigns_publisher_id ON campaigns (publisher_id);
 CREATE INDEX IF NOT EXISTS idx_placements_publisher_id ON placements (publisher_id);
+CREATE INDEX IF NOT EXISTS idx_ad_reports_user_id ON ad_reports (user_id);
+CREATE INDEX IF NOT EXISTS idx_privacy_jobs_subject_hash ON privacy_jobs (subject_hash);
+CREATE INDEX IF NOT EXISTS idx_privacy_audit_log_job_id ON privacy_audit_log (job_id);
 `
 
 // InitPostgres connects to Postgres with connection pooling configuration.
@@ -206,7 +275,7 @@ func (p *Postgres) ensureReportReasons() error {
 
 // LoadLineItems retrieves active line items from the database.
 func (p *Postgres) LoadLineItems() ([]models.LineItem, error) {
-	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, campaign_id, publisher_id, name, start_date, end_date, daily_impression_cap, daily_click_cap, pace_type, priority, frequency_cap, frequency_window, country, device_type, os, browser, active, key_values, cpm, cpc, ecpm, budget_type, budget_amount, spend, li_type, endpoint, click_url FROM line_items WHERE active AND (start_date IS NULL OR start_date <= NOW()) AND (end_date IS NULL OR end_date >= NOW())`)
+	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, campaign_id, publisher_id, name, start_date, end_date, daily_impression_cap, daily_click_cap, pace_type, priority, frequency_cap, frequency_window, country, device_type, os, browser, active, key_values, cpm, cpc, ecpm, budget_type, budget_amount, spend, li_type, endpoint, click_url, vendor_id, coppa_safe, domains, page_paths, app_bundles, categories, cities, metros, postal_codes, geofences, cpa, daily_event_caps, adomain, impression_trackers, click_trackers, server_side_trackers, referrers FROM line_items WHERE active AND (start_date IS NULL OR start_date <= NOW()) AND (end_date IS NULL OR end_date >= NOW())`)
 	if err != nil {
 		return nil, fmt.Errorf("query line items: %w", err)
 	}
@@ -222,8 +291,10 @@ func (p *Postgres) LoadLineItems() ([]models.LineItem, error) {
 		var kv sql.NullString
 		var pace, priority, country, deviceType, osVal, browser sql.NullString
 		var active bool
-		var budgetType, liType, endpoint, clickURL sql.NullString
-		if err := rows.Scan(&li.ID, &li.CampaignID, &li.PublisherID, &li.Name, &start, &end, &li.DailyImpressionCap, &li.DailyClickCap, &pace, &priority, &li.FrequencyCap, &freq, &country, &deviceType, &osVal, &browser, &active, &kv, &li.CPM, &li.CPC, &li.ECPM, &budgetType, &li.BudgetAmount, &li.Spend, &liType, &endpoint, &clickURL); err != nil {
+		var budgetType, liType, endpoint, clickURL, adomain sql.NullString
+		var vendorID sql.NullInt64
+		var geofences, eventCaps sql.NullString
+		if err := rows.Scan(&li.ID, &li.CampaignID, &li.PublisherID, &li.Name, &start, &end, &li.DailyImpressionCap, &li.DailyClickCap, &pace, &priority, &li.FrequencyCap, &freq, &country, &deviceType, &osVal, &browser, &active, &kv, &li.CPM, &li.CPC, &li.ECPM, &budgetType, &li.BudgetAmount, &li.Spend, &liType, &endpoint, &clickURL, &vendorID, &li.COPPASafe, pq.Array(&li.Domains), pq.Array(&li.PagePaths), pq.Array(&li.AppBundles), pq.Array(&li.Categories), pq.Array(&li.Cities), pq.Array(&li.Metros), pq.Array(&li.PostalCodes), &geofences, &li.CPA, &eventCaps, &adomain, pq.Array(&li.ImpressionTrackers), pq.Array(&li.ClickTrackers), &li.ServerSideTrackers, pq.Array(&li.Referrers)); err != nil {
 			return nil, fmt.Errorf("scan line item: %w", err)
 		}
 		if pace.Valid {
@@ -260,6 +331,12 @@ func (p *Postgres) LoadLineItems() ([]models.LineItem, error) {
 		if clickURL.Valid {
 			li.ClickURL = clickURL.String
 		}
+		if vendorID.Valid {
+			li.VendorID = int(vendorID.Int64)
+		}
+		if adomain.Valid {
+			li.ADomain = adomain.String
+		}
 		if start.Valid {
 			li.StartDate = start.Time
 		}
@@ -274,6 +351,16 @@ func (p *Postgres) LoadLineItems() ([]models.LineItem, error) {
 				return nil, fmt.Errorf("parse key_values: %w", err)
 			}
 		}
+		if geofences.Valid {
+			if err := json.Unmarshal([]byte(geofences.String), &li.Geofences); err != nil {
+				return nil, fmt.Errorf("parse geofences: %w", err)
+			}
+		}
+		if eventCaps.Valid {
+			if err := json.Unmarshal([]byte(eventCaps.String), &li.DailyEventCaps); err != nil {
+				return nil, fmt.Errorf("parse daily_event_caps: %w", err)
+			}
+		}
 		items = append(items, li)
 	}
 	if err := rows.Err(); err != nil {
@@ -307,7 +394,7 @@ func (p *Postgres) LoadCampaigns() ([]models.Campaign, error) {
 
 // LoadPlacements fetches placement definitions from the database.
 func (p *Postgres) LoadPlacements() ([]models.Placement, error) {
-	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, publisher_id, width, height, formats FROM placements`)
+	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, publisher_id, width, height, formats, child_directed, video, native, sizes FROM placements`)
 	if err != nil {
 		return nil, fmt.Errorf("query placements: %w", err)
 	}
@@ -318,10 +405,26 @@ func (p *Postgres) LoadPlacements() ([]models.Placement, error) {
 	for rows.Next() {
 		var pl models.Placement
 		var formats []string
-		if err := rows.Scan(&pl.ID, &pl.PublisherID, &pl.Width, &pl.Height, pq.Array(&formats)); err != nil {
+		var video, native, sizes sql.NullString
+		if err := rows.Scan(&pl.ID, &pl.PublisherID, &pl.Width, &pl.Height, pq.Array(&formats), &pl.ChildDirected, &video, &native, &sizes); err != nil {
 			return nil, fmt.Errorf("scan placement: %w", err)
 		}
 		pl.Formats = formats
+		if video.Valid {
+			if err := json.Unmarshal([]byte(video.String), &pl.Video); err != nil {
+				return nil, fmt.Errorf("parse placement video: %w", err)
+			}
+		}
+		if native.Valid {
+			if err := json.Unmarshal([]byte(native.String), &pl.Native); err != nil {
+				return nil, fmt.Errorf("parse placement native: %w", err)
+			}
+		}
+		if sizes.Valid {
+			if err := json.Unmarshal([]byte(sizes.String), &pl.Sizes); err != nil {
+				return nil, fmt.Errorf("parse placement sizes: %w", err)
+			}
+		}
 		pls = append(pls, pl)
 	}
 	if err := rows.Err(); err != nil {
@@ -332,7 +435,7 @@ func (p *Postgres) LoadPlacements() ([]models.Placement, error) {
 
 // LoadCreatives fetches creatives from the database.
 func (p *Postgres) LoadCreatives() ([]models.Creative, error) {
-	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, placement_id, line_item_id, campaign_id, publisher_id, html, native, banner, width, height, format, click_url FROM creatives`)
+	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, placement_id, line_item_id, campaign_id, publisher_id, html, native, banner, width, height, format, click_url, video, start_date, end_date, weight, frequency_cap, frequency_window, impression_trackers, click_trackers, template_id, template_values FROM creatives`)
 	if err != nil {
 		return nil, fmt.Errorf("query creatives: %w", err)
 	}
@@ -342,8 +445,10 @@ func (p *Postgres) LoadCreatives() ([]models.Creative, error) {
 	var cs []models.Creative
 	for rows.Next() {
 		var c models.Creative
-		var native, banner, clickURL sql.NullString
-		if err := rows.Scan(&c.ID, &c.PlacementID, &c.LineItemID, &c.CampaignID, &c.PublisherID, &c.HTML, &native, &banner, &c.Width, &c.Height, &c.Format, &clickURL); err != nil {
+		var native, banner, clickURL, video, templateValues sql.NullString
+		var start, end sql.NullTime
+		var freq int64
+		if err := rows.Scan(&c.ID, &c.PlacementID, &c.LineItemID, &c.CampaignID, &c.PublisherID, &c.HTML, &native, &banner, &c.Width, &c.Height, &c.Format, &clickURL, &video, &start, &end, &c.Weight, &c.FrequencyCap, &freq, pq.Array(&c.ImpressionTrackers), pq.Array(&c.ClickTrackers), &c.TemplateID, &templateValues); err != nil {
 			return nil, fmt.Errorf("scan creative: %w", err)
 		}
 		if native.Valid {
@@ -355,6 +460,23 @@ func (p *Postgres) LoadCreatives() ([]models.Creative, error) {
 		if clickURL.Valid {
 			c.ClickURL = clickURL.String
 		}
+		if video.Valid {
+			if err := json.Unmarshal([]byte(video.String), &c.Video); err != nil {
+				return nil, fmt.Errorf("parse creative video: %w", err)
+			}
+		}
+		if templateValues.Valid {
+			if err := json.Unmarshal([]byte(templateValues.String), &c.TemplateValues); err != nil {
+				return nil, fmt.Errorf("parse creative template values: %w", err)
+			}
+		}
+		if start.Valid {
+			c.StartDate = start.Time
+		}
+		if end.Valid {
+			c.EndDate = end.Time
+		}
+		c.FrequencyWindow = time.Duration(freq) * time.Second
 		cs = append(cs, c)
 	}
 	if err := rows.Err(); err != nil {
@@ -365,7 +487,7 @@ func (p *Postgres) LoadCreatives() ([]models.Creative, error) {
 
 // LoadPublishers fetches publishers from the database.
 func (p *Postgres) LoadPublishers() ([]models.Publisher, error) {
-	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, name, domain, api_key FROM publishers`)
+	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, name, domain, api_key, child_directed, event_types FROM publishers`)
 	if err != nil {
 		return nil, fmt.Errorf("query publishers: %w", err)
 	}
@@ -375,9 +497,15 @@ func (p *Postgres) LoadPublishers() ([]models.Publisher, error) {
 	var pubs []models.Publisher
 	for rows.Next() {
 		var pub models.Publisher
-		if err := rows.Scan(&pub.ID, &pub.Name, &pub.Domain, &pub.APIKey); err != nil {
+		var eventTypes sql.NullString
+		if err := rows.Scan(&pub.ID, &pub.Name, &pub.Domain, &pub.APIKey, &pub.ChildDirected, &eventTypes); err != nil {
 			return nil, fmt.Errorf("scan publisher: %w", err)
 		}
+		if eventTypes.Valid {
+			if err := json.Unmarshal([]byte(eventTypes.String), &pub.EventTypes); err != nil {
+				return nil, fmt.Errorf("parse event_types: %w", err)
+			}
+		}
 		pubs = append(pubs, pub)
 	}
 	if err := rows.Err(); err != nil {
@@ -388,7 +516,8 @@ func (p *Postgres) LoadPublishers() ([]models.Publisher, error) {
 
 // InsertPublisher inserts a new publisher record and returns the generated ID.
 func (p *Postgres) InsertPublisher(pub *models.Publisher) error {
-	err := p.DB.QueryRowContext(context.Background(), `INSERT INTO publishers (name, domain, api_key) VALUES ($1,$2,$3) RETURNING id`, pub.Name, pub.Domain, pub.APIKey).Scan(&pub.ID)
+	eventTypes, _ := json.Marshal(pub.EventTypes)
+	err := p.DB.QueryRowContext(context.Background(), `INSERT INTO publishers (name, domain, api_key, child_directed, event_types) VALUES ($1,$2,$3,$4,$5) RETURNING id`, pub.Name, pub.Domain, pub.APIKey, pub.ChildDirected, eventTypes).Scan(&pub.ID)
 	if err != nil {
 		return fmt.Errorf("insert publisher: %w", err)
 	}
@@ -402,7 +531,7 @@ func (p *Postgres) InsertAdReport(r models.AdReport) error {
             placement_id, report_reason, ip_address, user_agent, status)
             VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`,
 		r.CreativeID, r.LineItemID, r.CampaignID, r.PublisherID, r.UserID,
-		r.PlacementID, r.ReportReason, r.IPAddress, r.UserAgent, r.Status)
+		r.PlacementID, r.ReportReason, sql.NullString{String: r.IPAddress, Valid: r.IPAddress != ""}, r.UserAgent, r.Status)
 	if err != nil {
 		return fmt.Errorf("insert ad report: %w", err)
 	}
@@ -411,7 +540,8 @@ func (p *Postgres) InsertAdReport(r models.AdReport) error {
 
 // UpdatePublisher updates an existing publisher.
 func (p *Postgres) UpdatePublisher(pub models.Publisher) error {
-	_, err := p.DB.ExecContext(context.Background(), `UPDATE publishers SET name=$1, domain=$2, api_key=$3 WHERE id=$4`, pub.Name, pub.Domain, pub.APIKey, pub.ID)
+	eventTypes, _ := json.Marshal(pub.EventTypes)
+	_, err := p.DB.ExecContext(context.Background(), `UPDATE publishers SET name=$1, domain=$2, api_key=$3, child_directed=$4, event_types=$5 WHERE id=$6`, pub.Name, pub.Domain, pub.APIKey, pub.ChildDirected, eventTypes, pub.ID)
 	if err != nil {
 		return fmt.Errorf("update publisher: %w", err)
 	}
@@ -469,7 +599,10 @@ func (p *Postgres) DeleteCampaign(id int) error {
 
 // InsertPlacement inserts a new placement.
 func (p *Postgres) InsertPlacement(pl models.Placement) error {
-	_, err := p.DB.ExecContext(context.Background(), `INSERT INTO placements (id, publisher_id, width, height, formats) VALUES ($1,$2,$3,$4,$5)`, pl.ID, pl.PublisherID, pl.Width, pl.Height, pq.Array(pl.Formats))
+	video, _ := json.Marshal(pl.Video)
+	native, _ := json.Marshal(pl.Native)
+	sizes, _ := json.Marshal(pl.Sizes)
+	_, err := p.DB.ExecContext(context.Background(), `INSERT INTO placements (id, publisher_id, width, height, formats, child_directed, video, native, sizes) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`, pl.ID, pl.PublisherID, pl.Width, pl.Height, pq.Array(pl.Formats), pl.ChildDirected, video, native, sizes)
 	if err != nil {
 		return fmt.Errorf("insert placement: %w", err)
 	}
@@ -478,7 +611,10 @@ func (p *Postgres) InsertPlacement(pl models.Placement) error {
 
 // UpdatePlacement updates an existing placement.
 func (p *Postgres) UpdatePlacement(pl models.Placement) error {
-	_, err := p.DB.ExecContext(context.Background(), `UPDATE placements SET publisher_id=$1, width=$2, height=$3, formats=$4 WHERE id=$5`, pl.PublisherID, pl.Width, pl.Height, pq.Array(pl.Formats), pl.ID)
+	video, _ := json.Marshal(pl.Video)
+	native, _ := json.Marshal(pl.Native)
+	sizes, _ := json.Marshal(pl.Sizes)
+	_, err := p.DB.ExecContext(context.Background(), `UPDATE placements SET publisher_id=$1, width=$2, height=$3, formats=$4, child_directed=$5, video=$6, native=$7, sizes=$8 WHERE id=$9`, pl.PublisherID, pl.Width, pl.Height, pq.Array(pl.Formats), pl.ChildDirected, video, native, sizes, pl.ID)
 	if err != nil {
 		return fmt.Errorf("update placement: %w", err)
 	}
@@ -504,19 +640,27 @@ func (p *Postgres) DeletePlacement(id string) error {
 // InsertLineItem inserts a new line item and returns the generated ID.
 func (p *Postgres) InsertLineItem(li *models.LineItem) error {
 	kv, _ := json.Marshal(li.KeyValues)
+	fences, _ := json.Marshal(li.Geofences)
+	eventCaps, _ := json.Marshal(li.DailyEventCaps)
 	err := p.DB.QueryRowContext(context.Background(), `INSERT INTO line_items (
         campaign_id, publisher_id, name, start_date, end_date,
         daily_impression_cap, daily_click_cap, pace_type, priority,
         frequency_cap, frequency_window, country, device_type, os, browser,
         active, key_values, cpm, cpc, ecpm, budget_type, budget_amount, spend,
-        li_type, endpoint, click_url) VALUES (
-        $1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26
+        li_type, endpoint, click_url, vendor_id, coppa_safe, domains, page_paths,
+        app_bundles, categories, cities, metros, postal_codes, geofences, cpa,
+        daily_event_caps, adomain, impression_trackers, click_trackers,
+        server_side_trackers, referrers) VALUES (
+        $1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,$27,$28,$29,$30,$31,$32,$33,$34,$35,$36,$37,$38,$39,$40,$41,$42,$43
     ) RETURNING id`,
 		li.CampaignID, li.PublisherID, li.Name, li.StartDate, li.EndDate,
 		li.DailyImpressionCap, li.DailyClickCap, li.PaceType, li.Priority,
 		li.FrequencyCap, int(li.FrequencyWindow.Seconds()), li.Country,
 		li.DeviceType, li.OS, li.Browser, li.Active, kv, li.CPM, li.CPC,
-		li.ECPM, li.BudgetType, li.BudgetAmount, li.Spend, li.Type, li.Endpoint, li.ClickURL).Scan(&li.ID)
+		li.ECPM, li.BudgetType, li.BudgetAmount, li.Spend, li.Type, li.Endpoint, li.ClickURL, li.VendorID, li.COPPASafe,
+		pq.Array(li.Domains), pq.Array(li.PagePaths), pq.Array(li.AppBundles), pq.Array(li.Categories),
+		pq.Array(li.Cities), pq.Array(li.Metros), pq.Array(li.PostalCodes), fences, li.CPA, eventCaps, li.ADomain,
+		pq.Array(li.ImpressionTrackers), pq.Array(li.ClickTrackers), li.ServerSideTrackers, pq.Array(li.Referrers)).Scan(&li.ID)
 	if err != nil {
 		return fmt.Errorf("insert line item: %w", err)
 	}
@@ -526,19 +670,28 @@ func (p *Postgres) InsertLineItem(li *models.LineItem) error {
 // UpdateLineItem updates an existing line item.
 func (p *Postgres) UpdateLineItem(li models.LineItem) error {
 	kv, _ := json.Marshal(li.KeyValues)
+	fences, _ := json.Marshal(li.Geofences)
+	eventCaps, _ := json.Marshal(li.DailyEventCaps)
 	_, err := p.DB.ExecContext(context.Background(), `UPDATE line_items SET
         campaign_id=$1, publisher_id=$2, name=$3, start_date=$4, end_date=$5,
         daily_impression_cap=$6, daily_click_cap=$7, pace_type=$8, priority=$9,
         frequency_cap=$10, frequency_window=$11, country=$12, device_type=$13,
         os=$14, browser=$15, active=$16, key_values=$17, cpm=$18, cpc=$19,
         ecpm=$20, budget_type=$21, budget_amount=$22, spend=$23, li_type=$24,
-        endpoint=$25, click_url=$26 WHERE id=$27`,
+        endpoint=$25, click_url=$26, vendor_id=$27, coppa_safe=$28, domains=$29,
+        page_paths=$30, app_bundles=$31, categories=$32, cities=$33,
+        metros=$34, postal_codes=$35, geofences=$36, cpa=$37,
+        daily_event_caps=$38, adomain=$39, impression_trackers=$40,
+        click_trackers=$41, server_side_trackers=$42, referrers=$43 WHERE id=$44`,
 		li.CampaignID, li.PublisherID, li.Name, li.StartDate, li.EndDate,
 		li.DailyImpressionCap, li.DailyClickCap, li.PaceType, li.Priority,
 		li.FrequencyCap, int(li.FrequencyWindow.Seconds()), li.Country,
 		li.DeviceType, li.OS, li.Browser, li.Active, kv, li.CPM, li.CPC,
 		li.ECPM, li.BudgetType, li.BudgetAmount, li.Spend, li.Type,
-		li.Endpoint, li.ClickURL, li.ID)
+		li.Endpoint, li.ClickURL, li.VendorID, li.COPPASafe, pq.Array(li.Domains),
+		pq.Array(li.PagePaths), pq.Array(li.AppBundles), pq.Array(li.Categories),
+		pq.Array(li.Cities), pq.Array(li.Metros), pq.Array(li.PostalCodes), fences, li.CPA, eventCaps, li.ADomain,
+		pq.Array(li.ImpressionTrackers), pq.Array(li.ClickTrackers), li.ServerSideTrackers, pq.Array(li.Referrers), li.ID)
 	if err != nil {
 		return fmt.Errorf("update line item: %w", err)
 	}
@@ -577,7 +730,9 @@ func (p *Postgres) InsertCreative(c *models.Creative) error {
 		bannerParam = c.Banner
 	}
 
-	err := p.DB.QueryRowContext(context.Background(), `INSERT INTO creatives (placement_id, line_item_id, campaign_id, publisher_id, html, native, banner, width, height, format, click_url) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING id`, c.PlacementID, c.LineItemID, c.CampaignID, c.PublisherID, c.HTML, nativeParam, bannerParam, c.Width, c.Height, c.Format, c.ClickURL).Scan(&c.ID)
+	video, _ := json.Marshal(c.Video)
+	templateValues, _ := json.Marshal(c.TemplateValues)
+	err := p.DB.QueryRowContext(context.Background(), `INSERT INTO creatives (placement_id, line_item_id, campaign_id, publisher_id, html, native, banner, width, height, format, click_url, video, start_date, end_date, weight, frequency_cap, frequency_window, impression_trackers, click_trackers, template_id, template_values) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21) RETURNING id`, c.PlacementID, c.LineItemID, c.CampaignID, c.PublisherID, c.HTML, nativeParam, bannerParam, c.Width, c.Height, c.Format, c.ClickURL, video, nullTime(c.StartDate), nullTime(c.EndDate), c.Weight, c.FrequencyCap, int(c.FrequencyWindow.Seconds()), pq.Array(c.ImpressionTrackers), pq.Array(c.ClickTrackers), c.TemplateID, templateValues).Scan(&c.ID)
 	if err != nil {
 		return fmt.Errorf("insert creative: %w", err)
 	}
@@ -600,13 +755,107 @@ func (p *Postgres) UpdateCreative(c models.Creative) error {
 		bannerParam = c.Banner
 	}
 
-	_, err := p.DB.ExecContext(context.Background(), `UPDATE creatives SET placement_id=$1, line_item_id=$2, campaign_id=$3, publisher_id=$4, html=$5, native=$6, banner=$7, width=$8, height=$9, format=$10, click_url=$11 WHERE id=$12`, c.PlacementID, c.LineItemID, c.CampaignID, c.PublisherID, c.HTML, nativeParam, bannerParam, c.Width, c.Height, c.Format, c.ClickURL, c.ID)
+	video, _ := json.Marshal(c.Video)
+	templateValues, _ := json.Marshal(c.TemplateValues)
+	_, err := p.DB.ExecContext(context.Background(), `UPDATE creatives SET placement_id=$1, line_item_id=$2, campaign_id=$3, publisher_id=$4, html=$5, native=$6, banner=$7, width=$8, height=$9, format=$10, click_url=$11, video=$12, start_date=$13, end_date=$14, weight=$15, frequency_cap=$16, frequency_window=$17, impression_trackers=$18, click_trackers=$19, template_id=$20, template_values=$21 WHERE id=$22`, c.PlacementID, c.LineItemID, c.CampaignID, c.PublisherID, c.HTML, nativeParam, bannerParam, c.Width, c.Height, c.Format, c.ClickURL, video, nullTime(c.StartDate), nullTime(c.EndDate), c.Weight, c.FrequencyCap, int(c.FrequencyWindow.Seconds()), pq.Array(c.ImpressionTrackers), pq.Array(c.ClickTrackers), c.TemplateID, templateValues, c.ID)
 	if err != nil {
 		return fmt.Errorf("update creative: %w", err)
 	}
 	return nil
 }
 
+// nullTime stores zero times as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// LoadTemplates fetches creative templates from the database.
+func (p *Postgres) LoadTemplates() ([]models.CreativeTemplate, error) {
+	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, publisher_id, name, format, body, variables FROM creative_templates ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query creative templates: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var ts []models.CreativeTemplate
+	for rows.Next() {
+		var t models.CreativeTemplate
+		var variables sql.NullString
+		if err := rows.Scan(&t.ID, &t.PublisherID, &t.Name, &t.Format, &t.Body, &variables); err != nil {
+			return nil, fmt.Errorf("scan creative template: %w", err)
+		}
+		if variables.Valid {
+			if err := json.Unmarshal([]byte(variables.String), &t.Variables); err != nil {
+				return nil, fmt.Errorf("parse template variables: %w", err)
+			}
+		}
+		ts = append(ts, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return ts, nil
+}
+
+// LoadTemplate fetches one creative template, returning nil when it doesn't
+// exist.
+func (p *Postgres) LoadTemplate(id int) (*models.CreativeTemplate, error) {
+	var t models.CreativeTemplate
+	var variables sql.NullString
+	err := p.DB.QueryRowContext(context.Background(), `SELECT id, publisher_id, name, format, body, variables FROM creative_templates WHERE id=$1`, id).Scan(&t.ID, &t.PublisherID, &t.Name, &t.Format, &t.Body, &variables)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query creative template: %w", err)
+	}
+	if variables.Valid {
+		if err := json.Unmarshal([]byte(variables.String), &t.Variables); err != nil {
+			return nil, fmt.Errorf("parse template variables: %w", err)
+		}
+	}
+	return &t, nil
+}
+
+// InsertTemplate inserts a new creative template and returns the generated ID.
+func (p *Postgres) InsertTemplate(t *models.CreativeTemplate) error {
+	variables, _ := json.Marshal(t.Variables)
+	err := p.DB.QueryRowContext(context.Background(), `INSERT INTO creative_templates (publisher_id, name, format, body, variables) VALUES ($1,$2,$3,$4,$5) RETURNING id`, t.PublisherID, t.Name, t.Format, t.Body, variables).Scan(&t.ID)
+	if err != nil {
+		return fmt.Errorf("insert creative template: %w", err)
+	}
+	return nil
+}
+
+// UpdateTemplate updates an existing creative template.
+func (p *Postgres) UpdateTemplate(t models.CreativeTemplate) error {
+	variables, _ := json.Marshal(t.Variables)
+	_, err := p.DB.ExecContext(context.Background(), `UPDATE creative_templates SET publisher_id=$1, name=$2, format=$3, body=$4, variables=$5 WHERE id=$6`, t.PublisherID, t.Name, t.Format, t.Body, variables, t.ID)
+	if err != nil {
+		return fmt.Errorf("update creative template: %w", err)
+	}
+	return nil
+}
+
+// DeleteTemplate removes a creative template by ID.
+func (p *Postgres) DeleteTemplate(id int) error {
+	_, err := p.DB.ExecContext(context.Background(), `DELETE FROM creative_templates WHERE id=$1`, id)
+	if err != nil {
+		return fmt.Errorf("delete creative template: %w", err)
+	}
+	return nil
+}
+
+// CountTemplateCreatives returns how many creatives use a template.
+func (p *Postgres) CountTemplateCreatives(id int) (int, error) {
+	var n int
+	if err := p.DB.QueryRowContext(context.Background(), `SELECT COUNT(*) FROM creatives WHERE template_id=$1`, id).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count template creatives: %w", err)
+	}
+	return n, nil
+}
+
 // DeleteCreative removes a creative by ID.
 func (p *Postgres) DeleteCreative(id int) error {
 	_, err := p.DB.ExecContext(context.Background(), `DELETE FROM creatives WHERE id=$1`, id)
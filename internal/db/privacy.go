@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// InsertPrivacyJob stores a new privacy job and fills in its ID and creation time.
+func (p *Postgres) InsertPrivacyJob(job *models.PrivacyJob) error {
+	err := p.DB.QueryRowContext(context.Background(), `INSERT INTO privacy_jobs (job_type, status, subject_hash)
+            VALUES ($1,$2,$3) RETURNING id, created_at`,
+		job.Type, job.Status, job.SubjectHash).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert privacy job: %w", err)
+	}
+	return nil
+}
+
+// UpdatePrivacyJob persists the status, error, result and completion time of a job.
+func (p *Postgres) UpdatePrivacyJob(job models.PrivacyJob) error {
+	var result interface{}
+	if len(job.Result) > 0 {
+		result = []byte(job.Result)
+	}
+	_, err := p.DB.ExecContext(context.Background(), `UPDATE privacy_jobs SET status=$1, error=$2, result=$3, completed_at=$4 WHERE id=$5`,
+		job.Status, sql.NullString{String: job.Error, Valid: job.Error != ""}, result, job.CompletedAt, job.ID)
+	if err != nil {
+		return fmt.Errorf("update privacy job: %w", err)
+	}
+	return nil
+}
+
+// ClearPrivacyExports removes the results of the export jobs of a subject and
+// returns the number of jobs cleared.
+func (p *Postgres) ClearPrivacyExports(subjectHash string) (int64, error) {
+	res, err := p.DB.ExecContext(context.Background(), `UPDATE privacy_jobs SET result=NULL
+            WHERE subject_hash=$1 AND job_type=$2 AND result IS NOT NULL`, subjectHash, models.PrivacyJobExport)
+	if err != nil {
+		return 0, fmt.Errorf("clear privacy exports: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("clear privacy exports: %w", err)
+	}
+	return n, nil
+}
+
+// GetPrivacyJob loads a privacy job together with its audit trail. It returns
+// nil when no job with the given ID exists.
+func (p *Postgres) GetPrivacyJob(id int) (*models.PrivacyJob, error) {
+	var (
+		job         models.PrivacyJob
+		jobErr      sql.NullString
+		result      []byte
+		completedAt sql.NullTime
+	)
+	err := p.DB.QueryRowContext(context.Background(), `SELECT id, job_type, status, subject_hash, error, result, created_at, completed_at
+            FROM privacy_jobs WHERE id=$1`, id).Scan(
+		&job.ID, &job.Type, &job.Status, &job.SubjectHash, &jobErr, &result, &job.CreatedAt, &completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query privacy job: %w", err)
+	}
+	job.Error = jobErr.String
+	job.Result = result
+	if completedAt.Valid {
+		t := completedAt.Time
+		job.CompletedAt = &t
+	}
+
+	rows, err := p.DB.QueryContext(context.Background(), `SELECT store, action, records, detail, created_at
+            FROM privacy_audit_log WHERE job_id=$1 ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query privacy audit log: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var (
+			e      models.PrivacyAuditEntry
+			detail sql.NullString
+		)
+		if err := rows.Scan(&e.Store, &e.Action, &e.Records, &detail, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan privacy audit entry: %w", err)
+		}
+		e.Detail = detail.String
+		job.Audit = append(job.Audit, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return &job, nil
+}
+
+// InsertPrivacyAudit appends an entry to the audit trail of a privacy job.
+func (p *Postgres) InsertPrivacyAudit(jobID int, e models.PrivacyAuditEntry) error {
+	_, err := p.DB.ExecContext(context.Background(), `INSERT INTO privacy_audit_log (job_id, store, action, records, detail)
+            VALUES ($1,$2,$3,$4,$5)`,
+		jobID, e.Store, e.Action, e.Records, sql.NullString{String: e.Detail, Valid: e.Detail != ""})
+	if err != nil {
+		return fmt.Errorf("insert privacy audit entry: %w", err)
+	}
+	return nil
+}
+
+// LoadAdReportsByUser returns every ad report submitted with the given user ID.
+func (p *Postgres) LoadAdReportsByUser(userID string) ([]models.AdReport, error) {
+	rows, err := p.DB.QueryContext(context.Background(), `SELECT id, creative_id, line_item_id, campaign_id, publisher_id, user_id,
+            placement_id, report_reason, host(ip_address), user_agent, created_at, status
+            FROM ad_reports WHERE user_id=$1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query ad reports: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var reports []models.AdReport
+	for rows.Next() {
+		var (
+			r                                          models.AdReport
+			creativeID, lineItemID, campaignID, pubID  sql.NullInt64
+			placementID, ip, userAgent, status, userID sql.NullString
+			createdAt                                  sql.NullTime
+		)
+		if err := rows.Scan(&r.ID, &creativeID, &lineItemID, &campaignID, &pubID, &userID,
+			&placementID, &r.ReportReason, &ip, &userAgent, &createdAt, &status); err != nil {
+			return nil, fmt.Errorf("scan ad report: %w", err)
+		}
+		r.CreativeID = int(creativeID.Int64)
+		r.LineItemID = int(lineItemID.Int64)
+		r.CampaignID = int(campaignID.Int64)
+		r.PublisherID = int(pubID.Int64)
+		r.UserID = userID.String
+		r.PlacementID = placementID.String
+		r.IPAddress = ip.String
+		r.UserAgent = userAgent.String
+		r.Status = status.String
+		if createdAt.Valid {
+			r.CreatedAt = createdAt.Time
+		}
+		reports = append(reports, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return reports, nil
+}
+
+// DeleteAdReportsByUser removes every ad report submitted with the given user
+// ID and returns the number of rows deleted.
+func (p *Postgres) DeleteAdReportsByUser(userID string) (int64, error) {
+	res, err := p.DB.ExecContext(context.Background(), `DELETE FROM ad_reports WHERE user_id=$1`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("delete ad reports: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete ad reports: %w", err)
+	}
+	return n, nil
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/extra/redisotel/v9"
@@ -35,10 +36,19 @@ func InitRedis(addr string) (*RedisStore, error) {
 	return rs, nil
 }
 
-// IncrementImpression increments the Redis counter for (userID, creativeID).
+// IncrementImpression increments the frequency cap counter for (userID, lineItemID).
 // Sets a TTL of `window` if it's the first impression. Returns the current count.
-func (r *RedisStore) IncrementImpression(userID string, creativeID int, window time.Duration) (int64, error) {
-	key := fmt.Sprintf("freqcap:%s:%d", userID, creativeID)
+func (r *RedisStore) IncrementImpression(userID string, lineItemID int, window time.Duration) (int64, error) {
+	return r.incrementFrequency(fmt.Sprintf("freqcap:%s:%d", userID, lineItemID), window)
+}
+
+// IncrementCreativeImpression increments the creative-level frequency cap
+// counter for (userID, creativeID), kept next to the user's line item counters.
+func (r *RedisStore) IncrementCreativeImpression(userID string, creativeID int, window time.Duration) (int64, error) {
+	return r.incrementFrequency(fmt.Sprintf("freqcap:%s:creative:%d", userID, creativeID), window)
+}
+
+func (r *RedisStore) incrementFrequency(key string, window time.Duration) (int64, error) {
 	val, err := r.Client.Incr(r.Ctx, key).Result()
 	if err != nil {
 		return 0, err
@@ -100,6 +110,84 @@ func (r *RedisStore) GetCTRCounts(lineItemID int) (int64, int64) {
 	return imps, clicks
 }
 
+// IncrementCVRConversion increments the total conversion counter for
+// conversion rate calculation.
+func (r *RedisStore) IncrementCVRConversion(lineItemID int) error {
+	key := fmt.Sprintf("cvr:lineitem:%d:conv", lineItemID)
+	_, err := r.Client.Incr(r.Ctx, key).Result()
+	return err
+}
+
+// GetCVRCounts returns the total impressions and conversions for a line item.
+// Impressions share the CTR impression counter.
+func (r *RedisStore) GetCVRCounts(lineItemID int) (int64, int64) {
+	impKey := fmt.Sprintf("ctr:lineitem:%d:imp", lineItemID)
+	convKey := fmt.Sprintf("cvr:lineitem:%d:conv", lineItemID)
+	imps, _ := r.Client.Get(r.Ctx, impKey).Int64()
+	convs, _ := r.Client.Get(r.Ctx, convKey).Int64()
+	return imps, convs
+}
+
+// IncrementViewabilityImpression increments today's measured impression
+// counter for a placement's viewability rate, which covers the last days days.
+func (r *RedisStore) IncrementViewabilityImpression(placementID string, days int) error {
+	return r.incrementViewability(placementID, "imp", days)
+}
+
+// IncrementViewabilityViewable increments today's viewable impression counter
+// for a placement's viewability rate, which covers the last days days.
+func (r *RedisStore) IncrementViewabilityViewable(placementID string, days int) error {
+	return r.incrementViewability(placementID, "view", days)
+}
+
+// incrementViewability increments a daily viewability counter. The TTL keeps
+// the counter until it falls out of the window.
+func (r *RedisStore) incrementViewability(placementID, kind string, days int) error {
+	key := viewabilityKey(placementID, kind, time.Now())
+	val, err := r.Client.Incr(r.Ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if val == 1 {
+		r.Client.Expire(r.Ctx, key, time.Duration(max(days, 1)+1)*24*time.Hour)
+	}
+	return nil
+}
+
+// GetViewabilityCounts returns the measured impressions and viewable
+// impressions for a placement over the last days days, including today.
+func (r *RedisStore) GetViewabilityCounts(placementID string, days int) (int64, int64) {
+	days = max(days, 1)
+	keys := make([]string, 0, 2*days)
+	now := time.Now()
+	for d := 0; d < days; d++ {
+		day := now.AddDate(0, 0, -d)
+		keys = append(keys, viewabilityKey(placementID, "imp", day), viewabilityKey(placementID, "view", day))
+	}
+	vals, err := r.Client.MGet(r.Ctx, keys...).Result()
+	if err != nil {
+		return 0, 0
+	}
+	var imps, views int64
+	for i, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseInt(s, 10, 64)
+		if i%2 == 0 {
+			imps += n
+		} else {
+			views += n
+		}
+	}
+	return imps, views
+}
+
+func viewabilityKey(placementID, kind string, day time.Time) string {
+	return fmt.Sprintf("viewability:placement:%s:%s:%s", placementID, kind, day.Format("2006-01-02"))
+}
+
 // Close shuts down the Redis client.
 func (r *RedisStore) Close() {
 	if r != nil && r.Client != nil {
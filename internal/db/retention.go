@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// RetentionPolicy defines how long rows are kept in Postgres tables holding
+// user data. A zero duration keeps rows indefinitely.
+type RetentionPolicy struct {
+	AdReports   time.Duration
+	PrivacyJobs time.Duration
+	// PrivacyExports is how long export jobs keep their result; the job and
+	// its audit trail stay until PrivacyJobs expires.
+	PrivacyExports time.Duration
+}
+
+// PurgeExpired deletes rows older than the retention policy allows and returns
+// the number of rows removed per table.
+func (p *Postgres) PurgeExpired(policy RetentionPolicy, now time.Time) (map[string]int64, error) {
+	purged := make(map[string]int64)
+	ctx := context.Background()
+
+	if policy.AdReports > 0 {
+		res, err := p.DB.ExecContext(ctx, `DELETE FROM ad_reports WHERE created_at < $1`, now.Add(-policy.AdReports))
+		if err != nil {
+			return purged, fmt.Errorf("purge ad reports: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		purged["ad_reports"] = n
+	}
+
+	if policy.PrivacyJobs > 0 {
+		n, err := p.purgePrivacyJobs(ctx, now.Add(-policy.PrivacyJobs))
+		if err != nil {
+			return purged, err
+		}
+		purged["privacy_jobs"] = n
+	}
+
+	if policy.PrivacyExports > 0 {
+		res, err := p.DB.ExecContext(ctx, `UPDATE privacy_jobs SET result=NULL
+            WHERE job_type=$1 AND result IS NOT NULL AND completed_at < $2`,
+			models.PrivacyJobExport, now.Add(-policy.PrivacyExports))
+		if err != nil {
+			return purged, fmt.Errorf("purge privacy exports: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		purged["privacy_exports"] = n
+	}
+
+	return purged, nil
+}
+
+// purgePrivacyJobs deletes finished privacy jobs created before cutoff along
+// with their audit entries.
+func (p *Postgres) purgePrivacyJobs(ctx context.Context, cutoff time.Time) (int64, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("purge privacy jobs: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	const expired = `SELECT id FROM privacy_jobs WHERE created_at < $1 AND completed_at IS NOT NULL`
+	if _, err := tx.ExecContext(ctx, `DELETE FROM privacy_audit_log WHERE job_id IN (`+expired+`)`, cutoff); err != nil {
+		return 0, fmt.Errorf("purge privacy audit log: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM privacy_jobs WHERE id IN (`+expired+`)`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("purge privacy jobs: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("purge privacy jobs: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
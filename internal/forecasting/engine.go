@@ -88,6 +88,14 @@ func validateForecastRequest(req *models.ForecastRequest) error {
 		if req.CPC <= 0 {
 			return fmt.Errorf("cpc must be positive for CPC campaigns")
 		}
+	case models.BudgetTypeVCPM:
+		if req.CPM <= 0 {
+			return fmt.Errorf("cpm must be positive for vCPM campaigns")
+		}
+	case models.BudgetTypeCPA:
+		if req.CPA <= 0 {
+			return fmt.Errorf("cpa must be positive for CPA campaigns")
+		}
 	case models.BudgetTypeFlat:
 		// Flat budget is valid
 	default:
@@ -118,6 +126,14 @@ func (e *Engine) buildForecastResponse(req *models.ForecastRequest, patterns []*
 		response.EstimatedCTR = inventory.AverageCTR
 		response.EstimatedClicks = int64(float64(response.EstimatedImpressions) * response.EstimatedCTR)
 		response.EstimatedSpend = float64(response.EstimatedClicks) * req.CPC
+	case models.BudgetTypeVCPM:
+		response.EstimatedViewRate = inventory.AverageViewRate
+		response.EstimatedViewableImpressions = int64(float64(response.EstimatedImpressions) * response.EstimatedViewRate)
+		response.EstimatedSpend = float64(response.EstimatedViewableImpressions) * req.CPM / 1000.0
+	case models.BudgetTypeCPA:
+		response.EstimatedCVR = inventory.AverageCVR
+		response.EstimatedConversions = int64(float64(response.EstimatedImpressions) * response.EstimatedCVR)
+		response.EstimatedSpend = float64(response.EstimatedConversions) * req.CPA
 	case models.BudgetTypeFlat:
 		response.EstimatedSpend = req.Budget
 	}
@@ -126,8 +142,15 @@ func (e *Engine) buildForecastResponse(req *models.ForecastRequest, patterns []*
 	if response.EstimatedSpend > req.Budget {
 		response.EstimatedSpend = req.Budget
 		// Adjust impressions accordingly
-		if req.BudgetType == models.BudgetTypeCPM {
+		switch req.BudgetType {
+		case models.BudgetTypeCPM:
 			response.EstimatedImpressions = int64(req.Budget * 1000.0 / req.CPM)
+		case models.BudgetTypeVCPM:
+			response.EstimatedViewableImpressions = int64(req.Budget * 1000.0 / req.CPM)
+			response.EstimatedImpressions = int64(float64(response.EstimatedViewableImpressions) / response.EstimatedViewRate)
+		case models.BudgetTypeCPA:
+			response.EstimatedConversions = int64(req.Budget / req.CPA)
+			response.EstimatedImpressions = int64(float64(response.EstimatedConversions) / response.EstimatedCVR)
 		}
 	}
 
@@ -152,6 +175,12 @@ func (e *Engine) buildForecastResponse(req *models.ForecastRequest, patterns []*
 		case models.BudgetTypeCPC:
 			daily.EstimatedClicks = int64(float64(dailyEst) * response.EstimatedCTR)
 			daily.EstimatedSpend = float64(daily.EstimatedClicks) * req.CPC
+		case models.BudgetTypeVCPM:
+			daily.EstimatedViewableImpressions = int64(float64(dailyEst) * response.EstimatedViewRate)
+			daily.EstimatedSpend = float64(daily.EstimatedViewableImpressions) * req.CPM / 1000.0
+		case models.BudgetTypeCPA:
+			daily.EstimatedConversions = int64(float64(dailyEst) * response.EstimatedCVR)
+			daily.EstimatedSpend = float64(daily.EstimatedConversions) * req.CPA
 		}
 
 		response.DailyForecast = append(response.DailyForecast, daily)
@@ -170,6 +199,12 @@ func (e *Engine) buildForecastResponse(req *models.ForecastRequest, patterns []*
 	if inventory.DataDays < 7 {
 		response.Warnings = append(response.Warnings, fmt.Sprintf("Limited historical data available (%d days)", inventory.DataDays))
 	}
+	if req.BudgetType == models.BudgetTypeVCPM && len(patterns) > 0 && inventory.AverageViewRate == 0 {
+		response.Warnings = append(response.Warnings, "No viewable impressions measured for the specified targeting criteria")
+	}
+	if req.BudgetType == models.BudgetTypeCPA && len(patterns) > 0 && inventory.AverageCVR == 0 {
+		response.Warnings = append(response.Warnings, "No conversions recorded for the specified targeting criteria")
+	}
 	if len(conflicts) > 10 {
 		response.Warnings = append(response.Warnings, fmt.Sprintf("High competition detected: %d conflicting line items", len(conflicts)))
 	}
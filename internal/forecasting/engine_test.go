@@ -112,6 +112,28 @@ func TestValidateForecastRequest(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "vCPM request without cpm",
+			req: &models.ForecastRequest{
+				StartDate:   time.Now(),
+				EndDate:     time.Now().AddDate(0, 0, 7),
+				BudgetType:  models.BudgetTypeVCPM,
+				Budget:      1000.0,
+				PublisherID: 1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "CPA request without cpa",
+			req: &models.ForecastRequest{
+				StartDate:   time.Now(),
+				EndDate:     time.Now().AddDate(0, 0, 7),
+				BudgetType:  models.BudgetTypeCPA,
+				Budget:      1000.0,
+				PublisherID: 1,
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid budget type",
 			req: &models.ForecastRequest{
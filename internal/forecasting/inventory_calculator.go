@@ -18,6 +18,8 @@ type InventoryAvailability struct {
 	EstimatedImpressions int64
 	FillRate             float64
 	AverageCTR           float64
+	AverageViewRate      float64
+	AverageCVR           float64
 	DataDays             int
 	DailyBreakdown       map[string]int64 // date -> opportunities
 }
@@ -38,11 +40,13 @@ func (e *Engine) calculateAvailableInventory(ctx context.Context, req *models.Fo
 	inventory.DataDays = len(dailyPatterns)
 
 	// Calculate averages from historical data
-	var totalOpps, totalImps, totalClicks int64
+	var totalOpps, totalImps, totalClicks, totalViews, totalConvs int64
 	for _, pattern := range dailyPatterns {
 		totalOpps += pattern.Opportunities
 		totalImps += pattern.Impressions
 		totalClicks += pattern.Clicks
+		totalViews += pattern.Viewables
+		totalConvs += pattern.Conversions
 	}
 
 	// Calculate average daily traffic
@@ -54,6 +58,8 @@ func (e *Engine) calculateAvailableInventory(ctx context.Context, req *models.Fo
 	}
 	if totalImps > 0 {
 		inventory.AverageCTR = float64(totalClicks) / float64(totalImps)
+		inventory.AverageViewRate = float64(totalViews) / float64(totalImps)
+		inventory.AverageCVR = float64(totalConvs) / float64(totalImps)
 	}
 
 	// Project inventory for the forecast period
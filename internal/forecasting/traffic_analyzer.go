@@ -22,6 +22,8 @@ type TrafficPattern struct {
 	Opportunities int64
 	Impressions   int64
 	Clicks        int64
+	Viewables     int64
+	Conversions   int64
 	FillRate      float64
 	CTR           float64
 }
@@ -60,6 +62,8 @@ func (e *Engine) analyzeTrafficPatterns(ctx context.Context, req *models.Forecas
 			&p.Opportunities,
 			&p.Impressions,
 			&p.Clicks,
+			&p.Viewables,
+			&p.Conversions,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan traffic pattern: %w", err)
@@ -126,6 +130,7 @@ func buildTrafficQuery(req *models.ForecastRequest) (string, []interface{}) {
 		FROM events
 		WHERE 
 			event_type = 'ad_request'
+			AND invalid = 0
 			AND publisher_id = ?
 			AND timestamp >= now() - INTERVAL 30 DAY
 	),
@@ -136,6 +141,7 @@ func buildTrafficQuery(req *models.ForecastRequest) (string, []interface{}) {
 		FROM events
 		WHERE 
 			event_type = 'impression'
+			AND invalid = 0
 			AND timestamp >= now() - INTERVAL 30 DAY
 		GROUP BY request_id
 	),
@@ -146,6 +152,29 @@ func buildTrafficQuery(req *models.ForecastRequest) (string, []interface{}) {
 		FROM events
 		WHERE 
 			event_type = 'click'
+			AND invalid = 0
+			AND timestamp >= now() - INTERVAL 30 DAY
+		GROUP BY request_id
+	),
+	viewables AS (
+		SELECT 
+			request_id,
+			COUNT(*) as viewable_count
+		FROM events
+		WHERE 
+			event_type = 'viewable_impression'
+			AND invalid = 0
+			AND timestamp >= now() - INTERVAL 30 DAY
+		GROUP BY request_id
+	),
+	conversions AS (
+		SELECT 
+			request_id,
+			COUNT(*) as conversion_count
+		FROM events
+		WHERE 
+			event_type = 'conversion'
+			AND invalid = 0
 			AND timestamp >= now() - INTERVAL 30 DAY
 		GROUP BY request_id
 	)
@@ -158,10 +187,14 @@ func buildTrafficQuery(req *models.ForecastRequest) (string, []interface{}) {
 		toString(o.key_values) as key_values_json,
 		COUNT(DISTINCT o.request_id) as opportunities,
 		SUM(COALESCE(i.impression_count, 0)) as impressions,
-		SUM(COALESCE(c.click_count, 0)) as clicks
+		SUM(COALESCE(c.click_count, 0)) as clicks,
+		SUM(COALESCE(v.viewable_count, 0)) as viewables,
+		SUM(COALESCE(cv.conversion_count, 0)) as conversions
 	FROM opportunities o
 	LEFT JOIN impressions i ON o.request_id = i.request_id
 	LEFT JOIN clicks c ON o.request_id = c.request_id
+	LEFT JOIN viewables v ON o.request_id = v.request_id
+	LEFT JOIN conversions cv ON o.request_id = cv.request_id
 	WHERE 1=1
 	`
 
@@ -236,6 +269,8 @@ func aggregatePatternsByDay(patterns []*TrafficPattern) map[string]*TrafficPatte
 			existing.Opportunities += p.Opportunities
 			existing.Impressions += p.Impressions
 			existing.Clicks += p.Clicks
+			existing.Viewables += p.Viewables
+			existing.Conversions += p.Conversions
 		} else {
 			daily[key] = &TrafficPattern{
 				TimeWindow:    p.TimeWindow.Truncate(24 * time.Hour),
@@ -247,6 +282,8 @@ func aggregatePatternsByDay(patterns []*TrafficPattern) map[string]*TrafficPatte
 				Opportunities: p.Opportunities,
 				Impressions:   p.Impressions,
 				Clicks:        p.Clicks,
+				Viewables:     p.Viewables,
+				Conversions:   p.Conversions,
 			}
 		}
 	}
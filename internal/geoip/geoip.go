@@ -4,20 +4,34 @@ import (
 	"encoding/json"
 	"net"
 	"os"
+	"strconv"
 
 	"github.com/oschwald/geoip2-golang"
 )
 
-// GeoIP provides country lookup using a MaxMind DB or a JSON fallback.
+// GeoIP provides location lookup using a MaxMind DB or a JSON fallback.
+// Country databases yield country only; City databases add region, city,
+// metro (DMA) code, postal code and coordinates.
 type GeoIP struct {
 	db       *geoip2.Reader
 	fallback []record
 }
 
+// Location is the geographic data resolved for an IP address. Fields the
+// database does not provide are left empty.
+type Location struct {
+	Country    string  // ISO 3166-1 alpha-2 country code
+	Region     string  // First subdivision ISO code (e.g., "CA")
+	City       string  // English city name
+	Metro      string  // Nielsen DMA code (US only, e.g., "807")
+	PostalCode string  // Postal or ZIP code
+	Lat        float64 // Latitude; 0 when unknown
+	Lon        float64 // Longitude; 0 when unknown
+}
+
 type record struct {
-	net     *net.IPNet
-	country string
-	region  string
+	net *net.IPNet
+	loc Location
 }
 
 // Init opens the GeoIP2 database located at path. It returns a GeoIP instance.
@@ -35,21 +49,68 @@ func Init(path string) (*GeoIP, error) {
 		return nil, err
 	}
 	var entries []struct {
-		Net     string `json:"net"`
-		Country string `json:"country"`
-		Region  string `json:"region"`
+		Net        string  `json:"net"`
+		Country    string  `json:"country"`
+		Region     string  `json:"region"`
+		City       string  `json:"city"`
+		Metro      string  `json:"metro"`
+		PostalCode string  `json:"postal_code"`
+		Lat        float64 `json:"lat"`
+		Lon        float64 `json:"lon"`
 	}
 	if jerr = json.Unmarshal(data, &entries); jerr != nil {
 		return nil, err
 	}
 	for _, e := range entries {
 		if _, n, perr := net.ParseCIDR(e.Net); perr == nil {
-			g.fallback = append(g.fallback, record{net: n, country: e.Country, region: e.Region})
+			g.fallback = append(g.fallback, record{net: n, loc: Location{
+				Country:    e.Country,
+				Region:     e.Region,
+				City:       e.City,
+				Metro:      e.Metro,
+				PostalCode: e.PostalCode,
+				Lat:        e.Lat,
+				Lon:        e.Lon,
+			}})
 		}
 	}
 	return g, nil
 }
 
+// Lookup returns all location data known for the given IP. An empty Location
+// is returned when the IP is not found or the database hasn't been initialised.
+func (g *GeoIP) Lookup(ip net.IP) Location {
+	if g == nil {
+		return Location{}
+	}
+	if g.db != nil {
+		// City lookups are also permitted on Country databases.
+		rec, err := g.db.City(ip)
+		if err == nil {
+			loc := Location{
+				Country:    rec.Country.IsoCode,
+				City:       rec.City.Names["en"],
+				PostalCode: rec.Postal.Code,
+				Lat:        rec.Location.Latitude,
+				Lon:        rec.Location.Longitude,
+			}
+			if len(rec.Subdivisions) > 0 {
+				loc.Region = rec.Subdivisions[0].IsoCode
+			}
+			if rec.Location.MetroCode != 0 {
+				loc.Metro = strconv.Itoa(int(rec.Location.MetroCode))
+			}
+			return loc
+		}
+	}
+	for _, r := range g.fallback {
+		if r.net.Contains(ip) {
+			return r.loc
+		}
+	}
+	return Location{}
+}
+
 // Country returns the ISO country code for the given IP. If the IP is not found
 // in the database or the database hasn't been initialised, an empty string is returned.
 func (g *GeoIP) Country(ip net.IP) string {
@@ -64,7 +125,7 @@ func (g *GeoIP) Country(ip net.IP) string {
 	}
 	for _, r := range g.fallback {
 		if r.net.Contains(ip) {
-			return r.country
+			return r.loc.Country
 		}
 	}
 	return ""
@@ -84,7 +145,7 @@ func (g *GeoIP) Region(ip net.IP) string {
 	}
 	for _, r := range g.fallback {
 		if r.net.Contains(ip) {
-			return r.region
+			return r.loc.Region
 		}
 	}
 	return ""
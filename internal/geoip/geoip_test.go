@@ -0,0 +1,36 @@
+package geoip
+
+import (
+	"net"
+	"testing"
+)
+
+func TestLookupCityDatabase(t *testing.T) {
+	g, err := Init("testdata/GeoLite2-City-Test.mmdb")
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	defer func() { _ = g.Close() }()
+
+	loc := g.Lookup(net.ParseIP("192.0.2.5"))
+	want := Location{Country: "US", Region: "CA", City: "San Francisco", Metro: "807", PostalCode: "94107", Lat: 37.7749, Lon: -122.4194}
+	if loc != want {
+		t.Errorf("Lookup = %+v, want %+v", loc, want)
+	}
+	if got := g.Country(net.ParseIP("203.0.113.1")); got != "GB" {
+		t.Errorf("Country = %q, want GB", got)
+	}
+	if loc := g.Lookup(net.ParseIP("203.0.113.1")); loc.Metro != "" || loc.PostalCode != "EC1A" {
+		t.Errorf("unexpected London lookup %+v", loc)
+	}
+	if loc := g.Lookup(net.ParseIP("8.8.8.8")); loc != (Location{}) {
+		t.Errorf("expected empty location, got %+v", loc)
+	}
+}
+
+func TestLookupNil(t *testing.T) {
+	var g *GeoIP
+	if loc := g.Lookup(net.ParseIP("192.0.2.5")); loc != (Location{}) {
+		t.Errorf("expected empty location, got %+v", loc)
+	}
+}
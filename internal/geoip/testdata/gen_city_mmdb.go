@@ -0,0 +1,193 @@
+//go:build ignore
+
+// gen_city_mmdb writes GeoLite2-City-Test.mmdb, a tiny IPv4 City database
+// covering the documentation ranges used by the tests. Regenerate with:
+//
+//	cd internal/geoip/testdata && go run gen_city_mmdb.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"time"
+)
+
+type city struct {
+	net        string
+	country    string
+	region     string
+	name       string
+	metro      uint64
+	postal     string
+	lat, lon   float64
+	timeZone   string
+	geonameID  uint64
+	regionName string
+}
+
+var cities = []city{
+	{"192.0.2.0/24", "US", "CA", "San Francisco", 807, "94107", 37.7749, -122.4194, "America/Los_Angeles", 5391959, "California"},
+	{"198.51.100.0/24", "US", "NY", "New York", 501, "10001", 40.7128, -74.0060, "America/New_York", 5128581, "New York"},
+	{"203.0.113.0/24", "GB", "ENG", "London", 0, "EC1A", 51.5074, -0.1278, "Europe/London", 2643743, "England"},
+}
+
+func main() {
+	var data bytes.Buffer
+	type leaf struct {
+		ip     uint32
+		prefix int
+		offset int
+	}
+	var leaves []leaf
+	for _, c := range cities {
+		_, n, err := net.ParseCIDR(c.net)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ones, _ := n.Mask.Size()
+		offset := data.Len()
+		encode(&data, record(c))
+		leaves = append(leaves, leaf{binary.BigEndian.Uint32(n.IP.To4()), ones, offset})
+	}
+
+	// Build a binary trie over the 32-bit IPv4 space.
+	type node struct{ child [2]int } // >0 node index, <0 -(offset+1) data, 0 empty
+	nodes := []node{{}}
+	for _, l := range leaves {
+		cur := 0
+		for bit := 0; bit < l.prefix; bit++ {
+			b := (l.ip >> (31 - bit)) & 1
+			if bit == l.prefix-1 {
+				nodes[cur].child[b] = -(l.offset + 1)
+				break
+			}
+			if nodes[cur].child[b] <= 0 {
+				nodes = append(nodes, node{})
+				nodes[cur].child[b] = len(nodes) - 1
+			}
+			cur = nodes[cur].child[b]
+		}
+	}
+
+	nodeCount := len(nodes)
+	var out bytes.Buffer
+	for _, n := range nodes {
+		for _, c := range n.child {
+			var v int
+			switch {
+			case c > 0:
+				v = c
+			case c < 0:
+				v = nodeCount + 16 + (-c - 1)
+			default:
+				v = nodeCount
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xab\xcd\xefMaxMind.com")
+	encode(&out, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()),
+		"database_type":               "GeoLite2-City",
+		"description":                 map[string]any{"en": "openadserve test City database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	})
+	if err := os.WriteFile("GeoLite2-City-Test.mmdb", out.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func record(c city) map[string]any {
+	loc := map[string]any{
+		"latitude":  c.lat,
+		"longitude": c.lon,
+		"time_zone": c.timeZone,
+	}
+	if c.metro != 0 {
+		loc["metro_code"] = uint16(c.metro)
+	}
+	return map[string]any{
+		"city":         map[string]any{"geoname_id": uint32(c.geonameID), "names": map[string]any{"en": c.name}},
+		"country":      map[string]any{"iso_code": c.country},
+		"location":     loc,
+		"postal":       map[string]any{"code": c.postal},
+		"subdivisions": []any{map[string]any{"iso_code": c.region, "names": map[string]any{"en": c.regionName}}},
+	}
+}
+
+// encode writes v using the MaxMind DB data section format.
+func encode(buf *bytes.Buffer, v any) {
+	switch t := v.(type) {
+	case string:
+		control(buf, 2, len(t))
+		buf.WriteString(t)
+	case float64:
+		control(buf, 3, 8)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(t))
+	case uint16:
+		uintValue(buf, 5, uint64(t))
+	case uint32:
+		uintValue(buf, 6, uint64(t))
+	case uint64:
+		uintValue(buf, 9, t)
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		control(buf, 7, len(t))
+		for _, k := range keys {
+			encode(buf, k)
+			encode(buf, t[k])
+		}
+	case []any:
+		control(buf, 11, len(t))
+		for _, e := range t {
+			encode(buf, e)
+		}
+	default:
+		log.Fatalf("unsupported type %T", v)
+	}
+}
+
+func uintValue(buf *bytes.Buffer, typ int, v uint64) {
+	var b []byte
+	for v > 0 {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+	}
+	control(buf, typ, len(b))
+	buf.Write(b)
+}
+
+func control(buf *bytes.Buffer, typ, size int) {
+	var ext []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		ext = []byte{byte(size - 29)}
+		size = 29
+	default:
+		log.Fatalf("size %d too large", size)
+	}
+	if typ <= 7 {
+		buf.WriteByte(byte(typ<<5 | size))
+	} else {
+		buf.WriteByte(byte(size))
+		buf.WriteByte(byte(typ - 7))
+	}
+	buf.Write(ext)
+}
@@ -0,0 +1,351 @@
+// Package ivt detects invalid traffic (IVT): bots, datacenter traffic,
+// abnormal request velocity, impossible click timing and tracking tokens
+// replayed from many addresses. A detector returns the reason a request or
+// event is invalid, or "" when it looks legitimate; callers record the reason
+// and keep invalid traffic out of spend and pacing.
+package ivt
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/patrickwarner/openadserve/internal/clientip"
+	"github.com/patrickwarner/openadserve/internal/privacy"
+)
+
+// Reasons recorded in the ivt_reason column of analytics events.
+const (
+	ReasonBot          = "bot"           // User-Agent identifies a known bot or crawler.
+	ReasonDatacenter   = "datacenter"    // Client IP belongs to a hosting or cloud provider.
+	ReasonIPVelocity   = "ip_velocity"   // Too many ad requests from one IP in the window.
+	ReasonUserVelocity = "user_velocity" // Too many ad requests for one user in the window.
+	ReasonClickTiming  = "click_timing"  // Click arrived before, or too soon after, its impression.
+	ReasonClickBurst   = "click_burst"   // Too many clicks from one IP or user in the click window.
+	ReasonTokenReuse   = "token_reuse"   // Tracking token used from too many IP addresses.
+)
+
+// Config holds the detector thresholds. A zero limit disables that check.
+type Config struct {
+	// IPRequestLimit and UserRequestLimit cap ad requests per VelocityWindow.
+	IPRequestLimit   int
+	UserRequestLimit int
+	VelocityWindow   time.Duration
+	// MinClickDelay is the shortest plausible time between an impression and
+	// its click; zero accepts instant clicks. Clicks with no recorded
+	// impression are always flagged.
+	MinClickDelay time.Duration
+	// ClickIPLimit and ClickUserLimit cap clicks per ClickWindow.
+	ClickIPLimit   int
+	ClickUserLimit int
+	ClickWindow    time.Duration
+	// MaxTokenIPs is the number of distinct IPs one tracking token may be used from.
+	MaxTokenIPs int
+	// TokenTTL bounds how long impression times and token IP sets are kept.
+	TokenTTL time.Duration
+	// IPKey keys the hash IPs are stored under in Redis, so counters and
+	// token IP sets never hold a raw address. Instances sharing Redis need
+	// the same key; without one a random key is generated.
+	IPKey []byte
+	// AnonymizeIPs truncates IPs before they are hashed, so velocity limits
+	// and token IP counts apply per network instead of per address.
+	AnonymizeIPs bool
+}
+
+// Detector runs the IVT checks. Velocity, timing and token checks need Redis
+// and are skipped when it is nil. A nil Detector reports all traffic as valid.
+type Detector struct {
+	Redis       *redis.Client
+	Datacenters *IPList
+	Config      Config
+	Logger      *zap.Logger
+}
+
+// NewDetector creates a Detector. The logger may be nil.
+func NewDetector(rdb *redis.Client, datacenters *IPList, cfg Config, logger *zap.Logger) *Detector {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.VelocityWindow <= 0 {
+		cfg.VelocityWindow = time.Minute
+	}
+	if cfg.ClickWindow <= 0 {
+		cfg.ClickWindow = time.Minute
+	}
+	if len(cfg.IPKey) == 0 {
+		cfg.IPKey = make([]byte, 32)
+		if _, err := rand.Read(cfg.IPKey); err != nil {
+			logger.Warn("ivt: generate ip key", zap.Error(err))
+		}
+	}
+	return &Detector{Redis: rdb, Datacenters: datacenters, Config: cfg, Logger: logger}
+}
+
+// CheckRequest classifies an ad request by its UA bot flag, client IP and the
+// request velocity of the IP and user. Nothing derived from the IP of a
+// child-directed request is stored, so its IP velocity isn't counted.
+func (d *Detector) CheckRequest(ctx context.Context, ip, userID string, isBot, childDirected bool) string {
+	if d == nil {
+		return ""
+	}
+	if reason := d.checkClient(ip, isBot); reason != "" {
+		return reason
+	}
+	window := d.Config.VelocityWindow
+	if d.overLimit(ctx, "ip", d.storedIP(ip, childDirected), "req", window, d.Config.IPRequestLimit) {
+		return ReasonIPVelocity
+	}
+	if d.overLimit(ctx, "user", userID, "req", window, d.Config.UserRequestLimit) {
+		return ReasonUserVelocity
+	}
+	return ""
+}
+
+// CheckImpression classifies an impression and remembers when it happened so
+// the matching click can be timed. The creative ID tells apart the ads of a
+// pod, which share their request and impression IDs.
+func (d *Detector) CheckImpression(ctx context.Context, tok, ip, requestID, impID, creativeID string, isBot, childDirected bool) string {
+	if d == nil {
+		return ""
+	}
+	if d.Redis != nil {
+		key := impressionKey(requestID, impID, creativeID)
+		if err := d.Redis.SetNX(ctx, key, time.Now().UnixMilli(), d.ttl()).Err(); err != nil {
+			d.Logger.Warn("ivt: record impression time", zap.Error(err))
+		}
+	}
+	if reason := d.checkClient(ip, isBot); reason != "" {
+		return reason
+	}
+	return d.checkToken(ctx, tok, d.storedIP(ip, childDirected))
+}
+
+// CheckClick classifies a click, including whether it arrived impossibly fast
+// after, or without, its impression and whether the IP or user is clicking in
+// bursts. Every click counts towards the burst limits, even flagged ones.
+func (d *Detector) CheckClick(ctx context.Context, tok, ip, userID, requestID, impID, creativeID string, isBot, childDirected bool) string {
+	if d == nil {
+		return ""
+	}
+	window := d.Config.ClickWindow
+	ipBurst := d.overLimit(ctx, "ip", d.storedIP(ip, childDirected), "click", window, d.Config.ClickIPLimit)
+	userBurst := d.overLimit(ctx, "user", userID, "click", window, d.Config.ClickUserLimit)
+
+	if reason := d.checkClient(ip, isBot); reason != "" {
+		return reason
+	}
+	if reason := d.checkClickTiming(ctx, requestID, impID, creativeID); reason != "" {
+		return reason
+	}
+	if ipBurst || userBurst {
+		return ReasonClickBurst
+	}
+	return d.checkToken(ctx, tok, d.storedIP(ip, childDirected))
+}
+
+// CheckEvent classifies a custom tracking event.
+func (d *Detector) CheckEvent(ctx context.Context, tok, ip string, isBot, childDirected bool) string {
+	if d == nil {
+		return ""
+	}
+	if reason := d.checkClient(ip, isBot); reason != "" {
+		return reason
+	}
+	return d.checkToken(ctx, tok, d.storedIP(ip, childDirected))
+}
+
+func (d *Detector) checkClient(ip string, isBot bool) string {
+	if isBot {
+		return ReasonBot
+	}
+	if d.Datacenters.Contains(ip) {
+		return ReasonDatacenter
+	}
+	return ""
+}
+
+func (d *Detector) checkClickTiming(ctx context.Context, requestID, impID, creativeID string) string {
+	if d.Redis == nil {
+		return ""
+	}
+	v, err := d.Redis.Get(ctx, impressionKey(requestID, impID, creativeID)).Result()
+	if err == redis.Nil {
+		return ReasonClickTiming
+	}
+	if err != nil {
+		d.Logger.Warn("ivt: read impression time", zap.Error(err))
+		return ""
+	}
+	impAt, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return ""
+	}
+	if time.Since(time.UnixMilli(impAt)) < d.Config.MinClickDelay {
+		return ReasonClickTiming
+	}
+	return ""
+}
+
+// storedIP returns the form of ip the detector keeps in Redis: a keyed hash
+// of the address, truncated first when IPs are anonymized. It is empty for
+// child-directed traffic, whose IPs are never stored.
+func (d *Detector) storedIP(ip string, childDirected bool) string {
+	if ip == "" || childDirected {
+		return ""
+	}
+	if d.Config.AnonymizeIPs {
+		if ip = privacy.AnonymizeIP(ip); ip == "" {
+			return ""
+		}
+	}
+	mac := hmac.New(sha256.New, d.Config.IPKey)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// checkToken records the hashed IP a token was used from and flags the token
+// once it has been seen from more than MaxTokenIPs addresses.
+func (d *Detector) checkToken(ctx context.Context, tok, ip string) string {
+	if d.Redis == nil || d.Config.MaxTokenIPs <= 0 || tok == "" || ip == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(tok))
+	key := "ivt:tok:" + hex.EncodeToString(sum[:16])
+	pipe := d.Redis.TxPipeline()
+	pipe.SAdd(ctx, key, ip)
+	count := pipe.SCard(ctx, key)
+	pipe.Expire(ctx, key, d.ttl())
+	if _, err := pipe.Exec(ctx); err != nil {
+		d.Logger.Warn("ivt: token ip set", zap.Error(err))
+		return ""
+	}
+	if count.Val() > int64(d.Config.MaxTokenIPs) {
+		return ReasonTokenReuse
+	}
+	return ""
+}
+
+// overLimit counts one action for the subject in the current fixed window and
+// reports whether the count exceeds limit. Keys look like
+// ivt:user:<id>:click:<bucket> so per-user counters can be found for deletion;
+// IP counters use the hash from storedIP as their subject.
+func (d *Detector) overLimit(ctx context.Context, kind, subject, action string, window time.Duration, limit int) bool {
+	if d.Redis == nil || limit <= 0 || subject == "" {
+		return false
+	}
+	bucket := time.Now().UnixMilli() / window.Milliseconds()
+	key := fmt.Sprintf("ivt:%s:%s:%s:%d", kind, subject, action, bucket)
+	pipe := d.Redis.TxPipeline()
+	n := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		d.Logger.Warn("ivt: velocity counter", zap.Error(err), zap.String("key", key))
+		return false
+	}
+	return n.Val() > int64(limit)
+}
+
+func (d *Detector) ttl() time.Duration {
+	if d.Config.TokenTTL > 0 {
+		return d.Config.TokenTTL
+	}
+	return 30 * time.Minute
+}
+
+func impressionKey(requestID, impID, creativeID string) string {
+	return "ivt:imp:" + requestID + ":" + impID + ":" + creativeID
+}
+
+// NoBidReason maps an IVT reason to the OpenRTB no-bid reason code.
+func NoBidReason(reason string) int {
+	switch reason {
+	case ReasonBot:
+		return 3 // Known Web Spider
+	case ReasonDatacenter:
+		return 5 // Cloud, Data Center, or Proxy IP
+	default:
+		return 4 // Suspected Non-Human Traffic
+	}
+}
+
+// IPList is a set of CIDR ranges, such as known datacenter networks.
+type IPList struct {
+	nets []*net.IPNet
+}
+
+// LoadIPList reads one CIDR or IP address per line from path. Blank lines and
+// lines starting with # are ignored.
+func LoadIPList(path string) (*IPList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open ip list: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	l := &IPList{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		entry := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(entry, '#'); i != -1 {
+			entry = strings.TrimSpace(entry[:i])
+		}
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("ip list line %d: %w", line, err)
+		}
+		l.nets = append(l.nets, n)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read ip list: %w", err)
+	}
+	return l, nil
+}
+
+// Len returns the number of ranges in the list.
+func (l *IPList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.nets)
+}
+
+// Contains reports whether ip falls inside any range of the list.
+func (l *IPList) Contains(ip string) bool {
+	if l == nil || ip == "" {
+		return false
+	}
+	parsed := clientip.Parse(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range l.nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
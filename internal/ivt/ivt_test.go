@@ -0,0 +1,216 @@
+package ivt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestDetector(t *testing.T, cfg Config) (*Detector, *miniredis.Miniredis) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return NewDetector(rdb, nil, cfg, nil), mr
+}
+
+func writeIPList(t *testing.T, data string) *IPList {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dc.txt")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := LoadIPList(path)
+	if err != nil {
+		t.Fatalf("LoadIPList: %v", err)
+	}
+	return l
+}
+
+func TestLoadIPList(t *testing.T) {
+	l := writeIPList(t, "# cloud ranges\n203.0.113.0/24\n\n2001:db8:1::/48  # ipv6\n198.51.100.7\n")
+	if l.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", l.Len())
+	}
+	for ip, want := range map[string]bool{
+		"203.0.113.50":       true,
+		"198.51.100.7":       true,
+		"198.51.100.8":       false,
+		"2001:db8:1::1":      true,
+		"::ffff:203.0.113.9": true,
+		"bogus":              false,
+	} {
+		if got := l.Contains(ip); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", ip, got, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.txt")
+	if err := os.WriteFile(path, []byte("10.0.0.0/33\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIPList(path); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestCheckRequest(t *testing.T) {
+	d, _ := newTestDetector(t, Config{IPRequestLimit: 2, UserRequestLimit: 3, VelocityWindow: time.Minute})
+	d.Datacenters = writeIPList(t, "203.0.113.0/24\n")
+	ctx := context.Background()
+
+	if r := d.CheckRequest(ctx, "198.51.100.1", "u1", true, false); r != ReasonBot {
+		t.Errorf("bot: got %q", r)
+	}
+	if r := d.CheckRequest(ctx, "203.0.113.4", "u1", false, false); r != ReasonDatacenter {
+		t.Errorf("datacenter: got %q", r)
+	}
+	for i := 0; i < 2; i++ {
+		if r := d.CheckRequest(ctx, "198.51.100.2", "", false, false); r != "" {
+			t.Fatalf("request %d flagged %q", i, r)
+		}
+	}
+	if r := d.CheckRequest(ctx, "198.51.100.2", "", false, false); r != ReasonIPVelocity {
+		t.Errorf("ip velocity: got %q", r)
+	}
+	for i, ip := range []string{"198.51.100.10", "198.51.100.11", "198.51.100.12"} {
+		if r := d.CheckRequest(ctx, ip, "u2", false, false); r != "" {
+			t.Fatalf("user request %d flagged %q", i, r)
+		}
+	}
+	if r := d.CheckRequest(ctx, "198.51.100.13", "u2", false, false); r != ReasonUserVelocity {
+		t.Errorf("user velocity: got %q", r)
+	}
+}
+
+func TestCheckClickTiming(t *testing.T) {
+	d, mr := newTestDetector(t, Config{MinClickDelay: time.Second})
+	ctx := context.Background()
+
+	if r := d.CheckClick(ctx, "tok", "198.51.100.1", "", "req0", "1", "7", false, false); r != ReasonClickTiming {
+		t.Errorf("click without impression: got %q", r)
+	}
+	if r := d.CheckImpression(ctx, "tok", "198.51.100.1", "req1", "1", "7", false, false); r != "" {
+		t.Fatalf("impression flagged %q", r)
+	}
+	if r := d.CheckClick(ctx, "tok", "198.51.100.1", "", "req1", "1", "7", false, false); r != ReasonClickTiming {
+		t.Errorf("instant click: got %q", r)
+	}
+	// Backdate the impression past the minimum delay.
+	mr.Set("ivt:imp:req1:1:7", "1")
+	if r := d.CheckClick(ctx, "tok", "198.51.100.1", "", "req1", "1", "7", false, false); r != "" {
+		t.Errorf("delayed click flagged %q", r)
+	}
+	// Ads of a pod share the request and impression IDs; another ad's
+	// impression doesn't time this one's click.
+	if r := d.CheckClick(ctx, "tok", "198.51.100.1", "", "req1", "1", "8", false, false); r != ReasonClickTiming {
+		t.Errorf("click on a pod ad without its impression: got %q", r)
+	}
+}
+
+func TestCheckClickTiming_NoMinDelay(t *testing.T) {
+	d, _ := newTestDetector(t, Config{MinClickDelay: 0})
+	ctx := context.Background()
+
+	if r := d.CheckClick(ctx, "tok", "198.51.100.1", "", "req0", "1", "7", false, false); r != ReasonClickTiming {
+		t.Errorf("click without impression: got %q", r)
+	}
+	if r := d.CheckImpression(ctx, "tok", "198.51.100.1", "req1", "1", "7", false, false); r != "" {
+		t.Fatalf("impression flagged %q", r)
+	}
+	if r := d.CheckClick(ctx, "tok", "198.51.100.1", "", "req1", "1", "7", false, false); r != "" {
+		t.Errorf("instant click flagged %q without a minimum delay", r)
+	}
+}
+
+func TestCheckTokenReuse(t *testing.T) {
+	d, _ := newTestDetector(t, Config{MaxTokenIPs: 2})
+	ctx := context.Background()
+
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.1"} {
+		if r := d.CheckEvent(ctx, "tok", ip, false, false); r != "" {
+			t.Fatalf("event from %s flagged %q", ip, r)
+		}
+	}
+	if r := d.CheckEvent(ctx, "tok", "198.51.100.3", false, false); r != ReasonTokenReuse {
+		t.Errorf("token reuse: got %q", r)
+	}
+	if r := d.CheckEvent(ctx, "other", "198.51.100.3", false, false); r != "" {
+		t.Errorf("fresh token flagged %q", r)
+	}
+}
+
+func TestNilDetector(t *testing.T) {
+	var d *Detector
+	ctx := context.Background()
+	if d.CheckRequest(ctx, "1.2.3.4", "u", true, false) != "" || d.CheckClick(ctx, "t", "1.2.3.4", "u", "r", "i", "7", true, false) != "" {
+		t.Error("nil detector should treat traffic as valid")
+	}
+}
+
+func TestCheckClickBurst(t *testing.T) {
+	d, _ := newTestDetector(t, Config{ClickIPLimit: 3, ClickUserLimit: 2, ClickWindow: time.Minute})
+	ctx := context.Background()
+	if r := d.CheckImpression(ctx, "tok", "198.51.100.1", "req", "1", "7", false, false); r != "" {
+		t.Fatalf("impression flagged %q", r)
+	}
+
+	for i := 0; i < 2; i++ {
+		if r := d.CheckClick(ctx, "tok", "198.51.100.1", "u1", "req", "1", "7", false, false); r != "" {
+			t.Fatalf("click %d flagged %q", i, r)
+		}
+	}
+	if r := d.CheckClick(ctx, "tok", "198.51.100.2", "u1", "req", "1", "7", false, false); r != ReasonClickBurst {
+		t.Errorf("user burst: got %q", r)
+	}
+	// The IP has now clicked three times; the fourth click from it is a burst
+	// even for a different user.
+	if r := d.CheckClick(ctx, "tok", "198.51.100.1", "u2", "req", "1", "7", false, false); r != "" {
+		t.Fatalf("third ip click flagged %q", r)
+	}
+	if r := d.CheckClick(ctx, "tok", "198.51.100.1", "u3", "req", "1", "7", false, false); r != ReasonClickBurst {
+		t.Errorf("ip burst: got %q", r)
+	}
+}
+
+func TestStoredIPs(t *testing.T) {
+	d, mr := newTestDetector(t, Config{IPRequestLimit: 5, MaxTokenIPs: 2, IPKey: []byte("k"), AnonymizeIPs: true})
+	ctx := context.Background()
+
+	d.CheckRequest(ctx, "198.51.100.7", "", false, false)
+	d.CheckEvent(ctx, "tok", "198.51.100.7", false, false)
+	for _, key := range mr.Keys() {
+		if strings.Contains(key, "198.51.100") {
+			t.Errorf("raw ip in key %s", key)
+		}
+		if mr.Type(key) == "set" {
+			members, _ := mr.Members(key)
+			for _, m := range members {
+				if strings.Contains(m, "198.51.100") {
+					t.Errorf("raw ip in %s member %s", key, m)
+				}
+			}
+		}
+	}
+	// Anonymized addresses of one network share a counter.
+	if d.storedIP("198.51.100.7", false) != d.storedIP("198.51.100.200", false) {
+		t.Error("expected addresses of one network to hash alike")
+	}
+
+	mr.FlushAll()
+	d.CheckRequest(ctx, "198.51.100.7", "", false, true)
+	d.CheckEvent(ctx, "tok", "198.51.100.7", false, true)
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("expected nothing stored for child-directed traffic, got %v", keys)
+	}
+}
@@ -0,0 +1,184 @@
+package logic
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/avct/uasurfer"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// ClientHints holds device details reported through User-Agent Client Hints
+// (Sec-CH-UA-* headers) or OpenRTB device.sua. Empty fields are unknown.
+type ClientHints struct {
+	Brands          []models.BrandVersion // Browser brands with versions, GREASE entries removed.
+	Platform        string                // Platform name, e.g. "Windows" or "Android".
+	PlatformVersion string                // Platform version, e.g. "15.0.0".
+	Model           string                // Device model, e.g. "Pixel 7".
+	Mobile          *bool                 // Whether the agent prefers mobile content.
+}
+
+// hintPlatformOS maps client hint platform names to the OS names produced by
+// uasurfer, used when the UA string itself could not be parsed.
+var hintPlatformOS = map[string]string{
+	"windows":   "PlatformWindows OSWindows",
+	"macos":     "PlatformMac OSMacOSX",
+	"android":   "PlatformLinux OSAndroid",
+	"ios":       "PlatformiPhone OSiOS",
+	"chrome os": "PlatformLinux OSChromeOS",
+	"chromeos":  "PlatformLinux OSChromeOS",
+	"linux":     "PlatformLinux OSLinux",
+}
+
+// hintBrands lists the client hint brands reported by each uasurfer browser.
+var hintBrands = map[uasurfer.BrowserName][]string{
+	uasurfer.BrowserChrome:  {"Google Chrome", "Chromium"},
+	uasurfer.BrowserIE:      {"Microsoft Edge"}, // uasurfer reports Chromium Edge as IE
+	uasurfer.BrowserOpera:   {"Opera"},
+	uasurfer.BrowserSamsung: {"Samsung Internet"},
+	uasurfer.BrowserYandex:  {"YaBrowser", "Yandex"},
+}
+
+// ClientHintsFromHeaders reads User-Agent Client Hints from HTTP headers.
+// Sec-CH-UA-Full-Version-List is preferred over the major-only Sec-CH-UA.
+func ClientHintsFromHeaders(h http.Header) ClientHints {
+	var hints ClientHints
+	brands := h.Get("Sec-CH-UA-Full-Version-List")
+	if brands == "" {
+		brands = h.Get("Sec-CH-UA")
+	}
+	hints.Brands = parseBrandList(brands)
+	hints.Platform = unquote(h.Get("Sec-CH-UA-Platform"))
+	hints.PlatformVersion = unquote(h.Get("Sec-CH-UA-Platform-Version"))
+	hints.Model = unquote(h.Get("Sec-CH-UA-Model"))
+	switch strings.TrimSpace(h.Get("Sec-CH-UA-Mobile")) {
+	case "?1":
+		hints.Mobile = boolPtr(true)
+	case "?0":
+		hints.Mobile = boolPtr(false)
+	}
+	return hints
+}
+
+// ClientHintsFromSUA converts an OpenRTB device.sua object into ClientHints.
+func ClientHintsFromSUA(sua *models.UserAgent) ClientHints {
+	var hints ClientHints
+	if sua == nil {
+		return hints
+	}
+	for _, b := range sua.Browsers {
+		if b.Brand != "" && !isGreaseBrand(b.Brand) {
+			hints.Brands = append(hints.Brands, b)
+		}
+	}
+	if sua.Platform != nil {
+		hints.Platform = sua.Platform.Brand
+		hints.PlatformVersion = strings.Join(sua.Platform.Version, ".")
+	}
+	hints.Model = sua.Model
+	if sua.Mobile != nil {
+		hints.Mobile = boolPtr(*sua.Mobile == 1)
+	}
+	return hints
+}
+
+// Merge returns h with any empty fields filled from other.
+func (h ClientHints) Merge(other ClientHints) ClientHints {
+	if len(h.Brands) == 0 {
+		h.Brands = other.Brands
+	}
+	if h.Platform == "" {
+		h.Platform = other.Platform
+	}
+	if h.PlatformVersion == "" {
+		h.PlatformVersion = other.PlatformVersion
+	}
+	if h.Model == "" {
+		h.Model = other.Model
+	}
+	if h.Mobile == nil {
+		h.Mobile = other.Mobile
+	}
+	return h
+}
+
+// osVersion returns the hinted platform version in the form uasurfer reports
+// the OS version from the UA string, or "" when there is no usable hint.
+// Windows reports its own platform versions rather than the NT version: 13
+// and above is Windows 11, 1 to 12 is Windows 10 and 0.1 to 0.3 are Windows
+// 7 to 8.1. Windows 11 still reports NT 10.0 in the UA, so it gets "11.0.0".
+func (h ClientHints) osVersion() string {
+	if h.PlatformVersion == "" || !strings.EqualFold(h.Platform, "windows") {
+		return h.PlatformVersion
+	}
+	major, minor, _ := strings.Cut(h.PlatformVersion, ".")
+	m, err := strconv.Atoi(major)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case m >= 13:
+		return "11.0.0"
+	case m >= 1:
+		return "10.0.0"
+	}
+	minor, _, _ = strings.Cut(minor, ".")
+	switch minor {
+	case "1", "2", "3":
+		return "6." + minor + ".0"
+	}
+	return ""
+}
+
+// browserVersion returns the hinted version of the given browser, or "" when
+// the hints do not mention it. Only versions with more than a major component
+// replace the UA version.
+func (h ClientHints) browserVersion(name uasurfer.BrowserName) string {
+	for _, want := range hintBrands[name] {
+		for _, b := range h.Brands {
+			if strings.EqualFold(b.Brand, want) && len(b.Version) > 1 {
+				return strings.Join(b.Version, ".")
+			}
+		}
+	}
+	return ""
+}
+
+// parseBrandList parses a structured header brand list such as
+// `"Chromium";v="120.0.6099.71", "Not_A Brand";v="8"`.
+func parseBrandList(v string) []models.BrandVersion {
+	var out []models.BrandVersion
+	for _, item := range strings.Split(v, ",") {
+		parts := strings.Split(item, ";")
+		brand := unquote(parts[0])
+		if brand == "" || isGreaseBrand(brand) {
+			continue
+		}
+		bv := models.BrandVersion{Brand: brand}
+		for _, p := range parts[1:] {
+			if k, val, ok := strings.Cut(strings.TrimSpace(p), "="); ok && k == "v" {
+				if ver := unquote(val); ver != "" {
+					bv.Version = strings.Split(ver, ".")
+				}
+			}
+		}
+		out = append(out, bv)
+	}
+	return out
+}
+
+// isGreaseBrand reports whether a brand is one of the randomised "Not A Brand"
+// entries browsers add to keep parsers honest.
+func isGreaseBrand(brand string) bool {
+	return strings.Contains(brand, "Not") && strings.Contains(brand, "Brand")
+}
+
+func unquote(v string) string {
+	return strings.Trim(strings.TrimSpace(v), `"`)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
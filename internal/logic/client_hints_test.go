@@ -0,0 +1,115 @@
+package logic
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// Chrome's reduced UA freezes the Windows version at 10.0 and Android at "10; K".
+const (
+	reducedWindowsUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	reducedAndroidUA = "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+)
+
+func TestClientHintsFromHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Sec-CH-UA", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`)
+	h.Set("Sec-CH-UA-Full-Version-List", `"Not_A Brand";v="8.0.0.0", "Chromium";v="120.0.6099.71", "Google Chrome";v="120.0.6099.71"`)
+	h.Set("Sec-CH-UA-Platform", `"Android"`)
+	h.Set("Sec-CH-UA-Platform-Version", `"14.0.0"`)
+	h.Set("Sec-CH-UA-Model", `"Pixel 7"`)
+	h.Set("Sec-CH-UA-Mobile", "?1")
+
+	hints := ClientHintsFromHeaders(h)
+	if len(hints.Brands) != 2 || hints.Brands[1].Brand != "Google Chrome" {
+		t.Fatalf("unexpected brands %+v", hints.Brands)
+	}
+	if hints.Platform != "Android" || hints.PlatformVersion != "14.0.0" || hints.Model != "Pixel 7" {
+		t.Errorf("unexpected hints %+v", hints)
+	}
+	if hints.Mobile == nil || !*hints.Mobile {
+		t.Error("expected mobile hint")
+	}
+
+	ctx := ResolveTargetingWithHints(nil, reducedAndroidUA, "", hints)
+	if !strings.Contains(ctx.OS, "Android 14.0.0") {
+		t.Errorf("OS = %q, want hinted Android 14.0.0", ctx.OS)
+	}
+	if ctx.Browser != "BrowserChrome 120.0.6099.71" {
+		t.Errorf("Browser = %q", ctx.Browser)
+	}
+	if ctx.Model != "Pixel 7" || ctx.PlatformVersion != "14.0.0" || !ctx.Mobile {
+		t.Errorf("unexpected device fields %+v", ctx)
+	}
+}
+
+func TestClientHintsFromSUA(t *testing.T) {
+	mobile := 0
+	sua := &models.UserAgent{
+		Browsers: []models.BrandVersion{
+			{Brand: "Not A(Brand", Version: []string{"99"}},
+			{Brand: "Microsoft Edge", Version: []string{"120", "0", "2210", "91"}},
+		},
+		Platform: &models.BrandVersion{Brand: "Windows", Version: []string{"15", "0", "0"}},
+		Mobile:   &mobile,
+	}
+	// device.sua wins over headers; headers only fill gaps.
+	h := http.Header{}
+	h.Set("Sec-CH-UA-Platform-Version", `"10.0.0"`)
+	h.Set("Sec-CH-UA-Model", `"ignored on desktop"`)
+	hints := ClientHintsFromSUA(sua).Merge(ClientHintsFromHeaders(h))
+
+	ctx := ResolveTargetingWithHints(nil, reducedWindowsUA+" Edg/120.0.0.0", "", hints)
+	if ctx.OS != "PlatformWindows OSWindows 11.0.0" {
+		t.Errorf("OS = %q", ctx.OS)
+	}
+	if ctx.Browser != "BrowserIE 120.0.2210.91" {
+		t.Errorf("Browser = %q", ctx.Browser)
+	}
+	if ctx.Mobile || ctx.DeviceType != "desktop" {
+		t.Errorf("expected desktop, got %+v", ctx)
+	}
+	if ctx.Model != "ignored on desktop" {
+		t.Errorf("Model = %q, expected header fallback", ctx.Model)
+	}
+}
+
+func TestResolveTargetingWithoutHints(t *testing.T) {
+	ctx := ResolveTargetingWithHints(nil, reducedWindowsUA, "", ClientHints{})
+	if ctx.OS != "PlatformWindows OSWindows 10.0.0" || ctx.PlatformVersion != "10.0.0" {
+		t.Errorf("unexpected UA-only OS %q / %q", ctx.OS, ctx.PlatformVersion)
+	}
+
+	// An unparseable UA still gets an OS name from the platform hint.
+	ctx = ResolveTargetingWithHints(nil, "", "", ClientHints{Platform: "macOS", PlatformVersion: "14.1.0"})
+	if ctx.OS != "PlatformMac OSMacOSX 14.1.0" {
+		t.Errorf("OS = %q", ctx.OS)
+	}
+}
+
+func TestWindowsPlatformVersion(t *testing.T) {
+	for hint, want := range map[string]string{
+		"15.0.0": "11.0.0",
+		"13.0.0": "11.0.0",
+		"10.0.0": "10.0.0",
+		"1.0.0":  "10.0.0",
+		"0.3.0":  "6.3.0",
+		"0.1.0":  "6.1.0",
+		"0.0.0":  "10.0.0", // unknown, keep the UA version
+		"bogus":  "10.0.0",
+	} {
+		ctx := ResolveTargetingWithHints(nil, reducedWindowsUA, "", ClientHints{Platform: "Windows", PlatformVersion: hint})
+		if ctx.PlatformVersion != want || ctx.OS != "PlatformWindows OSWindows "+want {
+			t.Errorf("platform version %s: got %q / %q, want %s", hint, ctx.OS, ctx.PlatformVersion, want)
+		}
+	}
+
+	// Other platforms report their OS version as is.
+	ctx := ResolveTargetingWithHints(nil, "", "", ClientHints{Platform: "Android", PlatformVersion: "14.0.0"})
+	if ctx.PlatformVersion != "14.0.0" {
+		t.Errorf("Android platform version = %q", ctx.PlatformVersion)
+	}
+}
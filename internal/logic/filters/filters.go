@@ -3,6 +3,7 @@ package filters
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/patrickwarner/openadserve/internal/config"
 	"github.com/patrickwarner/openadserve/internal/db"
@@ -13,6 +14,10 @@ import (
 // ErrPacingLimitReached is returned when all creatives are filtered out due to pacing limits.
 var ErrPacingLimitReached = errors.New("line item pacing limit reached")
 
+// nowFn returns the current time for flight date checks. Tests may replace
+// it to simulate different times.
+var nowFn = time.Now
+
 // FilterByTargeting returns creatives whose line items match the given targeting context.
 func FilterByTargeting(creatives []models.Creative, ctx models.TargetingContext, dataStore models.AdDataStore) []models.Creative {
 	var out []models.Creative
@@ -25,10 +30,17 @@ func FilterByTargeting(creatives []models.Creative, ctx models.TargetingContext,
 }
 
 // FilterBySize filters creatives that don't match the requested size or allowed formats.
-func FilterBySize(creatives []models.Creative, width, height int, allowedFormats []string) []models.Creative {
+// Video creatives must also fit the player constraints in video, if any.
+func FilterBySize(creatives []models.Creative, width, height int, allowedFormats []string, video *models.VideoPlacement) []models.Creative {
+	return FilterBySizes(creatives, []models.Format{{W: width, H: height}}, allowedFormats, video)
+}
+
+// FilterBySizes is FilterBySize for slots that accept several sizes: a
+// creative fits when its size matches any of them.
+func FilterBySizes(creatives []models.Creative, sizes []models.Format, allowedFormats []string, video *models.VideoPlacement) []models.Creative {
 	var out []models.Creative
 	for _, c := range creatives {
-		if creativeFitsPlacement(c, width, height, allowedFormats) {
+		if creativeFitsPlacement(c, sizes, allowedFormats, video) {
 			out = append(out, c)
 		}
 	}
@@ -62,14 +74,24 @@ func FilterByFrequency(store *db.RedisStore, creatives []models.Creative, userID
 
 	var out []models.Creative
 	for _, c := range creatives {
-		creativeKey := fmt.Sprintf("%d_%d", c.PublisherID, c.LineItemID)
-		if !exceeded[creativeKey] {
+		if !logic.FrequencyExceeded(exceeded, c) {
 			out = append(out, c)
 		}
 	}
 	return out, nil
 }
 
+// FilterByFlight removes creatives outside their own flight dates.
+func FilterByFlight(creatives []models.Creative, now time.Time) []models.Creative {
+	var out []models.Creative
+	for _, c := range creatives {
+		if c.InFlight(now) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
 // FilterByPacing filters creatives blocked by line item pacing rules. Returns ErrPacingLimitReached
 // if all creatives are filtered out due to pacing caps.
 func FilterByPacing(store *db.RedisStore, creatives []models.Creative, dataStore models.AdDataStore, cfg config.Config) ([]models.Creative, error) {
@@ -132,12 +154,54 @@ func FilterByPacingWithTrace(store *db.RedisStore, creatives []models.Creative,
 	return out, details, nil
 }
 
-// creativeFitsPlacement checks that the creative matches the requested size and format constraints.
-func creativeFitsPlacement(c models.Creative, width, height int, allowedFormats []string) bool {
-	if width > 0 && c.Width != width {
-		return false
+// FilterByPodSeparation removes creatives whose line item or advertiser is
+// already part of the ad pod being filled.
+func FilterByPodSeparation(creatives []models.Creative, pod *models.PodSeparation) []models.Creative {
+	if pod == nil {
+		return creatives
+	}
+	var out []models.Creative
+	for _, c := range creatives {
+		adomain := ""
+		if c.LineItem != nil {
+			adomain = c.LineItem.ADomain
+		}
+		if pod.Allows(c.LineItemID, adomain) {
+			out = append(out, c)
+		}
 	}
-	if height > 0 && c.Height != height {
+	return out
+}
+
+// FilterByNative removes native creatives that can't fill the required
+// assets of the placement's native request.
+func FilterByNative(creatives []models.Creative, req *models.NativeRequest) []models.Creative {
+	if req == nil {
+		return creatives
+	}
+	var out []models.Creative
+	for _, c := range creatives {
+		if c.Format != models.FormatNative || req.Accepts(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// creativeFitsPlacement checks that the creative matches the requested size and format constraints.
+// Players scale video to fit, so video creatives are matched on the player
+// constraints instead of their size. Programmatic video without media is
+// checked once the bid's VAST is known.
+func creativeFitsPlacement(c models.Creative, sizes []models.Format, allowedFormats []string, video *models.VideoPlacement) bool {
+	if c.Format == models.FormatVideo {
+		if c.Video == nil && c.LineItem != nil && c.LineItem.Type == models.LineItemTypeProgrammatic {
+			if !video.SupportsVAST() {
+				return false
+			}
+		} else if !video.Accepts(c.Video) {
+			return false
+		}
+	} else if !fitsAnySize(c, sizes) {
 		return false
 	}
 	if len(allowedFormats) > 0 && c.Format != "" {
@@ -150,3 +214,17 @@ func creativeFitsPlacement(c models.Creative, width, height int, allowedFormats
 	}
 	return true
 }
+
+// fitsAnySize reports whether the creative's size matches one of the sizes.
+// No sizes leaves the size open.
+func fitsAnySize(c models.Creative, sizes []models.Format) bool {
+	if len(sizes) == 0 {
+		return true
+	}
+	for _, f := range sizes {
+		if f.Fits(c.Width, c.Height) {
+			return true
+		}
+	}
+	return false
+}
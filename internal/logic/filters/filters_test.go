@@ -59,12 +59,69 @@ func TestFilterBySize(t *testing.T) {
 		{ID: 2, Width: 728, Height: 90, Format: "video"},
 	}
 
-	filtered := FilterBySize(creatives, 300, 250, []string{"html"})
+	filtered := FilterBySize(creatives, 300, 250, []string{"html"}, nil)
 	if len(filtered) != 1 || filtered[0].ID != 1 {
 		t.Fatalf("expected only creative 1, got %+v", filtered)
 	}
 }
 
+func TestFilterBySizes(t *testing.T) {
+	creatives := []models.Creative{
+		{ID: 1, Width: 300, Height: 250, Format: "html"},
+		{ID: 2, Width: 336, Height: 280, Format: "html"},
+		{ID: 3, Width: 728, Height: 90, Format: "html"},
+	}
+	filtered := FilterBySizes(creatives, []models.Format{{W: 300, H: 250}, {W: 336, H: 280}}, []string{"html"}, nil)
+	if len(filtered) != 2 || filtered[0].ID != 1 || filtered[1].ID != 2 {
+		t.Fatalf("expected creatives 1 and 2, got %+v", filtered)
+	}
+	if filtered := FilterBySizes(creatives, nil, nil, nil); len(filtered) != 3 {
+		t.Fatalf("expected no sizes to accept all creatives, got %+v", filtered)
+	}
+}
+
+func TestFilterBySize_Video(t *testing.T) {
+	mp4 := []models.MediaFile{{URL: "https://cdn.example.com/a.mp4", MIME: "video/mp4", Width: 1280, Height: 720}}
+	creatives := []models.Creative{
+		{ID: 1, Width: 1280, Height: 720, Format: "video", Video: &models.VideoCreative{Duration: 15, MediaFiles: mp4}},
+		{ID: 2, Width: 1280, Height: 720, Format: "video", Video: &models.VideoCreative{Duration: 30, MediaFiles: mp4}},
+		{ID: 3, Width: 640, Height: 360, Format: "video"},
+		// Programmatic video is checked once the bid's VAST is known
+		{ID: 4, Format: "video", LineItem: &models.LineItem{Type: models.LineItemTypeProgrammatic}},
+		// Third-party tags carry no media files to match
+		{ID: 5, Format: "video", Video: &models.VideoCreative{Duration: 15, VASTTagURL: "https://adserver.example/vast"}},
+	}
+	video := &models.VideoPlacement{MaxDuration: 20, MIMEs: []string{"video/mp4"}, Protocols: []int{models.ProtocolVAST41}}
+
+	filtered := FilterBySize(creatives, 640, 480, []string{"video"}, video)
+	if len(filtered) != 3 || filtered[0].ID != 1 || filtered[1].ID != 4 || filtered[2].ID != 5 {
+		t.Fatalf("expected creatives 1, 4 and 5, got %+v", filtered)
+	}
+
+	video.Protocols = []int{2, 3}
+	if filtered := FilterBySize(creatives, 640, 480, []string{"video"}, video); len(filtered) != 0 {
+		t.Fatalf("expected no creatives without VAST 4 support, got %+v", filtered)
+	}
+}
+
+func TestFilterByPodSeparation(t *testing.T) {
+	creatives := []models.Creative{
+		{ID: 1, LineItemID: 1, LineItem: &models.LineItem{ID: 1, ADomain: "a.example"}},
+		{ID: 2, LineItemID: 2, LineItem: &models.LineItem{ID: 2, ADomain: "a.example"}},
+		{ID: 3, LineItemID: 3, LineItem: &models.LineItem{ID: 3}},
+		{ID: 4, LineItemID: 4, LineItem: &models.LineItem{ID: 4, ADomain: "b.example"}},
+	}
+	if got := FilterByPodSeparation(creatives, nil); len(got) != 4 {
+		t.Fatalf("expected no filtering outside pods, got %+v", got)
+	}
+	pod := &models.PodSeparation{}
+	pod.Add(3, "a.example")
+	got := FilterByPodSeparation(creatives, pod)
+	if len(got) != 1 || got[0].ID != 4 {
+		t.Fatalf("expected only creative 4, got %+v", got)
+	}
+}
+
 func TestFilterByFrequency(t *testing.T) {
 	ms, store := setupTestRedis(t)
 	defer ms.Close()
@@ -26,7 +26,9 @@ func NewSinglePassFilter(store *db.RedisStore, dataStore models.AdDataStore, cfg
 	}
 }
 
-// FilterCreatives applies all filters in a single pass using simple slice operations
+// FilterCreatives applies all filters in a single pass using simple slice operations.
+// Creatives must match width and height, or one of targetingCtx.Sizes when the
+// request accepts several sizes.
 func (spf *SinglePassFilter) FilterCreatives(
 	ctx context.Context,
 	creatives []models.Creative,
@@ -43,6 +45,13 @@ func (spf *SinglePassFilter) FilterCreatives(
 	// Pre-allocate result slice with reasonable capacity
 	filtered := make([]models.Creative, 0, len(creatives))
 
+	sizes := targetingCtx.Sizes
+	if len(sizes) == 0 {
+		sizes = []models.Format{{W: width, H: height}}
+	}
+
+	now := nowFn()
+
 	// Collect Redis batch data as we filter
 	var creativesForRedis []models.Creative
 
@@ -59,8 +68,9 @@ func (spf *SinglePassFilter) FilterCreatives(
 			continue
 		}
 
-		// 3. Size/format check
-		if !creativeFitsPlacement(c, width, height, allowedFormats) {
+		// 3. Vendor consent check - programmatic demand only sees requests
+		// from users who consented to that vendor under GDPR
+		if li.Type == models.LineItemTypeProgrammatic && !targetingCtx.Privacy.VendorAllowed(li.VendorID) {
 			continue
 		}
 
@@ -69,6 +79,26 @@ func (spf *SinglePassFilter) FilterCreatives(
 			c.LineItem = li
 		}
 
+		// 4. Size/format check
+		if !creativeFitsPlacement(c, sizes, allowedFormats, targetingCtx.Video) {
+			continue
+		}
+
+		// 5. Competitive separation within a video ad pod
+		if !targetingCtx.Pod.Allows(li.ID, li.ADomain) {
+			continue
+		}
+
+		// 6. Native assets must fill the placement's native request
+		if c.Format == models.FormatNative && !targetingCtx.Native.Accepts(c) {
+			continue
+		}
+
+		// 7. Creative flight dates
+		if !c.InFlight(now) {
+			continue
+		}
+
 		// Add to intermediate result
 		filtered = append(filtered, c)
 
@@ -95,7 +125,9 @@ func (spf *SinglePassFilter) FilterCreatives(
 	return filtered, nil
 }
 
-// applyRedisFilters applies frequency and pacing filters using optimized batch operations
+// applyRedisFilters applies frequency and pacing filters using optimized batch operations.
+// Frequency caps are skipped when there is no usable user ID, e.g. when the
+// user has not consented to identifier-based processing.
 func (spf *SinglePassFilter) applyRedisFilters(
 	preFiltered []models.Creative,
 	creativesForRedis []models.Creative,
@@ -103,9 +135,13 @@ func (spf *SinglePassFilter) applyRedisFilters(
 ) ([]models.Creative, error) {
 
 	// Batch frequency check
-	exceeded, err := logic.BatchFrequencyCheck(spf.store, userID, creativesForRedis, spf.dataStore)
-	if err != nil {
-		return nil, fmt.Errorf("batch frequency check failed for %d creatives: %w", len(creativesForRedis), err)
+	exceeded := map[string]bool{}
+	if userID != "" {
+		var err error
+		exceeded, err = logic.BatchFrequencyCheck(spf.store, userID, creativesForRedis, spf.dataStore)
+		if err != nil {
+			return nil, fmt.Errorf("batch frequency check failed for %d creatives: %w", len(creativesForRedis), err)
+		}
 	}
 
 	// Batch pacing check
@@ -120,8 +156,8 @@ func (spf *SinglePassFilter) applyRedisFilters(
 	for _, c := range preFiltered {
 		creativeKey := fmt.Sprintf("%d_%d", c.PublisherID, c.LineItemID)
 
-		// Check frequency cap
-		if exceeded[creativeKey] {
+		// Check line item and creative frequency caps
+		if logic.FrequencyExceeded(exceeded, c) {
 			continue
 		}
 
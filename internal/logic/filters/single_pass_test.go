@@ -231,7 +231,7 @@ func TestSinglePassVsMultiPassEquivalence(t *testing.T) {
 			multiPassResult = FilterByTargeting(multiPassResult, tt.targetingCtx, dataStore)
 
 			// Filter by size
-			multiPassResult = FilterBySize(multiPassResult, tt.width, tt.height, tt.allowedFormats)
+			multiPassResult = FilterBySize(multiPassResult, tt.width, tt.height, tt.allowedFormats, tt.targetingCtx.Video)
 
 			// Apply single-pass filter
 			spFilter := NewSinglePassFilter(nil, dataStore, config.Config{})
@@ -298,7 +298,7 @@ func BenchmarkFiltering(b *testing.B) {
 
 				result = FilterByActive(result, dataStore)
 				result = FilterByTargeting(result, ctx, dataStore)
-				result = FilterBySize(result, 300, 250, []string{"banner"})
+				result = FilterBySize(result, 300, 250, []string{"banner"}, nil)
 				_ = result // Use result to avoid ineffassign warning
 			}
 		})
@@ -400,3 +400,79 @@ func TestSinglePassTracing(t *testing.T) {
 	assert.Equal(t, "single_pass_start", trace.Steps[0].Stage)
 	assert.Equal(t, "single_pass_complete", trace.Steps[1].Stage)
 }
+
+// TestSinglePassVendorConsent checks that programmatic line items are dropped
+// when GDPR applies and the user has not consented to their vendor.
+func TestSinglePassVendorConsent(t *testing.T) {
+	dataStore := models.NewInMemoryAdDataStore()
+	creatives := createTestCreatives(3)
+
+	items := make([]models.LineItem, 3)
+	items[0] = *createTestLineItem(1, true, "") // Direct, no vendor check
+	items[1] = *createTestLineItem(2, true, "") // Programmatic with consent
+	items[1].Type = models.LineItemTypeProgrammatic
+	items[1].VendorID = 32
+	items[2] = *createTestLineItem(3, true, "") // Programmatic without consent
+	items[2].Type = models.LineItemTypeProgrammatic
+	items[2].VendorID = 99
+	_ = dataStore.SetLineItems(items)
+
+	ctx := models.TargetingContext{
+		Privacy: models.PrivacyContext{
+			GDPRApplies:    true,
+			Status:         models.ConsentGranted,
+			VendorConsents: map[int]bool{32: true},
+		},
+	}
+
+	spFilter := NewSinglePassFilter(nil, dataStore, config.Config{})
+	result, err := spFilter.FilterCreatives(context.Background(), creatives, ctx, 300, 250, []string{"banner"}, "")
+
+	assert.NoError(t, err)
+	ids := make([]int, 0, len(result))
+	for _, c := range result {
+		ids = append(ids, c.LineItemID)
+	}
+	assert.ElementsMatch(t, []int{1, 2}, ids)
+}
+
+// TestSinglePassCreativeDelivery checks creative flight dates and
+// creative-level frequency caps: a teaser creative shown twice per user makes
+// way for the line item's main creative.
+func TestSinglePassCreativeDelivery(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	dataStore := models.NewInMemoryAdDataStore()
+	_ = dataStore.SetLineItems([]models.LineItem{*createTestLineItem(1, true, "")})
+
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	origNow := nowFn
+	nowFn = func() time.Time { return now }
+	defer func() { nowFn = origNow }()
+
+	creatives := []models.Creative{
+		{ID: 1, PublisherID: 1, LineItemID: 1, Width: 300, Height: 250, Format: "banner", FrequencyCap: 2, FrequencyWindow: time.Hour},
+		{ID: 2, PublisherID: 1, LineItemID: 1, Width: 300, Height: 250, Format: "banner"},
+		{ID: 3, PublisherID: 1, LineItemID: 1, Width: 300, Height: 250, Format: "banner", StartDate: now.Add(time.Hour)},
+		{ID: 4, PublisherID: 1, LineItemID: 1, Width: 300, Height: 250, Format: "banner", EndDate: now.Add(-time.Hour)},
+	}
+	spFilter := NewSinglePassFilter(store, dataStore, config.Config{})
+	eligible := func() []int {
+		t.Helper()
+		result, err := spFilter.FilterCreatives(context.Background(), creatives, models.TargetingContext{}, 300, 250, []string{"banner"}, "u1")
+		assert.NoError(t, err)
+		ids := make([]int, 0, len(result))
+		for _, c := range result {
+			ids = append(ids, c.ID)
+		}
+		return ids
+	}
+
+	assert.ElementsMatch(t, []int{1, 2}, eligible(), "creatives outside their flight should be skipped")
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, logic.IncrementCreativeFrequencyCap(store, "u1", &creatives[0]))
+	}
+	assert.ElementsMatch(t, []int{2}, eligible(), "the teaser should stop at its own cap")
+	assert.True(t, ms.TTL("freqcap:u1:creative:1") > 0, "creative cap should expire with its window")
+}
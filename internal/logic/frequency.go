@@ -65,3 +65,25 @@ func IncrementFrequencyCap(store *db.RedisStore, userID string, publisherID, lin
 	}
 	return nil
 }
+
+// IncrementCreativeFrequencyCap increments the user's count for a creative
+// with its own frequency cap. Creatives without one are not counted.
+func IncrementCreativeFrequencyCap(store *db.RedisStore, userID string, c *models.Creative) error {
+	if store == nil || store.Client == nil {
+		return ErrNilRedisStore
+	}
+	if c == nil || c.FrequencyCap <= 0 {
+		return nil
+	}
+
+	window := DefaultFrequencyWindow
+	if c.FrequencyWindow > 0 {
+		window = c.FrequencyWindow
+	}
+
+	if _, err := store.IncrementCreativeImpression(userID, c.ID, window); err != nil {
+		zap.L().Error("failed to increment creative frequency cap", zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package logic
+
+import (
+	"math"
+	"sync"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+const (
+	earthRadiusKM = 6371.0
+	kmPerDegree   = 111.32
+
+	// geofenceCellDeg is the grid cell size of a GeofenceIndex in degrees
+	// (about 11 km of latitude).
+	geofenceCellDeg = 0.1
+	// maxCellsPerFence caps how many grid cells one geofence is registered in.
+	// Larger fences are kept in a list that is checked on every lookup.
+	maxCellsPerFence = 4096
+	// lonCells is the number of grid cells around the globe.
+	lonCells = int32(360 / geofenceCellDeg)
+)
+
+// GeofenceIndex is a grid-based spatial index over a line item's geofences.
+// Each fence is registered in the cells its bounding box overlaps, so a lookup
+// only tests the fences near the requested point.
+type GeofenceIndex struct {
+	fences []models.Geofence
+	cells  map[uint64][]int
+	large  []int
+}
+
+// NewGeofenceIndex builds an index for the given geofences. Circles without a
+// positive radius and polygons with fewer than three vertices are ignored.
+// Fences crossing the antimeridian are registered in the cells on both sides.
+func NewGeofenceIndex(fences []models.Geofence) *GeofenceIndex {
+	idx := &GeofenceIndex{fences: make([]models.Geofence, len(fences)), cells: make(map[uint64][]int)}
+	copy(idx.fences, fences)
+	for i := range idx.fences {
+		f := &idx.fences[i]
+		if f.IsPolygon() {
+			f.Polygon = unwrapPolygon(f.Polygon)
+		}
+		minLat, minLon, maxLat, maxLon, ok := fenceBounds(*f)
+		if !ok {
+			continue
+		}
+		lat0, lon0 := cellCoord(minLat), cellCoord(minLon)
+		lat1, lon1 := cellCoord(maxLat), cellCoord(maxLon)
+		if lon1-lon0+1 > lonCells {
+			lon0, lon1 = 0, lonCells-1
+		}
+		if (lat1-lat0+1)*(lon1-lon0+1) > maxCellsPerFence {
+			idx.large = append(idx.large, i)
+			continue
+		}
+		for y := lat0; y <= lat1; y++ {
+			for x := lon0; x <= lon1; x++ {
+				k := cellKey(y, wrapLonCell(x))
+				idx.cells[k] = append(idx.cells[k], i)
+			}
+		}
+	}
+	return idx
+}
+
+// Contains reports whether the point lies inside any indexed geofence.
+func (idx *GeofenceIndex) Contains(lat, lon float64) bool {
+	if idx == nil {
+		return false
+	}
+	for _, i := range idx.cells[cellKey(cellCoord(lat), wrapLonCell(cellCoord(lon)))] {
+		if fenceContains(idx.fences[i], lat, lon) {
+			return true
+		}
+	}
+	for _, i := range idx.large {
+		if fenceContains(idx.fences[i], lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+type geofenceCacheEntry struct {
+	src *models.Geofence
+	n   int
+	idx *GeofenceIndex
+}
+
+// geofenceCache holds one index per line item ID. Line items are replaced
+// rather than mutated on reload, so an entry is reused while it was built from
+// the same geofence slice. Reloads reset the cache so indexes of edited and
+// deleted line items don't linger.
+var geofenceCache sync.Map
+
+// ResetGeofenceIndexes drops every cached geofence index. Indexes are rebuilt
+// on first use.
+func ResetGeofenceIndexes() {
+	geofenceCache.Clear()
+}
+
+// ForgetGeofenceIndex drops the cached geofence index of a line item that
+// was updated or deleted.
+func ForgetGeofenceIndex(lineItemID int) {
+	geofenceCache.Delete(lineItemID)
+}
+
+// geofenceIndexFor returns the cached index for the line item's geofences,
+// building it on first use or when the geofences have changed.
+func geofenceIndexFor(li *models.LineItem) *GeofenceIndex {
+	src := &li.Geofences[0]
+	if v, ok := geofenceCache.Load(li.ID); ok {
+		e := v.(geofenceCacheEntry)
+		if e.src == src && e.n == len(li.Geofences) {
+			return e.idx
+		}
+	}
+	idx := NewGeofenceIndex(li.Geofences)
+	geofenceCache.Store(li.ID, geofenceCacheEntry{src: src, n: len(li.Geofences), idx: idx})
+	return idx
+}
+
+// MatchesGeofences returns true if the line item has no geofences or the
+// request location falls inside one of them. Requests without a location
+// never match a geofenced line item.
+func MatchesGeofences(li *models.LineItem, ctx models.TargetingContext) bool {
+	if li == nil || len(li.Geofences) == 0 {
+		return true
+	}
+	if !hasLocation(ctx.Lat, ctx.Lon) {
+		return false
+	}
+	return geofenceIndexFor(li).Contains(ctx.Lat, ctx.Lon)
+}
+
+// ApplyDeviceGeo replaces the IP-derived coordinates in ctx with the device
+// location from the request when it carries valid coordinates.
+func ApplyDeviceGeo(ctx *models.TargetingContext, geo *models.Geo) {
+	if geo == nil || !hasLocation(geo.Lat, geo.Lon) {
+		return
+	}
+	if geo.Lat < -90 || geo.Lat > 90 || geo.Lon < -180 || geo.Lon > 180 {
+		return
+	}
+	ctx.Lat = geo.Lat
+	ctx.Lon = geo.Lon
+}
+
+// hasLocation treats 0,0 as "unknown", which is how missing coordinates
+// arrive from both GeoIP and OpenRTB clients.
+func hasLocation(lat, lon float64) bool {
+	return lat != 0 || lon != 0
+}
+
+// fenceContains tests a fence whose polygon, if any, has been unwrapped.
+func fenceContains(f models.Geofence, lat, lon float64) bool {
+	if f.IsPolygon() {
+		if pointInPolygon(f.Polygon, lat, lon) {
+			return true
+		}
+		// Unwrapped polygons crossing the antimeridian extend past ±180
+		if lon < 0 {
+			return pointInPolygon(f.Polygon, lat, lon+360)
+		}
+		return pointInPolygon(f.Polygon, lat, lon-360)
+	}
+	return haversineKM(f.Lat, f.Lon, lat, lon) <= f.RadiusKM
+}
+
+// unwrapPolygon shifts longitudes by whole turns so that no edge spans more
+// than 180 degrees. A polygon crossing the antimeridian then extends past ±180
+// instead of reaching around the globe the long way. The input is not
+// modified.
+func unwrapPolygon(poly []models.GeoPoint) []models.GeoPoint {
+	var out []models.GeoPoint
+	prev := poly[0].Lon
+	for i := 1; i < len(poly); i++ {
+		lon := poly[i].Lon
+		for lon-prev > 180 {
+			lon -= 360
+		}
+		for lon-prev < -180 {
+			lon += 360
+		}
+		if lon != poly[i].Lon && out == nil {
+			out = append([]models.GeoPoint(nil), poly...)
+		}
+		if out != nil {
+			out[i].Lon = lon
+		}
+		prev = lon
+	}
+	if out == nil {
+		return poly
+	}
+	return out
+}
+
+// fenceBounds returns the bounding box of a geofence in degrees. Longitudes
+// of fences crossing the antimeridian extend past ±180.
+func fenceBounds(f models.Geofence) (minLat, minLon, maxLat, maxLon float64, ok bool) {
+	if f.IsPolygon() {
+		minLat, minLon = f.Polygon[0].Lat, f.Polygon[0].Lon
+		maxLat, maxLon = minLat, minLon
+		for _, p := range f.Polygon[1:] {
+			minLat, maxLat = math.Min(minLat, p.Lat), math.Max(maxLat, p.Lat)
+			minLon, maxLon = math.Min(minLon, p.Lon), math.Max(maxLon, p.Lon)
+		}
+		return minLat, minLon, maxLat, maxLon, true
+	}
+	if f.RadiusKM <= 0 {
+		return 0, 0, 0, 0, false
+	}
+	dLat := f.RadiusKM / kmPerDegree
+	dLon := 180.0 // near and around the poles a circle can span every longitude
+	if c := math.Cos(f.Lat * math.Pi / 180); c > 1e-6 && math.Abs(f.Lat)+dLat < 90 {
+		dLon = math.Min(180, f.RadiusKM/(kmPerDegree*c))
+	}
+	return math.Max(-90, f.Lat-dLat), f.Lon - dLon,
+		math.Min(90, f.Lat+dLat), f.Lon + dLon, true
+}
+
+func cellCoord(deg float64) int32 {
+	return int32(math.Floor(deg / geofenceCellDeg))
+}
+
+// wrapLonCell maps a longitude cell coordinate onto the cells of -180 to 180,
+// so cells past the antimeridian continue on the other side.
+func wrapLonCell(x int32) int32 {
+	x = (x + lonCells/2) % lonCells
+	if x < 0 {
+		x += lonCells
+	}
+	return x - lonCells/2
+}
+
+func cellKey(lat, lon int32) uint64 {
+	return uint64(uint32(lat))<<32 | uint64(uint32(lon))
+}
+
+// haversineKM returns the great-circle distance between two points.
+func haversineKM(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKM * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// pointInPolygon uses ray casting on plain lat/lon coordinates, which is
+// accurate enough for city-scale polygons.
+func pointInPolygon(poly []models.GeoPoint, lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if (a.Lat > lat) != (b.Lat > lat) &&
+			lon < (b.Lon-a.Lon)*(lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,147 @@
+package logic
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func TestGeofenceIndexContains(t *testing.T) {
+	idx := NewGeofenceIndex([]models.Geofence{
+		// 5 km around Union Square, San Francisco
+		{Name: "sf", Lat: 37.7880, Lon: -122.4075, RadiusKM: 5},
+		// Rough box around Manhattan below Central Park
+		{Name: "nyc", Polygon: []models.GeoPoint{
+			{Lat: 40.700, Lon: -74.020}, {Lat: 40.765, Lon: -74.010},
+			{Lat: 40.765, Lon: -73.970}, {Lat: 40.700, Lon: -73.970},
+		}},
+		// Large enough to skip the grid
+		{Name: "texas", Lat: 31.0, Lon: -100.0, RadiusKM: 800},
+		{Name: "invalid", Lat: 10, Lon: 10},
+	})
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"inside circle", 37.7749, -122.4194, true},
+		{"outside circle", 37.4419, -122.1430, false},
+		{"inside polygon", 40.7306, -73.9866, true},
+		{"outside polygon", 40.6782, -73.9442, false},
+		{"inside large fence", 29.7604, -95.3698, true},
+		{"zero radius fence", 10, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idx.Contains(tt.lat, tt.lon); got != tt.want {
+				t.Errorf("Contains(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeofenceIndexAntimeridian(t *testing.T) {
+	poly := []models.GeoPoint{
+		{Lat: 10, Lon: 179.5}, {Lat: 10, Lon: -179.5},
+		{Lat: 11, Lon: -179.5}, {Lat: 11, Lon: 179.5},
+	}
+	idx := NewGeofenceIndex([]models.Geofence{
+		// 50 km around a point just west of the date line
+		{Name: "circle", Lat: -17.0, Lon: 179.9, RadiusKM: 50},
+		// Box straddling the date line
+		{Name: "polygon", Polygon: poly},
+	})
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"circle same side", -17.0, 179.7, true},
+		{"circle across the date line", -17.0, -179.8, true},
+		{"circle too far across", -17.0, -179.0, false},
+		{"polygon west side", 10.5, 179.9, true},
+		{"polygon east side", 10.5, -179.9, true},
+		{"polygon at 180", 10.5, 180, true},
+		{"outside polygon east", 10.5, -179.0, false},
+		{"polygon does not wrap the long way", 10.5, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idx.Contains(tt.lat, tt.lon); got != tt.want {
+				t.Errorf("Contains(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+	if poly[1].Lon != -179.5 {
+		t.Error("indexing must not modify the line item's polygon")
+	}
+}
+
+func TestMatchesGeofences(t *testing.T) {
+	li := &models.LineItem{ID: 9001, Geofences: []models.Geofence{{Lat: 51.5074, Lon: -0.1278, RadiusKM: 2}}}
+
+	if !MatchesGeofences(li, models.TargetingContext{Lat: 51.51, Lon: -0.13}) {
+		t.Error("expected match inside fence")
+	}
+	if MatchesGeofences(li, models.TargetingContext{}) {
+		t.Error("request without location must not match a geofenced line item")
+	}
+	if !MatchesGeofences(&models.LineItem{}, models.TargetingContext{}) {
+		t.Error("line item without geofences should match")
+	}
+
+	// Replacing the geofences must invalidate the cached index.
+	li.Geofences = []models.Geofence{{Lat: 48.8566, Lon: 2.3522, RadiusKM: 2}}
+	if MatchesGeofences(li, models.TargetingContext{Lat: 51.51, Lon: -0.13}) {
+		t.Error("stale index used after geofences changed")
+	}
+
+	// A fence edited in place is only picked up once the index is dropped.
+	li.Geofences[0] = models.Geofence{Lat: 51.5074, Lon: -0.1278, RadiusKM: 2}
+	ForgetGeofenceIndex(li.ID)
+	if !MatchesGeofences(li, models.TargetingContext{Lat: 51.51, Lon: -0.13}) {
+		t.Error("expected the edited fence after forgetting the index")
+	}
+	ResetGeofenceIndexes()
+	if _, ok := geofenceCache.Load(li.ID); ok {
+		t.Error("expected reset to drop every index")
+	}
+}
+
+func TestApplyDeviceGeo(t *testing.T) {
+	ctx := models.TargetingContext{Lat: 37.7749, Lon: -122.4194}
+	ApplyDeviceGeo(&ctx, &models.Geo{Lat: 40.7128, Lon: -74.0060, Type: 1})
+	if ctx.Lat != 40.7128 || ctx.Lon != -74.0060 {
+		t.Errorf("device geo not applied: %v,%v", ctx.Lat, ctx.Lon)
+	}
+
+	ctx = models.TargetingContext{Lat: 37.7749, Lon: -122.4194}
+	ApplyDeviceGeo(&ctx, &models.Geo{})
+	ApplyDeviceGeo(&ctx, &models.Geo{Lat: 123, Lon: 0})
+	ApplyDeviceGeo(&ctx, nil)
+	if ctx.Lat != 37.7749 || ctx.Lon != -122.4194 {
+		t.Errorf("IP location should be kept, got %v,%v", ctx.Lat, ctx.Lon)
+	}
+}
+
+func BenchmarkMatchesGeofences(b *testing.B) {
+	fences := make([]models.Geofence, 5000)
+	for i := range fences {
+		fences[i] = models.Geofence{
+			Name:     fmt.Sprintf("store-%d", i),
+			Lat:      25 + float64(i%100)*0.24,
+			Lon:      -124 + float64(i/100)*1.14,
+			RadiusKM: 5,
+		}
+	}
+	li := &models.LineItem{ID: 9002, Geofences: fences}
+	ctx := models.TargetingContext{Lat: 39.7392, Lon: -104.9903}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MatchesGeofences(li, ctx)
+	}
+}
@@ -80,6 +80,41 @@ func checkPIDPacing(store *db.RedisStore, lineItemID int, count, capDaily int64,
 	return control > 0
 }
 
+// pacingCountKey returns the Redis key of the counter that pacing decisions
+// are based on. Most line items pace on serves so delayed impression pixels
+// can't cause over-delivery. vCPM line items buy viewable impressions, so
+// their daily cap applies to the viewable impression counter instead.
+func pacingCountKey(li *models.LineItem, lineItemID int, today string) string {
+	if li != nil && li.BudgetType == models.BudgetTypeVCPM {
+		return fmt.Sprintf("pacing:impressions:%d:%s", lineItemID, today)
+	}
+	return fmt.Sprintf("pacing:serves:%d:%s", lineItemID, today)
+}
+
+// customEventKey returns the Redis key of a line item's daily custom event
+// counter, as maintained by RedisStore.IncrementCustomEvent.
+func customEventKey(eventType string, lineItemID int, today string) string {
+	return fmt.Sprintf("event:%s:lineitem:%d:%s", eventType, lineItemID, today)
+}
+
+// eventCapReached reports whether any of the line item's daily custom event
+// caps has been reached.
+func eventCapReached(store *db.RedisStore, li *models.LineItem, today string) bool {
+	for eventType, limit := range li.DailyEventCaps {
+		if limit <= 0 {
+			continue
+		}
+		count, err := store.Client.Get(store.Ctx, customEventKey(eventType, li.ID, today)).Int64()
+		if err != nil && err != redis.Nil {
+			zap.L().Error("redis get events", zap.Error(err))
+		}
+		if count >= int64(limit) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsLineItemPacingEligible evaluates whether a line item is allowed to serve at
 // the current moment. It performs all read-only checks against Redis and the
 // configured line item but does **not** modify any counters. Incrementing the
@@ -125,10 +160,13 @@ func IsLineItemPacingEligible(store *db.RedisStore, publisherID, lineItemID int,
 			return false, nil
 		}
 	}
+	if eventCapReached(store, li, now.Format("2006-01-02")) {
+		return false, nil
+	}
 
-	// Build Redis key for today's serve count (used for pacing decisions)
+	// Build Redis key for today's pacing count
 	today := now.Format("2006-01-02")
-	key := fmt.Sprintf("pacing:serves:%d:%s", lineItemID, today)
+	key := pacingCountKey(li, lineItemID, today)
 
 	// Fetch current serve count (zero if missing or parse error)
 	count, err := store.Client.Get(store.Ctx, key).Int64()
@@ -211,10 +249,13 @@ func IsLineItemPacingEligibleWithReason(store *db.RedisStore, publisherID, lineI
 			return false, "click_cap_reached", nil
 		}
 	}
+	if eventCapReached(store, li, now.Format("2006-01-02")) {
+		return false, "event_cap_reached", nil
+	}
 
-	// Build Redis key for today's serve count (used for pacing decisions)
+	// Build Redis key for today's pacing count
 	today := now.Format("2006-01-02")
-	key := fmt.Sprintf("pacing:serves:%d:%s", lineItemID, today)
+	key := pacingCountKey(li, lineItemID, today)
 
 	// Fetch current serve count (zero if missing or parse error)
 	count, err := store.Client.Get(store.Ctx, key).Int64()
@@ -285,7 +326,8 @@ func IncrementLineItemServes(store *db.RedisStore, lineItemID int) error {
 // IncrementLineItemImpressions bumps the impression counter for a line item.
 // The impression count is used for billing and reporting rather than pacing and
 // should only be incremented once the impression tracking pixel or equivalent
-// confirmation has fired.
+// confirmation has fired. vCPM line items count viewable impressions here and
+// pace on this counter.
 func IncrementLineItemImpressions(store *db.RedisStore, lineItemID int) error {
 	if store == nil || store.Client == nil {
 		return ErrNilRedisStore
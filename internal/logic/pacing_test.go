@@ -192,6 +192,40 @@ func TestIsLineItemPacingEligible_ClickCap(t *testing.T) {
 	}
 }
 
+func TestIsLineItemPacingEligible_EventCap(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	testDataStore := models.NewTestAdDataStore()
+	_ = testDataStore.SetLineItems([]models.LineItem{
+		{ID: 9, CampaignID: 9, PublisherID: 0, DailyEventCaps: map[string]int{"video_complete": 2}, PaceType: models.PacingASAP, CPM: 1.0, ECPM: 1.0, Active: true},
+	})
+
+	nowFn = time.Now
+	eventKey := "event:video_complete:lineitem:9:" + nowFn().Format("2006-01-02")
+	if err := ms.Set(eventKey, "1"); err != nil {
+		t.Fatalf("failed to set event key: %v", err)
+	}
+	ok, reason, err := IsLineItemPacingEligibleWithReason(store, 0, 9, testDataStore, testConfig())
+	if err != nil || !ok {
+		t.Fatalf("expected to serve below the event cap, got %v %q %v", ok, reason, err)
+	}
+
+	if err := ms.Set(eventKey, "2"); err != nil {
+		t.Fatalf("failed to set event key: %v", err)
+	}
+	ok, reason, err = IsLineItemPacingEligibleWithReason(store, 0, 9, testDataStore, testConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok || reason != "event_cap_reached" {
+		t.Errorf("expected event_cap_reached, got %v %q", ok, reason)
+	}
+	if ok, _ := IsLineItemPacingEligible(store, 0, 9, testDataStore, testConfig()); ok {
+		t.Error("expected to block when events reach the cap")
+	}
+}
+
 func TestIsLineItemPacingEligible_UnlimitedImpressions(t *testing.T) {
 	ms, store := setupTestRedis(t)
 	defer ms.Close()
@@ -381,3 +415,31 @@ func TestCheckPIDPacing(t *testing.T) {
 		t.Error("expected false when count over target (60 > 50 at noon)")
 	}
 }
+
+func TestIsLineItemPacingEligible_VCPMCountsViewables(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	testDataStore := models.NewTestAdDataStore()
+	_ = testDataStore.SetLineItems([]models.LineItem{
+		{ID: 8, CampaignID: 1, DailyImpressionCap: 10, PaceType: models.PacingASAP, CPM: 5.0, BudgetType: models.BudgetTypeVCPM, Active: true},
+	})
+	nowFn = func() time.Time { return time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC) }
+
+	// Serves beyond the cap don't matter; only viewable impressions do.
+	if err := ms.Set("pacing:serves:8:2025-05-24", "50"); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+	ok, reason, err := IsLineItemPacingEligibleWithReason(store, 0, 8, testDataStore, testConfig())
+	if err != nil || !ok {
+		t.Fatalf("expected vCPM line item to serve, got %v %q %v", ok, reason, err)
+	}
+
+	if err := ms.Set("pacing:impressions:8:2025-05-24", "10"); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+	ok, reason, err = IsLineItemPacingEligibleWithReason(store, 0, 8, testDataStore, testConfig())
+	if err != nil || ok || reason != "asap_daily_cap_reached" {
+		t.Fatalf("expected viewable cap to block, got %v %q %v", ok, reason, err)
+	}
+}
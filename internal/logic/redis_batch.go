@@ -10,7 +10,10 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-// BatchFrequencyResults holds frequency cap check results for multiple creatives
+// BatchFrequencyCheck reports which frequency caps the user has reached,
+// keyed by "publisherID_lineItemID" for line item caps and by
+// CreativeCapKey for creatives with their own cap. Both are read in one
+// pipeline; use FrequencyExceeded to check a creative against the result.
 func BatchFrequencyCheck(store *db.RedisStore, userID string, creatives []models.Creative, dataStore models.AdDataStore) (map[string]bool, error) {
 	if store == nil || store.Client == nil {
 		return nil, ErrNilRedisStore
@@ -26,6 +29,8 @@ func BatchFrequencyCheck(store *db.RedisStore, userID string, creatives []models
 	// Map to store pipeline commands and creative info
 	commands := make(map[string]*redis.StringCmd)
 	creativesByKey := make(map[string]models.Creative)
+	creativeCommands := make(map[string]*redis.StringCmd)
+	creativeCaps := make(map[string]int)
 
 	// Add all frequency cap GETs to pipeline
 	for _, c := range creatives {
@@ -34,6 +39,12 @@ func BatchFrequencyCheck(store *db.RedisStore, userID string, creatives []models
 
 		commands[creativeKey] = pipe.Get(store.Ctx, key)
 		creativesByKey[creativeKey] = c
+
+		if c.FrequencyCap > 0 {
+			capKey := CreativeCapKey(c)
+			creativeCommands[capKey] = pipe.Get(store.Ctx, fmt.Sprintf("freqcap:%s:creative:%d", userID, c.ID))
+			creativeCaps[capKey] = c.FrequencyCap
+		}
 	}
 
 	// Execute pipeline
@@ -66,9 +77,29 @@ func BatchFrequencyCheck(store *db.RedisStore, userID string, creatives []models
 		result[creativeKey] = count >= int64(cap)
 	}
 
+	for capKey, cmd := range creativeCommands {
+		count, err := cmd.Int64()
+		if err != nil {
+			count = 0 // Missing key or fail open
+		}
+		result[capKey] = count >= int64(creativeCaps[capKey])
+	}
+
 	return result, nil
 }
 
+// CreativeCapKey is the BatchFrequencyCheck result key of a creative's own
+// frequency cap.
+func CreativeCapKey(c models.Creative) string {
+	return fmt.Sprintf("creative_%d", c.ID)
+}
+
+// FrequencyExceeded reports whether either the line item's or the
+// creative's own frequency cap is reached in a BatchFrequencyCheck result.
+func FrequencyExceeded(exceeded map[string]bool, c models.Creative) bool {
+	return exceeded[fmt.Sprintf("%d_%d", c.PublisherID, c.LineItemID)] || exceeded[CreativeCapKey(c)]
+}
+
 // BatchPacingCheck performs pacing checks for multiple creatives using pipeline, excluding PID keys
 func BatchPacingCheck(store *db.RedisStore, creatives []models.Creative, dataStore models.AdDataStore, cfg config.Config) (map[string]bool, error) {
 	if store == nil || store.Client == nil {
@@ -105,21 +136,31 @@ func BatchPacingCheck(store *db.RedisStore, creatives []models.Creative, dataSto
 		// Maps to store pipeline commands
 		pacingCommands := make(map[string]*redis.StringCmd)
 		clickCommands := make(map[string]*redis.StringCmd)
+		eventCommands := make(map[string]map[string]*redis.StringCmd)
 
 		// Add pacing and click count GETs to pipeline
 		for _, c := range batchableCreatives {
 			creativeKey := fmt.Sprintf("%d_%d", c.PublisherID, c.LineItemID)
 
-			// Add serve count GET (for pacing decisions)
-			pacingKey := fmt.Sprintf("pacing:serves:%d:%s", c.LineItemID, today)
+			li := dataStore.GetLineItem(c.PublisherID, c.LineItemID)
+
+			// Add pacing count GET (serves, or viewable impressions for vCPM)
+			pacingKey := pacingCountKey(li, c.LineItemID, today)
 			pacingCommands[creativeKey] = pipe.Get(store.Ctx, pacingKey)
 
 			// Add click count GET if needed
-			li := dataStore.GetLineItem(c.PublisherID, c.LineItemID)
 			if li != nil && li.DailyClickCap > 0 {
 				clickKey := fmt.Sprintf("clicks:lineitem:%d:%s", c.LineItemID, today)
 				clickCommands[creativeKey] = pipe.Get(store.Ctx, clickKey)
 			}
+
+			// Add custom event count GETs for daily event caps
+			if li != nil && len(li.DailyEventCaps) > 0 {
+				eventCommands[creativeKey] = make(map[string]*redis.StringCmd, len(li.DailyEventCaps))
+				for eventType := range li.DailyEventCaps {
+					eventCommands[creativeKey][eventType] = pipe.Get(store.Ctx, customEventKey(eventType, c.LineItemID, today))
+				}
+			}
 		}
 
 		// Execute pipeline
@@ -161,6 +202,24 @@ func BatchPacingCheck(store *db.RedisStore, creatives []models.Creative, dataSto
 				}
 			}
 
+			// Check daily event caps
+			capped := false
+			for eventType, cmd := range eventCommands[creativeKey] {
+				limit := li.DailyEventCaps[eventType]
+				count, err := cmd.Int64()
+				if err != nil {
+					count = 0 // Fail open
+				}
+				if limit > 0 && count >= int64(limit) {
+					capped = true
+					break
+				}
+			}
+			if capped {
+				result[creativeKey] = false
+				continue
+			}
+
 			// Check pacing
 			pacingCmd := pacingCommands[creativeKey]
 			count, err := pacingCmd.Int64()
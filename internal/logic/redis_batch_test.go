@@ -98,6 +98,7 @@ func TestBatchPacingCheck(t *testing.T) {
 		{ID: 203, CampaignID: 203, PublisherID: 2, DailyImpressionCap: 100, PaceType: models.PacingPID, Active: true}, // Should be handled individually
 		{ID: 204, CampaignID: 204, PublisherID: 2, DailyImpressionCap: 50, DailyClickCap: 5, PaceType: models.PacingASAP, Active: true},
 		{ID: 205, CampaignID: 205, PublisherID: 2, DailyImpressionCap: 0, PaceType: models.PacingASAP, Active: true}, // Unlimited
+		{ID: 206, CampaignID: 206, PublisherID: 2, DailyEventCaps: map[string]int{"video_complete": 10, "share": 3}, PaceType: models.PacingASAP, Active: true},
 	})
 
 	creatives := []models.Creative{
@@ -106,6 +107,7 @@ func TestBatchPacingCheck(t *testing.T) {
 		{ID: 303, LineItemID: 203, PublisherID: 2, Width: 300, Height: 250}, // PID pacing
 		{ID: 304, LineItemID: 204, PublisherID: 2, Width: 300, Height: 250}, // With click cap
 		{ID: 305, LineItemID: 205, PublisherID: 2, Width: 300, Height: 250}, // Unlimited
+		{ID: 306, LineItemID: 206, PublisherID: 2, Width: 300, Height: 250}, // With event caps
 	}
 
 	today := fixed.Format("2006-01-02")
@@ -132,6 +134,14 @@ func TestBatchPacingCheck(t *testing.T) {
 		t.Fatalf("failed to set click count: %v", err)
 	}
 
+	// Set up event counts for line item 206 (share at cap)
+	if err := store.Client.Set(store.Ctx, fmt.Sprintf("event:video_complete:lineitem:206:%s", today), 4, 0).Err(); err != nil {
+		t.Fatalf("failed to set event count: %v", err)
+	}
+	if err := store.Client.Set(store.Ctx, fmt.Sprintf("event:share:lineitem:206:%s", today), 3, 0).Err(); err != nil {
+		t.Fatalf("failed to set event count: %v", err)
+	}
+
 	// Test batched pacing checking
 	result, err := BatchPacingCheck(store, creatives, testDataStore, testBatchConfig())
 	if err != nil {
@@ -145,6 +155,7 @@ func TestBatchPacingCheck(t *testing.T) {
 		"2_203": false, // PID: should be blocked (handled individually)
 		"2_204": false, // ASAP with click cap: clicks at limit (5 >= 5)
 		"2_205": true,  // Unlimited impressions (eligible)
+		"2_206": false, // Event cap: shares at limit (3 >= 3)
 	}
 
 	if len(result) != len(expectedResults) {
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"sync"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// encodedMacro matches a {MACRO} that html/template percent-encoded in a URL.
+var encodedMacro = regexp.MustCompile(`%7[bB]([A-Za-z0-9_.]+)%7[dD]`)
+
+// compiled caches the parsed body of each creative template by template ID,
+// so serving doesn't re-parse a template for every impression. An edited
+// template replaces its entry, keeping one entry per template.
+var compiled sync.Map // map[int]compiledTemplate
+
+type compiledTemplate struct {
+	body string
+	tmpl *template.Template
+}
+
+// parseTemplate returns the parsed body of a template.
+func parseTemplate(t *models.CreativeTemplate) (*template.Template, error) {
+	if c, ok := compiled.Load(t.ID); ok && c.(compiledTemplate).body == t.Body {
+		return c.(compiledTemplate).tmpl, nil
+	}
+	tmpl, err := template.New("creative").Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return nil, err
+	}
+	compiled.Store(t.ID, compiledTemplate{body: t.Body, tmpl: tmpl})
+	return tmpl, nil
+}
+
+// ForgetTemplate drops a deleted template from the cache.
+func ForgetTemplate(id int) {
+	compiled.Delete(id)
+}
+
+// ComposeTemplateHTML renders a creative template with a creative's values.
+// Values are escaped by html/template for the context they appear in, so a
+// URL variable in an href or a color in a style attribute can't break out
+// of it. Macros such as {CREATIVE_ID} in values are left for expansion.
+func ComposeTemplateHTML(t *models.CreativeTemplate, values map[string]string) (string, error) {
+	tmpl, err := parseTemplate(t)
+	if err != nil {
+		return "", fmt.Errorf("template %d: %w", t.ID, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, t.Data(values)); err != nil {
+		return "", fmt.Errorf("template %d: %w", t.ID, err)
+	}
+	// Put back the braces of macros in URL values so they're expanded with
+	// the rest of the markup; macro names can't escape the attribute
+	return encodedMacro.ReplaceAllString(buf.String(), "{$1}"), nil
+}
+
+// CheckTemplate checks that a template parses and renders with sample values
+// for its variables, which catches references to undeclared variables.
+func CheckTemplate(t *models.CreativeTemplate) error {
+	tmpl, err := template.New("creative").Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	return tmpl.Execute(&buf, t.Data(t.SampleValues()))
+}
+
+// ComposeTemplateNative adds the HTML rendered from a native template to a
+// creative's native assets as the "html" asset, which the SDK's native
+// rendering shows in place of its default layout.
+func ComposeTemplateNative(native json.RawMessage, html string) json.RawMessage {
+	assets := map[string]json.RawMessage{}
+	if len(native) > 0 {
+		// Assets that aren't an object are replaced, like unparseable banners
+		_ = json.Unmarshal(native, &assets)
+	}
+	assets["html"], _ = json.Marshal(html)
+	out, _ := json.Marshal(assets)
+	return out
+}
@@ -0,0 +1,34 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func TestComposeTemplateHTML_EditedTemplate(t *testing.T) {
+	tmpl := &models.CreativeTemplate{ID: 41, Body: `<b>{{.title}}</b>`,
+		Variables: []models.TemplateVariable{{Name: "title", Type: models.TemplateVarText}}}
+	if got, err := ComposeTemplateHTML(tmpl, map[string]string{"title": "Hi"}); err != nil || got != "<b>Hi</b>" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// An edited body replaces the cached one instead of adding an entry.
+	tmpl.Body = `<i>{{.title}}</i>`
+	if got, err := ComposeTemplateHTML(tmpl, map[string]string{"title": "Hi"}); err != nil || got != "<i>Hi</i>" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	entries := 0
+	compiled.Range(func(_, _ any) bool {
+		entries++
+		return true
+	})
+	if entries != 1 {
+		t.Errorf("expected one cached template, got %d", entries)
+	}
+
+	ForgetTemplate(41)
+	if _, ok := compiled.Load(41); ok {
+		t.Error("expected the deleted template to be dropped")
+	}
+}
@@ -112,3 +112,51 @@ func TestSelectAd_RegionTargeting(t *testing.T) {
 		t.Error("expected no ad for non-matching region")
 	}
 }
+
+// TestSelectAd_CityTargeting verifies metro and postal code targeting using
+// the City test database.
+func TestSelectAd_CityTargeting(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	g, err := geoip.Init("../../geoip/testdata/GeoLite2-City-Test.mmdb")
+	if err != nil {
+		t.Fatalf("geoip init: %v", err)
+	}
+	defer func() { _ = g.Close() }()
+
+	testDataStore := models.NewTestAdDataStore()
+	_ = testDataStore.SetLineItems([]models.LineItem{
+		{ID: 300, CampaignID: 300, Metros: []string{"807"}, PostalCodes: []string{"94107", "94103"}, PaceType: models.PacingASAP, CPM: 2.0, ECPM: 2.0, Active: true, PublisherID: 0},
+	})
+
+	_ = testDataStore.SetCampaigns([]models.Campaign{
+		{ID: 300, Name: "Test Campaign SF"},
+	})
+
+	testCreative := models.Creative{
+		ID: 602, PlacementID: "sidebar", LineItemID: 300, CampaignID: 300,
+		HTML: "Test Ad SF", Width: 160, Height: 600, Format: "html",
+	}
+
+	testPlacement := models.Placement{
+		ID: "sidebar", Width: 160, Height: 600, Formats: []string{"html"},
+	}
+
+	database := createTestDB([]models.Creative{testCreative},
+		map[string]models.Placement{"sidebar": testPlacement})
+
+	ctx := logic.ResolveTargeting(g, "", "192.0.2.5") // San Francisco, DMA 807
+	ad, err := SelectAd(store, database, testDataStore, "sidebar", "user1", 0, 0, ctx, testConfig())
+	if err != nil {
+		t.Fatalf("expected ad, got error: %v", err)
+	}
+	if ad.CampaignID != 300 {
+		t.Errorf("expected campaign 300, got %d", ad.CampaignID)
+	}
+
+	ctx = logic.ResolveTargeting(g, "", "198.51.100.5") // New York, DMA 501
+	if _, err := SelectAd(store, database, testDataStore, "sidebar", "user1", 0, 0, ctx, testConfig()); err == nil {
+		t.Error("expected no ad for non-matching metro")
+	}
+}
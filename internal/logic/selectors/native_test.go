@@ -0,0 +1,87 @@
+package selectors
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func TestSelectAd_Native(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	native := &models.NativeRequest{Assets: []models.NativeAssetRequest{
+		{ID: 1, Required: 1, Title: &models.NativeTitleRequest{Len: 25}},
+		{ID: 2, Required: 1, Img: &models.NativeImageRequest{Type: 3, WMin: 600, HMin: 300}},
+	}}
+	adm := `{"native":{"assets":[{"id":1,"title":{"text":"Bid"}},{"id":2,"img":{"url":"https://dsp.example/a.jpg"}}],"link":{"url":"https://brand.example"}}}`
+
+	var gotImp programmaticImp
+	bidder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req programmaticRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotImp = req.Imp[0]
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"seatbid": []interface{}{map[string]interface{}{
+				"bid": []interface{}{map[string]interface{}{"price": 9.0, "adm": adm}},
+			}},
+		})
+	}))
+	defer bidder.Close()
+
+	dataStore := models.NewTestAdDataStore()
+	_ = dataStore.SetLineItems([]models.LineItem{
+		{ID: 101, CampaignID: 10, PaceType: models.PacingASAP, Priority: models.PriorityMedium, Active: true, ECPM: 5},
+		{ID: 201, CampaignID: 20, PaceType: models.PacingASAP, Priority: models.PriorityMedium, Active: true,
+			Type: models.LineItemTypeProgrammatic, Endpoint: bidder.URL},
+	})
+	creatives := populateCreativeLineItems([]models.Creative{
+		// Only the first creative fills the required image
+		{ID: 11, PlacementID: "feed", LineItemID: 101, CampaignID: 10, Format: models.FormatNative,
+			Native: json.RawMessage(`{"title":"Direct","images":[{"type":3,"url":"https://cdn.example/a.jpg","w":1200,"h":627}]}`)},
+		{ID: 12, PlacementID: "feed", LineItemID: 101, CampaignID: 10, Format: models.FormatNative,
+			Native: json.RawMessage(`{"title":"No image"}`)},
+		{ID: 21, PlacementID: "feed", LineItemID: 201, CampaignID: 20, Format: models.FormatNative},
+	}, dataStore)
+	database := createTestDB(creatives, map[string]models.Placement{
+		"feed": {ID: "feed", Formats: []string{models.FormatNative}, Native: native},
+	})
+	tctx := models.TargetingContext{Native: native}
+
+	resp, err := SelectAd(store, database, dataStore, "feed", "u1", 0, 0, tctx, testConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotImp.Native == nil || gotImp.Native.Ver != "1.2" {
+		t.Fatalf("expected native request to be forwarded, got %+v", gotImp)
+	}
+	var forwarded models.NativeRequest
+	if err := json.Unmarshal([]byte(gotImp.Native.Request), &forwarded); err != nil || len(forwarded.Assets) != 2 {
+		t.Fatalf("unexpected forwarded request %q: %v", gotImp.Native.Request, err)
+	}
+	if resp.CreativeID != 21 || resp.Price != 9 || resp.NativeAd == nil || resp.NativeAd.Link.URL != "https://brand.example" {
+		t.Fatalf("expected the programmatic bid to win, got %+v", resp)
+	}
+
+	// Without the bid the direct creative is matched to the requested assets
+	adm = `{"native":{"assets":[{"id":1,"title":{"text":"Bid"}}],"link":{"url":"https://brand.example"}}}`
+	resp, err = SelectAd(store, database, dataStore, "feed", "u1", 0, 0, tctx, testConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.CreativeID != 11 || resp.NativeAd == nil || len(resp.NativeAd.Assets) != 2 ||
+		resp.NativeAd.Assets[0].Title.Text != "Direct" || resp.NativeAd.Link.URL != "" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	database = createTestDB(creatives[1:2], map[string]models.Placement{
+		"feed": {ID: "feed", Formats: []string{models.FormatNative}, Native: native},
+	})
+	if _, err := SelectAd(store, database, dataStore, "feed", "u1", 0, 0, tctx, testConfig()); !errors.Is(err, ErrNoEligibleAd) {
+		t.Errorf("expected no eligible ad, got %v", err)
+	}
+}
@@ -1,7 +1,7 @@
 package selectors
 
 import (
-	"math/rand"
+	"time"
 
 	"github.com/patrickwarner/openadserve/internal/config"
 	"github.com/patrickwarner/openadserve/internal/db"
@@ -26,7 +26,17 @@ func (RandomSelector) SelectAd(store *db.RedisStore, database *db.DB, dataStore
 	creatives := database.FindCreativesForPlacement(placementID)
 
 	creatives = filters.FilterByTargeting(creatives, ctx, dataStore)
-	creatives = filters.FilterBySize(creatives, width, height, placement.Formats)
+	sizes := ctx.Sizes
+	if len(sizes) == 0 {
+		sizes = []models.Format{{W: width, H: height}}
+		if width == 0 && height == 0 && len(placement.Sizes) > 0 {
+			sizes = placement.AcceptedSizes()
+		}
+	}
+	creatives = filters.FilterBySizes(creatives, sizes, placement.Formats, ctx.Video)
+	creatives = filters.FilterByPodSeparation(creatives, ctx.Pod)
+	creatives = filters.FilterByNative(creatives, ctx.Native)
+	creatives = filters.FilterByFlight(creatives, time.Now())
 	var err error
 	creatives, err = filters.FilterByFrequency(store, creatives, userID, dataStore)
 	if err != nil {
@@ -39,11 +49,29 @@ func (RandomSelector) SelectAd(store *db.RedisStore, database *db.DB, dataStore
 	if len(creatives) == 0 {
 		return nil, ErrNoEligibleAd
 	}
-	c := creatives[rand.Intn(len(creatives))]
+	// Pick by rotation weight, skipping creatives whose template doesn't
+	// render rather than serving them empty
+	ShuffleFn(creatives)
+	for _, c := range creatives {
+		if resp, err := randomAdResponse(c, ctx); err == nil {
+			return resp, nil
+		}
+	}
+	return nil, ErrNoEligibleAd
+}
+
+func randomAdResponse(c models.Creative, ctx models.TargetingContext) (*models.AdResponse, error) {
 	li := c.LineItem
 	price := 0.0
+	adomain := ""
 	if li != nil {
 		price = li.ECPM
+		adomain = li.ADomain
+	}
+
+	var nativeAd *models.NativeResponse
+	if c.Format == models.FormatNative && ctx.Native != nil {
+		nativeAd = nativeResponse(c, ctx.Native)
 	}
 
 	// Compose banner HTML server-side if this is a banner creative
@@ -51,12 +79,29 @@ func (RandomSelector) SelectAd(store *db.RedisStore, database *db.DB, dataStore
 	if len(c.Banner) > 0 {
 		html = render.ComposeBannerHTML(c.Banner)
 	}
+	native := c.Native
+	if c.Template != nil {
+		rendered, err := render.ComposeTemplateHTML(c.Template, c.TemplateValues)
+		if err != nil {
+			return nil, err
+		}
+		if c.Format == models.FormatNative {
+			native = render.ComposeTemplateNative(c.Native, rendered)
+		} else {
+			html = rendered
+		}
+	}
 
 	return &models.AdResponse{
 		CreativeID: c.ID,
 		HTML:       html,
-		Native:     c.Native,
+		Native:     native,
 		Banner:     nil, // Don't send banner JSON to client - we composed HTML instead
+		Video:      c.Video,
+		NativeAd:   nativeAd,
+		ADomain:    adomain,
+		Width:      c.Width,
+		Height:     c.Height,
 		CampaignID: c.CampaignID,
 		LineItemID: c.LineItemID,
 		Price:      price,
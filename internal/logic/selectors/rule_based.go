@@ -11,6 +11,7 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,6 +24,7 @@ import (
 	"github.com/patrickwarner/openadserve/internal/models"
 	"github.com/patrickwarner/openadserve/internal/observability"
 	"github.com/patrickwarner/openadserve/internal/optimization"
+	"github.com/patrickwarner/openadserve/internal/vast"
 
 	"go.uber.org/zap"
 )
@@ -32,6 +34,15 @@ var (
 	ErrPacingLimitReached = errors.New("line item pacing limit reached")
 	ErrRateLimitReached   = errors.New("line item rate limit reached")
 	ErrUnknownPlacement   = errors.New("unknown placement")
+
+	// errVideoRejected marks video bids whose VAST doesn't fit the player.
+	errVideoRejected = errors.New("video bid does not fit the player")
+	// errPodConflict marks bids from an advertiser already in the ad pod.
+	errPodConflict = errors.New("advertiser already in the ad pod")
+	// errNativeRejected marks native bids that don't fill the native request.
+	errNativeRejected = errors.New("native bid does not fill the native request")
+	// errSizeRejected marks bids for a size the slot doesn't accept.
+	errSizeRejected = errors.New("bid size not accepted by the slot")
 )
 
 const (
@@ -52,50 +63,125 @@ var defaultCTROptimizationEnabled = func() bool {
 
 // bid represents a programmatic bid response.
 type bid struct {
-	Price float64
-	Adm   string
+	Price   float64
+	Adm     string
+	ADomain string
+	// W and H are the size the bid was made for, when the bidder says.
+	W, H int
+	// Video is the inline ad a video bid's VAST resolves to.
+	Video *models.VideoCreative
+	// Native is the parsed native response of a native bid.
+	Native *models.NativeResponse
 }
 
 // defaultShuffleFn shuffles creatives using rand.Shuffle. It relies on the
 // package-level random source which is not goroutine safe; the selector invokes
-// it only in single-threaded code paths.
+// it only in single-threaded code paths. When creatives carry rotation weights
+// the order is drawn by weight instead, so a creative comes first with
+// probability weight / total weight.
 var defaultShuffleFn = func(creatives []models.Creative) {
-	rand.Shuffle(len(creatives), func(i, j int) {
-		creatives[i], creatives[j] = creatives[j], creatives[i]
-	})
+	weighted := false
+	for _, c := range creatives {
+		if c.RotationWeight() != 1 {
+			weighted = true
+			break
+		}
+	}
+	if !weighted {
+		rand.Shuffle(len(creatives), func(i, j int) {
+			creatives[i], creatives[j] = creatives[j], creatives[i]
+		})
+		return
+	}
+	// Sorting by exponential keys scaled by weight draws a weighted random
+	// order without replacement.
+	keys := make([]float64, len(creatives))
+	for i, c := range creatives {
+		keys[i] = rand.ExpFloat64() / float64(c.RotationWeight())
+	}
+	sort.Sort(byKey{creatives, keys})
+}
+
+// byKey sorts creatives by ascending key.
+type byKey struct {
+	creatives []models.Creative
+	keys      []float64
+}
+
+func (b byKey) Len() int           { return len(b.creatives) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.creatives[i], b.creatives[j] = b.creatives[j], b.creatives[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
 }
 
 // ShuffleFn randomizes the creative slice. Tests may replace it for
 // deterministic behavior.
 var ShuffleFn = defaultShuffleFn
 
+// programmaticRequest is the minimal OpenRTB request sent to programmatic endpoints.
+type programmaticRequest struct {
+	Imp  []programmaticImp `json:"imp"`
+	User *programmaticUser `json:"user,omitempty"`
+	Regs *models.Regs      `json:"regs,omitempty"`
+}
+
+type programmaticImp struct {
+	ID     string            `json:"id"`
+	W      int               `json:"w"`
+	H      int               `json:"h"`
+	Banner *models.ImpBanner `json:"banner,omitempty"`
+	Video  *models.ImpVideo  `json:"video,omitempty"`
+	Native *models.ImpNative `json:"native,omitempty"`
+}
+
+// programmaticUser forwards only the consent string; user identifiers are not shared.
+type programmaticUser struct {
+	Consent string `json:"consent,omitempty"`
+}
+
+// newProgrammaticRequest builds the bid request for a slot and forwards the
+// request's privacy signals so bidders can apply their own consent checks.
+// Slots accepting several sizes list them in banner.format; video slots
+// carry the player constraints and native slots the placement's native
+// request.
+func newProgrammaticRequest(imp programmaticImp, p models.PrivacyContext) programmaticRequest {
+	imp.ID = "1"
+	req := programmaticRequest{Imp: []programmaticImp{imp}}
+	if p.TCFConsent != "" {
+		req.User = &programmaticUser{Consent: p.TCFConsent}
+	}
+	if p.GDPRApplies || p.COPPA || p.USPrivacy != "" || p.GPP != "" {
+		regs := &models.Regs{USPrivacy: p.USPrivacy, GPP: p.GPP, GPPSID: p.GPPSID}
+		if p.COPPA {
+			regs.COPPA = 1
+		}
+		if p.GDPRApplies {
+			gdpr := 1
+			regs.GDPR = &gdpr
+		}
+		req.Regs = regs
+	}
+	return req
+}
+
 // fetchProgrammaticBid sends a minimal OpenRTB request to the given endpoint
-// and returns the bid price and markup. Failures return zero values.
-func fetchProgrammaticBid(ctx context.Context, endpoint string, width, height int) (float64, string, error) {
-	reqBody := struct {
-		Imp []struct {
-			ID string `json:"id"`
-			W  int    `json:"w"`
-			H  int    `json:"h"`
-		} `json:"imp"`
-	}{Imp: []struct {
-		ID string `json:"id"`
-		W  int    `json:"w"`
-		H  int    `json:"h"`
-	}{{ID: "1", W: width, H: height}}}
+// and returns the bid. Failures return zero values.
+func fetchProgrammaticBid(ctx context.Context, endpoint string, imp programmaticImp, p models.PrivacyContext) (bid, error) {
+	reqBody := newProgrammaticRequest(imp, p)
 
 	data, err := json.Marshal(reqBody)
 	if err != nil {
-		return 0, "", err
+		return bid{}, err
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
 	if err != nil {
-		return 0, "", err
+		return bid{}, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return 0, "", err
+		return bid{}, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -103,18 +189,54 @@ func fetchProgrammaticBid(ctx context.Context, endpoint string, width, height in
 	var out struct {
 		SeatBid []struct {
 			Bid []struct {
-				Price float64 `json:"price"`
-				Adm   string  `json:"adm"`
+				Price   float64  `json:"price"`
+				Adm     string   `json:"adm"`
+				ADomain []string `json:"adomain"`
+				W       int      `json:"w"`
+				H       int      `json:"h"`
 			} `json:"bid"`
 		} `json:"seatbid"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return 0, "", err
+		return bid{}, err
 	}
 	if len(out.SeatBid) == 0 || len(out.SeatBid[0].Bid) == 0 {
-		return 0, "", nil
+		return bid{}, nil
+	}
+	b := out.SeatBid[0].Bid[0]
+	res := bid{Price: b.Price, Adm: b.Adm, W: b.W, H: b.H}
+	if len(b.ADomain) > 0 {
+		res.ADomain = b.ADomain[0]
+	}
+	return res, nil
+}
+
+// resolveVideoBid follows the VAST of a video bid to its inline ad and
+// checks the ad against the player constraints.
+func resolveVideoBid(ctx context.Context, b *bid, player *models.VideoPlacement, maxWrapperDepth int) error {
+	v, err := vast.Resolver{MaxDepth: maxWrapperDepth}.Resolve(ctx, b.Adm)
+	if err != nil {
+		return err
+	}
+	if !player.Accepts(v) {
+		return errVideoRejected
 	}
-	return out.SeatBid[0].Bid[0].Price, out.SeatBid[0].Bid[0].Adm, nil
+	b.Video = v
+	return nil
+}
+
+// checkNativeBid parses the native response of a native bid and checks it
+// against the placement's native request.
+func checkNativeBid(b *bid, req *models.NativeRequest) error {
+	resp, err := models.ParseNativeResponse(b.Adm)
+	if err != nil {
+		return err
+	}
+	if err := req.Check(resp); err != nil {
+		return fmt.Errorf("%w: %v", errNativeRejected, err)
+	}
+	b.Native = resp
+	return nil
 }
 
 // RuleBasedSelector is the default Selector implementation that relies on the
@@ -165,7 +287,8 @@ func (s *RuleBasedSelector) SetCTROptimizationEnabled(enabled bool) {
 }
 
 // calculateOptimizedECPM calculates the eCPM for a line item, applying CTR optimization for CPC items.
-func (s *RuleBasedSelector) calculateOptimizedECPM(li *models.LineItem, ctx models.TargetingContext, bids map[int]bid) float64 {
+// vCPM line items are discounted by viewRate, the placement's expected viewability rate.
+func (s *RuleBasedSelector) calculateOptimizedECPM(li *models.LineItem, ctx models.TargetingContext, bids map[int]bid, viewRate float64) float64 {
 	if li == nil {
 		return 0.0
 	}
@@ -178,6 +301,11 @@ func (s *RuleBasedSelector) calculateOptimizedECPM(li *models.LineItem, ctx mode
 		return 0.0
 	}
 
+	// vCPM line items only pay for viewable impressions
+	if li.BudgetType == models.BudgetTypeVCPM {
+		return li.CPM * viewRate
+	}
+
 	// Start with base eCPM
 	baseECPM := li.ECPM
 
@@ -259,6 +387,11 @@ func (s *RuleBasedSelector) performSelection(store *db.RedisStore, database *db.
 		return nil, ErrUnknownPlacement
 	}
 
+	// Without a requested size, creatives of every size the placement
+	// accepts compete
+	if len(ctx.Sizes) == 0 && width == 0 && height == 0 {
+		ctx.Sizes = placement.AcceptedSizes()
+	}
 	if width == 0 {
 		width = placement.Width
 	}
@@ -325,7 +458,7 @@ func (s *RuleBasedSelector) performSelection(store *db.RedisStore, database *db.
 	creatives = s.applyRateLimit(creatives, dataStore, trace)
 
 	// Gather programmatic bids
-	bids := s.fetchProgrammaticBids(creatives, width, height)
+	bids := s.fetchProgrammaticBids(creatives, width, height, ctx, cfg)
 
 	// Drop creatives that received no bid
 	creatives = s.filterCreativesByBid(creatives, bids)
@@ -334,11 +467,29 @@ func (s *RuleBasedSelector) performSelection(store *db.RedisStore, database *db.
 		return nil, ErrNoEligibleAd
 	}
 
+	// vCPM line items compete on their expected viewable share of impressions
+	viewRate := 1.0
+	for _, c := range creatives {
+		if c.LineItem != nil && c.LineItem.BudgetType == models.BudgetTypeVCPM {
+			viewRate = logic.PlacementViewabilityRate(store, placementID, cfg)
+			break
+		}
+	}
+
 	// Rank creatives by priority and eCPM
-	creatives = s.rankCreatives(creatives, ctx, bids, trace)
+	creatives = s.rankCreatives(creatives, ctx, bids, viewRate, trace)
 
-	// Return the highest ranked creative
-	return s.buildAdResponse(creatives[0], ctx, bids), nil
+	// Return the highest ranked creative that renders
+	for _, c := range creatives {
+		resp, err := s.buildAdResponse(c, ctx, bids, viewRate)
+		if err == nil {
+			return resp, nil
+		}
+		if s.logger != nil {
+			s.logger.Warn("creative template failed to render, skipping creative", zap.Error(err), zap.Int("creative_id", c.ID))
+		}
+	}
+	return nil, ErrNoEligibleAd
 }
 
 // applyRateLimit removes creatives that exceed the line item rate limit. It returns the
@@ -367,12 +518,17 @@ func (s *RuleBasedSelector) applyRateLimit(creatives []models.Creative, dataStor
 
 // fetchProgrammaticBids requests bids for all programmatic line items in the given
 // creative set. The returned map is keyed by line item ID.
-func (s *RuleBasedSelector) fetchProgrammaticBids(creatives []models.Creative, width, height int) map[int]bid {
+// Video bids return VAST, which is resolved within the bid timeout; bids whose
+// VAST doesn't fit the player, native bids that don't fill the native
+// request and bids whose advertiser is already in the ad pod count as no bid.
+func (s *RuleBasedSelector) fetchProgrammaticBids(creatives []models.Creative, width, height int,
+	tctx models.TargetingContext, cfg config.Config) map[int]bid {
 	bids := make(map[int]bid)
 
 	type liInfo struct {
-		id  int
-		url string
+		id     int
+		url    string
+		format string
 	}
 
 	var items []liInfo
@@ -381,7 +537,7 @@ func (s *RuleBasedSelector) fetchProgrammaticBids(creatives []models.Creative, w
 		if li != nil && li.Type == models.LineItemTypeProgrammatic && li.Endpoint != "" {
 			if _, ok := bids[li.ID]; !ok {
 				bids[li.ID] = bid{}
-				items = append(items, liInfo{id: li.ID, url: li.Endpoint})
+				items = append(items, liInfo{id: li.ID, url: li.Endpoint, format: c.Format})
 			}
 		}
 	}
@@ -390,7 +546,7 @@ func (s *RuleBasedSelector) fetchProgrammaticBids(creatives []models.Creative, w
 	var mu sync.Mutex
 	for _, it := range items {
 		wg.Add(1)
-		go func(id int, url string) {
+		go func(it liInfo) {
 			defer wg.Done()
 			timeout := s.programmaticBidTimeout
 			if timeout == 0 {
@@ -398,15 +554,41 @@ func (s *RuleBasedSelector) fetchProgrammaticBids(creatives []models.Creative, w
 			}
 			ctx, cancel := context.WithTimeout(context.Background(), timeout)
 			defer cancel()
-			bPrice, adm, err := fetchProgrammaticBid(ctx, url, width, height)
+			imp := programmaticImp{W: width, H: height}
+			video := it.format == models.FormatVideo
+			native := it.format == models.FormatNative && tctx.Native != nil
+			switch {
+			case video:
+				imp.Video = tctx.Video.Imp(width, height)
+			case native:
+				imp.Native = tctx.Native.Imp()
+			case len(tctx.Sizes) > 1:
+				imp.Banner = &models.ImpBanner{Format: tctx.Sizes}
+			}
+			b, err := fetchProgrammaticBid(ctx, it.url, imp, tctx.Privacy)
+			if err == nil && b.Price > 0 {
+				if video {
+					err = resolveVideoBid(ctx, &b, tctx.Video, cfg.VASTMaxWrapperDepth)
+				} else if native {
+					err = checkNativeBid(&b, tctx.Native)
+				} else if !sizeAccepted(b.W, b.H, tctx.Sizes) {
+					err = errSizeRejected
+				}
+			}
+			if err == nil && !tctx.Pod.Allows(it.id, b.ADomain) {
+				err = errPodConflict
+			}
+			if err != nil && s.logger != nil {
+				s.logger.Debug("programmatic bid rejected", zap.Int("line_item_id", it.id), zap.Error(err))
+			}
 			mu.Lock()
 			if err == nil {
-				bids[id] = bid{Price: bPrice, Adm: adm}
+				bids[it.id] = b
 			} else {
-				bids[id] = bid{}
+				bids[it.id] = bid{}
 			}
 			mu.Unlock()
-		}(it.id, it.url)
+		}(it)
 	}
 	wg.Wait()
 
@@ -433,7 +615,7 @@ func (s *RuleBasedSelector) filterCreativesByBid(creatives []models.Creative, bi
 // preserves a random order among creatives with identical eCPMs. The resulting
 // slice is returned in ranked order.
 func (s *RuleBasedSelector) rankCreatives(creatives []models.Creative, ctx models.TargetingContext,
-	bids map[int]bid, trace *logic.SelectionTrace) []models.Creative {
+	bids map[int]bid, viewRate float64, trace *logic.SelectionTrace) []models.Creative {
 	creativesByPriority := make(map[string][]models.Creative)
 	// calculateOptimizedECPM may call the CTR prediction service. If invoked
 	// inside the sort comparator it would be executed O(N log N) times, adding
@@ -448,7 +630,7 @@ func (s *RuleBasedSelector) rankCreatives(creatives []models.Creative, ctx model
 				priority = li.Priority
 			}
 			if _, ok := priceCache[li.ID]; !ok {
-				priceCache[li.ID] = s.calculateOptimizedECPM(li, ctx, bids)
+				priceCache[li.ID] = s.calculateOptimizedECPM(li, ctx, bids, viewRate)
 			}
 		}
 		creativesByPriority[priority] = append(creativesByPriority[priority], c)
@@ -493,18 +675,44 @@ func (s *RuleBasedSelector) rankCreatives(creatives []models.Creative, ctx model
 }
 
 // buildAdResponse constructs the final AdResponse using the ranked creative and any
-// programmatic bid information.
+// programmatic bid information. It fails when the creative's template doesn't
+// render, so an empty ad is never served.
 func (s *RuleBasedSelector) buildAdResponse(c models.Creative, ctx models.TargetingContext,
-	bids map[int]bid) *models.AdResponse {
+	bids map[int]bid, viewRate float64) (*models.AdResponse, error) {
 	li := c.LineItem
 	price := 0.0
 	html := c.HTML
+	video := c.Video
+	width, height := c.Width, c.Height
+	var vastDoc, adomain string
+	var nativeAd *models.NativeResponse
+	if c.Format == models.FormatNative && ctx.Native != nil {
+		nativeAd = nativeResponse(c, ctx.Native)
+	}
 	if li != nil {
-		price = s.calculateOptimizedECPM(li, ctx, bids)
+		price = s.calculateOptimizedECPM(li, ctx, bids, viewRate)
+		adomain = li.ADomain
 		if li.Type == models.LineItemTypeProgrammatic {
 			if b, ok := bids[li.ID]; ok && b.Price > 0 {
 				price = b.Price
-				if b.Adm != "" {
+				if b.ADomain != "" {
+					adomain = b.ADomain
+				}
+				if b.W > 0 && b.H > 0 {
+					width, height = b.W, b.H
+				}
+				switch {
+				case b.Native != nil:
+					nativeAd = b.Native
+				case b.Video != nil:
+					// Served as the bidder's VAST with our tracking added
+					video = &models.VideoCreative{Duration: b.Video.Duration}
+					if vast.IsTagURL(b.Adm) {
+						video.VASTTagURL = strings.TrimSpace(b.Adm)
+					} else {
+						vastDoc = b.Adm
+					}
+				case b.Adm != "":
 					html = b.Adm
 				}
 			}
@@ -515,14 +723,69 @@ func (s *RuleBasedSelector) buildAdResponse(c models.Creative, ctx models.Target
 	if len(c.Banner) > 0 {
 		html = render.ComposeBannerHTML(c.Banner)
 	}
+	// Render publisher templates with the creative's values
+	native := c.Native
+	if c.Template != nil {
+		rendered, err := render.ComposeTemplateHTML(c.Template, c.TemplateValues)
+		if err != nil {
+			return nil, err
+		}
+		if c.Format == models.FormatNative {
+			native = render.ComposeTemplateNative(c.Native, rendered)
+		} else {
+			html = rendered
+		}
+	}
 
 	return &models.AdResponse{
 		CreativeID: c.ID,
 		HTML:       html,
-		Native:     c.Native,
+		Native:     native,
 		Banner:     nil, // Don't send banner JSON to client - we composed HTML instead
+		Video:      video,
+		VAST:       vastDoc,
+		NativeAd:   nativeAd,
+		ADomain:    adomain,
+		Width:      width,
+		Height:     height,
 		CampaignID: c.CampaignID,
 		LineItemID: c.LineItemID,
 		Price:      price,
+	}, nil
+}
+
+// BuildPreviewResponse returns the AdResponse a creative is served as in the
+// targeting context, priced without programmatic bids or CTR predictions.
+// It lets creatives be previewed without running an auction.
+func BuildPreviewResponse(c models.Creative, ctx models.TargetingContext) (*models.AdResponse, error) {
+	return (&RuleBasedSelector{}).buildAdResponse(c, ctx, nil, 1)
+}
+
+// nativeResponse fills the placement's native request with the creative's
+// assets, or returns nil when it can't. Programmatic creatives carry no
+// assets; their native response comes from the bid.
+func nativeResponse(c models.Creative, req *models.NativeRequest) *models.NativeResponse {
+	nc, err := models.ParseNativeCreative(c.Native)
+	if err != nil {
+		return nil
 	}
+	resp, err := req.Response(nc)
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// sizeAccepted reports whether a bid made for the given size fits one of the
+// sizes the slot accepts. Bids that don't name a size are accepted.
+func sizeAccepted(w, h int, sizes []models.Format) bool {
+	if w == 0 || h == 0 || len(sizes) == 0 {
+		return true
+	}
+	for _, f := range sizes {
+		if f.Fits(w, h) {
+			return true
+		}
+	}
+	return false
 }
@@ -332,3 +332,104 @@ func TestSelectAd_AllFilteredByPacing(t *testing.T) {
 		t.Errorf("expected error '%s', got '%s'", ErrPacingLimitReached.Error(), err.Error())
 	}
 }
+
+func TestSelectAd_VCPMRankedByViewability(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	testDataStore := models.NewTestAdDataStore()
+	_ = testDataStore.SetLineItems([]models.LineItem{
+		{ID: 111, CampaignID: 111, PaceType: models.PacingASAP, Priority: models.PriorityMedium, CPM: 3.0, ECPM: 3.0, BudgetType: models.BudgetTypeCPM, DeviceType: "mobile", Active: true},
+		{ID: 112, CampaignID: 112, PaceType: models.PacingASAP, Priority: models.PriorityMedium, CPM: 5.0, BudgetType: models.BudgetTypeVCPM, DeviceType: "mobile", Active: true},
+	})
+	testCreatives := populateCreativeLineItems([]models.Creative{
+		{ID: 11, PlacementID: "header", LineItemID: 111, CampaignID: 111, HTML: "CPM Ad", Width: 320, Height: 50, Format: "html"},
+		{ID: 12, PlacementID: "header", LineItemID: 112, CampaignID: 112, HTML: "vCPM Ad", Width: 320, Height: 50, Format: "html"},
+	}, testDataStore)
+	database := createTestDB(testCreatives, map[string]models.Placement{
+		"header": {ID: "header", Width: 320, Height: 50, Formats: []string{"html"}},
+	})
+
+	cfg := testConfig()
+	cfg.DefaultViewabilityRate = 0.5
+	cfg.ViewabilityRateWeight = 100
+	ctx := models.TargetingContext{DeviceType: "mobile"}
+
+	// Without history the vCPM line item ranks at 5.0 * 0.5 = 2.5 and loses.
+	resp, err := SelectAd(store, database, testDataStore, "header", "user1", 0, 0, ctx, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.CreativeID != 11 {
+		t.Fatalf("expected CPM creative 11, got %d", resp.CreativeID)
+	}
+
+	// A highly viewable placement lifts it above the CPM line item.
+	today := time.Now().Format("2006-01-02")
+	if err := ms.Set("viewability:placement:header:imp:"+today, "900"); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+	if err := ms.Set("viewability:placement:header:view:"+today, "850"); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+	resp, err = SelectAd(store, database, testDataStore, "header", "user1", 0, 0, ctx, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.CreativeID != 12 || resp.Price != 4.5 {
+		t.Fatalf("expected vCPM creative 12 at 4.5, got %d at %f", resp.CreativeID, resp.Price)
+	}
+}
+
+func TestDefaultShuffleFn_RotationWeights(t *testing.T) {
+	counts := map[int]int{}
+	for i := 0; i < 4000; i++ {
+		creatives := []models.Creative{{ID: 1, Weight: 3}, {ID: 2}}
+		defaultShuffleFn(creatives)
+		counts[creatives[0].ID]++
+	}
+	// Creative 1 should lead about three times in four
+	if share := float64(counts[1]) / 4000; share < 0.7 || share > 0.8 {
+		t.Errorf("expected creative 1 first ~75%% of the time, got %.2f", share)
+	}
+}
+
+func TestSelectAd_TemplateRenderFailureSkipsCreative(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	testDataStore := models.NewTestAdDataStore()
+	_ = testDataStore.SetLineItems([]models.LineItem{
+		{ID: 121, CampaignID: 121, PaceType: models.PacingASAP, Priority: models.PriorityHigh, CPM: 1.0, ECPM: 1.0, Active: true},
+		{ID: 122, CampaignID: 122, PaceType: models.PacingASAP, Priority: models.PriorityLow, CPM: 1.0, ECPM: 1.0, Active: true},
+	})
+	_ = testDataStore.SetCampaigns([]models.Campaign{{ID: 121}, {ID: 122}})
+
+	// The body references a variable the template doesn't declare, which
+	// only fails when the template is executed
+	broken := &models.CreativeTemplate{ID: 90, Format: "html", Body: `<b>{{.title}}</b>`}
+	creatives := populateCreativeLineItems([]models.Creative{
+		{ID: 21, PlacementID: "header", LineItemID: 121, CampaignID: 121, Width: 320, Height: 50, Format: "html",
+			HTML: "stale markup", TemplateID: 90, Template: broken, TemplateValues: map[string]string{"title": "Hi"}},
+		{ID: 22, PlacementID: "header", LineItemID: 122, CampaignID: 122, Width: 320, Height: 50, Format: "html", HTML: "Fallback Ad"},
+	}, testDataStore)
+	database := createTestDB(creatives, map[string]models.Placement{
+		"header": {ID: "header", Width: 320, Height: 50, Formats: []string{"html"}},
+	})
+
+	resp, err := SelectAd(store, database, testDataStore, "header", "user1", 0, 0, models.TargetingContext{}, testConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.CreativeID != 22 || resp.HTML != "Fallback Ad" {
+		t.Fatalf("expected the next creative after the broken template, got %d %q", resp.CreativeID, resp.HTML)
+	}
+
+	// With nothing else to serve, no ad is returned rather than an empty one
+	database = createTestDB(creatives[:1], map[string]models.Placement{
+		"header": {ID: "header", Width: 320, Height: 50, Formats: []string{"html"}},
+	})
+	if _, err := SelectAd(store, database, testDataStore, "header", "user1", 0, 0, models.TargetingContext{}, testConfig()); err != ErrNoEligibleAd {
+		t.Fatalf("expected ErrNoEligibleAd, got %v", err)
+	}
+}
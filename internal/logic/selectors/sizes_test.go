@@ -0,0 +1,84 @@
+package selectors
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func TestSelectAd_MultiSize(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	bidW, bidH := 300, 250
+	var gotImp programmaticImp
+	bidder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req programmaticRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotImp = req.Imp[0]
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"seatbid": []interface{}{map[string]interface{}{
+				"bid": []interface{}{map[string]interface{}{"price": 8.0, "adm": "<div>bid</div>", "w": bidW, "h": bidH}},
+			}},
+		})
+	}))
+	defer bidder.Close()
+
+	dataStore := models.NewTestAdDataStore()
+	_ = dataStore.SetLineItems([]models.LineItem{
+		{ID: 101, CampaignID: 10, PaceType: models.PacingASAP, Priority: models.PriorityMedium, Active: true, ECPM: 2},
+		{ID: 102, CampaignID: 10, PaceType: models.PacingASAP, Priority: models.PriorityMedium, Active: true, ECPM: 5},
+		{ID: 103, CampaignID: 10, PaceType: models.PacingASAP, Priority: models.PriorityMedium, Active: true, ECPM: 9},
+	})
+	creatives := populateCreativeLineItems([]models.Creative{
+		{ID: 1, PlacementID: "mpu", LineItemID: 101, CampaignID: 10, Width: 300, Height: 250, Format: "html"},
+		{ID: 2, PlacementID: "mpu", LineItemID: 102, CampaignID: 10, Width: 336, Height: 280, Format: "html"},
+		// Pays most but the slot doesn't accept the size
+		{ID: 3, PlacementID: "mpu", LineItemID: 103, CampaignID: 10, Width: 728, Height: 90, Format: "html"},
+	}, dataStore)
+	placements := map[string]models.Placement{
+		"mpu": {ID: "mpu", Width: 300, Height: 250, Sizes: []models.Format{{W: 336, H: 280}}, Formats: []string{"html"}},
+	}
+	database := createTestDB(creatives, placements)
+
+	// The best paying creative across the accepted sizes wins
+	resp, err := SelectAd(store, database, dataStore, "mpu", "u1", 0, 0, models.TargetingContext{}, testConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.CreativeID != 2 || resp.Width != 336 || resp.Height != 280 {
+		t.Fatalf("expected the 336x280 creative, got %+v", resp)
+	}
+	ctx := models.TargetingContext{Sizes: []models.Format{{W: 300, H: 250}}}
+	if resp, err = SelectAd(store, database, dataStore, "mpu", "u1", 300, 250, ctx, testConfig()); err != nil || resp.CreativeID != 1 {
+		t.Fatalf("expected the requested size only, got %+v, %v", resp, err)
+	}
+
+	// Bidders are offered every accepted size and report the size they bid for
+	_ = dataStore.SetLineItems([]models.LineItem{
+		{ID: 201, CampaignID: 20, PaceType: models.PacingASAP, Priority: models.PriorityMedium, Active: true,
+			Type: models.LineItemTypeProgrammatic, Endpoint: bidder.URL},
+	})
+	creatives = populateCreativeLineItems([]models.Creative{
+		{ID: 21, PlacementID: "mpu", LineItemID: 201, CampaignID: 20, Width: 336, Height: 280, Format: "html"},
+	}, dataStore)
+	database = createTestDB(creatives, placements)
+	resp, err = SelectAd(store, database, dataStore, "mpu", "u1", 0, 0, models.TargetingContext{}, testConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotImp.Banner == nil || len(gotImp.Banner.Format) != 2 || gotImp.Banner.Format[1] != (models.Format{W: 336, H: 280}) {
+		t.Fatalf("expected accepted sizes in banner.format, got %+v", gotImp)
+	}
+	if resp.CreativeID != 21 || resp.Width != 300 || resp.Height != 250 {
+		t.Fatalf("expected the bid's size, got %+v", resp)
+	}
+	bidW, bidH = 728, 90
+	if _, err := SelectAd(store, database, dataStore, "mpu", "u1", 0, 0, models.TargetingContext{}, testConfig()); !errors.Is(err, ErrNoEligibleAd) {
+		t.Errorf("expected bids for sizes the slot doesn't accept to be dropped, got %v", err)
+	}
+}
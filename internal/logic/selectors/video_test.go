@@ -0,0 +1,85 @@
+package selectors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func TestSelectAd_ProgrammaticVideo(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	inline := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `<VAST version="4.0"><Ad id="x"><InLine><AdSystem>DSP</AdSystem><Impression>https://dsp.example/imp</Impression>`+
+			`<Creatives><Creative><Linear><Duration>00:00:14.5</Duration><MediaFiles>`+
+			`<MediaFile delivery="progressive" type="video/mp4" width="640" height="360">https://dsp.example/ad.mp4</MediaFile>`+
+			`</MediaFiles></Linear></Creative></Creatives></InLine></Ad></VAST>`)
+	}))
+	defer inline.Close()
+	wrapper := `<VAST version="4.0"><Ad id="w"><Wrapper><AdSystem>DSP</AdSystem><Impression>https://dsp.example/wimp</Impression>` +
+		`<VASTAdTagURI><![CDATA[` + inline.URL + `]]></VASTAdTagURI></Wrapper></Ad></VAST>`
+
+	var gotImp programmaticImp
+	bidder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req programmaticRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotImp = req.Imp[0]
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"seatbid": []interface{}{map[string]interface{}{
+				"bid": []interface{}{map[string]interface{}{"price": 5.0, "adm": wrapper, "adomain": []string{"brand.example"}}},
+			}},
+		})
+	}))
+	defer bidder.Close()
+
+	dataStore := models.NewTestAdDataStore()
+	_ = dataStore.SetLineItems([]models.LineItem{
+		{ID: 201, CampaignID: 20, PaceType: models.PacingASAP, Priority: models.PriorityMedium, Active: true,
+			Type: models.LineItemTypeProgrammatic, Endpoint: bidder.URL},
+	})
+	creatives := populateCreativeLineItems([]models.Creative{
+		{ID: 21, PlacementID: "preroll", LineItemID: 201, CampaignID: 20, Format: models.FormatVideo},
+	}, dataStore)
+	database := createTestDB(creatives, map[string]models.Placement{
+		"preroll": {ID: "preroll", Width: 640, Height: 360, Formats: []string{models.FormatVideo}},
+	})
+	cfg := testConfig()
+	cfg.VASTMaxWrapperDepth = 1
+	player := &models.VideoPlacement{MaxDuration: 30, MIMEs: []string{"video/mp4"}, Protocols: []int{models.ProtocolVAST41}}
+
+	resp, err := SelectAd(store, database, dataStore, "preroll", "u1", 0, 0, models.TargetingContext{Video: player}, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotImp.Video == nil || gotImp.Video.MaxDuration != 30 || gotImp.W != 640 {
+		t.Fatalf("expected video imp to be forwarded, got %+v", gotImp)
+	}
+	if resp.VAST != wrapper || resp.HTML != "" || resp.Video == nil || resp.Video.Duration != 15 ||
+		resp.ADomain != "brand.example" || resp.Price != 5 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	// Bids are dropped when the chain is too deep, the ad is too long or the
+	// advertiser is already in the pod
+	pod := &models.PodSeparation{}
+	pod.Add(999, "brand.example")
+	for name, tc := range map[string]struct {
+		depth int
+		ctx   models.TargetingContext
+	}{
+		"wrapper depth": {0, models.TargetingContext{Video: player}},
+		"too long":      {1, models.TargetingContext{Video: &models.VideoPlacement{MaxDuration: 10}}},
+		"separation":    {1, models.TargetingContext{Video: player, Pod: pod}},
+	} {
+		cfg.VASTMaxWrapperDepth = tc.depth
+		if _, err := SelectAd(store, database, dataStore, "preroll", "u1", 0, 0, tc.ctx, cfg); !errors.Is(err, ErrNoEligibleAd) {
+			t.Errorf("%s: expected no eligible ad, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package logic
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// ApplySiteContext copies the domain, page path, referrer domain, app bundle
+// and content categories from the request's site or app object into ctx. When
+// the site has no explicit domain it is taken from the page URL.
+func ApplySiteContext(ctx *models.TargetingContext, site *models.Site, app *models.App) {
+	var cats [][]string
+	switch {
+	case site != nil:
+		var page *url.URL
+		if site.Page != "" {
+			page, _ = url.Parse(site.Page)
+		}
+		domain := site.Domain
+		if domain == "" && page != nil {
+			domain = page.Hostname()
+		}
+		ctx.Domain = NormalizeDomain(domain)
+		if page != nil {
+			ctx.PagePath = page.EscapedPath()
+		}
+		if site.Ref != "" {
+			if ref, err := url.Parse(site.Ref); err == nil {
+				ctx.Referrer = NormalizeDomain(ref.Hostname())
+			}
+		}
+		cats = [][]string{site.Cat, site.SectionCat, site.PageCat}
+	case app != nil:
+		ctx.Domain = NormalizeDomain(app.Domain)
+		ctx.AppBundle = app.Bundle
+		cats = [][]string{app.Cat, app.SectionCat, app.PageCat}
+	}
+
+	seen := make(map[string]bool)
+	for _, list := range cats {
+		for _, c := range list {
+			if c != "" && !seen[c] {
+				seen[c] = true
+				ctx.Categories = append(ctx.Categories, c)
+			}
+		}
+	}
+}
+
+// NormalizeDomain lowercases a domain and strips a leading "www." and any port.
+func NormalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if host, _, ok := strings.Cut(domain, ":"); ok {
+		domain = host
+	}
+	return strings.TrimPrefix(domain, "www.")
+}
+
+// MatchesSiteContext returns true if the request's site or app context
+// satisfies the line item's domain, page path, referrer, app bundle and
+// category rules.
+// Each rule matches when any of its entries match; empty rules match everything.
+func MatchesSiteContext(li *models.LineItem, ctx models.TargetingContext) bool {
+	if li == nil {
+		return true
+	}
+	if len(li.Domains) > 0 && !matchesAny(li.Domains, func(d string) bool {
+		return matchesDomain(ctx.Domain, d)
+	}) {
+		return false
+	}
+	if len(li.PagePaths) > 0 && !matchesAny(li.PagePaths, func(p string) bool {
+		return matchesPathPrefix(ctx.PagePath, p)
+	}) {
+		return false
+	}
+	if len(li.Referrers) > 0 && !matchesAny(li.Referrers, func(d string) bool {
+		return matchesDomain(ctx.Referrer, d)
+	}) {
+		return false
+	}
+	if len(li.AppBundles) > 0 && !matchesAny(li.AppBundles, func(b string) bool {
+		return strings.EqualFold(ctx.AppBundle, b)
+	}) {
+		return false
+	}
+	if len(li.Categories) > 0 && !matchesAny(li.Categories, func(c string) bool {
+		for _, rc := range ctx.Categories {
+			if strings.EqualFold(rc, c) || strings.HasPrefix(strings.ToUpper(rc), strings.ToUpper(c)+"-") {
+				return true
+			}
+		}
+		return false
+	}) {
+		return false
+	}
+	return true
+}
+
+// matchesDomain reports whether domain is rule or one of its subdomains.
+func matchesDomain(domain, rule string) bool {
+	rule = NormalizeDomain(rule)
+	return domain == rule || strings.HasSuffix(domain, "."+rule)
+}
+
+// matchesPathPrefix reports whether path is prefix or lies below it, matching
+// whole segments only: "/sports" matches "/sports/football" but not
+// "/sportswear".
+func matchesPathPrefix(path, prefix string) bool {
+	if prefix == "" || !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+func matchesAny(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
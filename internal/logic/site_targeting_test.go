@@ -0,0 +1,96 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func TestApplySiteContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		site   *models.Site
+		app    *models.App
+		domain string
+		path   string
+		ref    string
+		bundle string
+		cats   []string
+	}{
+		{
+			name:   "site domain from page URL",
+			site:   &models.Site{Page: "https://WWW.News.example.com:443/sports/football?x=1", Ref: "https://www.Google.com/search?q=x", Cat: []string{"IAB17"}, PageCat: []string{"IAB17-12", "IAB17"}},
+			domain: "news.example.com",
+			path:   "/sports/football",
+			ref:    "google.com",
+			cats:   []string{"IAB17", "IAB17-12"},
+		},
+		{
+			name:   "explicit site domain wins",
+			site:   &models.Site{Domain: "example.com", Page: "https://cdn.other.net/a"},
+			domain: "example.com",
+			path:   "/a",
+		},
+		{
+			name:   "app",
+			app:    &models.App{Bundle: "com.example.game", Domain: "example.com", Cat: []string{"IAB9"}},
+			domain: "example.com",
+			bundle: "com.example.game",
+			cats:   []string{"IAB9"},
+		},
+		{
+			name: "neither",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctx models.TargetingContext
+			ApplySiteContext(&ctx, tt.site, tt.app)
+			if ctx.Domain != tt.domain || ctx.PagePath != tt.path || ctx.Referrer != tt.ref || ctx.AppBundle != tt.bundle {
+				t.Errorf("got domain=%q path=%q ref=%q bundle=%q", ctx.Domain, ctx.PagePath, ctx.Referrer, ctx.AppBundle)
+			}
+			if !reflect.DeepEqual(ctx.Categories, tt.cats) {
+				t.Errorf("categories = %v, want %v", ctx.Categories, tt.cats)
+			}
+		})
+	}
+}
+
+func TestMatchesSiteContext(t *testing.T) {
+	web := models.TargetingContext{Domain: "news.example.com", PagePath: "/sports/football", Referrer: "news.google.com", Categories: []string{"IAB17-12"}}
+	app := models.TargetingContext{Domain: "example.com", AppBundle: "com.example.game"}
+
+	tests := []struct {
+		name string
+		li   models.LineItem
+		ctx  models.TargetingContext
+		want bool
+	}{
+		{"no rules", models.LineItem{}, web, true},
+		{"exact domain", models.LineItem{Domains: []string{"news.example.com"}}, web, true},
+		{"parent domain", models.LineItem{Domains: []string{"www.example.com"}}, web, true},
+		{"other domain", models.LineItem{Domains: []string{"example.org"}}, web, false},
+		{"suffix is not subdomain", models.LineItem{Domains: []string{"ample.com"}}, web, false},
+		{"path prefix", models.LineItem{PagePaths: []string{"/sports"}}, web, true},
+		{"path mismatch", models.LineItem{PagePaths: []string{"/news"}}, web, false},
+		{"exact path", models.LineItem{PagePaths: []string{"/sports/football"}}, web, true},
+		{"path with trailing slash", models.LineItem{PagePaths: []string{"/sports/"}}, web, true},
+		{"partial segment", models.LineItem{PagePaths: []string{"/sports/foot"}}, web, false},
+		{"referrer", models.LineItem{Referrers: []string{"google.com"}}, web, true},
+		{"referrer mismatch", models.LineItem{Referrers: []string{"facebook.com"}}, web, false},
+		{"referrer on app", models.LineItem{Referrers: []string{"google.com"}}, app, false},
+		{"category parent", models.LineItem{Categories: []string{"iab17"}}, web, true},
+		{"category mismatch", models.LineItem{Categories: []string{"IAB1"}}, web, false},
+		{"bundle", models.LineItem{AppBundles: []string{"COM.example.game"}}, app, true},
+		{"bundle on web", models.LineItem{AppBundles: []string{"com.example.game"}}, web, false},
+		{"all rules", models.LineItem{Domains: []string{"example.com"}, PagePaths: []string{"/sports"}, Categories: []string{"IAB17-12"}}, web, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchesSiteContext(&tt.li, tt.ctx); got != tt.want {
+				t.Errorf("MatchesSiteContext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
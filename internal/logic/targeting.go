@@ -15,8 +15,13 @@ import (
 // ResolveTargetingFromUA parses a raw User-Agent string into a rich
 // TargetingContext using the uasurfer library.
 func ResolveTargetingFromUA(uaString string) models.TargetingContext {
-	u := uasurfer.Parse(uaString)
+	return targetingFromUA(uasurfer.Parse(uaString), ClientHints{})
+}
 
+// targetingFromUA builds the device part of a TargetingContext. OS and browser
+// names come from the UA string, while versions, model and the mobile flag are
+// taken from client hints when they are available.
+func targetingFromUA(u *uasurfer.UserAgent, hints ClientHints) models.TargetingContext {
 	// Device type
 	var deviceType string
 	switch u.DeviceType {
@@ -29,37 +34,68 @@ func ResolveTargetingFromUA(uaString string) models.TargetingContext {
 	default:
 		deviceType = "other"
 	}
+	mobile := deviceType == "mobile"
+	if hints.Mobile != nil {
+		mobile = *hints.Mobile
+		if mobile && deviceType == "other" {
+			deviceType = "mobile"
+		}
+	}
 
 	// OS
 	osName := fmt.Sprintf("%s %s", u.OS.Platform.String(), u.OS.Name.String())
+	if name, ok := hintPlatformOS[strings.ToLower(hints.Platform)]; ok && u.OS.Name == uasurfer.OSUnknown {
+		osName = name
+	}
 	v := u.OS.Version
 	osVersion := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if hv := hints.osVersion(); hv != "" {
+		osVersion = hv
+	}
 	fullOS := fmt.Sprintf("%s %s", osName, osVersion)
 
 	// Browser
 	browserName := u.Browser.Name.String()
 	bv := u.Browser.Version
 	browserVersion := fmt.Sprintf("%d.%d.%d", bv.Major, bv.Minor, bv.Patch)
+	if hv := hints.browserVersion(u.Browser.Name); hv != "" {
+		browserVersion = hv
+	}
 	fullBrowser := fmt.Sprintf("%s %s", browserName, browserVersion)
 
 	// Bot detection
 	isBot := u.IsBot()
 
 	return models.TargetingContext{
-		DeviceType: deviceType,
-		OS:         fullOS,
-		Browser:    fullBrowser,
-		IsBot:      isBot,
+		DeviceType:      deviceType,
+		OS:              fullOS,
+		Browser:         fullBrowser,
+		IsBot:           isBot,
+		Model:           hints.Model,
+		PlatformVersion: osVersion,
+		Mobile:          mobile,
 	}
 }
 
 // ResolveTargeting parses the UA string and IP address into a TargetingContext.
 func ResolveTargeting(g *geoip.GeoIP, uaString, ipString string) models.TargetingContext {
-	ctx := ResolveTargetingFromUA(uaString)
+	return ResolveTargetingWithHints(g, uaString, ipString, ClientHints{})
+}
+
+// ResolveTargetingWithHints is ResolveTargeting with User-Agent Client Hints
+// or device.sua data, which take precedence over the UA string.
+func ResolveTargetingWithHints(g *geoip.GeoIP, uaString, ipString string, hints ClientHints) models.TargetingContext {
+	ctx := targetingFromUA(uasurfer.Parse(uaString), hints)
 	if ip := net.ParseIP(ipString); ip != nil {
 		if g != nil {
-			ctx.Country = g.Country(ip)
-			ctx.Region = g.Region(ip)
+			loc := g.Lookup(ip)
+			ctx.Country = loc.Country
+			ctx.Region = loc.Region
+			ctx.City = loc.City
+			ctx.Metro = loc.Metro
+			ctx.PostalCode = loc.PostalCode
+			ctx.Lat = loc.Lat
+			ctx.Lon = loc.Lon
 		}
 	}
 	return ctx
@@ -67,11 +103,15 @@ func ResolveTargeting(g *geoip.GeoIP, uaString, ipString string) models.Targetin
 
 // MatchesTargeting checks if a Creative's campaign matches the given
 // TargetingContext based on device, OS and browser. Empty fields mean a
-// wildcard match.
+// wildcard match. Child-directed requests only match COPPA-safe line items.
 func MatchesTargeting(c models.Creative, ctx models.TargetingContext, dataStore models.AdDataStore) bool {
 	li := dataStore.GetLineItem(c.PublisherID, c.LineItemID)
 
 	if li != nil {
+		if ctx.Privacy.COPPA && !li.COPPASafe {
+			return false
+		}
+
 		ctxCountry := strings.ToLower(ctx.Country)
 		ctxRegion := strings.ToLower(ctx.Region)
 		ctxDevice := strings.ToLower(ctx.DeviceType)
@@ -90,6 +130,12 @@ func MatchesTargeting(c models.Creative, ctx models.TargetingContext, dataStore
 		if li.Region != "" && liRegion != ctxRegion {
 			return false
 		}
+		if !MatchesCityGeo(li, ctx) {
+			return false
+		}
+		if !MatchesGeofences(li, ctx) {
+			return false
+		}
 		if li.DeviceType != "" && liDevice != ctxDevice {
 			return false
 		}
@@ -104,12 +150,45 @@ func MatchesTargeting(c models.Creative, ctx models.TargetingContext, dataStore
 		if !MatchesKeyValues(li, ctx) {
 			return false
 		}
+		if !MatchesSiteContext(li, ctx) {
+			return false
+		}
 		return true
 	}
 	// If li is nil (e.g. creative has no line item), it cannot satisfy targeting.
 	return false
 }
 
+// MatchesCityGeo returns true if the request's city, metro and postal code
+// satisfy the line item's city-level geo rules. Empty rules match everything.
+func MatchesCityGeo(li *models.LineItem, ctx models.TargetingContext) bool {
+	if li == nil {
+		return true
+	}
+	if len(li.Cities) > 0 && !matchesAny(li.Cities, func(c string) bool {
+		return ctx.City != "" && strings.EqualFold(ctx.City, c)
+	}) {
+		return false
+	}
+	if len(li.Metros) > 0 && !matchesAny(li.Metros, func(m string) bool {
+		return ctx.Metro != "" && ctx.Metro == strings.TrimSpace(m)
+	}) {
+		return false
+	}
+	if len(li.PostalCodes) > 0 && !matchesAny(li.PostalCodes, func(p string) bool {
+		return ctx.PostalCode != "" && normalizePostal(ctx.PostalCode) == normalizePostal(p)
+	}) {
+		return false
+	}
+	return true
+}
+
+// normalizePostal uppercases a postal code and removes spaces so "ec1a 1bb"
+// and "EC1A1BB" compare equal.
+func normalizePostal(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(code, " ", ""))
+}
+
 // MatchesKeyValues returns true if all line item key/value pairs are present in the request context.
 func MatchesKeyValues(li *models.LineItem, ctx models.TargetingContext) bool {
 	if li == nil {
@@ -129,9 +208,10 @@ func MatchesKeyValues(li *models.LineItem, ctx models.TargetingContext) bool {
 	return true
 }
 
-// ResolveTargetingFromRequest extracts device type and country from HTTP request.
+// ResolveTargetingFromRequest extracts device type from the HTTP request and
+// country from the already resolved client IP.
 // This is used at impression/click time to get contextual data without storing it in tokens.
-func ResolveTargetingFromRequest(r *http.Request, geoIP *geoip.GeoIP) (deviceType, country string) {
+func ResolveTargetingFromRequest(r *http.Request, clientIP string, geoIP *geoip.GeoIP) (deviceType, country string) {
 	// Get device type from User-Agent
 	if ua := r.Header.Get("User-Agent"); ua != "" {
 		ctx := ResolveTargetingFromUA(ua)
@@ -140,23 +220,7 @@ func ResolveTargetingFromRequest(r *http.Request, geoIP *geoip.GeoIP) (deviceTyp
 
 	// Get country from IP address
 	if geoIP != nil {
-		// Try X-Forwarded-For first (handles proxies)
-		ipStr := r.Header.Get("X-Forwarded-For")
-		if ipStr == "" {
-			// Fall back to RemoteAddr
-			ipStr = r.RemoteAddr
-			// Remove port if present
-			if host, _, err := net.SplitHostPort(ipStr); err == nil {
-				ipStr = host
-			}
-		} else {
-			// X-Forwarded-For can be comma-separated, take first IP
-			if idx := strings.Index(ipStr, ","); idx != -1 {
-				ipStr = strings.TrimSpace(ipStr[:idx])
-			}
-		}
-
-		if ip := net.ParseIP(ipStr); ip != nil {
+		if ip := net.ParseIP(clientIP); ip != nil {
 			country = geoIP.Country(ip)
 		}
 	}
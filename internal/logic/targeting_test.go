@@ -120,6 +120,18 @@ func TestMatchesTargeting(t *testing.T) {
 			userContext:       models.TargetingContext{DeviceType: "mobile", Country: "US", OS: "iOS", Browser: "Safari"},
 			expectedMatch:     true,
 		},
+		{
+			name:              "COPPA request excludes unmarked line item",
+			lineItemTargeting: models.LineItem{ID: 1010, CampaignID: 1010, Active: true},
+			userContext:       models.TargetingContext{Privacy: models.PrivacyContext{COPPA: true}},
+			expectedMatch:     false,
+		},
+		{
+			name:              "COPPA request matches COPPA-safe line item",
+			lineItemTargeting: models.LineItem{ID: 1011, CampaignID: 1011, COPPASafe: true, Active: true},
+			userContext:       models.TargetingContext{Privacy: models.PrivacyContext{COPPA: true}},
+			expectedMatch:     true,
+		},
 		{
 			name:              "Exact match on Country",
 			lineItemTargeting: models.LineItem{ID: 1002, CampaignID: 1002, Country: "US", Active: true},
@@ -0,0 +1,27 @@
+package logic
+
+import (
+	"github.com/patrickwarner/openadserve/internal/config"
+	"github.com/patrickwarner/openadserve/internal/db"
+)
+
+// PlacementViewabilityRate estimates the share of a placement's impressions
+// that become viewable. The measured counts are blended with
+// cfg.DefaultViewabilityRate, weighted as cfg.ViewabilityRateWeight prior
+// impressions, so placements with little history start at the default and
+// converge on their observed rate. Only the last cfg.ViewabilityRateDays days
+// of measurements count.
+func PlacementViewabilityRate(store *db.RedisStore, placementID string, cfg config.Config) float64 {
+	if store == nil || store.Client == nil {
+		return cfg.DefaultViewabilityRate
+	}
+	imps, views := store.GetViewabilityCounts(placementID, cfg.ViewabilityRateDays)
+	if views > imps {
+		views = imps
+	}
+	total := float64(imps) + cfg.ViewabilityRateWeight
+	if total <= 0 {
+		return cfg.DefaultViewabilityRate
+	}
+	return (float64(views) + cfg.DefaultViewabilityRate*cfg.ViewabilityRateWeight) / total
+}
@@ -0,0 +1,39 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/patrickwarner/openadserve/internal/config"
+)
+
+func TestPlacementViewabilityRate(t *testing.T) {
+	ms, store := setupTestRedis(t)
+	defer ms.Close()
+
+	cfg := config.Config{DefaultViewabilityRate: 0.5, ViewabilityRateWeight: 100, ViewabilityRateDays: 7}
+	if got := PlacementViewabilityRate(store, "header", cfg); got != 0.5 {
+		t.Fatalf("expected default rate without history, got %f", got)
+	}
+
+	for i := 0; i < 900; i++ {
+		_ = store.IncrementViewabilityImpression("header", cfg.ViewabilityRateDays)
+	}
+	for i := 0; i < 850; i++ {
+		_ = store.IncrementViewabilityViewable("header", cfg.ViewabilityRateDays)
+	}
+	// (850 + 0.5*100) / (900 + 100)
+	if got := PlacementViewabilityRate(store, "header", cfg); got != 0.9 {
+		t.Fatalf("expected blended rate 0.9, got %f", got)
+	}
+
+	// Measurements from before the window no longer count.
+	old := time.Now().AddDate(0, 0, -cfg.ViewabilityRateDays).Format("2006-01-02")
+	_ = ms.Set("viewability:placement:header:imp:"+old, "5000")
+	if got := PlacementViewabilityRate(store, "header", cfg); got != 0.9 {
+		t.Fatalf("expected counts outside the window to be ignored, got %f", got)
+	}
+	if ttl := ms.TTL("viewability:placement:header:imp:" + time.Now().Format("2006-01-02")); ttl <= 0 {
+		t.Fatal("expected daily counters to expire")
+	}
+}
@@ -20,6 +20,11 @@ type MacroExpander struct {
 	expansionsMu sync.RWMutex
 	strictMode   bool // If true, any macro expansion failure causes the entire operation to fail
 
+	// priceKeys encrypt AUCTION_PRICE when set; priceErr makes the macro
+	// fail instead of falling back to a cleartext price
+	priceKeys *PriceKeys
+	priceErr  error
+
 	// Metrics
 	expansionCounter  *prometheus.CounterVec
 	expansionDuration prometheus.Histogram
@@ -36,6 +41,10 @@ type ExpansionContext struct {
 	ImpressionID string
 	Timestamp    time.Time
 
+	// ClickID identifies the click for conversion attribution. It is empty
+	// outside click redirects or when post-click attribution is disabled.
+	ClickID string
+
 	// Ad context
 	CreativeID  int32
 	LineItemID  int32
@@ -43,6 +52,9 @@ type ExpansionContext struct {
 	PublisherID int32
 	PlacementID string
 
+	// Price is the CPM price of the ad, substituted for AUCTION_PRICE
+	Price float64
+
 	// Custom parameters
 	CustomParams map[string]string
 }
@@ -135,6 +147,16 @@ func (e *MacroExpander) SetStrictMode(strict bool) {
 	e.strictMode = strict
 }
 
+// SetPriceKeys makes AUCTION_PRICE expand to the encrypted price. A non-nil
+// err marks encryption as required but unusable, so the macro fails rather
+// than revealing the price.
+func (e *MacroExpander) SetPriceKeys(keys *PriceKeys, err error) {
+	e.expansionsMu.Lock()
+	defer e.expansionsMu.Unlock()
+	e.priceKeys = keys
+	e.priceErr = err
+}
+
 // ExpandURL expands all macros in the given URL
 func (e *MacroExpander) ExpandURL(rawURL string, ctx *ExpansionContext) (string, error) {
 	start := time.Now()
@@ -204,7 +226,8 @@ func (e *MacroExpander) expandStandardMacros(rawURL string, ctx *ExpansionContex
 		return rawURL, 0, nil
 	}
 
-	// Build replacement pairs for strings.Replacer
+	// Build replacement pairs for strings.Replacer. The ${MACRO} form used
+	// by OpenRTB is listed first so the dollar sign is replaced too.
 	for _, macro := range foundMacros {
 		placeholder := "{" + macro + "}"
 		expansionFunc := e.expansions[macro]
@@ -227,7 +250,7 @@ func (e *MacroExpander) expandStandardMacros(rawURL string, ctx *ExpansionContex
 
 		// URL encode the expanded value
 		encodedValue := url.QueryEscape(value)
-		replacements = append(replacements, placeholder, encodedValue)
+		replacements = append(replacements, "$"+placeholder, encodedValue, placeholder, encodedValue)
 
 		e.expansionCounter.WithLabelValues(macro, "true").Inc()
 	}
@@ -286,6 +309,11 @@ func (e *MacroExpander) registerDefaultMacros() {
 		return ctx.ImpressionID, nil
 	}
 
+	// Click identifier for conversion postbacks
+	e.expansions["CLICK_ID"] = func(ctx *ExpansionContext) (string, error) {
+		return ctx.ClickID, nil
+	}
+
 	// Creative and campaign identifiers
 	e.expansions["CREATIVE_ID"] = func(ctx *ExpansionContext) (string, error) {
 		return fmt.Sprintf("%d", ctx.CreativeID), nil
@@ -325,6 +353,20 @@ func (e *MacroExpander) registerDefaultMacros() {
 		return fmt.Sprintf("%d", time.Now().UnixNano()), nil
 	}
 
+	e.expansions["CACHEBUSTER"] = e.expansions["RANDOM"]
+
+	// Price of the ad, encrypted when price keys are configured. Callers
+	// hold expansionsMu for reading.
+	e.expansions["AUCTION_PRICE"] = func(ctx *ExpansionContext) (string, error) {
+		if e.priceErr != nil {
+			return "", e.priceErr
+		}
+		if e.priceKeys != nil {
+			return e.priceKeys.EncryptPrice(ctx.Price)
+		}
+		return formatPrice(ctx.Price), nil
+	}
+
 	e.expansions["UUID"] = func(ctx *ExpansionContext) (string, error) {
 		return uuid.New().String(), nil
 	}
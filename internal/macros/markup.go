@@ -0,0 +1,253 @@
+package macros
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// markupContext is where in HTML markup a macro appears, which decides how
+// its value is encoded.
+type markupContext int
+
+const (
+	contextText markupContext = iota // element content
+	contextAttr                      // attribute value
+	contextURL                       // value of a URL attribute such as src or href
+	contextJS                        // inside a script element
+)
+
+// urlAttrs are the attributes whose values are URLs.
+var urlAttrs = map[string]bool{
+	"href": true, "src": true, "srcset": true, "action": true, "formaction": true,
+	"data": true, "poster": true, "background": true, "cite": true, "ping": true,
+}
+
+// ExpandHTML expands macros in HTML ad markup. Each value is encoded for the
+// place the macro appears: query-escaped and HTML-escaped in URL attributes,
+// escaped for JavaScript strings in scripts and HTML-escaped elsewhere.
+// Unknown macros and braces that aren't macros are left as is.
+func (e *MacroExpander) ExpandHTML(markup string, ctx *ExpansionContext) (string, error) {
+	start := time.Now()
+	defer func() {
+		e.expansionDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	return e.expandMarkup(markup, ctx, func(pos int, value string) string {
+		switch htmlContext(markup, pos) {
+		case contextURL:
+			return html.EscapeString(url.QueryEscape(value))
+		case contextJS:
+			return template.JSEscapeString(value)
+		default:
+			return html.EscapeString(value)
+		}
+	})
+}
+
+// ExpandJSON expands macros in the string values of JSON ad markup such as
+// native or banner assets. Values are query-escaped in strings that are URLs;
+// JSON encoding takes care of the rest. Markup without macros is returned
+// unchanged.
+func (e *MacroExpander) ExpandJSON(markup string, ctx *ExpansionContext) (string, error) {
+	start := time.Now()
+	defer func() {
+		e.expansionDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	dec := json.NewDecoder(strings.NewReader(markup))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return markup, fmt.Errorf("parse markup: %w", err)
+	}
+	changed := false
+	var expandErr error
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, child := range t {
+				t[k] = walk(child)
+			}
+		case []interface{}:
+			for i, child := range t {
+				t[i] = walk(child)
+			}
+		case string:
+			isURL := strings.HasPrefix(t, "http://") || strings.HasPrefix(t, "https://") || strings.HasPrefix(t, "//")
+			expanded, err := e.expandMarkup(t, ctx, func(_ int, value string) string {
+				if isURL {
+					return url.QueryEscape(value)
+				}
+				return value
+			})
+			if err != nil && expandErr == nil {
+				expandErr = err
+			}
+			if expanded != t {
+				changed = true
+			}
+			return expanded
+		}
+		return v
+	}
+	doc = walk(doc)
+	if expandErr != nil {
+		return "", expandErr
+	}
+	if !changed {
+		return markup, nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return markup, fmt.Errorf("encode markup: %w", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// expandMarkup replaces {MACRO}, ${MACRO} and {CUSTOM.key} placeholders
+// with values encoded by encode, which receives the placeholder's offset.
+func (e *MacroExpander) expandMarkup(markup string, ctx *ExpansionContext, encode func(pos int, value string) string) (string, error) {
+	if !strings.Contains(markup, "{") {
+		return markup, nil
+	}
+
+	e.expansionsMu.RLock()
+	defer e.expansionsMu.RUnlock()
+
+	var b strings.Builder
+	b.Grow(len(markup))
+	for i := 0; i < len(markup); {
+		open := i
+		if markup[i] == '$' && i+1 < len(markup) && markup[i+1] == '{' {
+			open = i + 1
+		} else if markup[i] != '{' {
+			b.WriteByte(markup[i])
+			i++
+			continue
+		}
+		end := strings.IndexByte(markup[open:], '}')
+		if end < 0 {
+			b.WriteString(markup[i:])
+			break
+		}
+		end += open
+		name := markup[open+1 : end]
+
+		value, ok, err := e.markupValue(name, ctx)
+		if err != nil {
+			e.expansionCounter.WithLabelValues(name, "false").Inc()
+			e.failureCounter.WithLabelValues(name, "expansion_error").Inc()
+			e.logger.Error("Failed to expand macro in markup",
+				zap.String("macro", name),
+				zap.Error(err))
+			if e.strictMode {
+				return "", fmt.Errorf("macro expansion failed in strict mode for macro '%s': %w", name, err)
+			}
+		}
+		if !ok || err != nil {
+			// Not a macro, or one that couldn't be expanded
+			b.WriteString(markup[i : open+1])
+			i = open + 1
+			continue
+		}
+		e.expansionCounter.WithLabelValues(name, "true").Inc()
+		b.WriteString(encode(i, value))
+		i = end + 1
+	}
+	return b.String(), nil
+}
+
+// markupValue returns the value of a macro by name; ok is false when name is
+// not a known macro. Callers hold expansionsMu for reading.
+func (e *MacroExpander) markupValue(name string, ctx *ExpansionContext) (value string, ok bool, err error) {
+	if key, custom := strings.CutPrefix(name, "CUSTOM."); custom {
+		value, ok = ctx.CustomParams[key]
+		return value, ok, nil
+	}
+	if name == "CUSTOM" {
+		return "", false, nil
+	}
+	fn, ok := e.expansions[name]
+	if !ok {
+		return "", false, nil
+	}
+	value, err = fn(ctx)
+	return value, true, err
+}
+
+// htmlContext reports where in the markup the offset pos lies. It is a
+// lightweight scan rather than a full parser, which is sufficient for the
+// attribute and script positions macros are placed in.
+func htmlContext(markup string, pos int) markupContext {
+	prefix := markup[:pos]
+	lower := strings.ToLower(prefix)
+	if open := strings.LastIndex(lower, "<script"); open >= 0 && open > strings.LastIndex(lower, "</script") &&
+		strings.Contains(prefix[open:], ">") {
+		return contextJS
+	}
+
+	lt := strings.LastIndexByte(prefix, '<')
+	if lt < 0 || lt < strings.LastIndexByte(prefix, '>') {
+		return contextText
+	}
+	// Inside a tag: walk its attributes to the one whose value holds the macro
+	tag := prefix[lt+1:]
+	i := strings.IndexAny(tag, " \t\n/")
+	if i < 0 {
+		return contextAttr
+	}
+	for i < len(tag) {
+		for i < len(tag) && strings.IndexByte(" \t\n/", tag[i]) >= 0 {
+			i++
+		}
+		nameStart := i
+		for i < len(tag) && strings.IndexByte(" \t\n=", tag[i]) < 0 {
+			i++
+		}
+		name := strings.ToLower(tag[nameStart:i])
+		for i < len(tag) && strings.IndexByte(" \t\n", tag[i]) >= 0 {
+			i++
+		}
+		if i == len(tag) || tag[i] != '=' {
+			continue
+		}
+		i++
+		for i < len(tag) && strings.IndexByte(" \t\n", tag[i]) >= 0 {
+			i++
+		}
+		// Skip the value; running off the end means the macro is in it
+		if i < len(tag) && (tag[i] == '"' || tag[i] == '\'') {
+			closing := strings.IndexByte(tag[i+1:], tag[i])
+			if closing < 0 {
+				return attrContext(name)
+			}
+			i += closing + 2
+		} else {
+			end := strings.IndexAny(tag[i:], " \t\n")
+			if end < 0 {
+				return attrContext(name)
+			}
+			i += end
+		}
+	}
+	return contextAttr
+}
+
+func attrContext(name string) markupContext {
+	if urlAttrs[name] {
+		return contextURL
+	}
+	return contextAttr
+}
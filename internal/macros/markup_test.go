@@ -0,0 +1,105 @@
+package macros
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestMacroExpander_ExpandHTML(t *testing.T) {
+	expander := NewMacroExpanderForTesting(zaptest.NewLogger(t), false)
+	ctx := &ExpansionContext{
+		RequestID:    "req-1",
+		CreativeID:   789,
+		Price:        2.5,
+		CustomParams: map[string]string{"q": `a b&"c"`},
+	}
+
+	tests := []struct {
+		name, markup, want string
+	}{
+		{"url attribute", `<img src="https://t.example/p?cr={CREATIVE_ID}&q={CUSTOM.q}">`, `<img src="https://t.example/p?cr=789&q=a+b%26%22c%22">`},
+		{"url attribute with other attributes", `<a class="x" href='https://t.example/?a=1&q={CUSTOM.q}' target=_blank>go</a>`, `<a class="x" href='https://t.example/?a=1&q=a+b%26%22c%22' target=_blank>go</a>`},
+		{"plain attribute", `<div data-q="{CUSTOM.q}"></div>`, `<div data-q="a b&amp;&#34;c&#34;"></div>`},
+		{"text", `<p>{CUSTOM.q}</p>`, `<p>a b&amp;&#34;c&#34;</p>`},
+		{"script", `<script>var q = "{CUSTOM.q}";</script>`, `<script>var q = "a b\u0026\"c\"";</script>`},
+		{"auction price", `<img src="https://dsp.example/win?p=${AUCTION_PRICE}">`, `<img src="https://dsp.example/win?p=2.5">`},
+		{"unknown macros and braces", `<style>p { color: red }</style>{UNKNOWN}{CUSTOM.missing}`, `<style>p { color: red }</style>{UNKNOWN}{CUSTOM.missing}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expander.ExpandHTML(tt.markup, ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+
+	got, _ := expander.ExpandHTML(`<img src="https://t.example/p?cb={CACHEBUSTER}">`, ctx)
+	if strings.Contains(got, "{CACHEBUSTER}") || !strings.HasPrefix(got, `<img src="https://t.example/p?cb=`) {
+		t.Errorf("expected a cache buster, got %s", got)
+	}
+}
+
+func TestMacroExpander_ExpandJSON(t *testing.T) {
+	expander := NewMacroExpanderForTesting(zaptest.NewLogger(t), false)
+	ctx := &ExpansionContext{RequestID: "req 1", CustomParams: map[string]string{"name": "<Jo & Co>"}}
+
+	got, err := expander.ExpandJSON(`{"title":"Hi {CUSTOM.name}","imptrackers":["https://t.example/i?r={AUCTION_ID}"],"ver":1.2}`, ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var doc struct {
+		Title       string   `json:"title"`
+		ImpTrackers []string `json:"imptrackers"`
+		Ver         json.Number
+	}
+	if err := json.Unmarshal([]byte(got), &doc); err != nil {
+		t.Fatalf("invalid json %s: %v", got, err)
+	}
+	if doc.Title != "Hi <Jo & Co>" || doc.ImpTrackers[0] != "https://t.example/i?r=req+1" || doc.Ver != "1.2" {
+		t.Errorf("unexpected expansion %s", got)
+	}
+
+	unchanged := `{"b": 1, "a": "no macros"}`
+	if got, _ := expander.ExpandJSON(unchanged, ctx); got != unchanged {
+		t.Errorf("expected markup without macros to be untouched, got %s", got)
+	}
+}
+
+func TestMacroExpander_EncryptedPrice(t *testing.T) {
+	expander := NewMacroExpanderForTesting(zaptest.NewLogger(t), false)
+	keys, err := ParsePriceKeys("c2VjcmV0LWVuY3J5cHRpb24ta2V5", "c2VjcmV0LWludGVncml0eS1rZXk=")
+	if err != nil {
+		t.Fatalf("parse keys: %v", err)
+	}
+	expander.SetPriceKeys(keys, nil)
+
+	got, err := expander.ExpandHTML(`<img src="https://dsp.example/win?p=${AUCTION_PRICE}">`, &ExpansionContext{Price: 3.21})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	enc := strings.TrimSuffix(strings.TrimPrefix(got, `<img src="https://dsp.example/win?p=`), `">`)
+	price, err := keys.DecryptPrice(enc)
+	if err != nil || price != 3.21 {
+		t.Fatalf("expected 3.21 to decrypt, got %v, %v from %s", price, err, got)
+	}
+
+	other := &PriceKeys{Encryption: keys.Encryption, Integrity: []byte("other")}
+	if _, err := other.DecryptPrice(enc); !errors.Is(err, ErrPriceSignature) {
+		t.Errorf("expected a signature mismatch, got %v", err)
+	}
+
+	// Unusable keys never fall back to the cleartext price
+	expander.SetPriceKeys(nil, errors.New("bad key"))
+	got, _ = expander.ExpandHTML(`p=${AUCTION_PRICE}`, &ExpansionContext{Price: 3.21})
+	if got != `p=${AUCTION_PRICE}` {
+		t.Errorf("expected the macro to stay unexpanded, got %s", got)
+	}
+}
@@ -0,0 +1,119 @@
+package macros
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Price encryption follows the widely used OpenRTB scheme: the price in
+// micros is XORed with an HMAC-SHA1 pad derived from a 16 byte
+// initialization vector and signed with a separate integrity key. The result
+// is iv || encrypted price || signature in web-safe base64 without padding.
+const (
+	priceIVSize        = 16
+	priceSize          = 8
+	priceSignatureSize = 4
+)
+
+// ErrPriceSignature is returned when an encrypted price fails its integrity check.
+var ErrPriceSignature = errors.New("price signature mismatch")
+
+// PriceKeys holds the keys used to encrypt the ${AUCTION_PRICE} macro.
+type PriceKeys struct {
+	Encryption []byte
+	Integrity  []byte
+}
+
+// ParsePriceKeys decodes base64 encryption and integrity keys. Both web-safe
+// and standard alphabets are accepted, with or without padding.
+func ParsePriceKeys(encryption, integrity string) (*PriceKeys, error) {
+	e, err := decodeKey(encryption)
+	if err != nil {
+		return nil, fmt.Errorf("price encryption key: %w", err)
+	}
+	i, err := decodeKey(integrity)
+	if err != nil {
+		return nil, fmt.Errorf("price integrity key: %w", err)
+	}
+	return &PriceKeys{Encryption: e, Integrity: i}, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	if s == "" {
+		return nil, errors.New("key is empty")
+	}
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// EncryptPrice encrypts a CPM price with a random initialization vector.
+func (k *PriceKeys) EncryptPrice(price float64) (string, error) {
+	iv := make([]byte, priceIVSize)
+	// Timestamp first so that ciphertexts are unique even if the random
+	// source repeats
+	binary.BigEndian.PutUint64(iv, uint64(time.Now().UnixNano()))
+	if _, err := rand.Read(iv[8:]); err != nil {
+		return "", fmt.Errorf("price iv: %w", err)
+	}
+	return k.encryptWithIV(price, iv), nil
+}
+
+func (k *PriceKeys) encryptWithIV(price float64, iv []byte) string {
+	plain := make([]byte, priceSize)
+	binary.BigEndian.PutUint64(plain, uint64(math.Round(price*1e6)))
+
+	pad := hmacSHA1(k.Encryption, iv)
+	out := make([]byte, 0, priceIVSize+priceSize+priceSignatureSize)
+	out = append(out, iv...)
+	for i := 0; i < priceSize; i++ {
+		out = append(out, plain[i]^pad[i])
+	}
+	sig := hmacSHA1(k.Integrity, append(plain, iv...))
+	out = append(out, sig[:priceSignatureSize]...)
+	return base64.RawURLEncoding.EncodeToString(out)
+}
+
+// DecryptPrice reverses EncryptPrice and verifies the signature.
+func (k *PriceKeys) DecryptPrice(encrypted string) (float64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encrypted, "="))
+	if err != nil {
+		return 0, fmt.Errorf("decode price: %w", err)
+	}
+	if len(b) != priceIVSize+priceSize+priceSignatureSize {
+		return 0, fmt.Errorf("encrypted price has %d bytes", len(b))
+	}
+	iv := b[:priceIVSize]
+	pad := hmacSHA1(k.Encryption, iv)
+	plain := make([]byte, priceSize)
+	for i := 0; i < priceSize; i++ {
+		plain[i] = b[priceIVSize+i] ^ pad[i]
+	}
+	sig := hmacSHA1(k.Integrity, append(append([]byte{}, plain...), iv...))
+	if !hmac.Equal(sig[:priceSignatureSize], b[priceIVSize+priceSize:]) {
+		return 0, ErrPriceSignature
+	}
+	return float64(binary.BigEndian.Uint64(plain)) / 1e6, nil
+}
+
+func hmacSHA1(key, data []byte) []byte {
+	m := hmac.New(sha1.New, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// formatPrice renders a cleartext CPM price for the price macro.
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/patrickwarner/openadserve/internal/models"
 )
 
-// Service provides macro expansion capabilities for click URLs
+// Service provides macro expansion capabilities for click URLs and ad markup
 type Service struct {
 	expander *MacroExpander
 	logger   *zap.Logger
@@ -46,27 +46,39 @@ func (s *Service) ValidateURL(rawURL string) []string {
 	return s.expander.ValidateURL(rawURL)
 }
 
+// ConfigurePriceEncryption encrypts AUCTION_PRICE with the given base64
+// keys. Empty keys leave the price in cleartext. Invalid keys are reported
+// and make the macro fail rather than reveal the price.
+func (s *Service) ConfigurePriceEncryption(encryptionKey, integrityKey string) error {
+	if encryptionKey == "" && integrityKey == "" {
+		s.expander.SetPriceKeys(nil, nil)
+		return nil
+	}
+	keys, err := ParsePriceKeys(encryptionKey, integrityKey)
+	s.expander.SetPriceKeys(keys, err)
+	return err
+}
+
 // ExpandClickURL expands macros in a click URL using ad request context
 func (s *Service) ExpandClickURL(rawURL string, req *ClickContext) (string, error) {
 	if rawURL == "" {
 		return "", nil
 	}
 
-	// Create expansion context
-	ctx := &ExpansionContext{
-		RequestID:    req.RequestID,
-		ImpressionID: req.ImpressionID,
-		Timestamp:    req.Timestamp,
-		CreativeID:   req.CreativeID,
-		LineItemID:   req.LineItemID,
-		CampaignID:   req.CampaignID,
-		PublisherID:  req.PublisherID,
-		PlacementID:  req.PlacementID,
-		CustomParams: req.CustomParams,
-	}
-
 	// The expander handles all macro types, including custom parameters
-	return s.expander.ExpandURL(rawURL, ctx)
+	return s.expander.ExpandURL(rawURL, req.expansionContext())
+}
+
+// ExpandHTML expands macros in the HTML markup of an ad, encoding each value
+// for where it appears.
+func (s *Service) ExpandHTML(markup string, req *ClickContext) (string, error) {
+	return s.expander.ExpandHTML(markup, req.expansionContext())
+}
+
+// ExpandJSON expands macros in the string values of JSON ad markup, such as
+// native assets or a native response.
+func (s *Service) ExpandJSON(markup string, req *ClickContext) (string, error) {
+	return s.expander.ExpandJSON(markup, req.expansionContext())
 }
 
 // GetDestinationURL determines the final destination URL for a click
@@ -108,12 +120,14 @@ func (s *Service) GetDestinationURL(ctx context.Context, creative *models.Creati
 	return expandedURL, nil
 }
 
-// ClickContext contains all the context needed for click URL macro expansion
+// ClickContext contains all the context needed for macro expansion in click
+// URLs and ad markup
 type ClickContext struct {
 	// Request identifiers
 	RequestID    string
 	ImpressionID string
 	Timestamp    time.Time
+	ClickID      string
 
 	// Ad identifiers
 	CreativeID  int32
@@ -122,10 +136,29 @@ type ClickContext struct {
 	PublisherID int32
 	PlacementID string
 
+	// Price is the CPM price of the ad
+	Price float64
+
 	// Custom parameters from ad request
 	CustomParams map[string]string
 }
 
+func (c *ClickContext) expansionContext() *ExpansionContext {
+	return &ExpansionContext{
+		RequestID:    c.RequestID,
+		ImpressionID: c.ImpressionID,
+		Timestamp:    c.Timestamp,
+		ClickID:      c.ClickID,
+		CreativeID:   c.CreativeID,
+		LineItemID:   c.LineItemID,
+		CampaignID:   c.CampaignID,
+		PublisherID:  c.PublisherID,
+		PlacementID:  c.PlacementID,
+		Price:        c.Price,
+		CustomParams: c.CustomParams,
+	}
+}
+
 // NewClickContextFromRequest creates a ClickContext from an ad request and selected creative
 func NewClickContextFromRequest(
 	requestID, impressionID string,
@@ -122,6 +122,7 @@ func TestService_ExpandClickURL(t *testing.T) {
 		RequestID:    "req-123",
 		ImpressionID: "imp-456",
 		Timestamp:    time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC),
+		ClickID:      "click-abc",
 		CreativeID:   789,
 		LineItemID:   101,
 		CampaignID:   202,
@@ -143,6 +144,11 @@ func TestService_ExpandClickURL(t *testing.T) {
 			rawURL:      "https://example.com?req={AUCTION_ID}&cr={CREATIVE_ID}&li={LINE_ITEM_ID}",
 			expectedURL: "https://example.com?req=req-123&cr=789&li=101",
 		},
+		{
+			name:        "Click ID",
+			rawURL:      "https://example.com?clickid={CLICK_ID}",
+			expectedURL: "https://example.com?clickid=click-abc",
+		},
 		{
 			name:        "Custom parameters",
 			rawURL:      "https://example.com?source={CUSTOM.utm_source}&medium={CUSTOM.utm_medium}",
@@ -1,6 +1,9 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Creative represents an ad unit, which is the actual piece of content to be displayed.
 // It is associated with a specific LineItem (for delivery rules) and a Campaign (for reporting).
@@ -25,18 +28,61 @@ type Creative struct {
 	// for retina/high-DPI displays. Publishers render these as standard <img> tags.
 	// Example: {"image": "url", "alt": "text", "images": [{"url": "...", "width": 728, "height": 90}]}
 	Banner json.RawMessage `json:"banner"`
-	Width  int             `json:"width"`  // Width of the creative in pixels.
-	Height int             `json:"height"` // Height of the creative in pixels.
-	// Format specifies the type of the creative, e.g., "html", "native", or "banner".
+	// Video holds the media files and duration if the creative format is "video".
+	// Video creatives are returned to the player as VAST XML.
+	Video  *VideoCreative `json:"video,omitempty"`
+	Width  int            `json:"width"`  // Width of the creative in pixels.
+	Height int            `json:"height"` // Height of the creative in pixels.
+	// Format specifies the type of the creative, e.g., "html", "native", "banner" or "video".
 	// This dictates how the ad content (HTML, Native, or Banner) is interpreted and rendered.
 	Format string `json:"format"`
 	// ClickURL is the destination URL where users should be redirected when they click on the ad.
 	// Supports macro expansion for dynamic values like {AUCTION_ID}, {CREATIVE_ID}, etc.
 	ClickURL string `json:"click_url,omitempty"`
+	// StartDate and EndDate restrict the creative to a flight within its
+	// line item's; zero values leave that end open.
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	// Weight sets how often the creative rotates in relative to creatives
+	// that tie with it on priority and price, such as the other creatives of
+	// its line item. Zero counts as 1.
+	Weight int `json:"weight,omitempty"`
+	// FrequencyCap limits how many times a user sees this creative within
+	// FrequencyWindow, in addition to the line item's cap. Zero means no
+	// creative-level cap.
+	FrequencyCap    int           `json:"frequency_cap,omitempty"`
+	FrequencyWindow time.Duration `json:"frequency_window,omitempty"`
+	// ImpressionTrackers and ClickTrackers are third-party tracking URLs
+	// fired with the creative's impressions and clicks, after its line
+	// item's. They support the same macros as click URLs.
+	ImpressionTrackers []string `json:"impression_trackers,omitempty"`
+	ClickTrackers      []string `json:"click_trackers,omitempty"`
+	// TemplateID references a CreativeTemplate of the creative's publisher.
+	// When set, the ad markup is rendered from the template with
+	// TemplateValues at serve time instead of taken from HTML or Banner.
+	TemplateID     int               `json:"template_id,omitempty"`
+	TemplateValues map[string]string `json:"template_values,omitempty"`
 
 	// LineItem is a cached pointer to the associated LineItem to avoid repeated lookups.
 	// This field is populated when creatives are loaded from the database and should not be serialized.
 	LineItem *LineItem `json:"-"`
+	// Template is a cached pointer to the creative's template, populated
+	// alongside LineItem.
+	Template *CreativeTemplate `json:"-"`
+}
+
+// InFlight reports whether now is within the creative's flight dates.
+func (c Creative) InFlight(now time.Time) bool {
+	return (c.StartDate.IsZero() || !now.Before(c.StartDate)) &&
+		(c.EndDate.IsZero() || !now.After(c.EndDate))
+}
+
+// RotationWeight is the creative's weight, with zero counting as 1.
+func (c Creative) RotationWeight() int {
+	if c.Weight <= 0 {
+		return 1
+	}
+	return c.Weight
 }
 
 // AdResponse is a simplified structure used for responding to ad requests (`/ad` endpoint).
@@ -50,8 +96,26 @@ type AdResponse struct {
 	Native json.RawMessage `json:"native,omitempty"`
 	// Banner holds the raw JSON data for banner ad assets if the creative format is "banner".
 	// This allows publishers to receive image URLs and metadata for rendering standard image-based ads.
-	Banner     json.RawMessage `json:"banner,omitempty"`
-	CampaignID int             `json:"campaign_id"`  // The ID of the campaign this ad belongs to (Campaign.ID).
-	LineItemID int             `json:"line_item_id"` // The ID of the line item this ad belongs to (LineItem.ID).
-	Price      float64         `json:"price"`        // The eCPM price of the ad.
+	Banner json.RawMessage `json:"banner,omitempty"`
+	// Video holds the media files of a video creative, which the ad handler
+	// wraps in a VAST document together with the tracking URLs.
+	Video *VideoCreative `json:"video,omitempty"`
+	// VAST holds the VAST document of a programmatic video bid. Video.Duration
+	// is the resolved duration of its linear ad; our tracking is inserted into
+	// the document when it is served.
+	VAST string `json:"vast,omitempty"`
+	// NativeAd is the native response for placements that declare a native
+	// request: the creative's assets matched to the requested ones, or the
+	// response of a programmatic bid. Tracking is added when it is served.
+	NativeAd *NativeResponse `json:"native_ad,omitempty"`
+	// ADomain is the advertiser domain of the ad, used to separate
+	// competitors within a video ad pod.
+	ADomain string `json:"adomain,omitempty"`
+	// Width and Height are the size of the ad: the creative's, or the size a
+	// programmatic bid was made for.
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	CampaignID int     `json:"campaign_id"`  // The ID of the campaign this ad belongs to (Campaign.ID).
+	LineItemID int     `json:"line_item_id"` // The ID of the line item this ad belongs to (LineItem.ID).
+	Price      float64 `json:"price"`        // The eCPM price of the ad.
 }
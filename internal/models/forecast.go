@@ -9,10 +9,11 @@ type ForecastRequest struct {
 	// Line item configuration
 	StartDate  time.Time `json:"start_date"`
 	EndDate    time.Time `json:"end_date"`
-	BudgetType string    `json:"budget_type"` // CPM, CPC, Flat
+	BudgetType string    `json:"budget_type"` // CPM, CPC, Flat, vCPM, CPA
 	Budget     float64   `json:"budget"`
 	CPM        float64   `json:"cpm,omitempty"`
 	CPC        float64   `json:"cpc,omitempty"`
+	CPA        float64   `json:"cpa,omitempty"`
 	Priority   int       `json:"priority"`
 	DailyCap   int       `json:"daily_cap,omitempty"`
 	Pacing     string    `json:"pacing,omitempty"` // ASAP, Even
@@ -39,6 +40,14 @@ type ForecastResponse struct {
 	FillRate             float64 `json:"fill_rate"`
 	EstimatedCTR         float64 `json:"estimated_ctr,omitempty"`
 
+	// Viewability estimates, set for vCPM forecasts
+	EstimatedViewableImpressions int64   `json:"estimated_viewable_impressions,omitempty"`
+	EstimatedViewRate            float64 `json:"estimated_view_rate,omitempty"`
+
+	// Conversion estimates, set for CPA forecasts
+	EstimatedConversions int64   `json:"estimated_conversions,omitempty"`
+	EstimatedCVR         float64 `json:"estimated_cvr,omitempty"`
+
 	// Daily breakdown
 	DailyForecast []DailyForecast `json:"daily_forecast"`
 
@@ -57,6 +66,10 @@ type DailyForecast struct {
 	EstimatedImpressions int64     `json:"estimated_impressions"`
 	EstimatedClicks      int64     `json:"estimated_clicks,omitempty"`
 	EstimatedSpend       float64   `json:"estimated_spend"`
+	// EstimatedViewableImpressions is set for vCPM forecasts
+	EstimatedViewableImpressions int64 `json:"estimated_viewable_impressions,omitempty"`
+	// EstimatedConversions is set for CPA forecasts
+	EstimatedConversions int64 `json:"estimated_conversions,omitempty"`
 }
 
 // ConflictingLineItem represents a line item competing for the same inventory
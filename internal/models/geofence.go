@@ -0,0 +1,23 @@
+package models
+
+// GeoPoint is a latitude/longitude pair in decimal degrees.
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Geofence is a location area a line item can target. It is either a
+// point-radius circle (Lat, Lon and RadiusKM) or, when Polygon has at least
+// three vertices, a polygon. Polygons are implicitly closed.
+type Geofence struct {
+	Name     string     `json:"name,omitempty"` // Optional label, e.g. a store identifier.
+	Lat      float64    `json:"lat,omitempty"`
+	Lon      float64    `json:"lon,omitempty"`
+	RadiusKM float64    `json:"radius_km,omitempty"`
+	Polygon  []GeoPoint `json:"polygon,omitempty"`
+}
+
+// IsPolygon reports whether the geofence describes a polygon rather than a circle.
+func (g Geofence) IsPolygon() bool {
+	return len(g.Polygon) >= 3
+}
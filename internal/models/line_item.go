@@ -20,6 +20,8 @@ const (
 	BudgetTypeCPM  = "cpm"  // Cost Per Mille (Thousand Impressions): Line item bids and spends based on impressions.
 	BudgetTypeCPC  = "cpc"  // Cost Per Click: Line item bids based on an eCPM derived from CPC and CTR, spends based on clicks.
 	BudgetTypeFlat = "flat" // Flat Rate: Line item has a fixed total budget, often for sponsorships or fixed placements.
+	BudgetTypeVCPM = "vcpm" // Viewable CPM: Line item bids per thousand viewable impressions and spends on viewability events.
+	BudgetTypeCPA  = "cpa"  // Cost Per Action: Line item bids based on an eCPM derived from CPA and conversion rate, spends based on conversions.
 )
 
 // Line item types indicate the source or nature of the line item.
@@ -55,6 +57,10 @@ type LineItem struct {
 	EndDate            time.Time `json:"end_date"`             // The date and time when the line item stops serving (flight end).
 	DailyImpressionCap int       `json:"daily_impression_cap"` // Maximum impressions allowed per day. 0 means unlimited.
 	DailyClickCap      int       `json:"daily_click_cap"`      // Maximum clicks allowed per day. 0 means unlimited.
+	// DailyEventCaps stops delivery for the day once the line item has
+	// recorded the given number of valid custom events of a type, e.g.
+	// {"video_complete": 500}. Event types come from the publisher's EventTypes.
+	DailyEventCaps map[string]int `json:"daily_event_caps,omitempty"`
 	// PaceType controls how impressions are delivered over time. Valid values: PacingASAP, PacingEven.
 	// This allows publishers to choose between rapid delivery or spreading it out.
 	PaceType string `json:"pace_type"`
@@ -72,20 +78,36 @@ type LineItem struct {
 	OS         string `json:"os"`          // Target operating systems (e.g., "iOS", "Android").
 	Browser    string `json:"browser"`     // Target specific browsers (e.g., "Chrome", "Safari").
 	Active     bool   `json:"active"`      // Toggles whether the line item is currently active and eligible for serving.
+	// City-level geo targeting. Requires a City GeoIP database. Each list matches when any entry matches.
+	Cities      []string `json:"cities,omitempty"`       // City names (e.g., "San Francisco").
+	Metros      []string `json:"metros,omitempty"`       // Nielsen DMA codes (e.g., "807").
+	PostalCodes []string `json:"postal_codes,omitempty"` // Postal or ZIP codes.
+	// Geofences restricts delivery to requests located inside any of the listed
+	// circles or polygons. Device coordinates are preferred over IP-derived ones.
+	Geofences []Geofence `json:"geofences,omitempty"`
 	// KeyValues enables publisher-defined custom targeting. Ad requests can include arbitrary key-value
 	// pairs in `OpenRTBRequest.Ext.KV`. If they match the rules defined here (e.g. {"category": "sports"}),
 	// the line item becomes eligible. This provides a powerful mechanism for publishers to leverage
 	// their own first-party data (like content categories or user segments) for precise targeting.
 	KeyValues map[string]string `json:"key_values,omitempty"`
-	CPM       float64           `json:"cpm"` // Cost Per Mille (Thousand Impressions) bid, if budget type is CPM.
-	CPC       float64           `json:"cpc"` // Cost Per Click bid, if budget type is CPC.
+	// Site and app targeting. Each list matches when any entry matches; an empty list matches everything.
+	Domains    []string `json:"domains,omitempty"`     // Domains; a domain also matches its subdomains.
+	PagePaths  []string `json:"page_paths,omitempty"`  // Page path prefixes (e.g., "/sports").
+	AppBundles []string `json:"app_bundles,omitempty"` // App bundle identifiers.
+	Referrers  []string `json:"referrers,omitempty"`   // Referrer domains; a domain also matches its subdomains.
+	Categories []string `json:"categories,omitempty"`  // IAB categories; "IAB17" also matches "IAB17-12".
+	CPM        float64  `json:"cpm"`                   // Cost Per Mille bid, if budget type is CPM; per thousand viewable impressions for vCPM.
+	CPC        float64  `json:"cpc"`                   // Cost Per Click bid, if budget type is CPC.
+	CPA        float64  `json:"cpa"`                   // Cost Per Action bid, if budget type is CPA.
 	// ECPM (Effective Cost Per Mille) is the normalized price used for ranking line items from different
 	// buying models (CPM, CPC) in an auction. For CPM line items, ECPM is typically `CPM`.
 	// For CPC line items, ECPM is calculated as `CPC * EstimatedCTR * 1000`.
+	// vCPM line items are ranked at `CPM * ViewabilityRate` for the requested placement.
+	// For CPA line items, ECPM is calculated as `CPA * EstimatedConversionRate * 1000`.
 	// This ensures fair competition and yield optimization for the publisher.
 	ECPM float64 `json:"ecpm"`
 	// BudgetType defines how the line item bids and how its spend is measured.
-	// Valid values: BudgetTypeCPM, BudgetTypeCPC, BudgetTypeFlat.
+	// Valid values: BudgetTypeCPM, BudgetTypeCPC, BudgetTypeFlat, BudgetTypeVCPM, BudgetTypeCPA.
 	// This gives publishers flexibility in how they structure deals.
 	BudgetType string `json:"budget_type"`
 	// BudgetAmount is the total monetary budget for this line item. Delivery stops if exhausted.
@@ -102,6 +124,25 @@ type LineItem struct {
 	// ClickURL is the default destination URL for ads in this line item.
 	// Can be overridden at the creative level. Supports macro expansion for dynamic values.
 	ClickURL string `json:"click_url,omitempty"`
+	// VendorID is the IAB Global Vendor List ID of a programmatic demand source.
+	// Under GDPR the endpoint is only called when the user consented to this vendor.
+	VendorID int `json:"vendor_id,omitempty"`
+	// COPPASafe marks the line item as suitable for child-directed inventory.
+	// Only COPPA-safe line items can serve when COPPA applies to a request.
+	COPPASafe bool `json:"coppa_safe,omitempty"`
+	// ADomain is the advertiser's domain (e.g. "brand.example"). Video ad pods
+	// never contain two ads from the same advertiser.
+	ADomain string `json:"adomain,omitempty"`
+	// ImpressionTrackers and ClickTrackers are third-party tracking URLs
+	// (e.g. the advertiser's ad server) fired with the impressions and clicks
+	// of all the line item's creatives, in addition to the creatives' own.
+	// They support the same macros as click URLs.
+	ImpressionTrackers []string `json:"impression_trackers,omitempty"`
+	ClickTrackers      []string `json:"click_trackers,omitempty"`
+	// ServerSideTrackers fires the third-party trackers from the server when
+	// our impression and click are recorded instead of returning them in the
+	// ad markup.
+	ServerSideTrackers bool `json:"server_side_trackers,omitempty"`
 }
 
 // SetLineItems replaces all in-memory line items using the provided store.
@@ -0,0 +1,306 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// FormatNative is the creative and placement format for native ads.
+const FormatNative = "native"
+
+// NativeVersion is the OpenRTB Native version of requests and responses.
+const NativeVersion = "1.2"
+
+// OpenRTB Native 1.2 event tracking types and methods.
+const (
+	NativeEventImpression    = 1
+	NativeEventViewableMRC50 = 2
+	NativeMethodImage        = 1
+)
+
+// NativeRequest is the OpenRTB Native 1.2 request a placement declares. It
+// is the asset contract creatives must satisfy and is forwarded to
+// programmatic bidders as is.
+type NativeRequest struct {
+	Ver    string               `json:"ver,omitempty"`
+	Assets []NativeAssetRequest `json:"assets"`
+	// EventTrackers lists the events and tracking methods the publisher
+	// supports. Our impression and viewability URLs are image trackers.
+	EventTrackers []NativeEventTrackerRequest `json:"eventtrackers,omitempty"`
+}
+
+// NativeAssetRequest asks for one title, image or data asset.
+type NativeAssetRequest struct {
+	ID       int                 `json:"id"`
+	Required int                 `json:"required,omitempty"` // 1 when the ad must include the asset.
+	Title    *NativeTitleRequest `json:"title,omitempty"`
+	Img      *NativeImageRequest `json:"img,omitempty"`
+	Data     *NativeDataRequest  `json:"data,omitempty"`
+}
+
+// NativeTitleRequest asks for a title of at most Len characters.
+type NativeTitleRequest struct {
+	Len int `json:"len"`
+}
+
+// NativeImageRequest asks for an image of a type (1 icon, 3 main). W and H
+// require an exact size; WMin and HMin a minimum size instead.
+type NativeImageRequest struct {
+	Type  int      `json:"type,omitempty"`
+	W     int      `json:"w,omitempty"`
+	H     int      `json:"h,omitempty"`
+	WMin  int      `json:"wmin,omitempty"`
+	HMin  int      `json:"hmin,omitempty"`
+	MIMEs []string `json:"mimes,omitempty"`
+}
+
+// NativeDataRequest asks for a data asset of a type (e.g. 2 description,
+// 12 call to action) of at most Len characters.
+type NativeDataRequest struct {
+	Type int `json:"type"`
+	Len  int `json:"len,omitempty"`
+}
+
+// NativeEventTrackerRequest names an event and the tracking methods
+// supported for it.
+type NativeEventTrackerRequest struct {
+	Event   int   `json:"event"`
+	Methods []int `json:"methods"`
+}
+
+// NativeResponse is the OpenRTB Native 1.2 response returned in adm.
+type NativeResponse struct {
+	Ver           string               `json:"ver,omitempty"`
+	Assets        []NativeAsset        `json:"assets"`
+	Link          NativeLink           `json:"link"`
+	ImpTrackers   []string             `json:"imptrackers,omitempty"`
+	EventTrackers []NativeEventTracker `json:"eventtrackers,omitempty"`
+}
+
+// NativeAsset is one asset of a native response, identified by the ID of
+// the requested asset it fills.
+type NativeAsset struct {
+	ID       int          `json:"id"`
+	Required int          `json:"required,omitempty"`
+	Title    *NativeTitle `json:"title,omitempty"`
+	Img      *NativeImage `json:"img,omitempty"`
+	Data     *NativeData  `json:"data,omitempty"`
+	Link     *NativeLink  `json:"link,omitempty"`
+}
+
+// NativeTitle is the text of a title asset.
+type NativeTitle struct {
+	Text string `json:"text"`
+}
+
+// NativeImage is an image asset.
+type NativeImage struct {
+	Type int    `json:"type,omitempty"`
+	URL  string `json:"url"`
+	W    int    `json:"w,omitempty"`
+	H    int    `json:"h,omitempty"`
+}
+
+// NativeData is a data asset such as a description or call to action.
+type NativeData struct {
+	Type  int    `json:"type,omitempty"`
+	Value string `json:"value"`
+}
+
+// NativeLink is the destination of the ad and the URLs called on click.
+type NativeLink struct {
+	URL           string   `json:"url"`
+	ClickTrackers []string `json:"clicktrackers,omitempty"`
+}
+
+// NativeEventTracker is one tracking URL for an event.
+type NativeEventTracker struct {
+	Event  int    `json:"event"`
+	Method int    `json:"method"`
+	URL    string `json:"url"`
+}
+
+// NativeCreative holds the assets of a native creative served in placements
+// that declare a native request. Images and data are matched to the
+// requested assets by type.
+type NativeCreative struct {
+	Title  string        `json:"title,omitempty"`
+	Images []NativeImage `json:"images,omitempty"`
+	Data   []NativeData  `json:"data,omitempty"`
+}
+
+// Validate checks that the request asks for at least one asset, each with a
+// unique ID and exactly one of title, img or data.
+func (r *NativeRequest) Validate() error {
+	if r == nil {
+		return nil
+	}
+	if len(r.Assets) == 0 {
+		return errors.New("native request requires at least one asset")
+	}
+	ids := make(map[int]bool, len(r.Assets))
+	for i, a := range r.Assets {
+		if a.ID <= 0 || ids[a.ID] {
+			return fmt.Errorf("native asset %d requires a unique positive id", i)
+		}
+		ids[a.ID] = true
+		n := 0
+		if a.Title != nil {
+			n++
+			if a.Title.Len <= 0 {
+				return fmt.Errorf("native asset %d: title len must be positive", a.ID)
+			}
+		}
+		if a.Img != nil {
+			n++
+		}
+		if a.Data != nil {
+			n++
+			if a.Data.Type <= 0 {
+				return fmt.Errorf("native asset %d: data type is required", a.ID)
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("native asset %d requires exactly one of title, img or data", a.ID)
+		}
+	}
+	return nil
+}
+
+// Imp encodes the request as the OpenRTB Native object of a bid request.
+func (r *NativeRequest) Imp() *ImpNative {
+	req := *r
+	req.Ver = NativeVersion
+	b, _ := json.Marshal(req)
+	return &ImpNative{Request: string(b), Ver: NativeVersion}
+}
+
+// ParseNativeCreative decodes the native assets of a creative.
+func ParseNativeCreative(raw json.RawMessage) (*NativeCreative, error) {
+	var c NativeCreative
+	if len(raw) == 0 {
+		return &c, nil
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("parse native assets: %w", err)
+	}
+	return &c, nil
+}
+
+// Response matches the creative's assets to the requested ones and returns
+// the native response without link and trackers. Optional assets the
+// creative can't fill are left out; missing required assets are an error.
+func (r *NativeRequest) Response(c *NativeCreative) (*NativeResponse, error) {
+	resp := &NativeResponse{Ver: NativeVersion}
+	for _, a := range r.Assets {
+		asset := NativeAsset{ID: a.ID, Required: a.Required}
+		switch {
+		case a.Title != nil:
+			if c.Title != "" && utf8.RuneCountInString(c.Title) <= a.Title.Len {
+				asset.Title = &NativeTitle{Text: c.Title}
+			}
+		case a.Img != nil:
+			for i := range c.Images {
+				if a.Img.fits(c.Images[i]) {
+					asset.Img = &c.Images[i]
+					break
+				}
+			}
+		case a.Data != nil:
+			for i, d := range c.Data {
+				if d.Type == a.Data.Type && d.Value != "" && (a.Data.Len == 0 || utf8.RuneCountInString(d.Value) <= a.Data.Len) {
+					asset.Data = &c.Data[i]
+					break
+				}
+			}
+		}
+		if asset.Title == nil && asset.Img == nil && asset.Data == nil {
+			if a.Required == 1 {
+				return nil, fmt.Errorf("native asset %d is required", a.ID)
+			}
+			continue
+		}
+		resp.Assets = append(resp.Assets, asset)
+	}
+	return resp, nil
+}
+
+// Accepts reports whether a native creative fills the required assets. Any
+// creative fits a placement without a native request.
+func (r *NativeRequest) Accepts(c Creative) bool {
+	if r == nil {
+		return true
+	}
+	// Programmatic bids return their own native response
+	if len(c.Native) == 0 && c.LineItem != nil && c.LineItem.Type == LineItemTypeProgrammatic {
+		return true
+	}
+	nc, err := ParseNativeCreative(c.Native)
+	if err != nil {
+		return false
+	}
+	_, err = r.Response(nc)
+	return err == nil
+}
+
+// Check verifies that a bidder's native response links somewhere and fills
+// every required asset.
+func (r *NativeRequest) Check(resp *NativeResponse) error {
+	if resp.Link.URL == "" {
+		return errors.New("native response requires a link")
+	}
+	filled := make(map[int]bool, len(resp.Assets))
+	for _, a := range resp.Assets {
+		filled[a.ID] = true
+	}
+	for _, a := range r.Assets {
+		if a.Required == 1 && !filled[a.ID] {
+			return fmt.Errorf("native asset %d is required", a.ID)
+		}
+	}
+	return nil
+}
+
+// Tracks reports whether the publisher accepts image trackers for the event.
+func (r *NativeRequest) Tracks(event int) bool {
+	if r == nil {
+		return false
+	}
+	for _, t := range r.EventTrackers {
+		if t.Event == event && containsAny(t.Methods, []int{NativeMethodImage}) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNativeResponse decodes a native response from a bid's adm. Both the
+// plain object and the object wrapped in "native" are accepted.
+func ParseNativeResponse(adm string) (*NativeResponse, error) {
+	var wrapped struct {
+		Native *NativeResponse `json:"native"`
+	}
+	if err := json.Unmarshal([]byte(adm), &wrapped); err != nil {
+		return nil, fmt.Errorf("parse native response: %w", err)
+	}
+	if wrapped.Native != nil {
+		return wrapped.Native, nil
+	}
+	var resp NativeResponse
+	if err := json.Unmarshal([]byte(adm), &resp); err != nil {
+		return nil, fmt.Errorf("parse native response: %w", err)
+	}
+	return &resp, nil
+}
+
+func (r *NativeImageRequest) fits(img NativeImage) bool {
+	if img.URL == "" || (r.Type != 0 && img.Type != r.Type) {
+		return false
+	}
+	if r.WMin > 0 || r.HMin > 0 {
+		return img.W >= r.WMin && img.H >= r.HMin
+	}
+	return (r.W == 0 || img.W == r.W) && (r.H == 0 || img.H == r.H)
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNativeRequestValidate(t *testing.T) {
+	ok := &NativeRequest{Assets: []NativeAssetRequest{
+		{ID: 1, Required: 1, Title: &NativeTitleRequest{Len: 25}},
+		{ID: 2, Img: &NativeImageRequest{Type: 3}},
+	}}
+	if err := ok.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for name, r := range map[string]*NativeRequest{
+		"no assets":    {},
+		"duplicate id": {Assets: []NativeAssetRequest{{ID: 1, Img: &NativeImageRequest{}}, {ID: 1, Img: &NativeImageRequest{}}}},
+		"two kinds":    {Assets: []NativeAssetRequest{{ID: 1, Title: &NativeTitleRequest{Len: 10}, Img: &NativeImageRequest{}}}},
+		"no title len": {Assets: []NativeAssetRequest{{ID: 1, Title: &NativeTitleRequest{}}}},
+		"no data type": {Assets: []NativeAssetRequest{{ID: 1, Data: &NativeDataRequest{}}}},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestNativeRequestResponse(t *testing.T) {
+	req := &NativeRequest{Assets: []NativeAssetRequest{
+		{ID: 1, Required: 1, Title: &NativeTitleRequest{Len: 10}},
+		{ID: 2, Required: 1, Img: &NativeImageRequest{Type: 3, W: 1200, H: 627}},
+		{ID: 3, Img: &NativeImageRequest{Type: 1, WMin: 50, HMin: 50}},
+		{ID: 4, Data: &NativeDataRequest{Type: 12, Len: 10}},
+	}}
+	c := &NativeCreative{
+		Title: "Héllo",
+		Images: []NativeImage{
+			{Type: 3, URL: "https://cdn.example/small.jpg", W: 600, H: 314},
+			{Type: 3, URL: "https://cdn.example/main.jpg", W: 1200, H: 627},
+		},
+		Data: []NativeData{{Type: 12, Value: "Shop the full collection"}},
+	}
+	resp, err := req.Response(c)
+	if err != nil {
+		t.Fatalf("Response: %v", err)
+	}
+	// The optional icon and the too long call to action are left out
+	if len(resp.Assets) != 2 || resp.Assets[0].Title.Text != "Héllo" || resp.Assets[1].Img.URL != "https://cdn.example/main.jpg" {
+		t.Fatalf("unexpected assets %+v", resp.Assets)
+	}
+
+	c.Title = "Far too long a title"
+	if _, err := req.Response(c); err == nil {
+		t.Error("expected error when the title doesn't fit")
+	}
+	if req.Accepts(Creative{Format: FormatNative, Native: json.RawMessage(`{"title":"Hi"}`)}) {
+		t.Error("expected creative without the main image to be rejected")
+	}
+	if !req.Accepts(Creative{Format: FormatNative, LineItem: &LineItem{Type: LineItemTypeProgrammatic}}) {
+		t.Error("expected programmatic creatives without assets to be accepted")
+	}
+}
+
+func TestParseNativeResponse(t *testing.T) {
+	req := &NativeRequest{Assets: []NativeAssetRequest{{ID: 1, Required: 1, Title: &NativeTitleRequest{Len: 10}}}}
+	for _, adm := range []string{
+		`{"native":{"assets":[{"id":1,"title":{"text":"Hi"}}],"link":{"url":"https://brand.example"}}}`,
+		`{"ver":"1.2","assets":[{"id":1,"title":{"text":"Hi"}}],"link":{"url":"https://brand.example"}}`,
+	} {
+		resp, err := ParseNativeResponse(adm)
+		if err != nil {
+			t.Fatalf("ParseNativeResponse: %v", err)
+		}
+		if err := req.Check(resp); err != nil || resp.Assets[0].Title.Text != "Hi" {
+			t.Errorf("unexpected response %+v: %v", resp, err)
+		}
+	}
+	resp, _ := ParseNativeResponse(`{"assets":[],"link":{"url":"https://brand.example"}}`)
+	if err := req.Check(resp); err == nil {
+		t.Error("expected error for missing required asset")
+	}
+	if _, err := ParseNativeResponse(`<div>not native</div>`); err == nil {
+		t.Error("expected error for non-JSON adm")
+	}
+}
@@ -8,6 +8,12 @@ type OpenRTBRequest struct {
 	Imp    []Impression `json:"imp"`    // Array of impression objects, representing one or more ad opportunities. Usually one for this server.
 	User   User         `json:"user"`   // User object containing information about the user.
 	Device Device       `json:"device"` // Device object containing information about the user's device.
+	// Site describes the website for web requests; App describes the application for in-app
+	// requests. A request should carry at most one of them.
+	Site *Site `json:"site,omitempty"`
+	App  *App  `json:"app,omitempty"`
+	// Regs carries regulatory signals (GDPR, US privacy, GPP) that govern how user data may be used.
+	Regs Regs `json:"regs,omitempty"`
 	// Ext holds extension fields. This is where publishers can include custom data.
 	Ext RequestExt `json:"ext,omitempty"`
 }
@@ -21,17 +27,171 @@ type Impression struct {
 	// This gives publishers flexibility to request different sizes for the same placement on a per-request basis.
 	W int `json:"w,omitempty"`
 	H int `json:"h,omitempty"`
+	// Banner lists the sizes a display slot accepts. Its sizes take
+	// precedence over W and H.
+	Banner *ImpBanner `json:"banner,omitempty"`
+	// Video is present when the slot is a video player. Its constraints narrow
+	// those of the placement.
+	Video *ImpVideo `json:"video,omitempty"`
+}
+
+// ImpBanner describes a display slot (OpenRTB Banner object).
+type ImpBanner struct {
+	W int `json:"w,omitempty"`
+	H int `json:"h,omitempty"`
+	// Format lists the sizes the slot accepts, preferred first.
+	Format []Format `json:"format,omitempty"`
+}
+
+// Sizes returns the sizes the slot accepts: the format list, or W and H
+// when no list is sent.
+func (b *ImpBanner) Sizes() []Format {
+	if b == nil {
+		return nil
+	}
+	if len(b.Format) > 0 {
+		return b.Format
+	}
+	if b.W > 0 && b.H > 0 {
+		return []Format{{W: b.W, H: b.H}}
+	}
+	return nil
+}
+
+// Format is a creative size in pixels (OpenRTB Format object).
+type Format struct {
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Fits reports whether a creative of the given size fills the slot size. A
+// zero width or height leaves that dimension open.
+func (f Format) Fits(width, height int) bool {
+	return (f.W == 0 || f.W == width) && (f.H == 0 || f.H == height)
+}
+
+// ImpVideo describes the video player of an impression (OpenRTB Video object).
+type ImpVideo struct {
+	MIMEs       []string `json:"mimes,omitempty"`       // Media types the player supports, e.g. "video/mp4".
+	MinDuration int      `json:"minduration,omitempty"` // Minimum ad duration in seconds.
+	MaxDuration int      `json:"maxduration,omitempty"` // Maximum ad duration in seconds.
+	Protocols   []int    `json:"protocols,omitempty"`   // Supported OpenRTB protocol IDs (VAST versions).
+	W           int      `json:"w,omitempty"`           // Player width in pixels.
+	H           int      `json:"h,omitempty"`           // Player height in pixels.
+	// Skip is 1 when the player allows skipping, 0 when it doesn't. Nil keeps
+	// the placement's setting.
+	Skip      *int `json:"skip,omitempty"`
+	SkipAfter int  `json:"skipafter,omitempty"` // Seconds before the ad can be skipped.
+	// MaxSeq and PodDur describe an ad pod: the most ads the break can hold
+	// and their total duration in seconds.
+	MaxSeq int `json:"maxseq,omitempty"`
+	PodDur int `json:"poddur,omitempty"`
+}
+
+// ImpNative is the OpenRTB Native object of an impression. Request holds
+// the JSON-encoded Native 1.2 request.
+type ImpNative struct {
+	Request string `json:"request"`
+	Ver     string `json:"ver,omitempty"`
+}
+
+// Site object describes the website on which the ad will be shown.
+type Site struct {
+	ID         string   `json:"id,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	Domain     string   `json:"domain,omitempty"`     // Site domain (e.g., "news.example.com").
+	Page       string   `json:"page,omitempty"`       // Full URL of the page where the ad will be shown.
+	Ref        string   `json:"ref,omitempty"`        // Referrer URL that led to the page.
+	Cat        []string `json:"cat,omitempty"`        // IAB content categories of the site.
+	SectionCat []string `json:"sectioncat,omitempty"` // IAB content categories of the current section.
+	PageCat    []string `json:"pagecat,omitempty"`    // IAB content categories of the current page.
+	Keywords   string   `json:"keywords,omitempty"`   // Comma separated keywords about the site.
+}
+
+// App object describes the application in which the ad will be shown.
+type App struct {
+	ID         string   `json:"id,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	Bundle     string   `json:"bundle,omitempty"`     // Store or package ID (e.g., "com.example.game" or "1234567890").
+	Domain     string   `json:"domain,omitempty"`     // Domain of the app (e.g., "example.com").
+	StoreURL   string   `json:"storeurl,omitempty"`   // App store URL.
+	Ver        string   `json:"ver,omitempty"`        // Application version.
+	Cat        []string `json:"cat,omitempty"`        // IAB content categories of the app.
+	SectionCat []string `json:"sectioncat,omitempty"` // IAB content categories of the current section.
+	PageCat    []string `json:"pagecat,omitempty"`    // IAB content categories of the current view.
+	Keywords   string   `json:"keywords,omitempty"`   // Comma separated keywords about the app.
 }
 
 // User object contains information about the user for whom the ad is being requested.
 type User struct {
 	ID string `json:"id"` // Unique identifier for the user, managed by the publisher or SDK (e.g., a cookie ID).
+	// Consent is the IAB TCF v2 consent string (OpenRTB 2.6 location).
+	Consent string `json:"consent,omitempty"`
+	// Ext carries the OpenRTB 2.5 extension location for the consent string.
+	Ext UserExt `json:"ext,omitempty"`
+}
+
+// UserExt holds extension fields on the User object.
+type UserExt struct {
+	Consent string `json:"consent,omitempty"` // TCF v2 consent string as sent by OpenRTB 2.5 clients.
+}
+
+// Regs object conveys the legal and regulatory signals that apply to the request.
+// Both the OpenRTB 2.6 top-level fields and the older ext locations are accepted.
+type Regs struct {
+	// COPPA is 1 when the request is subject to COPPA (child-directed).
+	COPPA int `json:"coppa,omitempty"`
+	// GDPR is 1 when the request is subject to GDPR, 0 when it is not. Nil means unknown.
+	GDPR *int `json:"gdpr,omitempty"`
+	// USPrivacy is the IAB CCPA string (e.g. "1YNN").
+	USPrivacy string `json:"us_privacy,omitempty"`
+	// GPP is the IAB Global Privacy Platform string.
+	GPP string `json:"gpp,omitempty"`
+	// GPPSID lists the GPP section IDs that apply to this request.
+	GPPSID []int   `json:"gpp_sid,omitempty"`
+	Ext    RegsExt `json:"ext,omitempty"`
+}
+
+// RegsExt holds the OpenRTB 2.5 extension locations for privacy signals.
+type RegsExt struct {
+	GDPR      *int   `json:"gdpr,omitempty"`
+	USPrivacy string `json:"us_privacy,omitempty"`
 }
 
 // Device object provides information about the user's device.
 type Device struct {
 	UA string `json:"ua"` // User-Agent string of the device's browser. Used for device, OS, and browser targeting.
 	IP string `json:"ip"` // IPv4 address of the device. Used for geo-targeting.
+	// Geo is the device location. When it carries coordinates they take
+	// precedence over the IP-derived location for geofence targeting.
+	Geo *Geo `json:"geo,omitempty"`
+	// SUA is the structured user agent built from User-Agent Client Hints.
+	// It is preferred over UA because reduced UA strings freeze OS versions.
+	SUA *UserAgent `json:"sua,omitempty"`
+}
+
+// UserAgent object (OpenRTB 2.6 device.sua) carries structured user agent data.
+type UserAgent struct {
+	Browsers     []BrandVersion `json:"browsers,omitempty"`     // Browser brands with full versions.
+	Platform     *BrandVersion  `json:"platform,omitempty"`     // Platform (OS) name and version.
+	Mobile       *int           `json:"mobile,omitempty"`       // 1 if the agent prefers mobile content, 0 if not.
+	Architecture string         `json:"architecture,omitempty"` // CPU architecture (e.g., "x86", "arm").
+	Bitness      string         `json:"bitness,omitempty"`      // CPU bitness (e.g., "64").
+	Model        string         `json:"model,omitempty"`        // Device model (e.g., "Pixel 7").
+	Source       int            `json:"source,omitempty"`       // 1 low-entropy hints, 2 high-entropy hints, 3 parsed from UA.
+}
+
+// BrandVersion identifies a browser or platform and its version components.
+type BrandVersion struct {
+	Brand   string   `json:"brand"`
+	Version []string `json:"version,omitempty"` // Version components, e.g. ["120", "0", "6099", "71"].
+}
+
+// Geo object describes the location of the device.
+type Geo struct {
+	Lat  float64 `json:"lat,omitempty"`  // Latitude from -90.0 to +90.0.
+	Lon  float64 `json:"lon,omitempty"`  // Longitude from -180.0 to +180.0.
+	Type int     `json:"type,omitempty"` // Location source: 1 GPS, 2 IP address, 3 user provided.
 }
 
 // RequestExt provides a means to extend the OpenRTBRequest object with custom data.
@@ -44,7 +204,7 @@ type RequestExt struct {
 	// and publisher-specific targeting logic.
 	KV          map[string]string `json:"kv,omitempty"`
 	PublisherID int               `json:"publisher_id"`
-	// CustomParams are key-value pairs that will be available for macro expansion in click URLs.
+	// CustomParams are key-value pairs that will be available for macro expansion in click URLs and ad markup.
 	// These parameters are passed through the click tracking token and can be used in destination URLs
 	// using the {CUSTOM.key} macro syntax. For example, if CustomParams contains {"utm_source": "homepage"},
 	// then {CUSTOM.utm_source} in a creative's click_url will be replaced with "homepage".
@@ -97,4 +257,13 @@ type Bid struct {
 	EventURL string `json:"evturl,omitempty"`
 	// ReportURL is a pre-signed URL for submitting an ad report.
 	ReportURL string `json:"repturl,omitempty"`
+	// ViewURL is a pre-signed URL the SDK calls once the ad meets the viewability
+	// standard (50% of pixels in view for one second, two for large formats).
+	ViewURL string `json:"viewurl,omitempty"`
+	// ADomain lists the advertiser domains of the ad, when known.
+	ADomain []string `json:"adomain,omitempty"`
+	// W and H are the size of the winning creative, which may be any of the
+	// sizes the slot accepts.
+	W int `json:"w,omitempty"`
+	H int `json:"h,omitempty"`
 }
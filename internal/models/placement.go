@@ -15,8 +15,62 @@ type Placement struct {
 	// Height is the default height of the ad slot in pixels.
 	// Similar to Width, this can be overridden by specific ad requests.
 	Height int `json:"height"`
+	// Sizes lists further sizes the slot accepts besides Width x Height,
+	// e.g. 336x280 for a 300x250 slot. Creatives of any accepted size
+	// compete for the slot.
+	Sizes []Format `json:"sizes,omitempty"`
 	// Formats is a list of creative formats allowed to serve in this placement (e.g., ["html", "native"]).
 	// Creatives selected for this placement must have a format that is in this list.
 	// This allows publishers to enforce, for example, that only native ads appear in a native-only slot.
 	Formats []string `json:"formats"`
+	// ChildDirected marks the placement as directed to children under COPPA,
+	// even when the rest of the publisher's inventory is not.
+	ChildDirected bool `json:"child_directed,omitempty"`
+	// Video holds the player constraints when the placement accepts "video"
+	// creatives. Requests can narrow them with imp.video.
+	Video *VideoPlacement `json:"video,omitempty"`
+	// Native is the OpenRTB Native 1.2 request of a "native" placement.
+	// Native creatives must fill its required assets and are returned as a
+	// native response. Without it, native assets are passed through as is.
+	Native *NativeRequest `json:"native,omitempty"`
+}
+
+// AcceptedSizes returns the default size followed by the further sizes the
+// placement accepts. A placement without a size accepts any size.
+func (p *Placement) AcceptedSizes() []Format {
+	sizes := []Format{{W: p.Width, H: p.Height}}
+	for _, f := range p.Sizes {
+		if f != sizes[0] {
+			sizes = append(sizes, f)
+		}
+	}
+	return sizes
+}
+
+// AcceptsSize reports whether a creative of the given size may serve in the
+// placement.
+func (p *Placement) AcceptsSize(width, height int) bool {
+	for _, f := range p.AcceptedSizes() {
+		if f.Fits(width, height) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestSizes returns the sizes an ad request accepts for the placement.
+// Sizes sent in the request replace the placement's defaults, like imp.w
+// and imp.h; when the placement lists further sizes, requested sizes it
+// doesn't accept are dropped. Nil means the request sent no sizes.
+func (p *Placement) RequestSizes(requested []Format) []Format {
+	if len(requested) == 0 || len(p.Sizes) == 0 {
+		return requested
+	}
+	var out []Format
+	for _, f := range requested {
+		if p.AcceptsSize(f.W, f.H) {
+			out = append(out, f)
+		}
+	}
+	return out
 }
@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestPlacementSizes(t *testing.T) {
+	p := &Placement{ID: "mpu", Width: 300, Height: 250, Sizes: []Format{{W: 336, H: 280}, {W: 300, H: 250}}}
+	if sizes := p.AcceptedSizes(); len(sizes) != 2 || sizes[0] != (Format{W: 300, H: 250}) || sizes[1] != (Format{W: 336, H: 280}) {
+		t.Fatalf("unexpected accepted sizes %v", sizes)
+	}
+	if !p.AcceptsSize(336, 280) || p.AcceptsSize(728, 90) {
+		t.Error("unexpected AcceptsSize result")
+	}
+
+	requested := (&ImpBanner{W: 1, H: 1, Format: []Format{{W: 728, H: 90}, {W: 336, H: 280}}}).Sizes()
+	if sizes := p.RequestSizes(requested); len(sizes) != 1 || sizes[0] != (Format{W: 336, H: 280}) {
+		t.Errorf("expected sizes the placement doesn't accept to be dropped, got %v", sizes)
+	}
+	// Single size placements take requested sizes as overrides, like imp.w and imp.h
+	single := &Placement{Width: 300, Height: 250}
+	if sizes := single.RequestSizes(requested); len(sizes) != 2 {
+		t.Errorf("expected requested sizes to replace the default, got %v", sizes)
+	}
+	if sizes := (&ImpBanner{W: 320, H: 50}).Sizes(); len(sizes) != 1 || sizes[0] != (Format{W: 320, H: 50}) {
+		t.Errorf("expected banner w and h without a format list, got %v", sizes)
+	}
+	if (*ImpBanner)(nil).Sizes() != nil {
+		t.Error("expected no sizes without a banner")
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+// Consent statuses recorded on analytics events. They summarise the privacy
+// decision made for a request so reports can be split by consent state.
+const (
+	ConsentNotApplicable = "not_applicable" // No privacy regime signalled for the request.
+	ConsentGranted       = "granted"        // A regime applies and the user allowed personal data use.
+	ConsentDenied        = "denied"         // GDPR applies and consent for storage/access is missing or invalid.
+	ConsentOptedOut      = "opted_out"      // The user opted out of sale/sharing under a US privacy law.
+	ConsentCOPPA         = "coppa"          // The request or inventory is child-directed; user data is never used.
+)
+
+// PrivacyContext is the privacy decision for a single ad request. It keeps the
+// raw signals so they can be forwarded to programmatic demand, together with the
+// outcome the ad server acts on.
+type PrivacyContext struct {
+	GDPRApplies bool   // True when GDPR applies to the request (regs.gdpr=1 or a GPP TCF section).
+	TCFConsent  string // Raw TCF v2 consent string, forwarded as-is to bidders.
+	USPrivacy   string // Raw US Privacy (CCPA) string.
+	GPP         string // Raw GPP string.
+	GPPSID      []int  // Applicable GPP section IDs.
+	COPPA       bool   // True when the request or inventory is child-directed.
+	// Status is one of the Consent* constants and is stored with every analytics event.
+	Status string
+	// RestrictUserData is true when the user identifier must not be used for
+	// frequency capping, audience lookups or stored with events and reports.
+	RestrictUserData bool
+	// VendorConsents holds the IAB Global Vendor List IDs the user consented to.
+	// It is only consulted when GDPRApplies is true.
+	VendorConsents map[int]bool
+}
+
+// VendorAllowed reports whether a demand source with the given Global Vendor
+// List ID may receive this request. Vendor checks only apply under GDPR, and a
+// zero vendor ID means the line item is not tied to a registered vendor.
+func (p PrivacyContext) VendorAllowed(vendorID int) bool {
+	if !p.GDPRApplies || vendorID <= 0 {
+		return true
+	}
+	return p.VendorConsents[vendorID]
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Privacy job types.
+const (
+	PrivacyJobDelete = "delete" // Remove every record tied to a user ID.
+	PrivacyJobExport = "export" // Collect every record tied to a user ID.
+)
+
+// Privacy job statuses.
+const (
+	PrivacyJobPending   = "pending"
+	PrivacyJobRunning   = "running"
+	PrivacyJobCompleted = "completed"
+	PrivacyJobFailed    = "failed"
+)
+
+// PrivacyJob tracks a user data deletion or export request. The raw user ID
+// is never stored with the job; SubjectHash is its SHA-256 so requests for
+// the same user can be correlated in the audit trail.
+type PrivacyJob struct {
+	ID          int                 `json:"id"`
+	Type        string              `json:"type"`
+	Status      string              `json:"status"`
+	SubjectHash string              `json:"subject_hash"`
+	Error       string              `json:"error,omitempty"`
+	Result      json.RawMessage     `json:"result,omitempty"`
+	Audit       []PrivacyAuditEntry `json:"audit,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty"`
+}
+
+// PrivacyAuditEntry records one step of a privacy job against a data store.
+type PrivacyAuditEntry struct {
+	Store     string    `json:"store"`
+	Action    string    `json:"action"`
+	Records   int64     `json:"records"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -1,6 +1,11 @@
 package models
 
-import "go.uber.org/zap"
+import (
+	"fmt"
+	"regexp"
+
+	"go.uber.org/zap"
+)
 
 // Publisher represents a site or app that uses the ad server.
 type Publisher struct {
@@ -8,6 +13,105 @@ type Publisher struct {
 	Name   string `json:"name"`
 	Domain string `json:"domain"`
 	APIKey string `json:"api_key"`
+	// ChildDirected marks all of the publisher's inventory as directed to
+	// children under COPPA.
+	ChildDirected bool `json:"child_directed,omitempty"`
+	// EventTypes lists the custom events accepted on /event for the
+	// publisher's ads. When empty, DefaultEventTypes apply.
+	EventTypes []EventType `json:"event_types,omitempty"`
+}
+
+// EventType defines a custom event a publisher tracks on its ads.
+type EventType struct {
+	// Name is the value of the type parameter on /event, e.g. "add_to_cart".
+	Name string `json:"name"`
+	// Dedupe records the event at most once per impression.
+	Dedupe bool `json:"dedupe,omitempty"`
+	// Billable events charge Cost to the line item's spend. They are always
+	// deduplicated, so replaying a tracking URL can't charge twice.
+	Billable bool `json:"billable,omitempty"`
+	// Cost is the price of one billable event.
+	Cost float64 `json:"cost,omitempty"`
+}
+
+// Deduplicated reports whether the event counts at most once per impression.
+func (et *EventType) Deduplicated() bool {
+	return et.Dedupe || et.Billable
+}
+
+// DefaultEventTypes apply to publishers that haven't defined their own.
+var DefaultEventTypes = []EventType{
+	{Name: "like"},    // user expressed a like/heart reaction
+	{Name: "share"},   // user shared the content
+	{Name: "comment"}, // user commented on the content
+}
+
+// VideoEventTypes are the VAST playback events, accepted for every publisher
+// in addition to its own event types. Each counts once per impression. A
+// publisher can redefine one, e.g. to bill completed views.
+var VideoEventTypes = []EventType{
+	{Name: "video_start", Dedupe: true},
+	{Name: "video_first_quartile", Dedupe: true},
+	{Name: "video_midpoint", Dedupe: true},
+	{Name: "video_third_quartile", Dedupe: true},
+	{Name: "video_complete", Dedupe: true},
+	{Name: "video_skip", Dedupe: true},
+}
+
+// reservedEventTypes are recorded by the server itself and can't be reused
+// for custom events.
+var reservedEventTypes = map[string]struct{}{
+	"ad_request":          {},
+	"ad_served":           {},
+	"impression":          {},
+	"viewable_impression": {},
+	"click":               {},
+	"invalid_click":       {},
+	"conversion":          {},
+}
+
+var eventTypeName = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// EventType returns the publisher's definition of the named custom event, or
+// nil if the publisher doesn't accept it.
+func (p *Publisher) EventType(name string) *EventType {
+	types := p.EventTypes
+	if len(types) == 0 {
+		types = DefaultEventTypes
+	}
+	for _, list := range [][]EventType{types, VideoEventTypes} {
+		for i := range list {
+			if list[i].Name == name {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateEventTypes checks that event type names are well formed, unique
+// and not reserved, and that only billable events have a cost.
+func (p *Publisher) ValidateEventTypes() error {
+	seen := make(map[string]bool, len(p.EventTypes))
+	for _, et := range p.EventTypes {
+		if !eventTypeName.MatchString(et.Name) {
+			return fmt.Errorf("invalid event type name %q: use 1-64 lowercase letters, digits or underscores", et.Name)
+		}
+		if _, ok := reservedEventTypes[et.Name]; ok {
+			return fmt.Errorf("event type %q is reserved", et.Name)
+		}
+		if seen[et.Name] {
+			return fmt.Errorf("duplicate event type %q", et.Name)
+		}
+		seen[et.Name] = true
+		if et.Cost < 0 {
+			return fmt.Errorf("event type %q: cost must not be negative", et.Name)
+		}
+		if et.Cost > 0 && !et.Billable {
+			return fmt.Errorf("event type %q: cost requires billable", et.Name)
+		}
+	}
+	return nil
 }
 
 // SetPublishers replaces the in-memory publisher slice.
@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestPublisherEventType(t *testing.T) {
+	pub := &Publisher{}
+	if pub.EventType("like") == nil {
+		t.Fatal("expected default event types without publisher definitions")
+	}
+
+	pub.EventTypes = []EventType{{Name: "add_to_cart", Billable: true, Cost: 0.5}}
+	if et := pub.EventType("add_to_cart"); et == nil || !et.Billable || et.Cost != 0.5 || !et.Deduplicated() {
+		t.Fatalf("unexpected event type %+v", et)
+	}
+	if pub.EventType("like") != nil {
+		t.Fatal("expected defaults to be replaced by publisher definitions")
+	}
+	if et := pub.EventType("video_complete"); et == nil || !et.Dedupe || et.Billable {
+		t.Fatalf("expected built-in video event, got %+v", et)
+	}
+
+	pub.EventTypes = append(pub.EventTypes, EventType{Name: "video_complete", Dedupe: true, Billable: true, Cost: 0.02})
+	if et := pub.EventType("video_complete"); et == nil || !et.Billable {
+		t.Fatalf("expected publisher definition to override video event, got %+v", et)
+	}
+}
+
+func TestPublisherValidateEventTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		types   []EventType
+		wantErr bool
+	}{
+		{"valid", []EventType{{Name: "video_complete", Dedupe: true}, {Name: "add_to_cart", Billable: true, Cost: 1}}, false},
+		{"bad name", []EventType{{Name: "Add To Cart"}}, true},
+		{"empty name", []EventType{{}}, true},
+		{"reserved", []EventType{{Name: "click"}}, true},
+		{"duplicate", []EventType{{Name: "share"}, {Name: "share"}}, true},
+		{"negative cost", []EventType{{Name: "share", Billable: true, Cost: -1}}, true},
+		{"cost without billable", []EventType{{Name: "share", Cost: 1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &Publisher{EventTypes: tt.types}
+			if err := pub.ValidateEventTypes(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEventTypes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
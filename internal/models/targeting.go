@@ -11,11 +11,44 @@ type TargetingContext struct {
 	OS         string // Operating system name and version (e.g., "iOS 15.1", "Android 12"). Derived from User-Agent.
 	Browser    string // Browser name and version (e.g., "Chrome 98.0", "Safari 15.1"). Derived from User-Agent.
 	IsBot      bool   // True if the User-Agent is identified as a known bot or crawler.
-	Country    string // ISO 3166-1 alpha-2 country code derived from the request's IP address (e.g., "US", "CA").
-	Region     string // Region or subdivision code derived from the IP address (e.g., "CA" for California in US, "ON" for Ontario in CA).
+	IVTReason  string // Why the request or event is invalid traffic (ivt.Reason*). Empty for valid traffic.
+	// Device details preferring User-Agent Client Hints or device.sua over the UA string.
+	Model           string // Device model (e.g., "Pixel 7"). Only known from client hints.
+	PlatformVersion string // OS version (e.g., "14.0.0"); also part of OS.
+	Mobile          bool   // True for phones, or when client hints report a mobile agent.
+	Country         string // ISO 3166-1 alpha-2 country code derived from the request's IP address (e.g., "US", "CA").
+	Region          string // Region or subdivision code derived from the IP address (e.g., "CA" for California in US, "ON" for Ontario in CA).
+	// City-level fields are only populated when GEOIP_DB points at a City database.
+	City       string  // English city name (e.g., "San Francisco").
+	Metro      string  // Nielsen DMA code for US locations (e.g., "807").
+	PostalCode string  // Postal or ZIP code (e.g., "94107").
+	Lat        float64 // Latitude from device.geo when allowed, otherwise from the IP address.
+	Lon        float64 // Longitude from device.geo when allowed, otherwise from the IP address.
 	// KeyValues contains the custom key-value pairs sent by the publisher in the ad request (`OpenRTBRequest.Ext.KV`).
 	// This is a critical feature for publisher customization, allowing them to pass their own contextual signals
 	// (e.g., content categories like "sports", user attributes like "premium_subscriber") for targeting.
 	// Line items can then be configured to target these specific key-values.
 	KeyValues map[string]string
+	// Site and app context from the request's `site`/`app` objects.
+	Domain     string   // Lowercased site or app domain without a leading "www.".
+	PagePath   string   // Path of the page URL (e.g., "/sports/football"). Empty for apps.
+	Referrer   string   // Domain of the referrer URL, normalized like Domain. Empty for apps.
+	AppBundle  string   // App store or package identifier. Empty for web requests.
+	Categories []string // IAB content categories from cat, sectioncat and pagecat.
+	// UserID is the request's user identifier after privacy rules are applied.
+	// It is empty when consent does not permit storing or using the identifier.
+	UserID string
+	// Privacy holds the consent decision and raw regulatory signals for the request.
+	Privacy PrivacyContext
+	// Video holds the video player constraints for the request: the placement's
+	// settings narrowed by imp.video. Nil when neither specifies any.
+	Video *VideoPlacement
+	// Pod holds the ads already selected for the current video ad pod so the
+	// next ad can be kept apart from them. Nil outside pods.
+	Pod *PodSeparation
+	// Native is the placement's native request. Nil when it declares none.
+	Native *NativeRequest
+	// Sizes lists the creative sizes the request accepts. Empty means the
+	// width and height passed to the selector, or the placement's sizes.
+	Sizes []Format
 }
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Template variable types. Values are checked against their type when a
+// creative is saved.
+const (
+	// TemplateVarText is plain text.
+	TemplateVarText = "text"
+	// TemplateVarURL is an absolute http or https URL.
+	TemplateVarURL = "url"
+	// TemplateVarImage is the absolute http or https URL of an image.
+	TemplateVarImage = "image"
+	// TemplateVarColor is a CSS hex color such as #fff or #1a2b3c.
+	TemplateVarColor = "color"
+	// TemplateVarNumber is a decimal number, passed to the template as a
+	// float64.
+	TemplateVarNumber = "number"
+)
+
+var (
+	templateVarName  = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	templateVarColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+)
+
+// CreativeTemplate is a publisher-defined Go html/template that builds ad
+// markup from the values a creative supplies for its declared variables.
+// Creatives that reference a template are served with the rendered HTML,
+// so ads can be built from forms instead of hand-written markup.
+type CreativeTemplate struct {
+	ID          int    `json:"id"`
+	PublisherID int    `json:"publisher_id"`
+	Name        string `json:"name"`
+	// Format is the creative format the template builds: "html", "banner"
+	// or "native". Creatives using the template take it as their format.
+	Format string `json:"format"`
+	// Body is the html/template source. Variables are referenced as
+	// {{.name}}; values are escaped for the context they appear in.
+	Body      string             `json:"body"`
+	Variables []TemplateVariable `json:"variables"`
+}
+
+// TemplateVariable declares one value a creative supplies to a template.
+type TemplateVariable struct {
+	// Name is how the template references the value, e.g. "headline" for
+	// {{.headline}}.
+	Name string `json:"name"`
+	// Type is one of the TemplateVar* types.
+	Type string `json:"type"`
+	// Label is shown next to the variable's form field.
+	Label    string `json:"label,omitempty"`
+	Required bool   `json:"required,omitempty"`
+	// MaxLength limits text values in characters; zero means no limit.
+	MaxLength int `json:"max_length,omitempty"`
+	// Default is used when a creative leaves the variable out.
+	Default string `json:"default,omitempty"`
+}
+
+// Validate checks the template's format and variable declarations. The body
+// is checked by render.CheckTemplate.
+func (t *CreativeTemplate) Validate() error {
+	switch t.Format {
+	case "html", "banner", FormatNative:
+	default:
+		return fmt.Errorf("template format must be html, banner or native, got %q", t.Format)
+	}
+	if t.Body == "" {
+		return errors.New("template body is required")
+	}
+	seen := make(map[string]bool, len(t.Variables))
+	for _, v := range t.Variables {
+		if !templateVarName.MatchString(v.Name) {
+			return fmt.Errorf("invalid template variable name %q", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("duplicate template variable %q", v.Name)
+		}
+		seen[v.Name] = true
+		if v.MaxLength < 0 {
+			return fmt.Errorf("template variable %s: max_length must not be negative", v.Name)
+		}
+		switch v.Type {
+		case TemplateVarText, TemplateVarURL, TemplateVarImage, TemplateVarColor, TemplateVarNumber:
+		default:
+			return fmt.Errorf("template variable %s: unknown type %q", v.Name, v.Type)
+		}
+		if v.Default != "" {
+			if err := v.check(v.Default); err != nil {
+				return fmt.Errorf("template variable %s: default: %w", v.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckValues checks a creative's values against the declared variables:
+// every value must be declared and of its variable's type, and required
+// variables without a default must have a value.
+func (t *CreativeTemplate) CheckValues(values map[string]string) error {
+	declared := make(map[string]bool, len(t.Variables))
+	for _, v := range t.Variables {
+		declared[v.Name] = true
+		value, ok := values[v.Name]
+		if !ok || value == "" {
+			if v.Required && v.Default == "" {
+				return fmt.Errorf("template variable %s is required", v.Name)
+			}
+			continue
+		}
+		if err := v.check(value); err != nil {
+			return fmt.Errorf("template variable %s: %w", v.Name, err)
+		}
+	}
+	for name := range values {
+		if !declared[name] {
+			return fmt.Errorf("template %d has no variable %q", t.ID, name)
+		}
+	}
+	return nil
+}
+
+// Data returns the values to execute the template with: every declared
+// variable, taking its default when the creative leaves it out, with
+// numbers as float64 and everything else as strings.
+func (t *CreativeTemplate) Data(values map[string]string) map[string]any {
+	data := make(map[string]any, len(t.Variables))
+	for _, v := range t.Variables {
+		value := values[v.Name]
+		if value == "" {
+			value = v.Default
+		}
+		if v.Type == TemplateVarNumber {
+			n, _ := strconv.ParseFloat(value, 64)
+			data[v.Name] = n
+			continue
+		}
+		data[v.Name] = value
+	}
+	return data
+}
+
+// SampleValues returns a valid value of each variable, used to check that a
+// template renders.
+func (t *CreativeTemplate) SampleValues() map[string]string {
+	values := make(map[string]string, len(t.Variables))
+	for _, v := range t.Variables {
+		switch {
+		case v.Default != "":
+			values[v.Name] = v.Default
+		case v.Type == TemplateVarURL || v.Type == TemplateVarImage:
+			values[v.Name] = "https://example.com/" + v.Name
+		case v.Type == TemplateVarColor:
+			values[v.Name] = "#000000"
+		case v.Type == TemplateVarNumber:
+			values[v.Name] = "1"
+		case v.MaxLength > 0 && len(v.Name) > v.MaxLength:
+			values[v.Name] = v.Name[:v.MaxLength]
+		default:
+			values[v.Name] = v.Name
+		}
+	}
+	return values
+}
+
+// check validates a non-empty value against the variable's type.
+func (v TemplateVariable) check(value string) error {
+	switch v.Type {
+	case TemplateVarText:
+		if v.MaxLength > 0 && utf8.RuneCountInString(value) > v.MaxLength {
+			return fmt.Errorf("longer than %d characters", v.MaxLength)
+		}
+	case TemplateVarURL, TemplateVarImage:
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%q is not an absolute http or https url", value)
+		}
+	case TemplateVarColor:
+		if !templateVarColor.MatchString(value) {
+			return fmt.Errorf("%q is not a hex color", value)
+		}
+	case TemplateVarNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", v.Type)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import "testing"
+
+func testTemplate() CreativeTemplate {
+	return CreativeTemplate{ID: 4, PublisherID: 1, Name: "Promo", Format: "banner",
+		Body: `<a href="{{.link}}" style="color: {{.color}}">{{.headline}}</a>`,
+		Variables: []TemplateVariable{
+			{Name: "headline", Type: TemplateVarText, Required: true, MaxLength: 20},
+			{Name: "link", Type: TemplateVarURL, Required: true},
+			{Name: "color", Type: TemplateVarColor, Default: "#333"},
+			{Name: "price", Type: TemplateVarNumber},
+		}}
+}
+
+func TestCreativeTemplateValidate(t *testing.T) {
+	tmpl := testTemplate()
+	if err := tmpl.Validate(); err != nil {
+		t.Fatalf("expected a valid template, got %v", err)
+	}
+
+	cases := map[string]func(*CreativeTemplate){
+		"format":         func(t *CreativeTemplate) { t.Format = "video" },
+		"body":           func(t *CreativeTemplate) { t.Body = "" },
+		"name":           func(t *CreativeTemplate) { t.Variables[0].Name = "head-line" },
+		"duplicate":      func(t *CreativeTemplate) { t.Variables[1].Name = "headline" },
+		"type":           func(t *CreativeTemplate) { t.Variables[0].Type = "html" },
+		"default":        func(t *CreativeTemplate) { t.Variables[2].Default = "red" },
+		"max length":     func(t *CreativeTemplate) { t.Variables[0].MaxLength = -1 },
+		"number default": func(t *CreativeTemplate) { t.Variables[3].Default = "ten" },
+	}
+	for name, mutate := range cases {
+		tmpl := testTemplate()
+		tmpl.Variables = append([]TemplateVariable(nil), tmpl.Variables...)
+		mutate(&tmpl)
+		if err := tmpl.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCreativeTemplateCheckValues(t *testing.T) {
+	tmpl := testTemplate()
+	valid := map[string]string{"headline": "Summer sale", "link": "https://brand.example/?c={CREATIVE_ID}", "price": "9.99"}
+	if err := tmpl.CheckValues(valid); err != nil {
+		t.Fatalf("expected valid values, got %v", err)
+	}
+
+	invalid := []map[string]string{
+		{"link": "https://brand.example"},
+		{"headline": "A headline that is far too long", "link": "https://brand.example"},
+		{"headline": "Sale", "link": "javascript:alert(1)"},
+		{"headline": "Sale", "link": "https://brand.example", "color": "red"},
+		{"headline": "Sale", "link": "https://brand.example", "price": "cheap"},
+		{"headline": "Sale", "link": "https://brand.example", "subtitle": "x"},
+	}
+	for _, values := range invalid {
+		if err := tmpl.CheckValues(values); err == nil {
+			t.Errorf("expected an error for %v", values)
+		}
+	}
+
+	data := tmpl.Data(valid)
+	if data["color"] != "#333" || data["price"] != 9.99 || data["headline"] != "Summer sale" {
+		t.Errorf("unexpected template data %v", data)
+	}
+	if err := tmpl.CheckValues(tmpl.SampleValues()); err != nil {
+		t.Errorf("sample values should be valid, got %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// FormatVideo is the creative and placement format for VAST video ads.
+const FormatVideo = "video"
+
+// OpenRTB protocol IDs for the VAST 4.x inline responses this server returns.
+const (
+	ProtocolVAST40 = 7
+	ProtocolVAST41 = 11
+	ProtocolVAST42 = 13
+)
+
+// VideoCreative describes the media of a video creative. The player picks the
+// media file that best suits its size and connection.
+type VideoCreative struct {
+	// Duration is the length of the video in seconds.
+	Duration int `json:"duration"`
+	// MediaFiles lists the available encodings of the video.
+	MediaFiles []MediaFile `json:"media_files"`
+	// VASTTagURL is a third-party VAST tag served instead of media files. The
+	// tag is wrapped in a VAST Wrapper carrying our tracking.
+	VASTTagURL string `json:"vast_tag_url,omitempty"`
+}
+
+// MediaFile is one encoding of a video creative.
+type MediaFile struct {
+	URL string `json:"url"`
+	// MIME is the file's content type, e.g. "video/mp4".
+	MIME string `json:"mime"`
+	// Bitrate is the average bitrate in kbps.
+	Bitrate int `json:"bitrate,omitempty"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	// Delivery is "progressive" (the default) or "streaming".
+	Delivery string `json:"delivery,omitempty"`
+}
+
+// VideoPlacement holds the player constraints of a video placement. Zero
+// values leave a constraint open.
+type VideoPlacement struct {
+	// MinDuration and MaxDuration bound the creative duration in seconds.
+	MinDuration int `json:"min_duration,omitempty"`
+	MaxDuration int `json:"max_duration,omitempty"`
+	// MIMEs lists the media types the player can play, e.g. ["video/mp4"].
+	MIMEs []string `json:"mimes,omitempty"`
+	// Protocols lists the OpenRTB protocol IDs the player supports. Video
+	// only serves when it includes a VAST 4.x protocol (7, 11 or 13).
+	Protocols []int `json:"protocols,omitempty"`
+	// Skippable lets viewers skip the ad after SkipAfter seconds.
+	Skippable bool `json:"skippable,omitempty"`
+	SkipAfter int  `json:"skip_after,omitempty"`
+	// PodSize is the most ads played back to back in one break. Values above
+	// one return an ad pod. PodDuration caps the pod's total length in
+	// seconds.
+	PodSize     int `json:"pod_size,omitempty"`
+	PodDuration int `json:"pod_duration,omitempty"`
+}
+
+// PodSeparation keeps competing ads apart within an ad pod. It records the
+// line items and advertisers already in the pod.
+type PodSeparation struct {
+	lineItems map[int]bool
+	adomains  map[string]bool
+}
+
+// Add records an ad placed in the pod.
+func (p *PodSeparation) Add(lineItemID int, adomain string) {
+	if p.lineItems == nil {
+		p.lineItems = make(map[int]bool)
+		p.adomains = make(map[string]bool)
+	}
+	p.lineItems[lineItemID] = true
+	if adomain != "" {
+		p.adomains[adomain] = true
+	}
+}
+
+// Allows reports whether an ad from the line item and advertiser may join
+// the pod. A nil PodSeparation allows everything.
+func (p *PodSeparation) Allows(lineItemID int, adomain string) bool {
+	if p == nil {
+		return true
+	}
+	return !p.lineItems[lineItemID] && (adomain == "" || !p.adomains[adomain])
+}
+
+// Validate checks that the video creative has a duration and playable media files.
+func (v *VideoCreative) Validate() error {
+	if v == nil {
+		return errors.New("video creative requires video")
+	}
+	if v.Duration <= 0 {
+		return errors.New("video duration must be positive")
+	}
+	if v.VASTTagURL != "" {
+		if len(v.MediaFiles) > 0 {
+			return errors.New("video requires either media files or a vast tag url, not both")
+		}
+		u, err := url.Parse(v.VASTTagURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("vast tag url must be an absolute http or https url")
+		}
+		return nil
+	}
+	if len(v.MediaFiles) == 0 {
+		return errors.New("video requires at least one media file or a vast tag url")
+	}
+	for i, mf := range v.MediaFiles {
+		if mf.URL == "" || mf.MIME == "" {
+			return fmt.Errorf("media file %d requires url and mime", i)
+		}
+		if mf.Delivery != "" && mf.Delivery != "progressive" && mf.Delivery != "streaming" {
+			return fmt.Errorf("media file %d: delivery must be progressive or streaming", i)
+		}
+	}
+	return nil
+}
+
+// Narrow returns the placement constraints combined with those sent in the
+// request's imp.video object. Durations only tighten the placement's; MIME
+// types and protocols describe the requesting player and replace them.
+func (p *VideoPlacement) Narrow(imp *ImpVideo) *VideoPlacement {
+	if imp == nil {
+		return p
+	}
+	out := VideoPlacement{}
+	if p != nil {
+		out = *p
+	}
+	if imp.MinDuration > out.MinDuration {
+		out.MinDuration = imp.MinDuration
+	}
+	if imp.MaxDuration > 0 && (out.MaxDuration == 0 || imp.MaxDuration < out.MaxDuration) {
+		out.MaxDuration = imp.MaxDuration
+	}
+	if len(imp.MIMEs) > 0 {
+		out.MIMEs = imp.MIMEs
+	}
+	if len(imp.Protocols) > 0 {
+		out.Protocols = imp.Protocols
+	}
+	if imp.Skip != nil {
+		out.Skippable = *imp.Skip == 1
+		if imp.SkipAfter > 0 {
+			out.SkipAfter = imp.SkipAfter
+		}
+	}
+	if imp.MaxSeq > 0 {
+		out.PodSize = imp.MaxSeq
+	}
+	if imp.PodDur > 0 && (out.PodDuration == 0 || imp.PodDur < out.PodDuration) {
+		out.PodDuration = imp.PodDur
+	}
+	return &out
+}
+
+// IsPod reports whether the break holds more than one ad.
+func (p *VideoPlacement) IsPod() bool {
+	return p != nil && p.PodSize > 1
+}
+
+// Slot returns the constraints for the next ad of a pod once used seconds
+// of the pod have been filled, or nil when no ad fits in the time left.
+func (p *VideoPlacement) Slot(used int) *VideoPlacement {
+	if p == nil || p.PodDuration == 0 {
+		return p
+	}
+	left := p.PodDuration - used
+	if left <= 0 || left < p.MinDuration {
+		return nil
+	}
+	out := *p
+	if out.MaxDuration == 0 || left < out.MaxDuration {
+		out.MaxDuration = left
+	}
+	return &out
+}
+
+// Imp converts the constraints to the OpenRTB Video object sent to
+// programmatic bidders for a player of the given size.
+func (p *VideoPlacement) Imp(width, height int) *ImpVideo {
+	imp := &ImpVideo{W: width, H: height}
+	if p == nil {
+		return imp
+	}
+	skip := 0
+	if p.Skippable {
+		skip = 1
+		imp.SkipAfter = p.SkipAfter
+	}
+	imp.Skip = &skip
+	imp.MIMEs = p.MIMEs
+	imp.MinDuration = p.MinDuration
+	imp.MaxDuration = p.MaxDuration
+	imp.Protocols = p.Protocols
+	return imp
+}
+
+// Accepts reports whether a video creative fits the constraints.
+func (p *VideoPlacement) Accepts(v *VideoCreative) bool {
+	if v == nil {
+		return false
+	}
+	if p == nil {
+		return true
+	}
+	if p.MinDuration > 0 && v.Duration < p.MinDuration {
+		return false
+	}
+	if p.MaxDuration > 0 && v.Duration > p.MaxDuration {
+		return false
+	}
+	if !p.SupportsVAST() {
+		return false
+	}
+	// Media files of third-party tags are only known to the player
+	if len(p.MIMEs) == 0 || len(v.MediaFiles) == 0 {
+		return true
+	}
+	for _, mf := range v.MediaFiles {
+		if containsAny(p.MIMEs, []string{mf.MIME}) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsVAST reports whether the player accepts the VAST 4.x documents
+// returned by this server.
+func (p *VideoPlacement) SupportsVAST() bool {
+	return p == nil || len(p.Protocols) == 0 || containsAny(p.Protocols, []int{ProtocolVAST40, ProtocolVAST41, ProtocolVAST42})
+}
+
+func containsAny[T comparable](list, values []T) bool {
+	for _, l := range list {
+		for _, v := range values {
+			if l == v {
+				return true
+			}
+		}
+	}
+	return false
+}
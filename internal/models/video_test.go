@@ -0,0 +1,41 @@
+package models
+
+import "testing"
+
+func TestVideoPlacementPod(t *testing.T) {
+	pl := &VideoPlacement{MinDuration: 5, MaxDuration: 30, PodSize: 4, PodDuration: 60}
+	p := pl.Narrow(&ImpVideo{MaxSeq: 3, PodDur: 45})
+	if !p.IsPod() || p.PodSize != 3 || p.PodDuration != 45 {
+		t.Fatalf("unexpected pod %+v", p)
+	}
+	if p.Narrow(&ImpVideo{PodDur: 90}).PodDuration != 45 {
+		t.Error("expected poddur to only shorten the pod")
+	}
+
+	for used, want := range map[int]int{0: 30, 20: 25, 38: 7} {
+		if s := p.Slot(used); s == nil || s.MaxDuration != want {
+			t.Errorf("Slot(%d) = %+v, want max duration %d", used, s, want)
+		}
+	}
+	if p.Slot(41) != nil || p.Slot(45) != nil {
+		t.Error("expected no slot once less than the minimum duration is left")
+	}
+	if (&VideoPlacement{PodSize: 1}).IsPod() {
+		t.Error("a single ad break is not a pod")
+	}
+}
+
+func TestVideoCreativeValidate_Tag(t *testing.T) {
+	if err := (&VideoCreative{Duration: 15, VASTTagURL: "https://adserver.example/vast?id=1"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, v := range []*VideoCreative{
+		{Duration: 15, VASTTagURL: "/vast"},
+		{VASTTagURL: "https://adserver.example/vast"},
+		{Duration: 15, VASTTagURL: "https://adserver.example/vast", MediaFiles: []MediaFile{{URL: "https://cdn.example/a.mp4", MIME: "video/mp4"}}},
+	} {
+		if err := v.Validate(); err == nil {
+			t.Errorf("expected error for %+v", v)
+		}
+	}
+}
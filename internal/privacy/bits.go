@@ -0,0 +1,82 @@
+package privacy
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// errShortString is returned when an encoded string ends before all fields were read.
+var errShortString = errors.New("encoded string too short")
+
+// bitReader reads big-endian bit fields from the decoded bytes of an IAB
+// consent string.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+// decodeWebSafe decodes the unpadded websafe base64 used by TCF and GPP.
+// The fields are a bit stream rather than whole bytes, so the input is
+// right-padded with zero characters to keep the trailing bits that a plain
+// base64 decode would drop.
+func decodeWebSafe(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if rem := len(s) % 4; rem != 0 {
+		s += strings.Repeat("A", 4-rem)
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// readInt reads n bits (n <= 64) as an unsigned integer.
+func (r *bitReader) readInt(n int) (uint64, error) {
+	if r.pos+n > len(r.data)*8 {
+		return 0, errShortString
+	}
+	var v uint64
+	for i := 0; i < n; i++ {
+		byteIdx := (r.pos + i) / 8
+		bitIdx := 7 - uint((r.pos+i)%8)
+		v = v<<1 | uint64((r.data[byteIdx]>>bitIdx)&1)
+	}
+	r.pos += n
+	return v, nil
+}
+
+// readBool reads a single bit.
+func (r *bitReader) readBool() (bool, error) {
+	v, err := r.readInt(1)
+	return v == 1, err
+}
+
+// skip advances the reader by n bits.
+func (r *bitReader) skip(n int) error {
+	if r.pos+n > len(r.data)*8 {
+		return errShortString
+	}
+	r.pos += n
+	return nil
+}
+
+// readFibonacci reads a Fibonacci-coded integer as used by GPP ranges. Each
+// set bit adds the matching Fibonacci number (1, 2, 3, 5, ...) and two
+// consecutive set bits terminate the value.
+func (r *bitReader) readFibonacci() (int, error) {
+	a, b := 1, 2
+	value := 0
+	prev := false
+	for {
+		bit, err := r.readBool()
+		if err != nil {
+			return 0, err
+		}
+		if bit && prev {
+			return value, nil
+		}
+		if bit {
+			value += a
+		}
+		prev = bit
+		a, b = b, a+b
+	}
+}
@@ -0,0 +1,111 @@
+// Package privacy parses IAB consent signals (TCF v2, US Privacy and GPP) and
+// turns them into the privacy decision used during ad serving.
+package privacy
+
+import (
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// Evaluate derives the privacy decision for an ad request from its regs and
+// user objects.
+//
+// Under GDPR the user identifier may only be used when the TCF string is valid
+// and grants Purpose 1; otherwise the request is served without user data and
+// only vendors the user consented to may bid. Outside GDPR a US opt-out (via
+// us_privacy or the GPP US National section) also restricts user data.
+//
+// A request flagged with regs.coppa=1 is treated as child-directed regardless
+// of consent; see ApplyCOPPA.
+func Evaluate(regs models.Regs, user models.User) models.PrivacyContext {
+	pc := evaluateConsent(regs, user)
+	if regs.COPPA == 1 {
+		ApplyCOPPA(&pc)
+	}
+	return pc
+}
+
+// ApplyCOPPA marks a privacy decision as child-directed. User data is never
+// used and only line items marked COPPA-safe may serve.
+func ApplyCOPPA(pc *models.PrivacyContext) {
+	pc.COPPA = true
+	pc.RestrictUserData = true
+	pc.Status = models.ConsentCOPPA
+}
+
+func evaluateConsent(regs models.Regs, user models.User) models.PrivacyContext {
+	pc := models.PrivacyContext{
+		TCFConsent: firstNonEmpty(user.Consent, user.Ext.Consent),
+		USPrivacy:  firstNonEmpty(regs.USPrivacy, regs.Ext.USPrivacy),
+		GPP:        regs.GPP,
+		GPPSID:     regs.GPPSID,
+		Status:     models.ConsentNotApplicable,
+	}
+
+	gdpr := regs.GDPR
+	if gdpr == nil {
+		gdpr = regs.Ext.GDPR
+	}
+	pc.GDPRApplies = gdpr != nil && *gdpr == 1
+
+	usSignal := false
+	usOptOut := false
+
+	if pc.GPP != "" {
+		if g, err := ParseGPP(pc.GPP); err == nil {
+			if g.Applies(SectionTCFEUv2, pc.GPPSID) {
+				pc.GDPRApplies = true
+				if pc.TCFConsent == "" {
+					pc.TCFConsent = g.Section(SectionTCFEUv2)
+				}
+			}
+			if pc.USPrivacy == "" && g.Applies(SectionUSPrivacy, pc.GPPSID) {
+				pc.USPrivacy = g.Section(SectionUSPrivacy)
+			}
+			if g.Applies(SectionUSNational, pc.GPPSID) {
+				usSignal = true
+				if n, err := ParseUSNational(g.Section(SectionUSNational)); err == nil && n.OptedOut() {
+					usOptOut = true
+				}
+			}
+		}
+	}
+
+	if pc.GDPRApplies {
+		tcf, err := ParseTCF(pc.TCFConsent)
+		if err != nil || !tcf.PurposeConsent(PurposeStoreAccess) {
+			pc.Status = models.ConsentDenied
+			pc.RestrictUserData = true
+			return pc
+		}
+		pc.Status = models.ConsentGranted
+		pc.VendorConsents = tcf.VendorConsents
+		return pc
+	}
+
+	if pc.USPrivacy != "" {
+		if usp, err := ParseUSPrivacy(pc.USPrivacy); err == nil && usp.Applies() {
+			usSignal = true
+			if usp.OptedOut() {
+				usOptOut = true
+			}
+		}
+	}
+
+	switch {
+	case usOptOut:
+		pc.Status = models.ConsentOptedOut
+		pc.RestrictUserData = true
+	case usSignal:
+		pc.Status = models.ConsentGranted
+	}
+	return pc
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
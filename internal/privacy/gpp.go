@@ -0,0 +1,170 @@
+package privacy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GPP section IDs interpreted by the ad server. Other sections are kept but
+// not decoded.
+const (
+	SectionTCFEUv2    = 2 // IAB TCF EU v2, same encoding as a TCF consent string
+	SectionUSPrivacy  = 6 // US Privacy string, same encoding as regs.us_privacy
+	SectionUSNational = 7 // US National privacy section
+)
+
+// maxSectionID bounds the section IDs accepted in a GPP header. Assigned IDs
+// are far below it; the bound keeps a crafted header from listing billions.
+const maxSectionID = 64
+
+// GPP is a decoded Global Privacy Platform string.
+type GPP struct {
+	SectionIDs []int
+	sections   map[int]string
+}
+
+// ParseGPP decodes the GPP header and splits the string into its sections.
+func ParseGPP(s string) (*GPP, error) {
+	parts := strings.Split(s, "~")
+	data, err := decodeWebSafe(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("decode gpp header: %w", err)
+	}
+	r := &bitReader{data: data}
+	typ, err := r.readInt(6)
+	if err != nil {
+		return nil, err
+	}
+	if typ != 3 {
+		return nil, fmt.Errorf("unexpected gpp header type %d", typ)
+	}
+	if _, err := r.readInt(6); err != nil { // version
+		return nil, err
+	}
+	ids, err := readFibonacciRange(r)
+	if err != nil {
+		return nil, fmt.Errorf("gpp section ids: %w", err)
+	}
+	if len(ids) != len(parts)-1 {
+		return nil, errors.New("gpp section count does not match header")
+	}
+	g := &GPP{SectionIDs: ids, sections: make(map[int]string, len(ids))}
+	for i, id := range ids {
+		g.sections[id] = parts[i+1]
+	}
+	return g, nil
+}
+
+// Section returns the encoded section with the given ID, or "" if absent.
+func (g *GPP) Section(id int) string {
+	if g == nil {
+		return ""
+	}
+	return g.sections[id]
+}
+
+// Applies reports whether a section is present and, when the request lists
+// applicable sections (regs.gpp_sid), whether it is one of them.
+func (g *GPP) Applies(id int, applicable []int) bool {
+	if g.Section(id) == "" {
+		return false
+	}
+	if len(applicable) == 0 {
+		return true
+	}
+	for _, sid := range applicable {
+		if sid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// readFibonacciRange decodes the GPP "Range (Fibonacci)" encoding. Each ID is
+// stored as an offset from the previous one. IDs above maxSectionID are
+// rejected, so the result never holds more than maxSectionID IDs.
+func readFibonacciRange(r *bitReader) ([]int, error) {
+	count, err := r.readInt(12)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	last := 0
+	for i := 0; i < int(count); i++ {
+		isRange, err := r.readBool()
+		if err != nil {
+			return nil, err
+		}
+		offset, err := r.readFibonacci()
+		if err != nil {
+			return nil, err
+		}
+		if offset <= 0 || offset > maxSectionID-last {
+			return nil, fmt.Errorf("section id offset %d out of range", offset)
+		}
+		start := last + offset
+		end := start
+		if isRange {
+			length, err := r.readFibonacci()
+			if err != nil {
+				return nil, err
+			}
+			if length < 0 || length > maxSectionID-start {
+				return nil, fmt.Errorf("section id range length %d out of range", length)
+			}
+			end = start + length
+		}
+		for id := start; id <= end; id++ {
+			ids = append(ids, id)
+		}
+		last = end
+	}
+	return ids, nil
+}
+
+// USNational is the subset of the GPP US National section used for opt-outs.
+// Opt-out fields use 0 for not applicable, 1 for opted out and 2 for did not opt out.
+type USNational struct {
+	Version                   int
+	SaleOptOut                int
+	SharingOptOut             int
+	TargetedAdvertisingOptOut int
+}
+
+// ParseUSNational decodes the core subsection of a GPP US National section.
+func ParseUSNational(s string) (USNational, error) {
+	core := s
+	if i := strings.IndexByte(core, '.'); i >= 0 {
+		core = core[:i]
+	}
+	data, err := decodeWebSafe(core)
+	if err != nil {
+		return USNational{}, fmt.Errorf("decode usnat section: %w", err)
+	}
+	r := &bitReader{data: data}
+	var out USNational
+	v, err := r.readInt(6)
+	if err != nil {
+		return out, err
+	}
+	out.Version = int(v)
+	// Six two-bit notice fields precede the opt-out fields.
+	if err := r.skip(12); err != nil {
+		return out, err
+	}
+	fields := []*int{&out.SaleOptOut, &out.SharingOptOut, &out.TargetedAdvertisingOptOut}
+	for _, f := range fields {
+		v, err := r.readInt(2)
+		if err != nil {
+			return out, err
+		}
+		*f = int(v)
+	}
+	return out, nil
+}
+
+// OptedOut reports whether the user opted out of sale, sharing or targeted advertising.
+func (u USNational) OptedOut() bool {
+	return u.SaleOptOut == 1 || u.SharingOptOut == 1 || u.TargetedAdvertisingOptOut == 1
+}
@@ -0,0 +1,17 @@
+package privacy
+
+import "net"
+
+// AnonymizeIP truncates an IP address so it no longer identifies a single
+// device: IPv4 addresses lose their last octet and IPv6 addresses their last
+// 80 bits. An empty string is returned for input that is not an IP address.
+func AnonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,410 @@
+package privacy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/patrickwarner/openadserve/internal/analytics"
+	"github.com/patrickwarner/openadserve/internal/db"
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// UserKeyPatterns lists the Redis key patterns that hold per-user data. The %s
+// verb is replaced with the user ID, escaped so it matches literally.
+var UserKeyPatterns = []string{
+	"freqcap:%s:*",     // frequency cap counters, one per line item
+	"segments:%s",      // segment memberships written by audience integrations
+	"ivt:user:%s:*",    // invalid traffic request velocity counters
+	"conv:view:%s:*",   // latest impression per campaign for post-view attribution
+	"conv:uclick:%s:*", // latest click per campaign for post-click attribution
+}
+
+// Keys holding a user's clicks are named by click ID rather than user ID and
+// are found through the conv:uclick pointers, whose values are click IDs.
+const (
+	userClickPrefix = "conv:uclick:"
+	clickPrefix     = "conv:click:"
+)
+
+// erasedKeyPrefix marks users whose data was deleted. Tracking tokens issued
+// before the deletion stay valid until they expire, and clicks remembered for
+// conversion attribution may outlive the pointer the deletion follows, so
+// events arriving for them are recorded without the user ID while the marker
+// exists.
+const erasedKeyPrefix = "privacy:erased:"
+
+// Audit store names used in privacy job audit entries.
+const (
+	auditRedis      = "redis"
+	auditPostgres   = "postgres"
+	auditClickHouse = "clickhouse"
+	auditTokens     = "tokens"
+)
+
+// UserDataExport is the result of an export job.
+type UserDataExport struct {
+	UserID    string                  `json:"user_id"`
+	RedisKeys map[string]interface{}  `json:"redis_keys"`
+	AdReports []models.AdReport       `json:"ad_reports"`
+	Events    []analytics.EventRecord `json:"events"`
+}
+
+// JobRunner executes user data deletion and export jobs. Jobs are persisted in
+// Postgres and run in the background; every step is written to the job's
+// audit trail.
+type JobRunner struct {
+	Redis     *redis.Client
+	PG        *db.Postgres
+	Analytics analytics.AnalyticsService
+	// EraseTTL is how long a deleted user's ID is kept off events issued
+	// before the deletion: the longest of the token TTL and the conversion
+	// attribution windows.
+	EraseTTL time.Duration
+	// ExportTTL is how long an export's result is returned with its job. The
+	// retention purge removes it from Postgres; zero keeps it.
+	ExportTTL time.Duration
+	Logger    *zap.Logger
+}
+
+// NewJobRunner creates a JobRunner. Redis may be nil, in which case the Redis
+// steps are recorded as skipped.
+func NewJobRunner(rdb *redis.Client, pg *db.Postgres, analyticsSvc analytics.AnalyticsService, eraseTTL, exportTTL time.Duration, logger *zap.Logger) *JobRunner {
+	return &JobRunner{
+		Redis:     rdb,
+		PG:        pg,
+		Analytics: analyticsSvc,
+		EraseTTL:  eraseTTL,
+		ExportTTL: exportTTL,
+		Logger:    logger,
+	}
+}
+
+// SubjectHash returns the identifier stored with jobs instead of the raw user ID.
+func SubjectHash(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:])
+}
+
+// Submit records a new job for the user and starts it in the background.
+func (r *JobRunner) Submit(jobType, userID string) (*models.PrivacyJob, error) {
+	if jobType != models.PrivacyJobDelete && jobType != models.PrivacyJobExport {
+		return nil, fmt.Errorf("unknown privacy job type %q", jobType)
+	}
+	job := &models.PrivacyJob{
+		Type:        jobType,
+		Status:      models.PrivacyJobPending,
+		SubjectHash: SubjectHash(userID),
+	}
+	if err := r.PG.InsertPrivacyJob(job); err != nil {
+		return nil, err
+	}
+	go r.run(*job, userID)
+	return job, nil
+}
+
+// Get returns a job and its audit trail, or nil if it does not exist. Export
+// results are left out once they are older than ExportTTL.
+func (r *JobRunner) Get(id int) (*models.PrivacyJob, error) {
+	job, err := r.PG.GetPrivacyJob(id)
+	if err != nil || job == nil {
+		return job, err
+	}
+	expireResult(job, r.ExportTTL, time.Now())
+	return job, nil
+}
+
+// expireResult drops the result of an export completed more than ttl before
+// now, which the retention purge may not have removed yet.
+func expireResult(job *models.PrivacyJob, ttl time.Duration, now time.Time) {
+	if ttl > 0 && job.CompletedAt != nil && now.Sub(*job.CompletedAt) > ttl {
+		job.Result = nil
+	}
+}
+
+// run executes a job and stores its outcome. The first failing step fails the
+// job; completed steps stay in the audit trail and every step is safe to
+// repeat, so a failed job can simply be resubmitted.
+func (r *JobRunner) run(job models.PrivacyJob, userID string) {
+	ctx := context.Background()
+	logger := r.Logger.With(zap.Int("privacy_job_id", job.ID), zap.String("type", job.Type))
+
+	job.Status = models.PrivacyJobRunning
+	if err := r.PG.UpdatePrivacyJob(job); err != nil {
+		logger.Error("update privacy job", zap.Error(err))
+	}
+
+	var err error
+	switch job.Type {
+	case models.PrivacyJobDelete:
+		err = r.runDelete(ctx, job.ID, userID)
+	case models.PrivacyJobExport:
+		job.Result, err = r.runExport(ctx, job.ID, userID)
+	}
+
+	now := time.Now().UTC()
+	job.CompletedAt = &now
+	job.Status = models.PrivacyJobCompleted
+	if err != nil {
+		job.Status = models.PrivacyJobFailed
+		job.Error = err.Error()
+		logger.Error("privacy job failed", zap.Error(err))
+	} else {
+		logger.Info("privacy job completed")
+	}
+	if err := r.PG.UpdatePrivacyJob(job); err != nil {
+		logger.Error("update privacy job", zap.Error(err))
+	}
+}
+
+// runDelete marks the user as erased first so tracking events arriving while
+// the job runs cannot recreate the data being deleted.
+func (r *JobRunner) runDelete(ctx context.Context, jobID int, userID string) error {
+	if err := r.expireTokens(ctx, jobID, userID); err != nil {
+		return err
+	}
+
+	if r.Redis != nil {
+		n, err := deleteUserKeys(ctx, r.Redis, userID)
+		if err != nil {
+			return err
+		}
+		r.audit(jobID, auditRedis, "delete", n, "")
+	} else {
+		r.audit(jobID, auditRedis, "skip", 0, "redis unavailable")
+	}
+
+	n, err := r.PG.DeleteAdReportsByUser(userID)
+	if err != nil {
+		return err
+	}
+	r.audit(jobID, auditPostgres, "delete", n, "ad_reports")
+
+	// Earlier exports hold a copy of the data being deleted
+	n, err = r.PG.ClearPrivacyExports(SubjectHash(userID))
+	if err != nil {
+		return err
+	}
+	r.audit(jobID, auditPostgres, "delete", n, "privacy_jobs export results")
+
+	return r.deleteEvents(ctx, jobID, userID)
+}
+
+func (r *JobRunner) deleteEvents(ctx context.Context, jobID int, userID string) error {
+	if r.Analytics == nil {
+		return fmt.Errorf("clickhouse: %w", analytics.ErrUnavailable)
+	}
+	n, err := r.Analytics.DeleteEventsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	r.audit(jobID, auditClickHouse, "delete", n, "events; applied as an asynchronous mutation")
+	return nil
+}
+
+// expireTokens marks the user as erased until every token issued and every
+// click remembered so far has expired. Tokens are signed rather than stored,
+// so they cannot be revoked individually.
+func (r *JobRunner) expireTokens(ctx context.Context, jobID int, userID string) error {
+	if r.Redis == nil || r.EraseTTL <= 0 {
+		r.audit(jobID, auditTokens, "skip", 0, "tracking tokens expire on their own")
+		return nil
+	}
+	if err := markErased(ctx, r.Redis, userID, r.EraseTTL); err != nil {
+		return err
+	}
+	r.audit(jobID, auditTokens, "expire", 0, fmt.Sprintf("outstanding tokens and clicks ignore the user ID until they expire in %s", r.EraseTTL))
+	return nil
+}
+
+// markErased sets the user's erase marker for ttl.
+func markErased(ctx context.Context, rdb *redis.Client, userID string, ttl time.Duration) error {
+	if err := rdb.Set(ctx, erasedKeyPrefix+SubjectHash(userID), time.Now().Unix(), ttl).Err(); err != nil {
+		return fmt.Errorf("redis erase marker: %w", err)
+	}
+	return nil
+}
+
+// deleteUserKeys deletes the user's Redis keys and returns how many there were.
+func deleteUserKeys(ctx context.Context, rdb *redis.Client, userID string) (int64, error) {
+	keys, err := scanUserKeys(ctx, rdb, userID)
+	if err != nil {
+		return 0, fmt.Errorf("redis: %w", err)
+	}
+	if len(keys) > 0 {
+		if err := rdb.Del(ctx, keys...).Err(); err != nil {
+			return 0, fmt.Errorf("redis delete: %w", err)
+		}
+	}
+	return int64(len(keys)), nil
+}
+
+func (r *JobRunner) runExport(ctx context.Context, jobID int, userID string) (json.RawMessage, error) {
+	export := UserDataExport{
+		UserID:    userID,
+		RedisKeys: map[string]interface{}{},
+	}
+
+	if r.Redis != nil {
+		keys, err := scanUserKeys(ctx, r.Redis, userID)
+		if err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		for _, k := range keys {
+			v, err := readKey(ctx, r.Redis, k)
+			if err != nil {
+				return nil, fmt.Errorf("redis read %s: %w", k, err)
+			}
+			if v != nil {
+				export.RedisKeys[k] = v
+			}
+		}
+		r.audit(jobID, auditRedis, "export", int64(len(export.RedisKeys)), "")
+	} else {
+		r.audit(jobID, auditRedis, "skip", 0, "redis unavailable")
+	}
+
+	reports, err := r.PG.LoadAdReportsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.AdReports = reports
+	r.audit(jobID, auditPostgres, "export", int64(len(reports)), "ad_reports")
+
+	if r.Analytics == nil {
+		return nil, fmt.Errorf("clickhouse: %w", analytics.ErrUnavailable)
+	}
+	events, err := r.Analytics.GetEventsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Events = events
+	r.audit(jobID, auditClickHouse, "export", int64(len(events)), "events")
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		return nil, fmt.Errorf("marshal export: %w", err)
+	}
+	return data, nil
+}
+
+func (r *JobRunner) audit(jobID int, store, action string, records int64, detail string) {
+	e := models.PrivacyAuditEntry{Store: store, Action: action, Records: records, Detail: detail}
+	if err := r.PG.InsertPrivacyAudit(jobID, e); err != nil {
+		r.Logger.Error("insert privacy audit entry", zap.Int("privacy_job_id", jobID), zap.Error(err))
+	}
+}
+
+// scanUserKeys returns every Redis key matching UserKeyPatterns for the user,
+// followed by the clicks their conv:uclick keys point to.
+func scanUserKeys(ctx context.Context, rdb *redis.Client, userID string) ([]string, error) {
+	escaped := escapeGlob(userID)
+	seen := make(map[string]bool)
+	var keys, clickPointers []string
+	for _, pattern := range UserKeyPatterns {
+		iter := rdb.Scan(ctx, 0, fmt.Sprintf(pattern, escaped), 500).Iterator()
+		for iter.Next(ctx) {
+			if k := iter.Val(); !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+				if strings.HasPrefix(k, userClickPrefix) {
+					clickPointers = append(clickPointers, k)
+				}
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, k := range clickPointers {
+		clickID, err := rdb.Get(ctx, k).Result()
+		if errors.Is(err, redis.Nil) || clickID == "" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		clickKey := clickPrefix + clickID
+		if seen[clickKey] {
+			continue
+		}
+		n, err := rdb.Exists(ctx, clickKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			seen[clickKey] = true
+			keys = append(keys, clickKey)
+		}
+	}
+	return keys, nil
+}
+
+// readKey returns the value of a key in a JSON friendly form, or nil if the
+// key disappeared or has an unsupported type.
+func readKey(ctx context.Context, rdb *redis.Client, key string) (interface{}, error) {
+	typ, err := rdb.Type(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	switch typ {
+	case "string":
+		v, err = rdb.Get(ctx, key).Result()
+	case "set":
+		v, err = rdb.SMembers(ctx, key).Result()
+	case "hash":
+		v, err = rdb.HGetAll(ctx, key).Result()
+	case "list":
+		v, err = rdb.LRange(ctx, key, 0, -1).Result()
+	case "zset":
+		v, err = rdb.ZRange(ctx, key, 0, -1).Result()
+	default:
+		return nil, nil
+	}
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return v, err
+}
+
+// escapeGlob escapes the characters Redis treats specially in MATCH patterns.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// ErasedAfter reports whether the user's data was deleted at or after
+// issuedAt, meaning a tracking token issued then must not attach the user ID
+// to new records.
+func ErasedAfter(ctx context.Context, rdb *redis.Client, userID string, issuedAt time.Time) bool {
+	if rdb == nil || userID == "" {
+		return false
+	}
+	v, err := rdb.Get(ctx, erasedKeyPrefix+SubjectHash(userID)).Result()
+	if err != nil {
+		return false
+	}
+	erasedAt, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return false
+	}
+	return !issuedAt.After(time.Unix(erasedAt, 0))
+}
@@ -0,0 +1,164 @@
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/patrickwarner/openadserve/internal/conversion"
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func setupTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s, redis.NewClient(&redis.Options{Addr: s.Addr()})
+}
+
+func TestScanUserKeys(t *testing.T) {
+	s, rdb := setupTestRedis(t)
+	_ = s.Set("freqcap:user1:10", "3")
+	_ = s.Set("freqcap:user1:11", "1")
+	_, _ = s.SetAdd("segments:user1", "sports", "travel")
+	_ = s.Set("freqcap:user10:10", "5")
+	_ = s.Set("freqcap:user*:10", "2")
+	_ = s.Set("ctr:lineitem:10:imp", "100")
+
+	keys, err := scanUserKeys(context.Background(), rdb, "user1")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	sort.Strings(keys)
+	want := []string{"freqcap:user1:10", "freqcap:user1:11", "segments:user1"}
+	if len(keys) != len(want) {
+		t.Fatalf("keys = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("keys = %v, want %v", keys, want)
+		}
+	}
+
+	// Glob characters in the user ID must match literally.
+	keys, err = scanUserKeys(context.Background(), rdb, "user*")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "freqcap:user*:10" {
+		t.Fatalf("escaped scan matched %v", keys)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	s, rdb := setupTestRedis(t)
+	_ = s.Set("freqcap:u:1", "4")
+	_, _ = s.SetAdd("segments:u", "a")
+
+	v, err := readKey(context.Background(), rdb, "freqcap:u:1")
+	if err != nil || v != "4" {
+		t.Fatalf("string value = %v, %v", v, err)
+	}
+	v, err = readKey(context.Background(), rdb, "segments:u")
+	if members, ok := v.([]string); err != nil || !ok || len(members) != 1 || members[0] != "a" {
+		t.Fatalf("set value = %v, %v", v, err)
+	}
+	v, err = readKey(context.Background(), rdb, "missing")
+	if err != nil || v != nil {
+		t.Fatalf("missing key = %v, %v", v, err)
+	}
+}
+
+func TestErasedAfter(t *testing.T) {
+	_, rdb := setupTestRedis(t)
+	ctx := context.Background()
+
+	issued := time.Now().Add(-time.Minute)
+	if ErasedAfter(ctx, rdb, "user1", issued) {
+		t.Fatal("user should not be erased before the marker is set")
+	}
+	key := erasedKeyPrefix + SubjectHash("user1")
+	if err := rdb.Set(ctx, key, time.Now().Unix(), time.Hour).Err(); err != nil {
+		t.Fatalf("set marker: %v", err)
+	}
+	if !ErasedAfter(ctx, rdb, "user1", issued) {
+		t.Fatal("token issued before the deletion should be treated as erased")
+	}
+	if ErasedAfter(ctx, rdb, "user1", time.Now().Add(time.Minute)) {
+		t.Fatal("token issued after the deletion should keep the user ID")
+	}
+	if ErasedAfter(ctx, rdb, "user2", issued) {
+		t.Fatal("other users must not be affected")
+	}
+}
+
+func TestExpireResult(t *testing.T) {
+	now := time.Now()
+	completed := now.Add(-2 * time.Hour)
+	job := models.PrivacyJob{Type: models.PrivacyJobExport, Result: json.RawMessage(`{"user_id":"u1"}`), CompletedAt: &completed}
+
+	expireResult(&job, 3*time.Hour, now)
+	if job.Result == nil {
+		t.Fatal("result within the TTL should be kept")
+	}
+	expireResult(&job, 0, now)
+	if job.Result == nil {
+		t.Fatal("a zero TTL should keep the result")
+	}
+	expireResult(&job, time.Hour, now)
+	if job.Result != nil {
+		t.Fatal("result past the TTL should be dropped")
+	}
+}
+
+func TestDeleteUserKeys_Clicks(t *testing.T) {
+	_, rdb := setupTestRedis(t)
+	ctx := context.Background()
+	tracker := conversion.NewTracker(rdb, conversion.Config{PostClickWindow: 30 * 24 * time.Hour}, nil)
+
+	touch := conversion.Touch{RequestID: "req-1", ImpID: "1", LineItemID: 1, CampaignID: 1, UserID: "user1", Time: time.Now().Add(-time.Hour)}
+	earlier, err := tracker.RecordClick(ctx, touch)
+	if err != nil {
+		t.Fatalf("RecordClick: %v", err)
+	}
+	latest, err := tracker.RecordClick(ctx, touch)
+	if err != nil {
+		t.Fatalf("RecordClick: %v", err)
+	}
+
+	if err := markErased(ctx, rdb, "user1", 30*24*time.Hour); err != nil {
+		t.Fatalf("markErased: %v", err)
+	}
+	n, err := deleteUserKeys(ctx, rdb, "user1")
+	if err != nil {
+		t.Fatalf("deleteUserKeys: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected the click pointer and its click to be deleted, got %d keys", n)
+	}
+
+	// A conversion posted with the latest click ID is no longer attributed
+	if _, _, err := tracker.Attribute(ctx, latest, "", 0); !errors.Is(err, conversion.ErrNotAttributed) {
+		t.Fatalf("expected deleted click to be unattributed, got %v", err)
+	}
+	// An earlier click isn't found through the pointer; the marker keeps its
+	// user ID off the conversion for the whole post-click window
+	got, _, err := tracker.Attribute(ctx, earlier, "", 0)
+	if err != nil {
+		t.Fatalf("Attribute: %v", err)
+	}
+	if !ErasedAfter(ctx, rdb, got.UserID, got.Time) {
+		t.Fatal("conversion of an earlier click should be recorded without the user ID")
+	}
+	if ttl := rdb.TTL(ctx, erasedKeyPrefix+SubjectHash("user1")).Val(); ttl < 29*24*time.Hour {
+		t.Fatalf("erase marker expires in %s, before the post-click window", ttl)
+	}
+}
@@ -0,0 +1,280 @@
+package privacy
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// bitWriter builds encoded strings for tests.
+type bitWriter struct {
+	bits []bool
+}
+
+func (w *bitWriter) writeInt(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bits = append(w.bits, v&(1<<uint(i)) != 0)
+	}
+}
+
+func (w *bitWriter) writeBool(b bool) {
+	w.bits = append(w.bits, b)
+}
+
+// writeFibonacci writes v (at least 1) in the Fibonacci coding used by GPP.
+func (w *bitWriter) writeFibonacci(v int) {
+	fib := []int{1, 2}
+	for fib[len(fib)-1] <= v {
+		fib = append(fib, fib[len(fib)-1]+fib[len(fib)-2])
+	}
+	bits := make([]bool, len(fib)-1)
+	for i := len(bits) - 1; i >= 0; i-- {
+		if fib[i] <= v {
+			bits[i] = true
+			v -= fib[i]
+		}
+	}
+	for len(bits) > 0 && !bits[len(bits)-1] {
+		bits = bits[:len(bits)-1]
+	}
+	w.bits = append(append(w.bits, bits...), true)
+}
+
+func (w *bitWriter) encode() string {
+	data := make([]byte, (len(w.bits)+7)/8)
+	for i, b := range w.bits {
+		if b {
+			data[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// buildTCF encodes a TCF v2 core string with the given purpose and vendor
+// consents. Vendors are written as a bitfield unless useRanges is set.
+func buildTCF(purposes []int, vendors []int, useRanges bool) string {
+	w := &bitWriter{}
+	w.writeInt(2, 6)   // Version
+	w.writeInt(0, 36)  // Created
+	w.writeInt(0, 36)  // LastUpdated
+	w.writeInt(7, 12)  // CmpId
+	w.writeInt(1, 12)  // CmpVersion
+	w.writeInt(1, 6)   // ConsentScreen
+	w.writeInt(0, 12)  // ConsentLanguage
+	w.writeInt(42, 12) // VendorListVersion
+	w.writeInt(2, 6)   // TcfPolicyVersion
+	w.writeBool(false) // IsServiceSpecific
+	w.writeBool(false) // UseNonStandardTexts
+	w.writeInt(0, 12)  // SpecialFeatureOptIns
+	var mask uint64
+	for _, p := range purposes {
+		mask |= 1 << uint(24-p)
+	}
+	w.writeInt(mask, 24) // PurposesConsent
+	w.writeInt(0, 24)    // PurposesLITransparency
+	w.writeBool(false)   // PurposeOneTreatment
+	w.writeInt(0, 12)    // PublisherCC
+
+	maxVendor := 0
+	for _, v := range vendors {
+		if v > maxVendor {
+			maxVendor = v
+		}
+	}
+	w.writeInt(uint64(maxVendor), 16)
+	w.writeBool(useRanges)
+	if useRanges {
+		w.writeInt(uint64(len(vendors)), 12)
+		for _, v := range vendors {
+			w.writeBool(false)
+			w.writeInt(uint64(v), 16)
+		}
+	} else {
+		set := make(map[int]bool)
+		for _, v := range vendors {
+			set[v] = true
+		}
+		for id := 1; id <= maxVendor; id++ {
+			w.writeBool(set[id])
+		}
+	}
+	return w.encode()
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestParseTCF_Bitfield(t *testing.T) {
+	c, err := ParseTCF(buildTCF([]int{1, 3, 4}, []int{5, 32, 755}, false))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if c.Version != 2 || c.CMPID != 7 || c.VendorListVersion != 42 {
+		t.Fatalf("unexpected header fields: %+v", c)
+	}
+	for _, p := range []int{1, 3, 4} {
+		if !c.PurposeConsent(p) {
+			t.Errorf("expected purpose %d to have consent", p)
+		}
+	}
+	if c.PurposeConsent(2) {
+		t.Error("purpose 2 should not have consent")
+	}
+	for _, v := range []int{5, 32, 755} {
+		if !c.VendorConsent(v) {
+			t.Errorf("expected vendor %d to have consent", v)
+		}
+	}
+	if c.VendorConsent(6) {
+		t.Error("vendor 6 should not have consent")
+	}
+}
+
+func TestParseTCF_RangeAndSegments(t *testing.T) {
+	s := buildTCF([]int{1}, []int{10, 20}, true) + ".IF0EWSFgAAAA"
+	c, err := ParseTCF(s)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !c.VendorConsent(10) || !c.VendorConsent(20) || c.VendorConsent(15) {
+		t.Fatalf("unexpected vendor consents: %v", c.VendorConsents)
+	}
+}
+
+func TestParseTCF_Invalid(t *testing.T) {
+	for _, s := range []string{"", "!!!", "BOEFEAyOEFEAyAHABDENAI4AAAB9vABAASA"} {
+		if _, err := ParseTCF(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestParseUSPrivacy(t *testing.T) {
+	u, err := ParseUSPrivacy("1YYN")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !u.Applies() || !u.OptedOut() {
+		t.Fatalf("expected opt-out, got %+v", u)
+	}
+	u, _ = ParseUSPrivacy("1---")
+	if u.Applies() {
+		t.Fatal("1--- should not apply")
+	}
+	if _, err := ParseUSPrivacy("2YNN"); err == nil {
+		t.Fatal("expected version error")
+	}
+}
+
+func TestParseGPP(t *testing.T) {
+	g, err := ParseGPP("DBACNY~CPXxRfAPXxRfAAfKABENB-CgAAAAAAAAAAYgAAAAAAAA~1YNN")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(g.SectionIDs) != 2 || g.SectionIDs[0] != SectionTCFEUv2 || g.SectionIDs[1] != SectionUSPrivacy {
+		t.Fatalf("unexpected section ids %v", g.SectionIDs)
+	}
+	if g.Section(SectionUSPrivacy) != "1YNN" {
+		t.Fatalf("unexpected usp section %q", g.Section(SectionUSPrivacy))
+	}
+	if g.Applies(SectionTCFEUv2, []int{6}) {
+		t.Fatal("tcf section should not apply when gpp_sid excludes it")
+	}
+	if _, err := ParseGPP("DBACNY~only-one"); err == nil {
+		t.Fatal("expected section count error")
+	}
+}
+
+func TestParseGPP_HugeRange(t *testing.T) {
+	header := func(offset, length int) string {
+		w := &bitWriter{}
+		w.writeInt(3, 6)  // Type
+		w.writeInt(1, 6)  // Version
+		w.writeInt(1, 12) // NumRanges
+		w.writeBool(true) // IsRange
+		w.writeFibonacci(offset)
+		w.writeFibonacci(length)
+		return w.encode()
+	}
+
+	// Sections 2 to 6
+	g, err := ParseGPP(header(2, 4) + "~a~b~c~d~e")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(g.SectionIDs) != 5 || g.SectionIDs[0] != 2 || g.SectionIDs[4] != 6 {
+		t.Fatalf("unexpected section ids %v", g.SectionIDs)
+	}
+
+	start := time.Now()
+	for _, h := range []string{header(1, 1<<40), header(1<<40, 1), header(1, maxSectionID)} {
+		if _, err := ParseGPP(h + "~a"); err == nil {
+			t.Fatalf("expected an error for an out of range header %q", h)
+		}
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("rejecting huge ranges took %s", d)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	granted := buildTCF([]int{1, 2, 3, 4}, []int{32}, false)
+	noPurpose1 := buildTCF([]int{2, 3}, []int{32}, false)
+
+	tests := []struct {
+		name       string
+		regs       models.Regs
+		user       models.User
+		wantStatus string
+		restricted bool
+		vendor32   bool
+		vendor99   bool
+	}{
+		{"no signals", models.Regs{}, models.User{}, models.ConsentNotApplicable, false, true, true},
+		{"gdpr without consent string", models.Regs{GDPR: intPtr(1)}, models.User{}, models.ConsentDenied, true, false, false},
+		{"gdpr without purpose 1", models.Regs{GDPR: intPtr(1)}, models.User{Consent: noPurpose1}, models.ConsentDenied, true, false, false},
+		{"gdpr granted", models.Regs{GDPR: intPtr(1)}, models.User{Consent: granted}, models.ConsentGranted, false, true, false},
+		{"gdpr via 2.5 ext", models.Regs{Ext: models.RegsExt{GDPR: intPtr(1)}}, models.User{Ext: models.UserExt{Consent: granted}}, models.ConsentGranted, false, true, false},
+		{"gdpr=0 ignores consent string", models.Regs{GDPR: intPtr(0)}, models.User{Consent: noPurpose1}, models.ConsentNotApplicable, false, true, true},
+		{"us opt-out", models.Regs{USPrivacy: "1YYN"}, models.User{}, models.ConsentOptedOut, true, true, true},
+		{"us no opt-out", models.Regs{USPrivacy: "1YNN"}, models.User{}, models.ConsentGranted, false, true, true},
+		{"coppa overrides consent", models.Regs{COPPA: 1, GDPR: intPtr(1)}, models.User{Consent: granted}, models.ConsentCOPPA, true, true, false},
+		{"gpp usp opt-out", models.Regs{GPP: "DBABTA~1YYN", GPPSID: []int{6}}, models.User{}, models.ConsentOptedOut, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := Evaluate(tt.regs, tt.user)
+			if pc.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", pc.Status, tt.wantStatus)
+			}
+			if pc.RestrictUserData != tt.restricted {
+				t.Errorf("restricted = %v, want %v", pc.RestrictUserData, tt.restricted)
+			}
+			if pc.VendorAllowed(32) != tt.vendor32 {
+				t.Errorf("vendor 32 allowed = %v, want %v", pc.VendorAllowed(32), tt.vendor32)
+			}
+			if pc.VendorAllowed(99) != tt.vendor99 {
+				t.Errorf("vendor 99 allowed = %v, want %v", pc.VendorAllowed(99), tt.vendor99)
+			}
+			if !pc.VendorAllowed(0) {
+				t.Error("line items without a vendor ID should always be allowed")
+			}
+		})
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.57":               "203.0.113.0",
+		"::ffff:203.0.113.57":        "203.0.113.0",
+		"2001:db8:85a3:8d3:1319::47": "2001:db8:85a3::",
+		"not-an-ip":                  "",
+		"":                           "",
+	}
+	for in, want := range tests {
+		if got := AnonymizeIP(in); got != want {
+			t.Errorf("AnonymizeIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package privacy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PurposeStoreAccess is TCF Purpose 1, "Store and/or access information on a
+// device". Without it the server must not use the user identifier.
+const PurposeStoreAccess = 1
+
+// ErrUnsupportedTCFVersion is returned for consent strings that are not TCF v2.
+var ErrUnsupportedTCFVersion = errors.New("unsupported TCF version")
+
+// TCFConsent is the decoded core segment of a TCF v2.x consent string. Only
+// the fields the ad server acts on are kept.
+type TCFConsent struct {
+	Version           int
+	CMPID             int
+	VendorListVersion int
+	PolicyVersion     int
+	// purposes is a bitmask where bit n-1 is set when Purpose n has consent.
+	purposes uint32
+	// VendorConsents lists the Global Vendor List IDs that have consent.
+	VendorConsents map[int]bool
+}
+
+// PurposeConsent reports whether the user consented to the given TCF purpose (1-24).
+func (c *TCFConsent) PurposeConsent(purpose int) bool {
+	if c == nil || purpose < 1 || purpose > 24 {
+		return false
+	}
+	return c.purposes&(1<<uint(purpose-1)) != 0
+}
+
+// VendorConsent reports whether the given vendor has consent.
+func (c *TCFConsent) VendorConsent(vendorID int) bool {
+	if c == nil {
+		return false
+	}
+	return c.VendorConsents[vendorID]
+}
+
+// ParseTCF decodes the core segment of a TCF v2 consent string. Additional
+// segments (disclosed vendors, publisher TC) are ignored.
+func ParseTCF(consent string) (*TCFConsent, error) {
+	if consent == "" {
+		return nil, errors.New("empty consent string")
+	}
+	core := consent
+	if i := strings.IndexByte(core, '.'); i >= 0 {
+		core = core[:i]
+	}
+	data, err := decodeWebSafe(core)
+	if err != nil {
+		return nil, fmt.Errorf("decode consent string: %w", err)
+	}
+	r := &bitReader{data: data}
+
+	version, err := r.readInt(6)
+	if err != nil {
+		return nil, err
+	}
+	if version != 2 {
+		return nil, ErrUnsupportedTCFVersion
+	}
+	out := &TCFConsent{Version: int(version)}
+
+	// Created (36) and LastUpdated (36) are not needed.
+	if err := r.skip(72); err != nil {
+		return nil, err
+	}
+	cmpID, err := r.readInt(12)
+	if err != nil {
+		return nil, err
+	}
+	out.CMPID = int(cmpID)
+	// CmpVersion (12), ConsentScreen (6), ConsentLanguage (12).
+	if err := r.skip(30); err != nil {
+		return nil, err
+	}
+	vlv, err := r.readInt(12)
+	if err != nil {
+		return nil, err
+	}
+	out.VendorListVersion = int(vlv)
+	policy, err := r.readInt(6)
+	if err != nil {
+		return nil, err
+	}
+	out.PolicyVersion = int(policy)
+	// IsServiceSpecific (1), UseNonStandardTexts (1), SpecialFeatureOptIns (12).
+	if err := r.skip(14); err != nil {
+		return nil, err
+	}
+	purposes, err := r.readInt(24)
+	if err != nil {
+		return nil, err
+	}
+	// The string stores Purpose 1 in the most significant bit; flip it so
+	// bit 0 of the mask corresponds to Purpose 1.
+	for i := 0; i < 24; i++ {
+		if purposes&(1<<uint(23-i)) != 0 {
+			out.purposes |= 1 << uint(i)
+		}
+	}
+	// PurposesLITransparency (24), PurposeOneTreatment (1), PublisherCC (12).
+	if err := r.skip(37); err != nil {
+		return nil, err
+	}
+
+	vendors, err := readVendorSection(r)
+	if err != nil {
+		return nil, fmt.Errorf("vendor consents: %w", err)
+	}
+	out.VendorConsents = vendors
+	return out, nil
+}
+
+// readVendorSection decodes a TCF vendor section, which is either a bitfield
+// or a list of ranges depending on which encoding was shorter.
+func readVendorSection(r *bitReader) (map[int]bool, error) {
+	maxVendor, err := r.readInt(16)
+	if err != nil {
+		return nil, err
+	}
+	isRange, err := r.readBool()
+	if err != nil {
+		return nil, err
+	}
+	vendors := make(map[int]bool)
+	if !isRange {
+		for id := 1; id <= int(maxVendor); id++ {
+			ok, err := r.readBool()
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				vendors[id] = true
+			}
+		}
+		return vendors, nil
+	}
+
+	entries, err := r.readInt(12)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(entries); i++ {
+		isARange, err := r.readBool()
+		if err != nil {
+			return nil, err
+		}
+		start, err := r.readInt(16)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isARange {
+			if end, err = r.readInt(16); err != nil {
+				return nil, err
+			}
+		}
+		if end < start || end > maxVendor {
+			return nil, fmt.Errorf("invalid vendor range %d-%d", start, end)
+		}
+		for id := start; id <= end; id++ {
+			vendors[int(id)] = true
+		}
+	}
+	return vendors, nil
+}
@@ -0,0 +1,51 @@
+package privacy
+
+import "fmt"
+
+// USPrivacy is a decoded IAB US Privacy (CCPA) string such as "1YNN".
+type USPrivacy struct {
+	Version    int
+	Notice     byte // 'Y', 'N' or '-'
+	OptOutSale byte // 'Y', 'N' or '-'
+	LSPA       byte // 'Y', 'N' or '-'
+}
+
+// ParseUSPrivacy validates and decodes a four character US Privacy string.
+func ParseUSPrivacy(s string) (USPrivacy, error) {
+	if len(s) != 4 {
+		return USPrivacy{}, fmt.Errorf("us_privacy must be 4 characters, got %q", s)
+	}
+	if s[0] != '1' {
+		return USPrivacy{}, fmt.Errorf("unsupported us_privacy version %q", s[0])
+	}
+	for i := 1; i < 4; i++ {
+		switch s[i] {
+		case 'Y', 'N', '-', 'y', 'n':
+		default:
+			return USPrivacy{}, fmt.Errorf("invalid us_privacy character %q", s[i])
+		}
+	}
+	upper := func(b byte) byte {
+		if b >= 'a' && b <= 'z' {
+			return b - 'a' + 'A'
+		}
+		return b
+	}
+	return USPrivacy{
+		Version:    1,
+		Notice:     upper(s[1]),
+		OptOutSale: upper(s[2]),
+		LSPA:       upper(s[3]),
+	}, nil
+}
+
+// Applies reports whether the string signals that US privacy law applies.
+// "1---" is the IAB convention for "not applicable".
+func (u USPrivacy) Applies() bool {
+	return u.Notice != '-' || u.OptOutSale != '-' || u.LSPA != '-'
+}
+
+// OptedOut reports whether the user opted out of the sale of personal data.
+func (u USPrivacy) OptedOut() bool {
+	return u.OptOutSale == 'Y'
+}
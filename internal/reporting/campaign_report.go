@@ -28,6 +28,9 @@ type CampaignMetrics struct {
 	CTR         float64   `json:"ctr"`         // Click-through rate as percentage (clicks/impressions * 100)
 	CPM         float64   `json:"cpm"`         // Cost per mille (cost per 1000 impressions) in USD
 	CPC         float64   `json:"cpc"`         // Cost per click in USD
+	// Viewable impressions met the MRC standard as measured by the SDK.
+	ViewableImpressions int64   `json:"viewable_impressions"`
+	ViewableRate        float64 `json:"viewable_rate"` // Viewable impressions as percentage of impressions
 }
 
 // CampaignSummary contains comprehensive campaign performance data including
@@ -38,6 +41,7 @@ type CampaignSummary struct {
 	DailyMetrics    []CampaignMetrics `json:"daily_metrics"`     // Day-by-day performance breakdown
 	TopCreatives    []CreativeMetrics `json:"top_creatives"`     // Top performing creatives ranked by CTR
 	LineItemMetrics []LineItemMetrics `json:"line_item_metrics"` // Performance breakdown by line item
+	SiteMetrics     []SiteMetrics     `json:"site_metrics"`      // Performance breakdown by domain and app
 }
 
 // CreativeMetrics represents performance metrics for individual creatives within a campaign.
@@ -60,7 +64,22 @@ type LineItemMetrics struct {
 	CTR         float64 `json:"ctr"`          // Click-through rate as percentage
 	CPM         float64 `json:"cpm"`          // Cost per mille (cost per 1000 impressions) in USD
 	CPC         float64 `json:"cpc"`          // Cost per click in USD
-	BudgetType  string  `json:"budget_type"`  // Budget type: "cpm", "cpc", or "flat"
+	BudgetType  string  `json:"budget_type"`  // Budget type: "cpm", "cpc", "flat", "vcpm", or "cpa"
+	// Viewable impressions and their share of impressions as a percentage.
+	ViewableImpressions int64   `json:"viewable_impressions"`
+	ViewableRate        float64 `json:"viewable_rate"`
+}
+
+// SiteMetrics represents performance metrics for a site domain or app bundle.
+// Used to report delivery and revenue by inventory source.
+type SiteMetrics struct {
+	Domain      string  `json:"domain"`      // Site or app domain; empty when unknown
+	AppBundle   string  `json:"app_bundle"`  // App bundle identifier; empty for web traffic
+	Impressions int64   `json:"impressions"` // Total impressions on this site or app
+	Clicks      int64   `json:"clicks"`      // Total clicks on this site or app
+	Spend       float64 `json:"spend"`       // Total spend on this site or app in USD
+	CTR         float64 `json:"ctr"`         // Click-through rate as percentage
+	CPM         float64 `json:"cpm"`         // Cost per mille (cost per 1000 impressions) in USD
 }
 
 // GenerateCampaignReport queries ClickHouse for campaign performance data and
@@ -88,12 +107,14 @@ func GenerateCampaignReport(ctx context.Context, db *sql.DB, campaignID int, day
 		totalMetrics.Impressions += dm.Impressions
 		totalMetrics.Clicks += dm.Clicks
 		totalMetrics.Spend += dm.Spend
+		totalMetrics.ViewableImpressions += dm.ViewableImpressions
 	}
 
 	// Calculate derived metrics (CTR, CPM, CPC)
 	if totalMetrics.Impressions > 0 {
 		totalMetrics.CTR = float64(totalMetrics.Clicks) / float64(totalMetrics.Impressions) * 100
 		totalMetrics.CPM = totalMetrics.Spend / float64(totalMetrics.Impressions) * 1000
+		totalMetrics.ViewableRate = float64(totalMetrics.ViewableImpressions) / float64(totalMetrics.Impressions) * 100
 	}
 	if totalMetrics.Clicks > 0 {
 		totalMetrics.CPC = totalMetrics.Spend / float64(totalMetrics.Clicks)
@@ -114,6 +135,13 @@ func GenerateCampaignReport(ctx context.Context, db *sql.DB, campaignID int, day
 	}
 	summary.LineItemMetrics = lineItemMetrics
 
+	// Get performance by site domain and app bundle
+	siteMetrics, err := getSiteMetrics(ctx, db, campaignID, days)
+	if err != nil {
+		return nil, fmt.Errorf("get site metrics: %w", err)
+	}
+	summary.SiteMetrics = siteMetrics
+
 	return summary, nil
 }
 
@@ -129,9 +157,12 @@ func getDailyMetrics(ctx context.Context, db *sql.DB, campaignID int, days int)
 			sum(cost) as spend,
 			round(if(impressions > 0, clicks / impressions * 100, 0), 2) as ctr,
 			round(if(impressions > 0, spend / impressions * 1000, 0), 2) as cpm,
-			round(if(clicks > 0, spend / clicks, 0), 2) as cpc
+			round(if(clicks > 0, spend / clicks, 0), 2) as cpc,
+			countIf(event_type = 'viewable_impression') as viewable_impressions,
+			round(if(impressions > 0, viewable_impressions / impressions * 100, 0), 2) as viewable_rate
 		FROM events
 		WHERE campaign_id = ?
+			AND invalid = 0
 			AND timestamp >= now() - INTERVAL ? DAY
 		GROUP BY date
 		ORDER BY date DESC`
@@ -149,7 +180,7 @@ func getDailyMetrics(ctx context.Context, db *sql.DB, campaignID int, days int)
 		var m CampaignMetrics
 		m.CampaignID = campaignID // Set it directly since we're filtering by it
 		err := rows.Scan(&m.Date, &m.Impressions, &m.Clicks,
-			&m.Spend, &m.CTR, &m.CPM, &m.CPC)
+			&m.Spend, &m.CTR, &m.CPM, &m.CPC, &m.ViewableImpressions, &m.ViewableRate)
 		if err != nil {
 			return nil, fmt.Errorf("scan daily metrics: %w", err)
 		}
@@ -171,6 +202,7 @@ func getTopCreatives(ctx context.Context, db *sql.DB, campaignID int, days int,
 			sum(cost) as spend
 		FROM events
 		WHERE campaign_id = ?
+			AND invalid = 0
 			AND creative_id IS NOT NULL
 			AND timestamp >= now() - INTERVAL ? DAY
 		GROUP BY creative_id
@@ -208,9 +240,12 @@ func getLineItemMetrics(ctx context.Context, db *sql.DB, campaignID int, days in
 			sum(cost) as spend,
 			round(if(impressions > 0, clicks / impressions * 100, 0), 2) as ctr,
 			round(if(impressions > 0, spend / impressions * 1000, 0), 2) as cpm,
-			round(if(clicks > 0, spend / clicks, 0), 2) as cpc
+			round(if(clicks > 0, spend / clicks, 0), 2) as cpc,
+			countIf(event_type = 'viewable_impression') as viewable_impressions,
+			round(if(impressions > 0, viewable_impressions / impressions * 100, 0), 2) as viewable_rate
 		FROM events
 		WHERE campaign_id = ?
+			AND invalid = 0
 			AND line_item_id IS NOT NULL
 			AND timestamp >= now() - INTERVAL ? DAY
 		GROUP BY line_item_id
@@ -227,7 +262,7 @@ func getLineItemMetrics(ctx context.Context, db *sql.DB, campaignID int, days in
 	var lineItems []LineItemMetrics
 	for rows.Next() {
 		var li LineItemMetrics
-		err := rows.Scan(&li.LineItemID, &li.Impressions, &li.Clicks, &li.Spend, &li.CTR, &li.CPM, &li.CPC)
+		err := rows.Scan(&li.LineItemID, &li.Impressions, &li.Clicks, &li.Spend, &li.CTR, &li.CPM, &li.CPC, &li.ViewableImpressions, &li.ViewableRate)
 		if err != nil {
 			return nil, fmt.Errorf("scan line item metrics: %w", err)
 		}
@@ -235,3 +270,42 @@ func getLineItemMetrics(ctx context.Context, db *sql.DB, campaignID int, days in
 	}
 	return lineItems, rows.Err()
 }
+
+// getSiteMetrics queries ClickHouse for campaign performance grouped by site domain
+// and app bundle. Returns metrics ordered by spend descending.
+func getSiteMetrics(ctx context.Context, db *sql.DB, campaignID int, days int) ([]SiteMetrics, error) {
+	query := `
+		SELECT
+			domain,
+			app_bundle,
+			countIf(event_type = 'impression') as impressions,
+			countIf(event_type = 'click') as clicks,
+			sum(cost) as spend,
+			round(if(impressions > 0, clicks / impressions * 100, 0), 2) as ctr,
+			round(if(impressions > 0, spend / impressions * 1000, 0), 2) as cpm
+		FROM events
+		WHERE campaign_id = ?
+			AND invalid = 0
+			AND timestamp >= now() - INTERVAL ? DAY
+		GROUP BY domain, app_bundle
+		ORDER BY spend DESC`
+
+	rows, err := db.QueryContext(ctx, query, campaignID, days)
+	if err != nil {
+		return nil, fmt.Errorf("query site metrics: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var sites []SiteMetrics
+	for rows.Next() {
+		var m SiteMetrics
+		err := rows.Scan(&m.Domain, &m.AppBundle, &m.Impressions, &m.Clicks, &m.Spend, &m.CTR, &m.CPM)
+		if err != nil {
+			return nil, fmt.Errorf("scan site metrics: %w", err)
+		}
+		sites = append(sites, m)
+	}
+	return sites, rows.Err()
+}
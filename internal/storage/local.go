@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// Local stores objects as files in a directory. The content type is derived
+// from the key's extension.
+type Local struct {
+	Dir string
+}
+
+// NewLocal creates the directory if needed and returns a Local storage.
+func NewLocal(dir string) (*Local, error) {
+	if dir == "" {
+		return nil, errors.New("local storage requires a directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create storage dir: %w", err)
+	}
+	return &Local{Dir: dir}, nil
+}
+
+// Put writes the object to a temporary file and renames it into place so
+// that readers never see a partial file.
+func (l *Local) Put(_ context.Context, key string, data []byte, _ string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	tmp, err := os.CreateTemp(l.Dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write object: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("write object: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(l.Dir, key)); err != nil {
+		return fmt.Errorf("store object: %w", err)
+	}
+	return nil
+}
+
+// Get opens the object's file.
+func (l *Local) Get(_ context.Context, key string) (io.ReadCloser, Object, error) {
+	if !ValidKey(key) {
+		return nil, Object{}, ErrNotFound
+	}
+	f, err := os.Open(filepath.Join(l.Dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Object{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Object{}, fmt.Errorf("open object: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, Object{}, fmt.Errorf("stat object: %w", err)
+	}
+	return f, Object{ContentType: mime.TypeByExtension(filepath.Ext(key)), Size: info.Size()}, nil
+}
+
+// Delete removes the object's file.
+func (l *Local) Delete(_ context.Context, key string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	err := os.Remove(filepath.Join(l.Dir, key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	return nil
+}
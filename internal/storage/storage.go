@@ -0,0 +1,78 @@
+// Package storage stores uploaded creative assets as objects addressed by
+// key. Assets are kept on the local filesystem or in an S3-compatible object
+// store and served by the ad server itself, so creatives reference them
+// through the same host whichever backend is used.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned when no object exists for a key.
+var ErrNotFound = errors.New("object not found")
+
+// Storage is an object store for asset files.
+type Storage interface {
+	// Put stores the object under key, replacing any existing one.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens the object stored under key. The caller closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// Delete removes the object; deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Object describes a stored object.
+type Object struct {
+	ContentType string
+	Size        int64
+}
+
+// Config selects and configures the storage backend.
+type Config struct {
+	// Backend is "local" or "s3".
+	Backend string
+	// Dir is the directory of the local backend.
+	Dir string
+	// S3 configures the s3 backend.
+	S3 S3Config
+}
+
+// New returns the storage backend named in cfg.
+func New(cfg Config) (Storage, error) {
+	var (
+		s   Storage
+		err error
+	)
+	switch cfg.Backend {
+	case "", "local":
+		s, err = NewLocal(cfg.Dir)
+	case "s3":
+		s, err = NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ValidKey reports whether key is safe to use as an object name: one path
+// segment of letters, digits, '-', '_' and '.' that doesn't start with a dot.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 200 || strings.HasPrefix(key, ".") {
+		return false
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
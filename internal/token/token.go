@@ -23,6 +23,13 @@ const (
 	MaxCustomParamsCount      = 10
 )
 
+// Request context limits; longer page paths and category lists are truncated
+// so that tokens stay short enough for URLs.
+const (
+	MaxPagePathLength = 200
+	MaxCategories     = 10
+)
+
 // payload structure for encoding/decoding
 type payload struct {
 	ReqID        string            `json:"r"`
@@ -37,6 +44,31 @@ type payload struct {
 	Currency     string            `json:"cur"` // Auction currency
 	TS           int64             `json:"t"`
 	CustomParams map[string]string `json:"cp,omitempty"` // Custom parameters for macro expansion
+	Consent      string            `json:"cs,omitempty"` // Consent status decided at ad request time
+	COPPA        bool              `json:"co,omitempty"` // Request was child-directed
+	Domain       string            `json:"d,omitempty"`  // Site or app domain
+	AppBundle    string            `json:"ab,omitempty"` // App bundle identifier
+	PagePath     string            `json:"pp,omitempty"` // Page path
+	Categories   []string          `json:"ca,omitempty"` // IAB content categories
+	IVTReason    string            `json:"iv,omitempty"` // Invalid traffic reason from the ad request
+}
+
+// RequestContext carries request-level state that tracking endpoints need but
+// which is not part of the auction identifiers.
+type RequestContext struct {
+	// ConsentStatus is the privacy decision made for the ad request (models.Consent*).
+	ConsentStatus string
+	// COPPA is true when the ad request was child-directed.
+	COPPA bool
+	// Domain, PagePath and AppBundle identify the site or app the ad was
+	// served on, and Categories its content.
+	Domain     string
+	PagePath   string
+	AppBundle  string
+	Categories []string
+	// IVTReason is set when the ad request was flagged as invalid traffic, so
+	// its impressions and clicks are flagged too.
+	IVTReason string
 }
 
 // validateCustomParams checks custom parameters against size limits to prevent token bloat
@@ -71,6 +103,12 @@ func GenerateWithCustomParams(requestID, impID, crID, cid, liid, userID, pubID s
 
 // GenerateWithAuctionData creates a signed token for the given identifiers including auction data and custom parameters.
 func GenerateWithAuctionData(requestID, impID, crID, cid, liid, userID, pubID, placementID string, bidPrice float64, currency string, customParams map[string]string, secret []byte) (string, error) {
+	return GenerateWithContext(requestID, impID, crID, cid, liid, userID, pubID, placementID, bidPrice, currency, customParams, RequestContext{}, secret)
+}
+
+// GenerateWithContext creates a signed token including auction data, custom
+// parameters and request context such as the consent decision.
+func GenerateWithContext(requestID, impID, crID, cid, liid, userID, pubID, placementID string, bidPrice float64, currency string, customParams map[string]string, rc RequestContext, secret []byte) (string, error) {
 	// Validate custom parameters to prevent token size issues
 	if customParams != nil {
 		if err := validateCustomParams(customParams); err != nil {
@@ -91,6 +129,19 @@ func GenerateWithAuctionData(requestID, impID, crID, cid, liid, userID, pubID, p
 		Currency:     currency,
 		TS:           time.Now().Unix(),
 		CustomParams: customParams,
+		Consent:      rc.ConsentStatus,
+		COPPA:        rc.COPPA,
+		Domain:       rc.Domain,
+		AppBundle:    rc.AppBundle,
+		PagePath:     rc.PagePath,
+		Categories:   rc.Categories,
+		IVTReason:    rc.IVTReason,
+	}
+	if len(pl.PagePath) > MaxPagePathLength {
+		pl.PagePath = pl.PagePath[:MaxPagePathLength]
+	}
+	if len(pl.Categories) > MaxCategories {
+		pl.Categories = pl.Categories[:MaxCategories]
 	}
 	data, err := json.Marshal(pl)
 	if err != nil {
@@ -118,6 +169,8 @@ func Verify(token string, secret []byte, ttl time.Duration) (out struct {
 	BidPrice     float64
 	Currency     string
 	CustomParams map[string]string
+	Context      RequestContext
+	IssuedAt     time.Time
 }, err error) {
 	parts := strings.Split(token, ".")
 	if len(parts) != 2 {
@@ -157,5 +210,7 @@ func Verify(token string, secret []byte, ttl time.Duration) (out struct {
 	out.BidPrice = pl.BidPrice
 	out.Currency = pl.Currency
 	out.CustomParams = pl.CustomParams
+	out.Context = RequestContext{ConsentStatus: pl.Consent, COPPA: pl.COPPA, Domain: pl.Domain, PagePath: pl.PagePath, AppBundle: pl.AppBundle, Categories: pl.Categories, IVTReason: pl.IVTReason}
+	out.IssuedAt = time.Unix(pl.TS, 0)
 	return out, nil
 }
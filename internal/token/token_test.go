@@ -1,6 +1,7 @@
 package token
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -98,3 +99,38 @@ func TestGenerateVerifyNilCustomParams(t *testing.T) {
 		t.Fatalf("expected nil or empty custom params, got %+v", p.CustomParams)
 	}
 }
+
+func TestGenerateWithContext(t *testing.T) {
+	secret := []byte("secret")
+	tok, err := GenerateWithContext("r1", "i1", "c1", "cid1", "li1", "", "1", "pl1", 1.5, "USD", nil, RequestContext{ConsentStatus: "coppa", COPPA: true}, secret)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	p, err := Verify(tok, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if p.Context.ConsentStatus != "coppa" || !p.Context.COPPA || p.UserID != "" {
+		t.Fatalf("unexpected payload: %+v", p)
+	}
+}
+
+func TestGenerateWithContext_SiteContext(t *testing.T) {
+	secret := []byte("secret")
+	cats := []string{"IAB1", "IAB2", "IAB3", "IAB4", "IAB5", "IAB6", "IAB7", "IAB8", "IAB9", "IAB10", "IAB11"}
+	rc := RequestContext{Domain: "example.com", PagePath: "/sports/" + strings.Repeat("a", MaxPagePathLength), Categories: cats}
+	tok, err := GenerateWithContext("r1", "i1", "c1", "cid1", "li1", "", "1", "pl1", 1.5, "USD", nil, rc, secret)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	p, err := Verify(tok, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if p.Context.Domain != "example.com" || !strings.HasPrefix(p.Context.PagePath, "/sports/") || len(p.Context.PagePath) != MaxPagePathLength {
+		t.Errorf("unexpected page context: %+v", p.Context)
+	}
+	if len(p.Context.Categories) != MaxCategories || p.Context.Categories[0] != "IAB1" {
+		t.Errorf("expected the first %d categories, got %v", MaxCategories, p.Context.Categories)
+	}
+}
@@ -0,0 +1,347 @@
+// Package trackers fires third-party impression and click tracking URLs from
+// the server. URLs are queued to a fixed pool of workers so that slow or
+// unreachable tracking hosts never hold up our own tracking endpoints; when
+// the queue is full further URLs are dropped rather than waited for. Failed
+// requests are retried with exponential backoff, and each tracking domain
+// can be given its own timeout. Tracking URLs come from advertisers, so they
+// are only fired at public addresses: loopback, private and link-local
+// addresses are refused when connecting, including after redirects.
+package trackers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// userAgent identifies requests when the viewer's user agent is unknown.
+const userAgent = "OpenAdServe-Tracker/1.0"
+
+// maxRedirects bounds how many redirects a tracker may follow.
+const maxRedirects = 5
+
+// ErrBlockedAddress is returned for trackers that resolve to an address
+// that isn't public.
+var ErrBlockedAddress = errors.New("tracker address is not public")
+
+// nonPublic lists reserved ranges not covered by the net.IP predicates used
+// in PublicIP.
+var nonPublic = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4", "64:ff9b::/96"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// Config sizes the worker pool and sets retry and timeout behaviour.
+type Config struct {
+	// Workers is the number of concurrent requests. Zero or less disables
+	// server-side firing.
+	Workers int
+	// QueueSize is the number of URLs waiting for a worker beyond which new
+	// URLs are dropped.
+	QueueSize int
+	// Retries is the number of additional attempts after a request fails
+	// with a network error or a 5xx status. RetryBackoff is the wait before
+	// the first retry and doubles for each one after.
+	Retries      int
+	RetryBackoff time.Duration
+	// Timeout bounds each attempt. DomainTimeouts overrides it by host; an
+	// entry for "example.com" also covers its subdomains.
+	Timeout        time.Duration
+	DomainTimeouts map[string]time.Duration
+	// AllowPrivate also fires trackers at loopback, private and link-local
+	// addresses. It is meant for tests against local servers only.
+	AllowPrivate bool
+}
+
+// Request is one tracking URL to fire on behalf of a viewer.
+type Request struct {
+	URL string
+	// UserAgent is forwarded so that trackers can classify the device.
+	UserAgent string
+}
+
+// Stats counts the outcome of queued requests.
+type Stats struct {
+	Fired   int64 // Requests answered with a non-error status.
+	Failed  int64 // Requests that failed after all attempts.
+	Dropped int64 // Requests dropped because the queue was full or closed.
+}
+
+// Firer fires tracking requests from a bounded worker pool. A nil Firer
+// fires nothing.
+type Firer struct {
+	cfg    Config
+	client *http.Client
+	logger *zap.Logger
+	queue  chan Request
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+
+	fired, failed, dropped atomic.Int64
+}
+
+// New starts a Firer with cfg.Workers workers, or returns nil when Workers
+// is zero or less. The logger may be nil.
+func New(cfg Config, logger *zap.Logger) *Firer {
+	if cfg.Workers <= 0 {
+		return nil
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	f := &Firer{
+		cfg:    cfg,
+		client: newClient(cfg.AllowPrivate),
+		logger: logger,
+		queue:  make(chan Request, cfg.QueueSize),
+	}
+	f.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go f.work()
+	}
+	return f
+}
+
+// Fire queues the requests without blocking and returns how many were
+// queued. Requests that don't fit in the queue are dropped.
+func (f *Firer) Fire(reqs ...Request) int {
+	if f == nil {
+		return 0
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	queued := 0
+	for _, req := range reqs {
+		if f.closed {
+			f.dropped.Add(1)
+			continue
+		}
+		select {
+		case f.queue <- req:
+			queued++
+		default:
+			f.dropped.Add(1)
+			f.logger.Warn("tracker queue full, dropping request", zap.String("url", req.URL))
+		}
+	}
+	return queued
+}
+
+// Close stops accepting requests and waits for the queued ones to be fired.
+func (f *Firer) Close() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.queue)
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+}
+
+// Stats returns the outcome counts so far.
+func (f *Firer) Stats() Stats {
+	if f == nil {
+		return Stats{}
+	}
+	return Stats{Fired: f.fired.Load(), Failed: f.failed.Load(), Dropped: f.dropped.Load()}
+}
+
+func (f *Firer) work() {
+	defer f.wg.Done()
+	for req := range f.queue {
+		if err := f.send(req); err != nil {
+			f.failed.Add(1)
+			f.logger.Warn("third-party tracker failed", zap.String("url", req.URL), zap.Error(err))
+			continue
+		}
+		f.fired.Add(1)
+	}
+}
+
+// newClient returns the client trackers are fired with. Every connection,
+// including those made for redirects, is checked against the address it is
+// about to dial, so hostnames that resolve to internal addresses are refused
+// too.
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !PublicIP(net.ParseIP(host)) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		// Environment proxies are not used: the proxy would make the
+		// requests and the addresses dialed here couldn't be checked
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return CheckURL(req.URL.String(), allowPrivate)
+		},
+	}
+}
+
+// PublicIP reports whether ip is a public unicast address trackers may be
+// fired at.
+func PublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range nonPublic {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL checks that a tracker is an absolute http or https URL. Unless
+// allowPrivate is set, hosts that are non-public IP literals or localhost
+// are refused; other hostnames are checked once resolved, when fired.
+func CheckURL(raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid tracker url %q", raw)
+	}
+	if allowPrivate {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !PublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+// send fires one request, retrying network errors and 5xx statuses.
+// Blocked addresses are not retried.
+func (f *Firer) send(req Request) error {
+	if err := CheckURL(req.URL, f.cfg.AllowPrivate); err != nil {
+		return err
+	}
+	u, _ := url.Parse(req.URL)
+	timeout := f.timeout(u.Hostname())
+	backoff := f.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := f.attempt(req, timeout)
+		var permanent permanentError
+		if err == nil || errors.As(err, &permanent) || errors.Is(err, ErrBlockedAddress) || attempt >= f.cfg.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// permanentError is a response that retrying won't change.
+type permanentError struct{ status int }
+
+func (e permanentError) Error() string { return fmt.Sprintf("status %d", e.status) }
+
+func (f *Firer) attempt(req Request, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, req.URL, nil)
+	if err != nil {
+		return err
+	}
+	ua := req.UserAgent
+	if ua == "" {
+		ua = userAgent
+	}
+	httpReq.Header.Set("User-Agent", ua)
+	resp, err := f.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("status %d", resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return permanentError{resp.StatusCode}
+	}
+	return nil
+}
+
+// timeout returns the timeout for a host: that of the most specific domain
+// in DomainTimeouts that matches it, or the default.
+func (f *Firer) timeout(host string) time.Duration {
+	host = strings.ToLower(host)
+	for {
+		if d, ok := f.cfg.DomainTimeouts[host]; ok {
+			return d
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return f.cfg.Timeout
+		}
+		host = host[i+1:]
+	}
+}
+
+// ParseDomainTimeouts parses a comma-separated list of domain=duration
+// pairs, e.g. "doubleclick.net=1s,adsafeprotected.com=500ms".
+func ParseDomainTimeouts(s string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		domain, value, ok := strings.Cut(part, "=")
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if !ok || domain == "" {
+			return nil, fmt.Errorf("invalid domain timeout %q", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout for %s: %q", domain, value)
+		}
+		out[domain] = d
+	}
+	return out, nil
+}
@@ -0,0 +1,149 @@
+package trackers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFirer_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	var gotUA atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA.Store(r.UserAgent())
+		switch r.URL.Path {
+		case "/flaky":
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/gone":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	f := New(Config{Workers: 2, QueueSize: 10, Retries: 2, RetryBackoff: time.Millisecond, AllowPrivate: true}, nil)
+	if n := f.Fire(Request{URL: srv.URL + "/flaky", UserAgent: "Mozilla/5.0"}, Request{URL: srv.URL + "/gone"}, Request{URL: "ftp://example.com/x"}); n != 3 {
+		t.Fatalf("expected 3 queued, got %d", n)
+	}
+	f.Close()
+
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected the flaky tracker to be tried 3 times, got %d", got)
+	}
+	if s := f.Stats(); s.Fired != 1 || s.Failed != 2 {
+		t.Errorf("expected 1 fired and 2 failed, got %+v", s)
+	}
+	if f.Fire(Request{URL: srv.URL}) != 0 || f.Stats().Dropped != 1 {
+		t.Errorf("expected requests after Close to be dropped")
+	}
+}
+
+func TestFirer_QueueBound(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	f := New(Config{Workers: 1, QueueSize: 1, AllowPrivate: true}, nil)
+	// The first request occupies the worker; wait until it has been taken
+	f.Fire(Request{URL: srv.URL})
+	for len(f.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := f.Fire(Request{URL: srv.URL}, Request{URL: srv.URL}); n != 1 {
+		t.Errorf("expected only one request to fit in the queue, got %d", n)
+	}
+	close(release)
+	f.Close()
+	if s := f.Stats(); s.Fired != 2 || s.Dropped != 1 {
+		t.Errorf("expected 2 fired and 1 dropped, got %+v", s)
+	}
+}
+
+func TestFirer_DomainTimeouts(t *testing.T) {
+	timeouts, err := ParseDomainTimeouts("doubleclick.net=1s, Ads.Example.com=250ms")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	f := &Firer{cfg: Config{Timeout: 2 * time.Second, DomainTimeouts: timeouts}}
+	for host, want := range map[string]time.Duration{
+		"ad.doubleclick.net": time.Second,
+		"ads.example.com":    250 * time.Millisecond,
+		"example.com":        2 * time.Second,
+	} {
+		if got := f.timeout(host); got != want {
+			t.Errorf("timeout(%s) = %v, want %v", host, got, want)
+		}
+	}
+	if _, err := ParseDomainTimeouts("doubleclick.net"); err == nil {
+		t.Error("expected an error for a missing timeout")
+	}
+	if New(Config{}, nil) != nil {
+		t.Error("expected no firer without workers")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://ad.doubleclick.net/pixel?c={CREATIVE_ID}": true,
+		"http://203.0.113.7/imp":                           true,
+		"ftp://example.com/x":                              false,
+		"http://169.254.169.254/latest/meta-data/":         false,
+		"http://localhost:6379/":                           false,
+		"http://LOCALHOST./":                               false,
+		"http://127.0.0.1/":                                false,
+		"http://10.1.2.3/":                                 false,
+		"http://192.168.1.1/":                              false,
+		"http://100.64.0.1/":                               false,
+		"http://[::1]/":                                    false,
+		"http://[fe80::1]/":                                false,
+		"http://[::ffff:10.0.0.1]/":                        false,
+	} {
+		if err := CheckURL(raw, false); (err == nil) != ok {
+			t.Errorf("CheckURL(%q) = %v, want ok=%v", raw, err, ok)
+		}
+	}
+	if err := CheckURL("http://127.0.0.1/", true); err != nil {
+		t.Errorf("expected private addresses to be allowed, got %v", err)
+	}
+}
+
+func TestFirer_BlocksPrivateAddresses(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	f := New(Config{Workers: 1, QueueSize: 10, Retries: 2, RetryBackoff: time.Millisecond}, nil)
+	f.Fire(Request{URL: srv.URL + "/imp"})
+	f.Close()
+	if calls.Load() != 0 || f.Stats().Failed != 1 {
+		t.Errorf("expected the loopback tracker to be refused, got %d calls and %+v", calls.Load(), f.Stats())
+	}
+
+	// Hostnames are checked against the address they resolve to
+	u, _ := url.Parse(srv.URL)
+	resp, err := newClient(false).Get("http://localhost:" + u.Port() + "/imp")
+	if err == nil {
+		_ = resp.Body.Close()
+	}
+	if !errors.Is(err, ErrBlockedAddress) || calls.Load() != 0 {
+		t.Errorf("expected dialing a name for loopback to be refused, got %v", err)
+	}
+
+	// Redirects are checked before they are followed
+	req := httptest.NewRequest(http.MethodGet, "http://169.254.169.254/latest/meta-data/", nil)
+	if err := newClient(false).CheckRedirect(req, []*http.Request{req}); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("expected a redirect to the metadata service to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package vast
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// ErrWrapperDepth is returned when a wrapper chain is longer than allowed.
+var ErrWrapperDepth = errors.New("vast: too many wrappers")
+
+// maxDocumentSize bounds the size of a fetched VAST document.
+const maxDocumentSize = 1 << 20
+
+// probe holds the parts of a VAST document needed to resolve it.
+type probe struct {
+	Ads []struct {
+		InLine *struct {
+			Linear []struct {
+				Duration   string `xml:"Duration"`
+				MediaFiles []struct {
+					Delivery string `xml:"delivery,attr"`
+					Type     string `xml:"type,attr"`
+					Width    int    `xml:"width,attr"`
+					Height   int    `xml:"height,attr"`
+					Bitrate  int    `xml:"bitrate,attr"`
+					URL      string `xml:",chardata"`
+				} `xml:"MediaFiles>MediaFile"`
+			} `xml:"Creatives>Creative>Linear"`
+		} `xml:"InLine"`
+		Wrapper *struct {
+			TagURI string `xml:"VASTAdTagURI"`
+		} `xml:"Wrapper"`
+	} `xml:"Ad"`
+}
+
+// IsTagURL reports whether a bid's markup is the URL of a VAST tag rather
+// than a VAST document.
+func IsTagURL(adm string) bool {
+	adm = strings.TrimSpace(adm)
+	return strings.HasPrefix(adm, "http://") || strings.HasPrefix(adm, "https://")
+}
+
+// Resolver follows third-party VAST through its wrappers to the inline ad.
+type Resolver struct {
+	// Client fetches wrapped tags; nil uses http.DefaultClient.
+	Client *http.Client
+	// MaxDepth is the most wrappers allowed between our response and the
+	// inline ad. A tag URL counts as one since it is served in our wrapper.
+	MaxDepth int
+}
+
+// Resolve follows adm, a VAST document or tag URL, to its inline ad and
+// returns the ad's linear video. The first ad of each document is used.
+func (r Resolver) Resolve(ctx context.Context, adm string) (*models.VideoCreative, error) {
+	depth := 0
+	doc := []byte(adm)
+	if IsTagURL(adm) {
+		depth++
+		if depth > r.MaxDepth {
+			return nil, ErrWrapperDepth
+		}
+		var err error
+		if doc, err = r.fetch(ctx, strings.TrimSpace(adm)); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		var p probe
+		if err := xml.Unmarshal(doc, &p); err != nil {
+			return nil, fmt.Errorf("parse vast: %w", err)
+		}
+		if len(p.Ads) == 0 {
+			return nil, ErrNoAd
+		}
+		ad := p.Ads[0]
+		switch {
+		case ad.InLine != nil:
+			if len(ad.InLine.Linear) == 0 {
+				return nil, ErrNoAd
+			}
+			lin := ad.InLine.Linear[0]
+			d, err := ParseDuration(lin.Duration)
+			if err != nil {
+				return nil, err
+			}
+			v := &models.VideoCreative{Duration: d}
+			for _, mf := range lin.MediaFiles {
+				v.MediaFiles = append(v.MediaFiles, models.MediaFile{
+					URL:      strings.TrimSpace(mf.URL),
+					MIME:     mf.Type,
+					Bitrate:  mf.Bitrate,
+					Width:    mf.Width,
+					Height:   mf.Height,
+					Delivery: mf.Delivery,
+				})
+			}
+			return v, nil
+		case ad.Wrapper != nil:
+			depth++
+			if depth > r.MaxDepth {
+				return nil, ErrWrapperDepth
+			}
+			uri := strings.TrimSpace(ad.Wrapper.TagURI)
+			if uri == "" {
+				return nil, ErrNoAd
+			}
+			var err error
+			if doc, err = r.fetch(ctx, uri); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, ErrNoAd
+		}
+	}
+}
+
+func (r Resolver) fetch(ctx context.Context, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch vast: %w", err)
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch vast: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch vast: status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return nil, fmt.Errorf("fetch vast: %w", err)
+	}
+	return body, nil
+}
+
+// ParseDuration parses a VAST HH:MM:SS or HH:MM:SS.mmm time code into
+// seconds, rounding fractions up so duration limits are never exceeded.
+func ParseDuration(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid vast duration %q", s)
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil || h < 0 || m < 0 || sec < 0 {
+		return 0, fmt.Errorf("invalid vast duration %q", s)
+	}
+	return h*3600 + m*60 + int(math.Ceil(sec)), nil
+}
@@ -0,0 +1,61 @@
+package vast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/inline":
+			_, _ = fmt.Fprint(w, `<VAST version="4.0"><Ad><InLine><Creatives><Creative><Linear><Duration>00:00:30.000</Duration>`+
+				`<MediaFiles><MediaFile type="video/webm" width="1280" height="720"> https://cdn.example/a.webm </MediaFile></MediaFiles>`+
+				`</Linear></Creative></Creatives></InLine></Ad></VAST>`)
+		case "/wrapper":
+			_, _ = fmt.Fprintf(w, `<VAST version="4.0"><Ad><Wrapper><VASTAdTagURI>%s/inline</VASTAdTagURI></Wrapper></Ad></VAST>`, srv.URL)
+		case "/empty":
+			_, _ = fmt.Fprint(w, `<VAST version="4.0"/>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	// A tag URL around a wrapper around the inline ad is two wrappers deep
+	v, err := Resolver{MaxDepth: 2}.Resolve(ctx, srv.URL+"/wrapper")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if v.Duration != 30 || len(v.MediaFiles) != 1 || v.MediaFiles[0].MIME != "video/webm" || v.MediaFiles[0].URL != "https://cdn.example/a.webm" {
+		t.Fatalf("unexpected video %+v", v)
+	}
+	if _, err := (Resolver{MaxDepth: 1}).Resolve(ctx, srv.URL+"/wrapper"); !errors.Is(err, ErrWrapperDepth) {
+		t.Errorf("expected ErrWrapperDepth, got %v", err)
+	}
+	if _, err := (Resolver{MaxDepth: 1}).Resolve(ctx, srv.URL+"/empty"); !errors.Is(err, ErrNoAd) {
+		t.Errorf("expected ErrNoAd, got %v", err)
+	}
+	if _, err := (Resolver{MaxDepth: 1}).Resolve(ctx, srv.URL+"/missing"); err == nil {
+		t.Error("expected error for missing tag")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for in, want := range map[string]int{"00:00:15": 15, "00:01:15.250": 76, " 01:00:00 ": 3600} {
+		if got, err := ParseDuration(in); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "15", "00:xx:10", "-1:00:00"} {
+		if _, err := ParseDuration(in); err == nil {
+			t.Errorf("ParseDuration(%q): expected error", in)
+		}
+	}
+}
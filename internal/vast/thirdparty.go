@@ -0,0 +1,244 @@
+package vast
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNoAd is returned for VAST documents without a usable ad.
+var ErrNoAd = errors.New("vast: no ad")
+
+// element records where an element of a document starts and ends so that
+// markup can be inserted without re-encoding the rest of the document.
+type element struct {
+	name   string
+	parent int // index of the parent element, -1 for the root
+	attrs  []xml.Attr
+	// start and startEnd delimit the start tag, end and endEnd the end tag.
+	// Both ranges end at the same offset for self-closing elements.
+	start, startEnd int
+	end, endEnd     int
+}
+
+func (e element) selfClosing() bool {
+	return e.end == e.startEnd && e.endEnd == e.startEnd
+}
+
+// scan returns the elements of doc in document order.
+func scan(doc []byte) ([]element, error) {
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	var els []element
+	var open []int
+	for {
+		off := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse vast: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			parent := -1
+			if len(open) > 0 {
+				parent = open[len(open)-1]
+			}
+			els = append(els, element{
+				name:     t.Name.Local,
+				parent:   parent,
+				attrs:    t.Copy().Attr,
+				start:    off,
+				startEnd: int(dec.InputOffset()),
+			})
+			open = append(open, len(els)-1)
+		case xml.EndElement:
+			i := open[len(open)-1]
+			open = open[:len(open)-1]
+			els[i].end = off
+			els[i].endEnd = int(dec.InputOffset())
+		}
+	}
+	return els, nil
+}
+
+// child returns the index of the first child of parent with the given name,
+// or -1.
+func child(els []element, parent int, name string) int {
+	for i := parent + 1; i < len(els); i++ {
+		if els[i].parent == parent && els[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// edit replaces del bytes at offset at with text.
+type edit struct {
+	at, del int
+	text    string
+}
+
+func apply(doc []byte, edits []edit) []byte {
+	// Stable, so insertions at the same offset keep their order
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].at < edits[j].at })
+	var buf bytes.Buffer
+	pos := 0
+	for _, e := range edits {
+		buf.Write(doc[pos:e.at])
+		buf.WriteString(e.text)
+		pos = e.at + e.del
+	}
+	buf.Write(doc[pos:])
+	return buf.Bytes()
+}
+
+// cdataText wraps value in a CDATA section.
+func cdataText(value string) string {
+	return "<![CDATA[" + strings.ReplaceAll(value, "]]>", "]]]]><![CDATA[>") + "]]>"
+}
+
+// cdataElement renders <name><![CDATA[value]]></name>.
+func cdataElement(name, value string) string {
+	return "<" + name + ">" + cdataText(value) + "</" + name + ">"
+}
+
+// InsertTracking adds the ad's impression, viewability, click and playback
+// tracking to every InLine and Wrapper ad of a third-party VAST document.
+// The rest of the document is left byte for byte as it was.
+func InsertTracking(doc []byte, ad Ad) ([]byte, error) {
+	els, err := scan(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var events strings.Builder
+	for _, t := range ad.trackingEvents() {
+		events.WriteString(`<Tracking event="` + t.Event + `">` + cdataText(t.URL) + "</Tracking>")
+	}
+	trackingEvents := events.String()
+	var clicks string
+	if ad.ClickTracking != "" {
+		clicks = cdataElement("ClickTracking", ad.ClickTracking)
+	}
+
+	var edits []edit
+	found := false
+	for i, e := range els {
+		if (e.name != "InLine" && e.name != "Wrapper") || e.parent < 0 || els[e.parent].name != "Ad" || e.selfClosing() {
+			continue
+		}
+		found = true
+
+		// Our impression goes next to the existing ones
+		at := e.end
+		if imp := child(els, i, "Impression"); imp >= 0 {
+			at = els[imp].start
+		}
+		text := cdataElement("Impression", ad.Impression)
+		if ad.Viewable != "" {
+			viewable := cdataElement("Viewable", ad.Viewable)
+			if vi := child(els, i, "ViewableImpression"); vi < 0 {
+				text += "<ViewableImpression>" + viewable + "</ViewableImpression>"
+			} else {
+				edits = append(edits, insertInto(els[vi], "ViewableImpression", viewable))
+			}
+		}
+		edits = append(edits, edit{at: at, text: text})
+
+		linear := "<TrackingEvents>" + trackingEvents + "</TrackingEvents>"
+		if clicks != "" {
+			linear += "<VideoClicks>" + clicks + "</VideoClicks>"
+		}
+		creatives := child(els, i, "Creatives")
+		linears := 0
+		if creatives >= 0 {
+			for c := creatives + 1; c < len(els); c++ {
+				if els[c].parent != creatives || els[c].name != "Creative" {
+					continue
+				}
+				l := child(els, c, "Linear")
+				if l < 0 || els[l].selfClosing() {
+					continue
+				}
+				linears++
+				if te := child(els, l, "TrackingEvents"); te >= 0 {
+					edits = append(edits, insertInto(els[te], "TrackingEvents", trackingEvents))
+				} else {
+					edits = append(edits, edit{at: els[l].end, text: "<TrackingEvents>" + trackingEvents + "</TrackingEvents>"})
+				}
+				if clicks == "" {
+					continue
+				}
+				if vc := child(els, l, "VideoClicks"); vc >= 0 {
+					edits = append(edits, insertInto(els[vc], "VideoClicks", clicks))
+				} else {
+					edits = append(edits, edit{at: els[l].end, text: "<VideoClicks>" + clicks + "</VideoClicks>"})
+				}
+			}
+		}
+		// Wrappers may leave out creatives; playback is tracked on a linear
+		// creative of our own, which the player merges with the inline ad.
+		if linears == 0 && e.name == "Wrapper" {
+			block := "<Creative><Linear>" + linear + "</Linear></Creative>"
+			switch {
+			case creatives < 0:
+				edits = append(edits, edit{at: e.end, text: "<Creatives>" + block + "</Creatives>"})
+			case els[creatives].selfClosing():
+				edits = append(edits, insertInto(els[creatives], "Creatives", block))
+			default:
+				edits = append(edits, edit{at: els[creatives].end, text: block})
+			}
+		}
+	}
+	if !found {
+		return nil, ErrNoAd
+	}
+	return apply(doc, edits), nil
+}
+
+// insertInto appends text to the content of e, expanding it if it is
+// self-closing.
+func insertInto(e element, name, text string) edit {
+	if e.selfClosing() {
+		return edit{at: e.start, del: e.endEnd - e.start, text: "<" + name + ">" + text + "</" + name + ">"}
+	}
+	return edit{at: e.end, text: text}
+}
+
+// firstAd returns the first Ad element of doc for embedding in an ad pod.
+// A non-zero sequence replaces the ad's sequence attribute.
+func firstAd(doc []byte, sequence int) ([]byte, error) {
+	els, err := scan(doc)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range els {
+		if e.name != "Ad" || e.parent != 0 || e.selfClosing() {
+			continue
+		}
+		var buf bytes.Buffer
+		buf.WriteString("<Ad")
+		for _, a := range e.attrs {
+			if a.Name.Space != "" || (sequence > 0 && a.Name.Local == "sequence") {
+				continue
+			}
+			buf.WriteString(" " + a.Name.Local + `="`)
+			_ = xml.EscapeText(&buf, []byte(a.Value))
+			buf.WriteString(`"`)
+		}
+		if sequence > 0 {
+			buf.WriteString(` sequence="` + strconv.Itoa(sequence) + `"`)
+		}
+		buf.WriteString(">")
+		buf.Write(doc[e.startEnd:e.endEnd])
+		return buf.Bytes(), nil
+	}
+	return nil, ErrNoAd
+}
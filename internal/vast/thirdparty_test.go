@@ -0,0 +1,123 @@
+package vast
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func testTracking() Ad {
+	return Ad{
+		SkipAfter:     -1,
+		Impression:    "https://ads.example.com/impression?t=abc",
+		ClickTracking: "https://ads.example.com/click?t=abc",
+		Tracking: map[string]string{
+			"start":    "https://ads.example.com/event?t=abc&type=video_start",
+			"complete": "https://ads.example.com/event?t=abc&type=video_complete",
+		},
+	}
+}
+
+func TestInsertTracking(t *testing.T) {
+	inline := `<?xml version="1.0"?>
+<VAST version="3.0"><Ad id="1"><InLine><AdSystem>DSP</AdSystem><Impression><![CDATA[https://dsp.example/imp]]></Impression>
+<Creatives><Creative><Linear><Duration>00:00:15</Duration><TrackingEvents/>
+<VideoClicks><ClickThrough>https://brand.example</ClickThrough></VideoClicks>
+<MediaFiles><MediaFile type="video/mp4">https://dsp.example/a.mp4</MediaFile></MediaFiles></Linear></Creative></Creatives>
+<Extensions><Extension type="x"><Custom a="1"/></Extension></Extensions></InLine></Ad></VAST>`
+
+	out, err := InsertTracking([]byte(inline), testTracking())
+	if err != nil {
+		t.Fatalf("InsertTracking: %v", err)
+	}
+	var doc struct {
+		Impressions []string `xml:"Ad>InLine>Impression"`
+		Linear      struct {
+			Tracking []struct {
+				Event string `xml:"event,attr"`
+			} `xml:"TrackingEvents>Tracking"`
+			ClickThrough  string   `xml:"VideoClicks>ClickThrough"`
+			ClickTracking []string `xml:"VideoClicks>ClickTracking"`
+		} `xml:"Ad>InLine>Creatives>Creative>Linear"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("result is not valid XML: %v\n%s", err, out)
+	}
+	if len(doc.Impressions) != 2 || doc.Impressions[0] != "https://ads.example.com/impression?t=abc" {
+		t.Errorf("expected our impression before theirs, got %v", doc.Impressions)
+	}
+	if len(doc.Linear.Tracking) != 2 || doc.Linear.Tracking[0].Event != "start" || doc.Linear.Tracking[1].Event != "complete" {
+		t.Errorf("unexpected tracking events %+v", doc.Linear.Tracking)
+	}
+	if doc.Linear.ClickThrough != "https://brand.example" || len(doc.Linear.ClickTracking) != 1 {
+		t.Errorf("unexpected clicks %+v", doc.Linear)
+	}
+	// Everything else is untouched
+	if !strings.Contains(string(out), `<Extensions><Extension type="x"><Custom a="1"/></Extension></Extensions>`) ||
+		!strings.HasPrefix(string(out), `<?xml version="1.0"?>`) {
+		t.Errorf("document was re-encoded:\n%s", out)
+	}
+
+	// Wrappers without creatives get a linear creative for our tracking
+	wrapper := `<VAST version="4.0"><Ad><Wrapper><AdSystem>DSP</AdSystem><VASTAdTagURI>https://dsp.example/tag</VASTAdTagURI></Wrapper></Ad></VAST>`
+	out, err = InsertTracking([]byte(wrapper), testTracking())
+	if err != nil {
+		t.Fatalf("InsertTracking: %v", err)
+	}
+	if !strings.Contains(string(out), `<Impression><![CDATA[https://ads.example.com/impression?t=abc]]></Impression>`+
+		`<Creatives><Creative><Linear><TrackingEvents><Tracking event="start">`) {
+		t.Errorf("unexpected wrapper:\n%s", out)
+	}
+
+	if _, err := InsertTracking([]byte(`<VAST version="4.0"/>`), testTracking()); err != ErrNoAd {
+		t.Errorf("expected ErrNoAd for empty VAST, got %v", err)
+	}
+}
+
+func TestBuild_Pod(t *testing.T) {
+	first := testTracking()
+	first.ID = "7"
+	first.Video = models.VideoCreative{Duration: 15, MediaFiles: []models.MediaFile{{URL: "https://cdn.example.com/a.mp4", MIME: "video/mp4"}}}
+	tag := testTracking()
+	tag.ID = "8"
+	tag.TagURI = "https://adserver.example/vast?id=1"
+	third := testTracking()
+	third.Document = []byte(`<VAST version="4.0"><Ad id="dsp" sequence="4"><InLine><AdSystem>DSP</AdSystem><Impression>https://dsp.example/imp</Impression></InLine></Ad></VAST>`)
+
+	out, err := Build(first, tag, third)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	var doc struct {
+		Ads []struct {
+			ID       string `xml:"id,attr"`
+			Sequence int    `xml:"sequence,attr"`
+			InLine   *struct {
+				Impressions []string `xml:"Impression"`
+			} `xml:"InLine"`
+			Wrapper *struct {
+				TagURI string `xml:"VASTAdTagURI"`
+				Clicks string `xml:"Creatives>Creative>Linear>VideoClicks>ClickTracking"`
+			} `xml:"Wrapper"`
+		} `xml:"Ad"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("pod is not valid XML: %v\n%s", err, out)
+	}
+	if len(doc.Ads) != 3 {
+		t.Fatalf("expected 3 ads, got %d:\n%s", len(doc.Ads), out)
+	}
+	for i, ad := range doc.Ads {
+		if ad.Sequence != i+1 {
+			t.Errorf("ad %d: expected sequence %d, got %d", i, i+1, ad.Sequence)
+		}
+	}
+	if doc.Ads[1].Wrapper == nil || doc.Ads[1].Wrapper.TagURI != tag.TagURI || doc.Ads[1].Wrapper.Clicks != tag.ClickTracking {
+		t.Errorf("unexpected wrapper %+v", doc.Ads[1].Wrapper)
+	}
+	if doc.Ads[2].ID != "dsp" || doc.Ads[2].InLine == nil || len(doc.Ads[2].InLine.Impressions) != 2 {
+		t.Errorf("unexpected third-party ad %+v", doc.Ads[2])
+	}
+}
@@ -0,0 +1,282 @@
+// Package vast renders video ads as IAB VAST 4.x documents and inserts our
+// tracking into third-party VAST.
+package vast
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+// Version is the VAST version of the documents built by this package.
+const Version = "4.1"
+
+// adSystem names this server in the AdSystem element.
+const adSystem = "OpenAdServe"
+
+// Event maps a VAST tracking event to the custom event type it is recorded
+// as on /event.
+type Event struct {
+	VAST      string
+	EventType string
+}
+
+// Events lists the tracking events included in every linear ad, in playback
+// order. SkipEvent is only included for skippable ads.
+var Events = []Event{
+	{VAST: "start", EventType: "video_start"},
+	{VAST: "firstQuartile", EventType: "video_first_quartile"},
+	{VAST: "midpoint", EventType: "video_midpoint"},
+	{VAST: "thirdQuartile", EventType: "video_third_quartile"},
+	{VAST: "complete", EventType: "video_complete"},
+}
+
+// SkipEvent is tracked when the viewer skips a skippable ad.
+var SkipEvent = Event{VAST: "skip", EventType: "video_skip"}
+
+// Ad describes a linear video ad and its tracking URLs. All URLs must be
+// absolute since the player resolves them outside the publisher page.
+type Ad struct {
+	// ID identifies the creative in the Ad, Creative and UniversalAdId elements.
+	ID string
+	// AdServingID identifies this serve across the parties involved.
+	AdServingID string
+	Title       string
+	Video       models.VideoCreative
+	// SkipAfter is the number of seconds before the ad can be skipped.
+	// Negative values make the ad non-skippable.
+	SkipAfter int
+	// Impression and Viewable are fired when the ad starts playing and when
+	// it becomes viewable. Viewable is optional.
+	Impression string
+	Viewable   string
+	// ClickThrough is opened when the viewer clicks the ad. ClickTracking is
+	// fired on click when there is no landing page to open.
+	ClickThrough  string
+	ClickTracking string
+	// Tracking holds the URL for each VAST event name in Events and SkipEvent.
+	Tracking map[string]string
+	// TagURI makes the ad a Wrapper around a third-party VAST tag instead of
+	// an inline ad with Video's media files. Wrappers only use ClickTracking.
+	TagURI string
+	// Document is a third-party VAST document to serve. Our tracking is
+	// inserted into it; only Impression, Viewable, ClickTracking and Tracking
+	// are used.
+	Document []byte
+}
+
+type adElement struct {
+	XMLName  xml.Name `xml:"Ad"`
+	ID       string   `xml:"id,attr"`
+	Sequence int      `xml:"sequence,attr,omitempty"`
+	InLine   *inLine  `xml:"InLine,omitempty"`
+	Wrapper  *wrapper `xml:"Wrapper,omitempty"`
+}
+
+type inLine struct {
+	AdSystem           string              `xml:"AdSystem"`
+	AdServingID        string              `xml:"AdServingId"`
+	AdTitle            string              `xml:"AdTitle"`
+	Impression         cdata               `xml:"Impression"`
+	ViewableImpression *viewableImpression `xml:"ViewableImpression,omitempty"`
+	Creatives          []creative          `xml:"Creatives>Creative"`
+}
+
+type wrapper struct {
+	AdSystem           string              `xml:"AdSystem"`
+	Impression         cdata               `xml:"Impression"`
+	ViewableImpression *viewableImpression `xml:"ViewableImpression,omitempty"`
+	VASTAdTagURI       cdata               `xml:"VASTAdTagURI"`
+	Creatives          []wrapperCreative   `xml:"Creatives>Creative"`
+}
+
+type wrapperCreative struct {
+	Linear wrapperLinear `xml:"Linear"`
+}
+
+type wrapperLinear struct {
+	TrackingEvents []tracking   `xml:"TrackingEvents>Tracking"`
+	VideoClicks    *videoClicks `xml:"VideoClicks,omitempty"`
+}
+
+type viewableImpression struct {
+	Viewable cdata `xml:"Viewable"`
+}
+
+type creative struct {
+	ID            string        `xml:"id,attr"`
+	AdID          string        `xml:"adId,attr"`
+	UniversalAdID universalAdID `xml:"UniversalAdId"`
+	Linear        linear        `xml:"Linear"`
+}
+
+type universalAdID struct {
+	IDRegistry string `xml:"idRegistry,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type linear struct {
+	SkipOffset     string       `xml:"skipoffset,attr,omitempty"`
+	Duration       string       `xml:"Duration"`
+	TrackingEvents []tracking   `xml:"TrackingEvents>Tracking"`
+	VideoClicks    *videoClicks `xml:"VideoClicks,omitempty"`
+	MediaFiles     []mediaFile  `xml:"MediaFiles>MediaFile"`
+}
+
+type tracking struct {
+	Event string `xml:"event,attr"`
+	URL   string `xml:",cdata"`
+}
+
+type videoClicks struct {
+	ClickThrough  *cdata `xml:"ClickThrough,omitempty"`
+	ClickTracking *cdata `xml:"ClickTracking,omitempty"`
+}
+
+type mediaFile struct {
+	Delivery string `xml:"delivery,attr"`
+	Type     string `xml:"type,attr"`
+	Width    int    `xml:"width,attr"`
+	Height   int    `xml:"height,attr"`
+	Bitrate  int    `xml:"bitrate,attr,omitempty"`
+	URL      string `xml:",cdata"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+// Build renders the ads as one VAST document. Several ads form an ad pod
+// played in the given order. A single third-party Document is returned with
+// our tracking inserted but otherwise unchanged.
+func Build(ads ...Ad) ([]byte, error) {
+	if len(ads) == 1 && ads[0].Document != nil {
+		return InsertTracking(ads[0].Document, ads[0])
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<VAST version="%s">`, Version)
+	for i, ad := range ads {
+		sequence := 0
+		if len(ads) > 1 {
+			sequence = i + 1
+		}
+		out, err := ad.render(sequence)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(out)
+	}
+	buf.WriteString("</VAST>")
+	return buf.Bytes(), nil
+}
+
+// render returns the Ad element for the ad. A non-zero sequence sets its
+// position within an ad pod.
+func (ad Ad) render(sequence int) ([]byte, error) {
+	if ad.Document != nil {
+		doc, err := InsertTracking(ad.Document, ad)
+		if err != nil {
+			return nil, err
+		}
+		return firstAd(doc, sequence)
+	}
+
+	el := adElement{ID: ad.ID, Sequence: sequence}
+	if ad.TagURI != "" {
+		el.Wrapper = &wrapper{
+			AdSystem:     adSystem,
+			Impression:   cdata{ad.Impression},
+			VASTAdTagURI: cdata{ad.TagURI},
+			Creatives:    []wrapperCreative{{Linear: wrapperLinear{TrackingEvents: ad.trackingEvents()}}},
+		}
+		if ad.ClickTracking != "" {
+			el.Wrapper.Creatives[0].Linear.VideoClicks = &videoClicks{ClickTracking: &cdata{ad.ClickTracking}}
+		}
+		if ad.Viewable != "" {
+			el.Wrapper.ViewableImpression = &viewableImpression{Viewable: cdata{ad.Viewable}}
+		}
+	} else {
+		el.InLine = ad.inLine()
+	}
+
+	out, err := xml.Marshal(el)
+	if err != nil {
+		return nil, fmt.Errorf("marshal vast: %w", err)
+	}
+	return out, nil
+}
+
+// inLine builds the InLine element for an ad with its own media files.
+func (ad Ad) inLine() *inLine {
+	lin := linear{Duration: FormatDuration(ad.Video.Duration), TrackingEvents: ad.trackingEvents()}
+	if ad.SkipAfter >= 0 {
+		lin.SkipOffset = FormatDuration(ad.SkipAfter)
+	}
+	if ad.ClickThrough != "" || ad.ClickTracking != "" {
+		lin.VideoClicks = &videoClicks{}
+		if ad.ClickThrough != "" {
+			lin.VideoClicks.ClickThrough = &cdata{ad.ClickThrough}
+		}
+		if ad.ClickTracking != "" {
+			lin.VideoClicks.ClickTracking = &cdata{ad.ClickTracking}
+		}
+	}
+	for _, mf := range ad.Video.MediaFiles {
+		delivery := mf.Delivery
+		if delivery == "" {
+			delivery = "progressive"
+		}
+		lin.MediaFiles = append(lin.MediaFiles, mediaFile{
+			Delivery: delivery,
+			Type:     mf.MIME,
+			Width:    mf.Width,
+			Height:   mf.Height,
+			Bitrate:  mf.Bitrate,
+			URL:      mf.URL,
+		})
+	}
+
+	il := &inLine{
+		AdSystem:    adSystem,
+		AdServingID: ad.AdServingID,
+		AdTitle:     ad.Title,
+		Impression:  cdata{ad.Impression},
+		Creatives: []creative{{
+			ID:            ad.ID,
+			AdID:          ad.ID,
+			UniversalAdID: universalAdID{IDRegistry: "unknown", Value: ad.ID},
+			Linear:        lin,
+		}},
+	}
+	if ad.Viewable != "" {
+		il.ViewableImpression = &viewableImpression{Viewable: cdata{ad.Viewable}}
+	}
+	return il
+}
+
+// trackingEvents lists the ad's Tracking elements in playback order. The
+// skip event is left out for non-skippable ads.
+func (ad Ad) trackingEvents() []tracking {
+	events := Events
+	if ad.SkipAfter >= 0 {
+		events = append(append([]Event{}, Events...), SkipEvent)
+	}
+	var out []tracking
+	for _, ev := range events {
+		if u := ad.Tracking[ev.VAST]; u != "" {
+			out = append(out, tracking{Event: ev.VAST, URL: u})
+		}
+	}
+	return out
+}
+
+// FormatDuration formats seconds as the HH:MM:SS time code used by VAST.
+func FormatDuration(seconds int) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
@@ -0,0 +1,60 @@
+package vast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/patrickwarner/openadserve/internal/models"
+)
+
+func TestBuild(t *testing.T) {
+	ad := Ad{
+		ID:          "7",
+		AdServingID: "req-1-1",
+		Video: models.VideoCreative{Duration: 75, MediaFiles: []models.MediaFile{
+			{URL: "https://cdn.example.com/a.mp4?x=1&y=2", MIME: "video/mp4", Bitrate: 800, Width: 640, Height: 360},
+		}},
+		SkipAfter:     5,
+		Impression:    "https://ads.example.com/impression?t=abc",
+		ClickTracking: "https://ads.example.com/click?t=abc",
+		Tracking: map[string]string{
+			"start":    "https://ads.example.com/event?t=abc&type=video_start",
+			"complete": "https://ads.example.com/event?t=abc&type=video_complete",
+			"skip":     "https://ads.example.com/event?t=abc&type=video_skip",
+		},
+	}
+	out, err := Build(ad)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	doc := string(out)
+	for _, want := range []string{
+		`<VAST version="4.1">`,
+		`<Linear skipoffset="00:00:05"><Duration>00:01:15</Duration>`,
+		`<Tracking event="start"><![CDATA[https://ads.example.com/event?t=abc&type=video_start]]></Tracking>`,
+		`<Tracking event="skip">`,
+		`<ClickTracking><![CDATA[https://ads.example.com/click?t=abc]]></ClickTracking>`,
+		`<MediaFile delivery="progressive" type="video/mp4" width="640" height="360" bitrate="800"><![CDATA[https://cdn.example.com/a.mp4?x=1&y=2]]></MediaFile>`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("missing %s in\n%s", want, doc)
+		}
+	}
+	if strings.Contains(doc, "ViewableImpression") || strings.Contains(doc, "ClickThrough") {
+		t.Errorf("unexpected optional elements in\n%s", doc)
+	}
+
+	ad.SkipAfter = -1
+	out, _ = Build(ad)
+	if strings.Contains(string(out), "skipoffset") || strings.Contains(string(out), `event="skip"`) {
+		t.Errorf("non-skippable ad has skip settings:\n%s", out)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for in, want := range map[int]string{0: "00:00:00", 30: "00:00:30", 3725: "01:02:05", -1: "00:00:00"} {
+		if got := FormatDuration(in); got != want {
+			t.Errorf("FormatDuration(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
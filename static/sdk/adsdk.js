@@ -239,6 +239,51 @@
     sendPixel(impressionUrl, baseUrl);
   }
 
+  /**
+   * Reports a viewable impression once the element has been at least 50% in
+   * view for one continuous second, or two seconds for large formats
+   * (242,500 pixels or more). Time spent in a hidden tab does not count.
+   * The signal is sent at most once per call and the ad server only records it
+   * for measurement; impressions are still counted when the ad renders.
+   * @param {Element} element - The element containing the rendered ad.
+   * @param {string} viewableUrl - The `viewurl` from the ad response.
+   * @param {string} [baseUrl] - Optional base URL for the ad server.
+   */
+  function trackViewability(element, viewableUrl, baseUrl) {
+    if (!element || !viewableUrl) return;
+    if (!("IntersectionObserver" in window)) return;
+    const rect = element.getBoundingClientRect();
+    const requiredMs = rect.width * rect.height >= 242500 ? 2000 : 1000;
+    let timer = null;
+    let inView = false;
+    const update = () => {
+      if (inView && !document.hidden) {
+        if (!timer) {
+          timer = setTimeout(() => {
+            observer.disconnect();
+            document.removeEventListener("visibilitychange", update);
+            sendPixel(viewableUrl, baseUrl);
+          }, requiredMs);
+        }
+      } else {
+        clearTimeout(timer);
+        timer = null;
+      }
+    };
+    const observer = new IntersectionObserver(
+      (entries) => {
+        entries.forEach((entry) => {
+          inView = entry.intersectionRatio >= 0.5;
+        });
+        update();
+      },
+      { threshold: [0, 0.5] },
+    );
+    // The observer doesn't fire when the tab is hidden or shown again
+    document.addEventListener("visibilitychange", update);
+    observer.observe(element);
+  }
+
   /**
    * Triggers a click tracking event by requesting the provided click URL.
    * This should be called when the user clicks on the ad.
@@ -332,7 +377,7 @@
         }
 
         const bid = seatbid[0].bid[0]; // Assuming one bid.
-        const { adm, impurl, clkurl, evturl, repturl } = bid;
+        const { adm, impurl, clkurl, evturl, repturl, viewurl } = bid;
 
         // Store report URL on the container for convenience
         if (repturl) {
@@ -456,6 +501,7 @@
 
         // Trigger the impression tracking pixel once the ad is rendered.
         sendImpression(impurl, baseUrl);
+        trackViewability(wrapper, viewurl, baseUrl);
 
         // TODO: Consider adding cleanup for the window.removeEventListener when the ad is removed or replaced.
       })
@@ -543,7 +589,7 @@
           return;
         }
 
-        const { impurl, clkurl, evturl, repturl } = bid;
+        const { impurl, clkurl, evturl, repturl, viewurl } = bid;
 
         // Add tracking URLs to assets for template access
         // Note: clkurl, impurl, evturl are already complete paths (e.g., "/click?t=...")
@@ -555,10 +601,13 @@
         };
 
         // The publisher-provided template function is responsible for creating the HTML from the assets.
-        // This gives complete rendering control to the publisher.
+        // This gives complete rendering control to the publisher. Creatives built from a server-side
+        // creative template arrive already rendered as the "html" asset.
         const html =
           typeof template === "function"
             ? template(assetsWithTracking) // Publisher's custom templating logic.
+            : assetsWithTracking.html
+            ? assetsWithTracking.html
             : `<!-- Default native rendering if no template provided -->
              <div>
                <h2>${assetsWithTracking.title || "Native Ad"}</h2>
@@ -568,6 +617,7 @@
              </div>`;
         container.innerHTML = html;
         sendImpression(impurl, baseUrl); // Track impression once rendered.
+        trackViewability(container, viewurl, baseUrl);
 
         if (repturl) {
           container.dataset.reportUrl = repturl;
@@ -1023,6 +1073,7 @@
     renderAd,
     fetchAd,
     renderNativeAd,
+    trackViewability,
     setApiKey,
     setPublisherId,
     // Custom parameters API
@@ -107,16 +107,19 @@ func printCampaignReport(summary *reporting.CampaignSummary, days int) {
 	if total.CPC > 0 {
 		fmt.Printf("Average CPC:        $%.2f\n", total.CPC)
 	}
+	if total.ViewableImpressions > 0 {
+		fmt.Printf("Viewable Rate:      %.2f%% (%s viewable)\n", total.ViewableRate, formatNumber(total.ViewableImpressions))
+	}
 	fmt.Printf("\n")
 
 	// Daily Breakdown
 	if len(summary.DailyMetrics) > 0 {
 		fmt.Printf("📅 DAILY BREAKDOWN\n")
 		fmt.Printf("───────────────────────────────────────────────────────────────────────────────────\n")
-		fmt.Printf("Date        | Impressions | Clicks |   CTR   |   Spend   |   CPM   |   CPC   \n")
-		fmt.Printf("------------|-------------|--------|---------|-----------|---------|----------\n")
+		fmt.Printf("Date        | Impressions | Clicks |   CTR   |   Spend   |   CPM   |   CPC   | Viewable\n")
+		fmt.Printf("------------|-------------|--------|---------|-----------|---------|---------|---------\n")
 		for _, dm := range summary.DailyMetrics {
-			fmt.Printf("%-10s | %11s | %6s | %6.2f%% | $%8.2f | $%6.2f | $%6.2f\n",
+			fmt.Printf("%-10s | %11s | %6s | %6.2f%% | $%8.2f | $%6.2f | $%6.2f | %6.2f%%\n",
 				dm.Date.Format("2006-01-02"),
 				formatNumber(dm.Impressions),
 				formatNumber(dm.Clicks),
@@ -124,6 +127,7 @@ func printCampaignReport(summary *reporting.CampaignSummary, days int) {
 				dm.Spend,
 				dm.CPM,
 				dm.CPC,
+				dm.ViewableRate,
 			)
 		}
 		fmt.Printf("\n")
@@ -133,10 +137,10 @@ func printCampaignReport(summary *reporting.CampaignSummary, days int) {
 	if len(summary.LineItemMetrics) > 0 {
 		fmt.Printf("📋 LINE ITEM BREAKDOWN\n")
 		fmt.Printf("───────────────────────────────────────────────────────────────────────────────────\n")
-		fmt.Printf("Line Item ID | Impressions | Clicks |   CTR   |   Spend   |   CPM   |   CPC   \n")
-		fmt.Printf("-------------|-------------|--------|---------|-----------|---------|----------\n")
+		fmt.Printf("Line Item ID | Impressions | Clicks |   CTR   |   Spend   |   CPM   |   CPC   | Viewable\n")
+		fmt.Printf("-------------|-------------|--------|---------|-----------|---------|---------|---------\n")
 		for _, li := range summary.LineItemMetrics {
-			fmt.Printf("%12d | %11s | %6s | %6.2f%% | $%8.2f | $%6.2f | $%6.2f\n",
+			fmt.Printf("%12d | %11s | %6s | %6.2f%% | $%8.2f | $%6.2f | $%6.2f | %6.2f%%\n",
 				li.LineItemID,
 				formatNumber(li.Impressions),
 				formatNumber(li.Clicks),
@@ -144,6 +148,33 @@ func printCampaignReport(summary *reporting.CampaignSummary, days int) {
 				li.Spend,
 				li.CPM,
 				li.CPC,
+				li.ViewableRate,
+			)
+		}
+		fmt.Printf("\n")
+	}
+
+	// Site / App Breakdown
+	if len(summary.SiteMetrics) > 0 {
+		fmt.Printf("🌐 SITE / APP BREAKDOWN\n")
+		fmt.Printf("───────────────────────────────────────────────────────────────────────────────────\n")
+		fmt.Printf("Domain / App                   | Impressions | Clicks |   CTR   |   Spend   |   CPM   \n")
+		fmt.Printf("-------------------------------|-------------|--------|---------|-----------|---------\n")
+		for _, s := range summary.SiteMetrics {
+			name := s.Domain
+			if s.AppBundle != "" {
+				name = s.AppBundle
+			}
+			if name == "" {
+				name = "(unknown)"
+			}
+			fmt.Printf("%-30.30s | %11s | %6s | %6.2f%% | $%8.2f | $%6.2f\n",
+				name,
+				formatNumber(s.Impressions),
+				formatNumber(s.Clicks),
+				s.CTR,
+				s.Spend,
+				s.CPM,
 			)
 		}
 		fmt.Printf("\n")
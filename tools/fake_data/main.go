@@ -450,7 +450,7 @@ var browsers = []string{"Safari", "Chrome", "Firefox", "Edge"}
 var countries = []string{"US", "CA", "GB", "DE", "FR"}
 var paceTypes = []string{models.PacingASAP, models.PacingEven}
 var priorities = []string{models.PriorityHigh, models.PriorityMedium, models.PriorityLow}
-var budgetTypes = []string{models.BudgetTypeCPM, models.BudgetTypeCPC}
+var budgetTypes = []string{models.BudgetTypeCPM, models.BudgetTypeCPC, models.BudgetTypeVCPM, models.BudgetTypeCPA}
 var lineItemTypes = []string{models.LineItemTypeDirect, models.LineItemTypeProgrammatic}
 
 func demoLineItemWithECPM(r *rand.Rand, campID, pubID int, ecpm float64) models.LineItem {
@@ -521,6 +521,13 @@ func randomLineItem(r *rand.Rand, campID, pubID int) models.LineItem {
 		li.CPC = float64(r.Intn(200)+25) / 100
 		ctr := 0.02 + r.Float64()*0.05
 		li.ECPM = li.CPC * ctr * 1000
+	case models.BudgetTypeVCPM:
+		li.CPM = float64(r.Intn(800)+100) / 100
+		li.ECPM = li.CPM * 0.5
+	case models.BudgetTypeCPA:
+		li.CPA = float64(r.Intn(4000)+500) / 100
+		cvr := 0.005 + r.Float64()*0.02
+		li.ECPM = li.CPA * cvr * 1000
 	}
 	if li.Type == models.LineItemTypeProgrammatic {
 		li.Endpoint = fmt.Sprintf("https://buyer%d.example.com/bid", r.Intn(10))
@@ -0,0 +1,45 @@
+// Postback Key Tool prints the key a campaign's advertiser passes as the key
+// parameter of conversion postbacks and user_id conversion pixels.
+//
+// Keys are derived from POSTBACK_SECRET and never served over HTTP, so only
+// operators with the secret can hand them out. Share a key only with the
+// campaign's advertiser; anyone holding it can report that campaign's
+// conversions.
+//
+// Usage:
+//
+//	POSTBACK_SECRET=... go run ./tools/postback_key -campaign-id=123
+//
+// Configuration:
+//
+//	-campaign-id: Required. The campaign to print the key for
+//
+// Environment Variables:
+//
+//	POSTBACK_SECRET: Required. The secret configured on the ad server
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/patrickwarner/openadserve/internal/conversion"
+)
+
+func main() {
+	campaignID := flag.Int("campaign-id", 0, "Campaign ID to print the postback key for")
+	flag.Parse()
+
+	if *campaignID <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: campaign-id is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	secret := os.Getenv("POSTBACK_SECRET")
+	if secret == "" {
+		fmt.Fprintf(os.Stderr, "Error: POSTBACK_SECRET is not set\n")
+		os.Exit(1)
+	}
+	fmt.Println(conversion.PostbackKey([]byte(secret), *campaignID))
+}